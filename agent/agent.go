@@ -2,12 +2,15 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 func handleConnection(conn net.Conn) {
@@ -31,9 +34,37 @@ func handleConnection(conn net.Conn) {
 	}
 
 	cmdStr := strings.TrimSpace(string(data))
+	if isHello(cmdStr) {
+		fmt.Printf("[DEBUG] Handshake: %s\n", cmdStr)
+		conn.Write([]byte(helloResponse()))
+		return
+	}
+
+	runID, cmdStr := splitRunID(cmdStr)
+	cmdStr = strings.TrimSpace(cmdStr)
 	fmt.Printf("[DEBUG] Received command length: %d\n", len(cmdStr))
 	fmt.Printf("[DEBUG] Command preview: %s...\n", cmdStr[:min(100, len(cmdStr))])
 
+	if runID == "" {
+		executeCommand(context.Background(), cmdStr, conn)
+		return
+	}
+
+	cached, _ := runCache.Do(runID, conn, func(ctx context.Context, w io.Writer) error {
+		return executeCommand(ctx, cmdStr, w)
+	})
+	if cached {
+		fmt.Printf("[DEBUG] Run %s already executed, returning cached result\n", runID)
+	}
+}
+
+// executeCommand runs a single command or multi-line script, streaming its
+// output to w as it is produced. It returns the execution error, which is
+// also reported in the output.
+func executeCommand(ctx context.Context, cmdStr string, w io.Writer) error {
+	output := &outputCounter{w: w}
+	var runErr error
+
 	// Check if it's a multi-line script
 	if strings.Contains(cmdStr, "\n") || strings.HasPrefix(cmdStr, "#!/") {
 		fmt.Printf("[DEBUG] Executing multi-line script\n")
@@ -41,8 +72,8 @@ func handleConnection(conn net.Conn) {
 		tmpFile, err := os.CreateTemp("/tmp", "agent_script_*.sh")
 		if err != nil {
 			fmt.Printf("[DEBUG] Error creating temp file: %v\n", err)
-			fmt.Fprintf(conn, "Error creating temp file: %v\n", err)
-			return
+			fmt.Fprintf(w, "Error creating temp file: %v\n", err)
+			return err
 		}
 		defer os.Remove(tmpFile.Name())
 
@@ -50,37 +81,43 @@ func handleConnection(conn net.Conn) {
 		tmpFile.Close()
 		os.Chmod(tmpFile.Name(), 0755)
 
-		cmd := exec.Command("bash", tmpFile.Name())
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			fmt.Printf("[DEBUG] Script execution error: %v\n", err)
-			fmt.Fprintf(conn, "Command error: %v\n", err)
-		}
-
-		fmt.Printf("[DEBUG] Script output length: %d\n", len(output))
-		if len(output) > 0 {
-			fmt.Printf("[DEBUG] Output preview: %s...\n", string(output)[:min(200, len(output))])
+		cmd := exec.CommandContext(ctx, "bash", tmpFile.Name())
+		killProcessGroupOnCancel(cmd)
+		cmd.Stdout = output
+		cmd.Stderr = output
+		if runErr = cmd.Run(); runErr != nil {
+			fmt.Printf("[DEBUG] Script execution error: %v\n", runErr)
+			fmt.Fprintf(w, "Command error: %v\n", runErr)
 		}
 
-		conn.Write(output)
-		conn.Write([]byte("\n"))
+		fmt.Printf("[DEBUG] Script output length: %d\n", output.n)
 	} else {
 		fmt.Printf("[DEBUG] Executing single command\n")
-		cmd := exec.Command("bash", "-c", cmdStr)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			fmt.Printf("[DEBUG] Command execution error: %v\n", err)
-			fmt.Fprintf(conn, "Command error: %v\n", err)
-		}
-
-		fmt.Printf("[DEBUG] Command output length: %d\n", len(output))
-		if len(output) > 0 {
-			fmt.Printf("[DEBUG] Output preview: %s...\n", string(output)[:min(200, len(output))])
+		cmd := exec.CommandContext(ctx, "bash", "-c", cmdStr)
+		killProcessGroupOnCancel(cmd)
+		cmd.Stdout = output
+		cmd.Stderr = output
+		if runErr = cmd.Run(); runErr != nil {
+			fmt.Printf("[DEBUG] Command execution error: %v\n", runErr)
+			fmt.Fprintf(w, "Command error: %v\n", runErr)
 		}
 
-		conn.Write(output)
-		conn.Write([]byte("\n"))
+		fmt.Printf("[DEBUG] Command output length: %d\n", output.n)
 	}
+
+	w.Write([]byte("\n"))
+	return runErr
+}
+
+// outputCounter forwards command output and counts the bytes written.
+type outputCounter struct {
+	w io.Writer
+	n int
+}
+
+func (o *outputCounter) Write(p []byte) (int, error) {
+	o.n += len(p)
+	return o.w.Write(p)
 }
 
 func min(a, b int) int {
@@ -90,12 +127,44 @@ func min(a, b int) int {
 	return b
 }
 
+var runCache *RunCache
+
 func main() {
 	port := "9001"
 	if len(os.Args) > 1 {
 		port = os.Args[1]
 	}
 
+	// How long executed run IDs are remembered, e.g. AGENT_RUN_CACHE_TTL=30m
+	ttl := defaultRunCacheTTL
+	if value := os.Getenv("AGENT_RUN_CACHE_TTL"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			ttl = parsed
+		}
+	}
+	runCache = NewRunCache(ttl)
+
+	// Optional gRPC listener next to the legacy TCP one, e.g.
+	// AGENT_GRPC_PORT=10001. PushFile and PullFile only work inside
+	// AGENT_FILE_DIR.
+	if grpcPort := os.Getenv("AGENT_GRPC_PORT"); grpcPort != "" && grpcPort != "off" {
+		fileDir := os.Getenv("AGENT_FILE_DIR")
+		if fileDir != "" {
+			abs, err := filepath.Abs(fileDir)
+			if err != nil {
+				panic(err)
+			}
+			fileDir = abs
+		}
+		grpcListenPort = grpcPort
+		go func() {
+			fmt.Printf("Agent gRPC service listening on port %s...\n", grpcPort)
+			if err := NewGRPCServer(fileDir).ListenAndServe(":" + grpcPort); err != nil {
+				fmt.Printf("[DEBUG] gRPC server error: %v\n", err)
+			}
+		}()
+	}
+
 	ln, err := net.Listen("tcp", ":"+port)
 	if err != nil {
 		panic(err)
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"bash-king/internal/grpcwire"
+)
+
+// gRPC implementation of the Agent service in proto/agent.proto, served over
+// HTTP/2 without TLS next to the legacy TCP listener. It is only started
+// when AGENT_GRPC_PORT is set, as nothing authenticates its callers.
+
+const grpcServicePath = "/bashking.agent.v1.Agent/"
+
+// gRPC status codes used by the agent.
+const (
+	grpcOK               = 0
+	grpcInvalidArgument  = 3
+	grpcNotFound         = 5
+	grpcPermissionDenied = 7
+	grpcUnimplemented    = 12
+	grpcInternal         = 13
+)
+
+type grpcError struct {
+	code    int
+	message string
+}
+
+func (e *grpcError) Error() string {
+	return e.message
+}
+
+func grpcErrorf(code int, format string, args ...interface{}) error {
+	return &grpcError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+type GRPCServer struct {
+	hostname string
+	// fileDir is the only directory PushFile and PullFile may touch; file
+	// transfer is disabled when it is empty.
+	fileDir string
+}
+
+func NewGRPCServer(fileDir string) *GRPCServer {
+	hostname, _ := os.Hostname()
+	return &GRPCServer{hostname: hostname, fileDir: fileDir}
+}
+
+func (s *GRPCServer) features() []string {
+	features := []string{"execute", "run-id", "stream", "cancel"}
+	if s.fileDir != "" {
+		features = append(features, "push-file", "pull-file")
+	}
+	return features
+}
+
+// openFile resolves a PushFile or PullFile path inside fileDir. Relative
+// paths are relative to fileDir; absolute ones must lie below it. The
+// returned root also refuses symlinks and ".." leading out of fileDir.
+func (s *GRPCServer) openFile(path string) (*os.Root, string, error) {
+	if s.fileDir == "" {
+		return nil, "", grpcErrorf(grpcPermissionDenied, "file transfer is disabled, set AGENT_FILE_DIR")
+	}
+
+	name := filepath.Clean(path)
+	if filepath.IsAbs(name) {
+		rel, err := filepath.Rel(s.fileDir, name)
+		if err != nil {
+			return nil, "", grpcErrorf(grpcPermissionDenied, "path outside %s: %q", s.fileDir, path)
+		}
+		name = rel
+	}
+	if path == "" || name == "." || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return nil, "", grpcErrorf(grpcPermissionDenied, "path outside %s: %q", s.fileDir, path)
+	}
+
+	root, err := os.OpenRoot(s.fileDir)
+	if err != nil {
+		return nil, "", grpcErrorf(grpcInternal, "opening file directory: %v", err)
+	}
+	return root, name, nil
+}
+
+// ListenAndServe serves the Agent service on addr using HTTP/2 with prior
+// knowledge (h2c).
+func (s *GRPCServer) ListenAndServe(addr string) error {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+
+	server := &http.Server{
+		Addr:      addr,
+		Handler:   s,
+		Protocols: &protocols,
+	}
+	return server.ListenAndServe()
+}
+
+func (s *GRPCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+
+	method := strings.TrimPrefix(r.URL.Path, grpcServicePath)
+	fmt.Printf("[DEBUG] gRPC call: %s\n", method)
+
+	req, err := grpcwire.ReadFrame(r.Body)
+	if err != nil {
+		writeGRPCStatus(w, grpcErrorf(grpcInvalidArgument, "reading request: %v", err))
+		return
+	}
+
+	stream := &grpcStream{w: w}
+	switch method {
+	case "Execute":
+		err = s.execute(r.Context(), req, stream)
+	case "Cancel":
+		err = s.cancel(req, stream)
+	case "GetInfo":
+		err = s.getInfo(stream)
+	case "PushFile":
+		err = s.pushFile(req, stream)
+	case "PullFile":
+		err = s.pullFile(req, stream)
+	default:
+		err = grpcErrorf(grpcUnimplemented, "unknown method %s", r.URL.Path)
+	}
+
+	writeGRPCStatus(w, err)
+}
+
+// grpcStream sends framed messages and flushes each one immediately.
+type grpcStream struct {
+	mu sync.Mutex
+	w  http.ResponseWriter
+}
+
+func (s *grpcStream) Send(msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := grpcwire.WriteFrame(s.w, msg); err != nil {
+		return err
+	}
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// Write sends p as an ExecuteResponse output event.
+func (s *grpcStream) Write(p []byte) (int, error) {
+	if err := s.Send(grpcwire.AppendMessageField(nil, 1, p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func writeGRPCStatus(w http.ResponseWriter, err error) {
+	code, message := grpcOK, ""
+	if err != nil {
+		var grpcErr *grpcError
+		if errors.As(err, &grpcErr) {
+			code, message = grpcErr.code, grpcErr.message
+		} else {
+			code, message = grpcInternal, err.Error()
+		}
+		fmt.Printf("[DEBUG] gRPC error: %s\n", message)
+	}
+
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set("Grpc-Message", grpcwire.EncodeStatusMessage(message))
+	}
+}
+
+// execute runs a script. Without a run ID the script is tied to ctx, the
+// request's context, so a client that disconnects or times out kills it;
+// with one it runs to completion or Cancel, so a retry can replay its result.
+func (s *GRPCServer) execute(ctx context.Context, req []byte, stream *grpcStream) error {
+	fields, err := grpcwire.Parse(req)
+	if err != nil {
+		return grpcErrorf(grpcInvalidArgument, "invalid ExecuteRequest: %v", err)
+	}
+
+	var runID, script string
+	for _, field := range fields {
+		switch field.Num {
+		case 1:
+			runID = string(field.Bytes)
+		case 2:
+			script = string(field.Bytes)
+		}
+	}
+
+	script = strings.TrimSpace(script)
+	if script == "" {
+		return grpcErrorf(grpcInvalidArgument, "script is required")
+	}
+
+	start := time.Now()
+	cached := false
+	if runID == "" {
+		err = executeCommand(ctx, script, stream)
+	} else {
+		cached, err = runCache.Do(runID, stream, func(ctx context.Context, w io.Writer) error {
+			return executeCommand(ctx, script, w)
+		})
+	}
+
+	// ExecuteResult
+	var result []byte
+	if err != nil {
+		exitCode := -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
+		result = grpcwire.AppendVarintField(result, 1, uint64(int64(exitCode)))
+		result = grpcwire.AppendStringField(result, 2, err.Error())
+	}
+	result = grpcwire.AppendBoolField(result, 3, cached)
+	result = grpcwire.AppendVarintField(result, 4, uint64(time.Since(start).Milliseconds()))
+
+	return stream.Send(grpcwire.AppendMessageField(nil, 2, result))
+}
+
+func (s *GRPCServer) cancel(req []byte, stream *grpcStream) error {
+	fields, err := grpcwire.Parse(req)
+	if err != nil {
+		return grpcErrorf(grpcInvalidArgument, "invalid CancelRequest: %v", err)
+	}
+
+	var runID string
+	for _, field := range fields {
+		if field.Num == 1 {
+			runID = string(field.Bytes)
+		}
+	}
+
+	cancelled := runID != "" && runCache.Cancel(runID)
+	if cancelled {
+		fmt.Printf("[DEBUG] Cancelled run %s\n", runID)
+	}
+	return stream.Send(grpcwire.AppendBoolField(nil, 1, cancelled))
+}
+
+func (s *GRPCServer) getInfo(stream *grpcStream) error {
+	var info []byte
+	info = grpcwire.AppendStringField(info, 1, s.hostname)
+	info = grpcwire.AppendStringField(info, 2, runtime.GOOS)
+	info = grpcwire.AppendStringField(info, 3, runtime.GOARCH)
+	for _, feature := range s.features() {
+		info = grpcwire.AppendStringField(info, 4, feature)
+	}
+	info = grpcwire.AppendVarintField(info, 5, protocolVersion)
+	return stream.Send(info)
+}
+
+func (s *GRPCServer) pushFile(req []byte, stream *grpcStream) error {
+	fields, err := grpcwire.Parse(req)
+	if err != nil {
+		return grpcErrorf(grpcInvalidArgument, "invalid PushFileRequest: %v", err)
+	}
+
+	var path string
+	var content []byte
+	mode := os.FileMode(0644)
+	for _, field := range fields {
+		switch field.Num {
+		case 1:
+			path = string(field.Bytes)
+		case 2:
+			content = field.Bytes
+		case 3:
+			if field.Varint != 0 {
+				mode = os.FileMode(field.Varint) & os.ModePerm
+			}
+		}
+	}
+
+	root, name, err := s.openFile(path)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	// os.Root has no MkdirAll, create the parents one by one
+	dir := ""
+	for _, part := range strings.Split(filepath.Dir(name), string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+		dir = filepath.Join(dir, part)
+		if err := root.Mkdir(dir, 0755); err != nil && !errors.Is(err, os.ErrExist) {
+			return grpcErrorf(grpcInternal, "creating directory: %v", err)
+		}
+	}
+
+	file, err := root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return grpcErrorf(grpcInternal, "writing file: %v", err)
+	}
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Chmod(mode)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return grpcErrorf(grpcInternal, "writing file: %v", err)
+	}
+
+	fmt.Printf("[DEBUG] Received file %s (%d bytes)\n", path, len(content))
+	return stream.Send(grpcwire.AppendVarintField(nil, 1, uint64(len(content))))
+}
+
+func (s *GRPCServer) pullFile(req []byte, stream *grpcStream) error {
+	fields, err := grpcwire.Parse(req)
+	if err != nil {
+		return grpcErrorf(grpcInvalidArgument, "invalid PullFileRequest: %v", err)
+	}
+
+	var path string
+	for _, field := range fields {
+		if field.Num == 1 {
+			path = string(field.Bytes)
+		}
+	}
+
+	root, name, err := s.openFile(path)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	file, err := root.Open(name)
+	if os.IsNotExist(err) {
+		return grpcErrorf(grpcNotFound, "file not found: %s", path)
+	}
+	if err != nil {
+		return grpcErrorf(grpcInternal, "opening file: %v", err)
+	}
+	defer file.Close()
+
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := file.Read(buffer)
+		if n > 0 {
+			if err := stream.Send(grpcwire.AppendBytesField(nil, 1, buffer[:n])); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return grpcErrorf(grpcInternal, "reading file: %v", err)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"bash-king/internal/grpcwire"
+)
+
+// grpcReply is what a gRPC client sees of one call: the response messages
+// and the status from the trailers, with the message still percent-encoded.
+type grpcReply struct {
+	messages [][]byte
+	status   int
+	message  string
+}
+
+// startGRPCServer serves s over HTTP/2 with prior knowledge, as the agent
+// does, and returns a client that only speaks h2c.
+func startGRPCServer(t *testing.T, s *GRPCServer) (string, *http.Client) {
+	t.Helper()
+	runCache = NewRunCache(time.Minute)
+
+	server := httptest.NewUnstartedServer(s)
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	t.Cleanup(server.Close)
+
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+	t.Cleanup(client.CloseIdleConnections)
+	return server.URL, client
+}
+
+func grpcCall(t *testing.T, client *http.Client, url, method string, req []byte) grpcReply {
+	t.Helper()
+
+	var body bytes.Buffer
+	grpcwire.WriteFrame(&body, req)
+	httpReq, err := http.NewRequest(http.MethodPost, url+grpcServicePath+method, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpReq.Header.Set("Content-Type", "application/grpc")
+	httpReq.Header.Set("TE", "trailers")
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		t.Fatalf("%s: %v", method, err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 || resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/grpc" {
+		t.Fatalf("%s: %s %s with Content-Type %q, want HTTP/2 200 application/grpc",
+			method, resp.Proto, resp.Status, resp.Header.Get("Content-Type"))
+	}
+
+	var reply grpcReply
+	for {
+		msg, err := grpcwire.ReadFrame(resp.Body)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		reply.messages = append(reply.messages, msg)
+	}
+
+	if reply.status, err = strconv.Atoi(resp.Trailer.Get("Grpc-Status")); err != nil {
+		t.Fatalf("%s: no Grpc-Status trailer in %v", method, resp.Trailer)
+	}
+	reply.message = resp.Trailer.Get("Grpc-Message")
+	for i := 0; i < len(reply.message); i++ {
+		if c := reply.message[i]; c < 0x20 || c > 0x7e {
+			t.Errorf("%s: Grpc-Message %q is not percent-encoded", method, reply.message)
+			break
+		}
+	}
+	return reply
+}
+
+// field returns the first field num of msg.
+func field(t *testing.T, msg []byte, num int) grpcwire.Field {
+	t.Helper()
+	fields, err := grpcwire.Parse(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range fields {
+		if f.Num == num {
+			return f
+		}
+	}
+	return grpcwire.Field{}
+}
+
+// executeReply splits an Execute stream into its output and ExecuteResult.
+func executeReply(t *testing.T, reply grpcReply) (string, grpcwire.Field, grpcwire.Field, grpcwire.Field) {
+	t.Helper()
+	var output strings.Builder
+	var result []byte
+	for _, msg := range reply.messages {
+		if chunk := field(t, msg, 1); chunk.Num == 1 {
+			output.Write(chunk.Bytes)
+		}
+		if r := field(t, msg, 2); r.Num == 2 {
+			result = r.Bytes
+		}
+	}
+	if result == nil {
+		t.Fatalf("Execute sent no ExecuteResult (status %d %q)", reply.status, reply.message)
+	}
+	return output.String(), field(t, result, 1), field(t, result, 2), field(t, result, 3)
+}
+
+func TestGRPCExecute(t *testing.T) {
+	url, client := startGRPCServer(t, NewGRPCServer(""))
+
+	execute := func(runID, script string) grpcReply {
+		var req []byte
+		req = grpcwire.AppendStringField(req, 1, runID)
+		req = grpcwire.AppendStringField(req, 2, script)
+		return grpcCall(t, client, url, "Execute", req)
+	}
+
+	reply := execute("run-1", "echo hello")
+	output, exitCode, errText, cached := executeReply(t, reply)
+	if reply.status != grpcOK || output != "hello\n\n" || exitCode.Num != 0 || errText.Num != 0 || cached.Varint != 0 {
+		t.Errorf("first run: status %d, output %q, exit %d, error %q, cached %d",
+			reply.status, output, exitCode.Varint, errText.Bytes, cached.Varint)
+	}
+
+	reply = execute("run-1", "echo hello")
+	if output, _, _, cached := executeReply(t, reply); output != "hello\n\n" || cached.Varint != 1 {
+		t.Errorf("resubmitted run: output %q, cached %d; want the replayed output", output, cached.Varint)
+	}
+
+	reply = execute("", "echo failing; exit 3")
+	output, exitCode, errText, _ = executeReply(t, reply)
+	if reply.status != grpcOK || int64(exitCode.Varint) != 3 || string(errText.Bytes) != "exit status 3" ||
+		!strings.HasPrefix(output, "failing\n") {
+		t.Errorf("failing script: status %d, output %q, exit %d, error %q",
+			reply.status, output, int64(exitCode.Varint), errText.Bytes)
+	}
+
+	if reply := execute("run-2", "   "); reply.status != grpcInvalidArgument || reply.message != "script is required" {
+		t.Errorf("empty script: status %d %q, want %d", reply.status, reply.message, grpcInvalidArgument)
+	}
+}
+
+func TestGRPCCancel(t *testing.T) {
+	url, client := startGRPCServer(t, NewGRPCServer(""))
+
+	cancel := func(runID string) bool {
+		reply := grpcCall(t, client, url, "Cancel", grpcwire.AppendStringField(nil, 1, runID))
+		if reply.status != grpcOK || len(reply.messages) != 1 {
+			t.Fatalf("Cancel: status %d %q, %d messages", reply.status, reply.message, len(reply.messages))
+		}
+		return field(t, reply.messages[0], 1).Varint == 1
+	}
+
+	if cancel("unknown") {
+		t.Error("Cancel of an unknown run returned true")
+	}
+
+	done := make(chan grpcReply)
+	go func() {
+		var req []byte
+		req = grpcwire.AppendStringField(req, 1, "long-run")
+		req = grpcwire.AppendStringField(req, 2, "sleep 30 & wait")
+		done <- grpcCall(t, client, url, "Execute", req)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cancel("long-run") {
+		if time.Now().After(deadline) {
+			t.Fatal("the run never became cancellable")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case reply := <-done:
+		_, exitCode, errText, _ := executeReply(t, reply)
+		if int64(exitCode.Varint) != -1 || !strings.Contains(string(errText.Bytes), "killed") {
+			t.Errorf("cancelled run: exit %d, error %q; want -1 and killed", int64(exitCode.Varint), errText.Bytes)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Execute did not return after Cancel")
+	}
+}
+
+// A script without a run ID belongs to its request: when the client goes
+// away the script is killed rather than left running.
+func TestGRPCExecuteStopsWhenClientDisconnects(t *testing.T) {
+	url, client := startGRPCServer(t, NewGRPCServer(""))
+
+	var body bytes.Buffer
+	grpcwire.WriteFrame(&body, grpcwire.AppendStringField(nil, 2, "echo $$; exec sleep 30"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url+grpcServicePath+"Execute", &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := grpcwire.ReadFrame(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(field(t, msg, 1).Bytes)))
+	if err != nil {
+		t.Fatalf("first output %q is not the script's pid", msg)
+	}
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	resp.Body.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for proc.Signal(syscall.Signal(0)) == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("script %d still running after the client disconnected", pid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGRPCFileTransfer(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "files")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "secret"), []byte("outside"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(base, filepath.Join(dir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	url, client := startGRPCServer(t, NewGRPCServer(dir))
+
+	push := func(path, content string, mode uint64) grpcReply {
+		var req []byte
+		req = grpcwire.AppendStringField(req, 1, path)
+		req = grpcwire.AppendStringField(req, 2, content)
+		req = grpcwire.AppendVarintField(req, 3, mode)
+		return grpcCall(t, client, url, "PushFile", req)
+	}
+	pull := func(path string) (string, grpcReply) {
+		reply := grpcCall(t, client, url, "PullFile", grpcwire.AppendStringField(nil, 1, path))
+		var content strings.Builder
+		for _, msg := range reply.messages {
+			content.Write(field(t, msg, 1).Bytes)
+		}
+		return content.String(), reply
+	}
+
+	reply := push("conf/app.conf", "port=8080\n", 0600)
+	if reply.status != grpcOK || len(reply.messages) != 1 || field(t, reply.messages[0], 1).Varint != 10 {
+		t.Fatalf("PushFile: status %d %q, %d messages", reply.status, reply.message, len(reply.messages))
+	}
+	info, err := os.Stat(filepath.Join(dir, "conf", "app.conf"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("pushed file: %v, mode %v; want 0600", err, info.Mode().Perm())
+	}
+
+	for _, path := range []string{"conf/app.conf", filepath.Join(dir, "conf", "app.conf"), "conf/../conf/app.conf"} {
+		if content, reply := pull(path); reply.status != grpcOK || content != "port=8080\n" {
+			t.Errorf("PullFile %s: status %d %q, content %q", path, reply.status, reply.message, content)
+		}
+	}
+
+	large := strings.Repeat("0123456789abcdef", 5000)
+	if reply := push("large.bin", large, 0); reply.status != grpcOK {
+		t.Fatalf("PushFile large.bin: status %d %q", reply.status, reply.message)
+	}
+	if content, reply := pull("large.bin"); reply.status != grpcOK || content != large || len(reply.messages) < 2 {
+		t.Errorf("PullFile large.bin: status %d, %d bytes in %d messages", reply.status, len(content), len(reply.messages))
+	}
+
+	for _, path := range []string{"../secret", "conf/../../secret", filepath.Join(base, "secret"), "/etc/passwd", "", ".", ".."} {
+		if reply := push(path, "owned", 0644); reply.status != grpcPermissionDenied {
+			t.Errorf("PushFile %q: status %d %q, want %d", path, reply.status, reply.message, grpcPermissionDenied)
+		}
+		if content, reply := pull(path); reply.status != grpcPermissionDenied || content != "" {
+			t.Errorf("PullFile %q: status %d %q, content %q; want %d", path, reply.status, reply.message, content, grpcPermissionDenied)
+		}
+	}
+	if content, reply := pull("escape/secret"); reply.status == grpcOK || content != "" {
+		t.Errorf("PullFile through a symlink out of the directory: status %d, content %q", reply.status, content)
+	}
+	if reply := push("escape/planted", "owned", 0644); reply.status == grpcOK {
+		t.Error("PushFile through a symlink out of the directory succeeded")
+	}
+	if data, _ := os.ReadFile(filepath.Join(base, "secret")); string(data) != "outside" {
+		t.Errorf("file outside the directory was overwritten: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(base, "planted")); !os.IsNotExist(err) {
+		t.Error("PushFile created a file outside the directory")
+	}
+
+	// Non-ASCII names reach the client percent-encoded and decode back
+	_, reply = pull("dosyalar/ü.txt")
+	want := "file not found: dosyalar/ü.txt"
+	if reply.status != grpcNotFound || grpcwire.DecodeStatusMessage(reply.message) != want {
+		t.Errorf("PullFile of a missing file: status %d %q, want %d %q", reply.status, reply.message, grpcNotFound, want)
+	}
+}
+
+func TestGRPCFileTransferDisabled(t *testing.T) {
+	url, client := startGRPCServer(t, NewGRPCServer(""))
+
+	reply := grpcCall(t, client, url, "PullFile", grpcwire.AppendStringField(nil, 1, "app.conf"))
+	if reply.status != grpcPermissionDenied {
+		t.Errorf("PullFile without AGENT_FILE_DIR: status %d %q, want %d", reply.status, reply.message, grpcPermissionDenied)
+	}
+
+	reply = grpcCall(t, client, url, "GetInfo", nil)
+	fields, err := grpcwire.Parse(reply.messages[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var features []string
+	for _, f := range fields {
+		if f.Num == 4 {
+			features = append(features, string(f.Bytes))
+		}
+	}
+	if want := []string{"execute", "run-id", "stream", "cancel"}; !slices.Equal(features, want) {
+		t.Errorf("GetInfo features = %v, want %v", features, want)
+	}
+}
+
+func TestGRPCUnknownMethod(t *testing.T) {
+	url, client := startGRPCServer(t, NewGRPCServer(""))
+
+	reply := grpcCall(t, client, url, "Ça%0Asert", nil)
+	want := "unknown method " + grpcServicePath + "Ça\nsert"
+	if reply.status != grpcUnimplemented || grpcwire.DecodeStatusMessage(reply.message) != want {
+		t.Errorf("status %d %q, want %d %q", reply.status, reply.message, grpcUnimplemented, want)
+	}
+}
+
+func TestGRPCRejectsPlainHTTP(t *testing.T) {
+	url, client := startGRPCServer(t, NewGRPCServer(""))
+
+	resp, err := client.Get(url + grpcServicePath + "GetInfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("GET: %s, want 415", resp.Status)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import (
+	"os/exec"
+	"time"
+)
+
+// killProcessGroupOnCancel only kills the command itself: without process
+// groups, children the script started keep running.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {
+	cmd.WaitDelay = 2 * time.Second
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Protocol versions spoken by agents over the TCP listener:
+//
+//	0  one newline-terminated command per connection (old_versions)
+//	1  script read until the client half-closes, no handshake
+//	   (monitoring/agent_v2.go advertises the system_info command)
+//	2  version 1 plus the handshake, run IDs and streamed output
+const protocolVersion = 2
+
+// helloPrefix starts the handshake line sent by the script manager. The line
+// is a bash no-op, so agents without handshake support just run it and
+// return an empty result, which is how the manager recognises them.
+const helloPrefix = ": BASH-KING-HELLO"
+
+// grpcListenPort is the port of the gRPC service, empty when it is disabled.
+var grpcListenPort string
+
+// isHello reports whether the request is a handshake.
+func isHello(cmdStr string) bool {
+	return strings.HasPrefix(cmdStr, helloPrefix)
+}
+
+// helloResponse describes the protocol version and features of this agent,
+// e.g. "BASH-KING/2 features=run-id,stream,grpc grpc-port=10001".
+func helloResponse() string {
+	features := []string{"run-id", "stream"}
+	if grpcListenPort != "" {
+		features = append(features, "grpc")
+	}
+
+	response := fmt.Sprintf("BASH-KING/%d features=%s", protocolVersion, strings.Join(features, ","))
+	if grpcListenPort != "" {
+		response += " grpc-port=" + grpcListenPort
+	}
+	return response + "\n"
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runIDHeader is prepended by the script manager to every request. It is a
+// plain bash comment, so agents that do not understand it still execute the
+// script unchanged.
+const runIDHeader = "# bash-king-run-id: "
+
+const defaultRunCacheTTL = 10 * time.Minute
+
+type runEntry struct {
+	done     chan struct{}
+	output   []byte
+	err      error
+	finished time.Time
+	cancel   context.CancelFunc
+}
+
+// RunCache remembers the output of recently executed run IDs so that a
+// resubmitted request returns the cached result instead of running again.
+type RunCache struct {
+	mu      sync.Mutex
+	entries map[string]*runEntry
+	ttl     time.Duration
+}
+
+func NewRunCache(ttl time.Duration) *RunCache {
+	c := &RunCache{
+		entries: make(map[string]*runEntry),
+		ttl:     ttl,
+	}
+	go c.expireLoop()
+	return c
+}
+
+// Do executes fn once per run ID within the cache window, streaming its
+// output to w. Concurrent callers with the same run ID wait for the first
+// execution and receive its complete output and error. The first return
+// value reports whether the result came from the cache. The context passed
+// to fn is cancelled by Cancel.
+func (c *RunCache) Do(runID string, w io.Writer, fn func(context.Context, io.Writer) error) (bool, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[runID]; ok {
+		c.mu.Unlock()
+		<-entry.done
+		w.Write(entry.output)
+		return true, entry.err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	entry := &runEntry{done: make(chan struct{}), cancel: cancel}
+	c.entries[runID] = entry
+	c.mu.Unlock()
+
+	tee := &cacheWriter{w: w}
+	err := fn(ctx, tee)
+
+	c.mu.Lock()
+	entry.output = tee.buf.Bytes()
+	entry.err = err
+	entry.finished = time.Now()
+	entry.cancel = nil
+	c.mu.Unlock()
+	close(entry.done)
+
+	return false, err
+}
+
+// Cancel stops the script running under runID. It reports whether a running
+// script was found.
+func (c *RunCache) Cancel(runID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[runID]
+	if !ok || entry.cancel == nil {
+		return false
+	}
+	entry.cancel()
+	return true
+}
+
+// cacheWriter records everything written to it and forwards it to w. Errors
+// from w are remembered but not returned, so a dropped connection never
+// interrupts the script or truncates the cached output.
+type cacheWriter struct {
+	buf bytes.Buffer
+	w   io.Writer
+	err error
+}
+
+func (c *cacheWriter) Write(p []byte) (int, error) {
+	c.buf.Write(p)
+	if c.err == nil {
+		_, c.err = c.w.Write(p)
+	}
+	return len(p), nil
+}
+
+func (c *RunCache) expireLoop() {
+	ticker := time.NewTicker(time.Minute)
+	for range ticker.C {
+		c.mu.Lock()
+		for id, entry := range c.entries {
+			select {
+			case <-entry.done:
+				if time.Since(entry.finished) > c.ttl {
+					delete(c.entries, id)
+				}
+			default:
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// splitRunID strips the run ID header from the request, if present.
+func splitRunID(data string) (string, string) {
+	if !strings.HasPrefix(data, runIDHeader) {
+		return "", data
+	}
+
+	line, rest, _ := strings.Cut(data, "\n")
+	return strings.TrimSpace(strings.TrimPrefix(line, runIDHeader)), rest
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunCacheDo(t *testing.T) {
+	errScript := errors.New("exit status 1")
+
+	tests := []struct {
+		name       string
+		runIDs     []string
+		err        error
+		wantRuns   int
+		wantCached []bool
+	}{
+		{"single run", []string{"a"}, nil, 1, []bool{false}},
+		{"resubmitted run ID", []string{"a", "a", "a"}, nil, 1, []bool{false, true, true}},
+		{"distinct run IDs", []string{"a", "b"}, nil, 2, []bool{false, false}},
+		{"failed run is replayed", []string{"a", "a"}, errScript, 1, []bool{false, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewRunCache(time.Minute)
+			runs := 0
+
+			for i, runID := range tt.runIDs {
+				var out bytes.Buffer
+				cached, err := cache.Do(runID, &out, func(ctx context.Context, w io.Writer) error {
+					runs++
+					io.WriteString(w, "output of "+runID)
+					return tt.err
+				})
+
+				if cached != tt.wantCached[i] {
+					t.Errorf("call %d: cached = %v, want %v", i, cached, tt.wantCached[i])
+				}
+				if err != tt.err {
+					t.Errorf("call %d: err = %v, want %v", i, err, tt.err)
+				}
+				if got := out.String(); got != "output of "+runID {
+					t.Errorf("call %d: output = %q, want %q", i, got, "output of "+runID)
+				}
+			}
+
+			if runs != tt.wantRuns {
+				t.Errorf("fn ran %d times, want %d", runs, tt.wantRuns)
+			}
+		})
+	}
+}
+
+// Callers that arrive while the run is still executing wait for it and get
+// the complete output, including what was written before they arrived.
+func TestRunCacheConcurrentCallers(t *testing.T) {
+	cache := NewRunCache(time.Minute)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var runs atomic.Int32
+
+	fn := func(ctx context.Context, w io.Writer) error {
+		runs.Add(1)
+		io.WriteString(w, "first ")
+		close(started)
+		<-release
+		io.WriteString(w, "second")
+		return nil
+	}
+
+	var first bytes.Buffer
+	firstDone := make(chan bool)
+	go func() {
+		cached, _ := cache.Do("run", &first, fn)
+		firstDone <- cached
+	}()
+	<-started
+
+	const callers = 5
+	outputs := make([]bytes.Buffer, callers)
+	cached := make([]bool, callers)
+	var wg sync.WaitGroup
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cached[i], _ = cache.Do("run", &outputs[i], fn)
+		}()
+	}
+	close(release)
+	wg.Wait()
+
+	if <-firstDone {
+		t.Error("first caller got a cached result")
+	}
+	if n := runs.Load(); n != 1 {
+		t.Errorf("fn ran %d times, want 1", n)
+	}
+	if got := first.String(); got != "first second" {
+		t.Errorf("first output = %q", got)
+	}
+	for i := range callers {
+		if !cached[i] {
+			t.Errorf("caller %d: result not cached", i)
+		}
+		if got := outputs[i].String(); got != "first second" {
+			t.Errorf("caller %d: output = %q, want %q", i, got, "first second")
+		}
+	}
+}
+
+func TestRunCacheCancel(t *testing.T) {
+	cache := NewRunCache(time.Minute)
+	started := make(chan struct{})
+	done := make(chan error)
+
+	go func() {
+		_, err := cache.Do("run", io.Discard, func(ctx context.Context, w io.Writer) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		done <- err
+	}()
+	<-started
+
+	if cache.Cancel("other") {
+		t.Error("Cancel of an unknown run ID reported true")
+	}
+	if !cache.Cancel("run") {
+		t.Error("Cancel of a running script reported false")
+	}
+	if err := <-done; err != context.Canceled {
+		t.Errorf("err = %v, want %v", err, context.Canceled)
+	}
+	if cache.Cancel("run") {
+		t.Error("Cancel of a finished run reported true")
+	}
+}
+
+func TestSplitRunID(t *testing.T) {
+	tests := []struct {
+		data       string
+		wantID     string
+		wantScript string
+	}{
+		{"# bash-king-run-id: abc\necho hi\n", "abc", "echo hi\n"},
+		{"# bash-king-run-id:  abc  \necho hi", "abc", "echo hi"},
+		{"echo hi\n", "", "echo hi\n"},
+		{"# a comment\n# bash-king-run-id: abc\n", "", "# a comment\n# bash-king-run-id: abc\n"},
+	}
+
+	for _, tt := range tests {
+		id, script := splitRunID(tt.data)
+		if id != tt.wantID || script != tt.wantScript {
+			t.Errorf("splitRunID(%q) = %q, %q, want %q, %q", tt.data, id, script, tt.wantID, tt.wantScript)
+		}
+	}
+}
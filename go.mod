@@ -0,0 +1,3 @@
+module bash-king
+
+go 1.24
@@ -0,0 +1,671 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const accountStateSchemaVersion = 1
+
+// Password states from the second field of /etc/shadow.
+const (
+	passwordSet      = "set"
+	passwordLocked   = "locked"   // "!" before a hash, e.g. passwd -l
+	passwordDisabled = "disabled" // "*", "!" or "!*": no password can match
+	passwordEmpty    = "empty"    // no password needed
+	passwordUnknown  = "unknown"  // shadow not readable
+)
+
+// noLoginShells are shells that do not give an interactive session.
+var noLoginShells = map[string]bool{
+	"nologin": true, "false": true, "true": true, "sync": true, "shutdown": true, "halt": true,
+}
+
+// sudoGroups grant sudo on common distributions; they are used only when
+// sudoers cannot be read.
+var sudoGroups = []string{"sudo", "wheel", "admin"}
+
+// Account is one entry of /etc/passwd with its shadow, group and sudo
+// details. Dates are YYYY-MM-DD; PasswordAgeDays is unset when the shadow
+// entry has no last change date.
+type Account struct {
+	Name            string   `json:"name"`
+	UID             int      `json:"uid"`
+	GID             int      `json:"gid"`
+	Groups          []string `json:"groups"`
+	Home            string   `json:"home"`
+	Shell           string   `json:"shell"`
+	LoginShell      bool     `json:"login_shell"`
+	Password        string   `json:"password"`
+	PasswordChanged string   `json:"password_changed,omitempty"`
+	PasswordAgeDays *int     `json:"password_age_days,omitempty"`
+	PasswordExpires string   `json:"password_expires,omitempty"`
+	PasswordExpired bool     `json:"password_expired"`
+	AccountExpires  string   `json:"account_expires,omitempty"`
+	AccountExpired  bool     `json:"account_expired"`
+	Sudo            bool     `json:"sudo"`
+	SudoNoPassword  bool     `json:"sudo_nopasswd"`
+	SudoRules       []string `json:"sudo_rules,omitempty"`
+}
+
+// AccountAudit is the result of the accounts collector.
+type AccountAudit struct {
+	Accounts         []Account `json:"accounts"`
+	UID0             []string  `json:"uid0"`
+	LoginAccounts    []string  `json:"login_accounts"`
+	SudoUsers        []string  `json:"sudo_users"`
+	EmptyPasswords   []string  `json:"empty_passwords"`
+	ExpiredPasswords []string  `json:"expired_passwords"`
+	ShadowReadable   bool      `json:"shadow_readable"`
+	SudoersReadable  bool      `json:"sudoers_readable"`
+}
+
+// sudoRule is one user specification from sudoers, with the users and
+// groups it names as written.
+type sudoRule struct {
+	Users      []string
+	NoPassword bool
+	Text       string
+	Source     string
+}
+
+type AccountAuditor struct {
+	host *Host
+}
+
+func NewAccountAuditor() *AccountAuditor {
+	return &AccountAuditor{host: LocalHost()}
+}
+
+// SetHost points the AccountAuditor at another filesystem root or command runner.
+func (aa *AccountAuditor) SetHost(host *Host) {
+	aa.host = host
+}
+
+// Audit reads passwd, shadow, group and sudoers.
+func (aa *AccountAuditor) Audit() AccountAudit {
+	var audit AccountAudit
+	now := time.Now()
+
+	groups, primary := aa.readGroups()
+	shadowEntries, err := aa.readColonFile("/etc/shadow", 9)
+	audit.ShadowReadable = err == nil
+	shadow := make(map[string][]string)
+	for _, fields := range shadowEntries {
+		shadow[fields[0]] = fields
+	}
+
+	passwd, _ := aa.readColonFile("/etc/passwd", 7)
+	for _, fields := range passwd {
+		uid, _ := strconv.Atoi(fields[2])
+		gid, _ := strconv.Atoi(fields[3])
+		account := Account{Name: fields[0], UID: uid, GID: gid, Home: fields[5], Shell: fields[6], Password: passwordUnknown}
+		account.LoginShell = !noLoginShells[filepath.Base(account.Shell)]
+		if name, ok := primary[gid]; ok {
+			account.Groups = append(account.Groups, name)
+		}
+		for _, group := range groups {
+			if hasString(group.members, account.Name) && !hasString(account.Groups, group.name) {
+				account.Groups = append(account.Groups, group.name)
+			}
+		}
+		if entry, ok := shadow[account.Name]; ok {
+			applyShadow(&account, entry, now)
+		}
+		audit.Accounts = append(audit.Accounts, account)
+	}
+
+	aliases := make(map[string][]string)
+	rules, err := aa.readSudoers("/etc/sudoers", 0, aliases)
+	expandUserAliases(rules, aliases)
+	audit.SudoersReadable = err == nil
+	if errors.Is(err, fs.ErrPermission) {
+		for _, group := range sudoGroups {
+			rules = append(rules, sudoRule{Users: []string{"%" + group}, Text: "%" + group + " (sudoers not readable)", Source: "/etc/group"})
+		}
+	}
+	for i := range audit.Accounts {
+		account := &audit.Accounts[i]
+		for _, rule := range rules {
+			if !sudoRuleMatches(rule, *account) {
+				continue
+			}
+			account.Sudo = true
+			account.SudoNoPassword = account.SudoNoPassword || rule.NoPassword
+			account.SudoRules = append(account.SudoRules, rule.Text+" ("+rule.Source+")")
+		}
+	}
+
+	for _, account := range audit.Accounts {
+		if account.UID == 0 {
+			audit.UID0 = append(audit.UID0, account.Name)
+		}
+		if account.LoginShell {
+			audit.LoginAccounts = append(audit.LoginAccounts, account.Name)
+		}
+		if account.Sudo {
+			audit.SudoUsers = append(audit.SudoUsers, account.Name)
+		}
+		if account.Password == passwordEmpty {
+			audit.EmptyPasswords = append(audit.EmptyPasswords, account.Name)
+		}
+		if account.PasswordExpired {
+			audit.ExpiredPasswords = append(audit.ExpiredPasswords, account.Name)
+		}
+	}
+	return audit
+}
+
+// applyShadow fills in the password fields from a shadow entry:
+// name:password:lastchg:min:max:warn:inactive:expire:reserved, with dates
+// in days since 1970-01-01.
+func applyShadow(account *Account, fields []string, now time.Time) {
+	switch hash := fields[1]; {
+	case hash == "":
+		account.Password = passwordEmpty
+	case hash == "*" || hash == "!" || hash == "!!" || hash == "!*":
+		account.Password = passwordDisabled
+	case strings.HasPrefix(hash, "!"):
+		account.Password = passwordLocked
+	case strings.HasPrefix(hash, "*"):
+		account.Password = passwordDisabled
+	default:
+		account.Password = passwordSet
+	}
+
+	today := int(now.Unix() / 86400)
+	if changed, err := strconv.Atoi(fields[2]); err == nil {
+		if changed == 0 {
+			// 0 forces a change at the next login
+			account.PasswordExpired = true
+		} else {
+			age := today - changed
+			account.PasswordChanged = shadowDate(changed)
+			account.PasswordAgeDays = &age
+			if max, err := strconv.Atoi(fields[4]); err == nil && max < 99999 {
+				account.PasswordExpires = shadowDate(changed + max)
+				account.PasswordExpired = account.Password == passwordSet && today > changed+max
+			}
+		}
+	}
+	if expire, err := strconv.Atoi(fields[7]); err == nil {
+		account.AccountExpires = shadowDate(expire)
+		account.AccountExpired = today >= expire
+	}
+}
+
+func shadowDate(days int) string {
+	return time.Unix(int64(days)*86400, 0).UTC().Format("2006-01-02")
+}
+
+type groupEntry struct {
+	name    string
+	gid     int
+	members []string
+}
+
+// readGroups returns the groups of /etc/group and their names by GID.
+func (aa *AccountAuditor) readGroups() ([]groupEntry, map[int]string) {
+	var groups []groupEntry
+	byGID := make(map[int]string)
+	entries, _ := aa.readColonFile("/etc/group", 4)
+	for _, fields := range entries {
+		gid, _ := strconv.Atoi(fields[2])
+		groups = append(groups, groupEntry{name: fields[0], gid: gid, members: splitList(fields[3])})
+		byGID[gid] = fields[0]
+	}
+	return groups, byGID
+}
+
+// readColonFile returns the entries of a passwd style file in file order,
+// each padded to at least n fields.
+func (aa *AccountAuditor) readColonFile(path string, n int) ([][]string, error) {
+	data, err := aa.host.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseColonFile(string(data), n), nil
+}
+
+func parseColonFile(data string, n int) [][]string {
+	var entries [][]string
+	for _, line := range strings.Split(data, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		for len(fields) < n {
+			fields = append(fields, "")
+		}
+		entries = append(entries, fields)
+	}
+	return entries
+}
+
+// readSudoers returns the user specifications of a sudoers file and the
+// files it includes. Defaults and Cmnd, Host and Runas aliases are skipped;
+// User_Alias definitions are collected into aliases.
+func (aa *AccountAuditor) readSudoers(path string, depth int, aliases map[string][]string) ([]sudoRule, error) {
+	if depth > 8 {
+		return nil, nil
+	}
+	data, err := aa.host.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []sudoRule
+	lines := strings.Split(string(data), "\n")
+	for number := 0; number < len(lines); number++ {
+		// A trailing backslash continues the line; Source is where it starts
+		start := number
+		line := strings.TrimSpace(lines[number])
+		for strings.HasSuffix(line, "\\") && number+1 < len(lines) {
+			number++
+			line = strings.TrimSpace(strings.TrimSuffix(line, "\\") + " " + strings.TrimSpace(lines[number]))
+		}
+		directive, argument, _ := strings.Cut(line, " ")
+		argument = strings.TrimSpace(argument)
+
+		switch directive {
+		case "#include", "@include", "#includedir", "@includedir":
+			if !filepath.IsAbs(argument) {
+				argument = filepath.Join(filepath.Dir(path), argument)
+			}
+			if strings.HasSuffix(directive, "include") {
+				included, _ := aa.readSudoers(argument, depth+1, aliases)
+				rules = append(rules, included...)
+				continue
+			}
+			entries, _ := aa.host.ReadDir(argument)
+			for _, entry := range entries {
+				// sudo skips files ending in ~ or containing a dot
+				if entry.IsDir() || strings.HasSuffix(entry.Name(), "~") || strings.Contains(entry.Name(), ".") {
+					continue
+				}
+				included, _ := aa.readSudoers(filepath.Join(argument, entry.Name()), depth+1, aliases)
+				rules = append(rules, included...)
+			}
+			continue
+		}
+
+		if i := sudoersComment(line); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" || strings.HasPrefix(line, "Defaults") {
+			continue
+		}
+		if directive, argument, _ := strings.Cut(line, " "); strings.HasSuffix(directive, "_Alias") {
+			if directive == "User_Alias" {
+				for _, definition := range strings.Split(argument, ":") {
+					if name, members, ok := strings.Cut(definition, "="); ok {
+						aliases[strings.TrimSpace(name)] = splitList(members)
+					}
+				}
+			}
+			continue
+		}
+
+		// user_list host_list = (runas) [tags:] commands
+		who, what, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(who)
+		if len(fields) < 2 {
+			continue
+		}
+		rules = append(rules, sudoRule{
+			Users:      splitList(strings.Join(fields[:len(fields)-1], " ")),
+			NoPassword: strings.Contains(what, "NOPASSWD:"),
+			Text:       strings.Join(strings.Fields(line), " "),
+			Source:     fmt.Sprintf("%s:%d", path, start+1),
+		})
+	}
+	return rules, nil
+}
+
+// sudoersComment returns where a comment starts in a line, or -1. "#"
+// followed by a digit is a UID, not a comment.
+func sudoersComment(line string) int {
+	for i := 0; i < len(line); i++ {
+		if line[i] != '#' || (i > 0 && line[i-1] != ' ' && line[i-1] != '\t') {
+			continue
+		}
+		if i+1 < len(line) && line[i+1] >= '0' && line[i+1] <= '9' {
+			continue
+		}
+		return i
+	}
+	return -1
+}
+
+// sudoRuleMatches reports whether rule names account directly, by UID,
+// through a group, or with ALL. User_Alias names must already be expanded.
+// Negated entries are ignored, so an account may be reported as able to
+// sudo when a rule excludes it.
+func sudoRuleMatches(rule sudoRule, account Account) bool {
+	for _, user := range rule.Users {
+		switch {
+		case strings.HasPrefix(user, "!") || strings.HasPrefix(user, "+") || strings.HasPrefix(user, "%:"):
+			continue
+		case user == "ALL" || user == account.Name || user == "#"+strconv.Itoa(account.UID):
+			return true
+		case strings.HasPrefix(user, "%"):
+			if hasString(account.Groups, strings.TrimPrefix(user, "%")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expandUserAliases replaces User_Alias names in each rule with their
+// members.
+func expandUserAliases(rules []sudoRule, aliases map[string][]string) {
+	var expand func(users []string, seen map[string]bool) []string
+	expand = func(users []string, seen map[string]bool) []string {
+		var expanded []string
+		for _, user := range users {
+			members, ok := aliases[user]
+			if !ok || seen[user] {
+				expanded = append(expanded, user)
+				continue
+			}
+			seen[user] = true
+			expanded = append(expanded, expand(members, seen)...)
+		}
+		return expanded
+	}
+	for i := range rules {
+		rules[i].Users = expand(rules[i].Users, map[string]bool{})
+	}
+}
+
+// AccountState is the saved account list "host-monitor accounts" compares
+// with.
+type AccountState struct {
+	SchemaVersion int       `json:"schema_version"`
+	Hostname      string    `json:"hostname"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Accounts      []Account `json:"accounts"`
+}
+
+// AccountChange is an account that was added, removed or changed since the
+// saved state, with the fields that differ.
+type AccountChange struct {
+	Name   string   `json:"name"`
+	Change string   `json:"change"`
+	Fields []string `json:"fields,omitempty"`
+	Before *Account `json:"before,omitempty"`
+	After  *Account `json:"after,omitempty"`
+}
+
+// AccountReport is the output of "host-monitor accounts".
+type AccountReport struct {
+	Audit   AccountAudit    `json:"audit"`
+	State   string          `json:"state"`
+	Since   *time.Time      `json:"since,omitempty"`
+	Changes []AccountChange `json:"changes"`
+}
+
+// accountFields are compared between runs. Ages and expiry flags are left
+// out: they change with the date, not with the account.
+var accountFields = []string{"uid", "gid", "groups", "home", "shell", "password", "password_changed", "account_expires", "sudo", "sudo_nopasswd"}
+
+func accountField(account *Account, field string) string {
+	switch field {
+	case "uid":
+		return strconv.Itoa(account.UID)
+	case "gid":
+		return strconv.Itoa(account.GID)
+	case "groups":
+		return strings.Join(account.Groups, ",")
+	case "home":
+		return account.Home
+	case "shell":
+		return account.Shell
+	case "password":
+		return account.Password
+	case "password_changed":
+		return account.PasswordChanged
+	case "account_expires":
+		return account.AccountExpires
+	case "sudo":
+		return strconv.FormatBool(account.Sudo)
+	case "sudo_nopasswd":
+		return strconv.FormatBool(account.SudoNoPassword)
+	}
+	return ""
+}
+
+// DiffAccounts compares two account lists by name. A password field that
+// is unknown on either side, because shadow was not readable, is not
+// compared.
+func DiffAccounts(before, after []Account) []AccountChange {
+	old := make(map[string]*Account)
+	for i := range before {
+		old[before[i].Name] = &before[i]
+	}
+	current := make(map[string]bool)
+
+	changes := []AccountChange{}
+	for i := range after {
+		account := &after[i]
+		current[account.Name] = true
+		previous, ok := old[account.Name]
+		if !ok {
+			changes = append(changes, AccountChange{Name: account.Name, Change: fimAdded, After: account})
+			continue
+		}
+
+		var fields []string
+		unknown := previous.Password == passwordUnknown || account.Password == passwordUnknown
+		for _, field := range accountFields {
+			if unknown && strings.HasPrefix(field, "password") {
+				continue
+			}
+			if accountField(previous, field) != accountField(account, field) {
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) > 0 {
+			changes = append(changes, AccountChange{Name: account.Name, Change: fimChanged, Fields: fields, Before: previous, After: account})
+		}
+	}
+	for i := range before {
+		if !current[before[i].Name] {
+			changes = append(changes, AccountChange{Name: before[i].Name, Change: fimRemoved, Before: &before[i]})
+		}
+	}
+	return changes
+}
+
+func defaultAccountState(hostname string) string {
+	return filepath.Join("/var/lib/host-monitor/accounts", hostname+".json")
+}
+
+func LoadAccountState(path string) (*AccountState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var state AccountState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid account state %s: %v", path, err)
+	}
+	if state.SchemaVersion != accountStateSchemaVersion {
+		return nil, fmt.Errorf("account state %s has schema version %d, expected %d", path, state.SchemaVersion, accountStateSchemaVersion)
+	}
+	return &state, nil
+}
+
+// Save writes the state file atomically.
+func (state *AccountState) Save(path string) error {
+	state.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+func describeAccount(account *Account) string {
+	text := fmt.Sprintf("(uid %d, %s, password %s", account.UID, account.Shell, account.Password)
+	if account.Sudo {
+		text += ", sudo"
+	}
+	return text + ")"
+}
+
+func formatAccountChange(change AccountChange) string {
+	switch change.Change {
+	case fimAdded:
+		return fmt.Sprintf("➕ %s %s", change.Name, describeAccount(change.After))
+	case fimRemoved:
+		return fmt.Sprintf("➖ %s %s", change.Name, describeAccount(change.Before))
+	}
+	var diffs []string
+	for _, field := range change.Fields {
+		diffs = append(diffs, fmt.Sprintf("%s %q → %q", field, accountField(change.Before, field), accountField(change.After, field)))
+	}
+	return fmt.Sprintf("✏️  %s: %s", change.Name, strings.Join(diffs, ", "))
+}
+
+func (aa *AccountAuditor) PrintAccountAudit() {
+	aa.printAccountAudit(aa.Audit())
+}
+
+// printAccountAudit writes the text report for an already collected result.
+func (aa *AccountAuditor) printAccountAudit(audit AccountAudit) {
+	fmt.Println("=== ACCOUNT AUDIT ===")
+	fmt.Printf("Accounts: %d\n", len(audit.Accounts))
+	fmt.Println("==========================================")
+	if !audit.ShadowReadable {
+		fmt.Println("⚠️  /etc/shadow not readable, run as root for password details")
+	}
+	if !audit.SudoersReadable {
+		fmt.Println("⚠️  /etc/sudoers not readable or not installed")
+	}
+
+	fmt.Printf("%-18s %6s %-20s %-9s %-11s %6s %s\n", "USER", "UID", "SHELL", "PASSWORD", "CHANGED", "AGE", "SUDO")
+	for _, account := range audit.Accounts {
+		age := "-"
+		if account.PasswordAgeDays != nil {
+			age = strconv.Itoa(*account.PasswordAgeDays) + "d"
+		}
+		sudo := ""
+		if account.Sudo {
+			sudo = "yes"
+			if account.SudoNoPassword {
+				sudo = "NOPASSWD"
+			}
+		}
+		password := account.Password
+		if account.PasswordExpired {
+			password = "expired"
+		}
+		if account.AccountExpired {
+			password = "acct exp"
+		}
+		fmt.Printf("%-18s %6d %-20s %-9s %-11s %6s %s\n", account.Name, account.UID, account.Shell, password,
+			firstNonEmpty(account.PasswordChanged, "-"), age, sudo)
+	}
+
+	fmt.Println()
+	printAccountList("👑 UID 0", audit.UID0)
+	printAccountList("🐚 Login shells", audit.LoginAccounts)
+	printAccountList("🔑 Sudo", audit.SudoUsers)
+	printAccountList("❌ Empty passwords", audit.EmptyPasswords)
+	printAccountList("⏰ Expired passwords", audit.ExpiredPasswords)
+	for _, account := range audit.Accounts {
+		for _, rule := range account.SudoRules {
+			fmt.Printf("  %s: %s\n", account.Name, rule)
+		}
+	}
+}
+
+func printAccountList(label string, names []string) {
+	if len(names) == 0 {
+		fmt.Printf("%s: none\n", label)
+		return
+	}
+	fmt.Printf("%s: %s\n", label, strings.Join(names, ", "))
+}
+
+// accountsCommand implements "host-monitor accounts". It reports the audit
+// and the changes since the saved state and exits 1 when accounts changed.
+func accountsCommand(args []string) int {
+	fs := flag.NewFlagSet("accounts", flag.ContinueOnError)
+	fs.Usage = usage
+	statePath := fs.String("state", "", "Saved accounts (default /var/lib/host-monitor/accounts/<hostname>.json)")
+	update := fs.Bool("update", false, "Save the current accounts as the new state after reporting")
+	format := fs.String("format", formatText, "Report format: text, json or yaml")
+	applyHost := hostFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	settings := DefaultSettings(applyHost())
+
+	if !validFormat(*format) {
+		fmt.Fprintf(os.Stderr, "❌ Unknown format %q (use text, json or yaml)\n", *format)
+		return 2
+	}
+	warnPrivileges([]Collector{builtinCollector("accounts")})
+
+	hostname := settings.Host.Hostname()
+	path := firstNonEmpty(*statePath, defaultAccountState(hostname))
+	report := AccountReport{Audit: settings.accountAuditor().Audit(), State: path, Changes: []AccountChange{}}
+
+	previous, err := LoadAccountState(path)
+	switch {
+	case err == nil:
+		report.Since = &previous.UpdatedAt
+		report.Changes = DiffAccounts(previous.Accounts, report.Audit.Accounts)
+	case !errors.Is(err, os.ErrNotExist):
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+
+	if *format == formatText {
+		settings.accountAuditor().printAccountAudit(report.Audit)
+		fmt.Println()
+		switch {
+		case report.Since == nil:
+			fmt.Printf("ℹ️  No saved state in %s, run with --update to record one\n", path)
+		case len(report.Changes) == 0:
+			fmt.Printf("✅ No account changes since %s\n", report.Since.Format("2006-01-02 15:04:05"))
+		default:
+			fmt.Printf("Changes since %s:\n", report.Since.Format("2006-01-02 15:04:05"))
+			for _, change := range report.Changes {
+				fmt.Println(formatAccountChange(change))
+			}
+		}
+	} else if err := WriteReport(os.Stdout, *format, NewReport("accounts", hostname, report)); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to write account report: %v\n", err)
+		return 2
+	}
+
+	if *update {
+		state := &AccountState{SchemaVersion: accountStateSchemaVersion, Hostname: hostname, Accounts: report.Audit.Accounts}
+		if err := state.Save(path); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+	}
+	if len(report.Changes) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSudoersComment(t *testing.T) {
+	tests := []struct {
+		line string
+		want int
+	}{
+		{"# comment", 0},
+		{"alice ALL=(ALL) ALL # admin", 20},
+		{"#1001 ALL=(ALL) ALL", -1},
+		{"alice ALL=(#0) ALL", -1},
+		{"alice ALL=/usr/bin/echo a#b", -1},
+		{"alice ALL=(ALL) ALL\t#tab", 20},
+		{"#includedir /etc/sudoers.d", 0},
+	}
+
+	for _, tt := range tests {
+		if got := sudoersComment(tt.line); got != tt.want {
+			t.Errorf("sudoersComment(%q) = %d, want %d", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestAuditSudoers(t *testing.T) {
+	host := newTestHost(t, map[string]string{
+		"etc/passwd": strings.Join([]string{
+			"root:x:0:0:root:/root:/bin/bash",
+			"alice:x:1000:1000::/home/alice:/bin/bash",
+			"bob:x:1001:1001::/home/bob:/bin/bash",
+			"carol:x:1002:1002::/home/carol:/bin/bash",
+			"dave:x:1003:1003::/home/dave:/bin/bash",
+			"erin:x:1004:1004::/home/erin:/bin/bash",
+			"frank:x:1005:1005::/home/frank:/bin/bash",
+			"grace:x:1006:1006::/home/grace:/bin/bash",
+		}, "\n") + "\n",
+		"etc/group": "root:x:0:\nwheel:x:10:erin\nalice:x:1000:\n",
+		"etc/sudoers": strings.Join([]string{
+			"Defaults env_reset",
+			"User_Alias ADMINS = alice, \\",
+			"    OPS",
+			"User_Alias OPS = bob",
+			"Cmnd_Alias REBOOT = /sbin/reboot",
+			"root ALL=(ALL:ALL) ALL",
+			"ADMINS ALL=(ALL) ALL",
+			"#1002 ALL=(ALL) NOPASSWD: REBOOT",
+			"# dave ALL=(ALL) ALL",
+			"%wheel ALL=(ALL) ALL # wheel members",
+			"#includedir /etc/sudoers.d",
+		}, "\n") + "\n",
+		"etc/sudoers.d/deploy":  "dave ALL=(ALL) NOPASSWD: ALL\n",
+		"etc/sudoers.d/old.bak": "frank ALL=(ALL) ALL\n",
+		"etc/sudoers.d/grace~":  "grace ALL=(ALL) ALL\n",
+	})
+
+	aa := NewAccountAuditor()
+	aa.SetHost(host)
+	audit := aa.Audit()
+
+	tests := []struct {
+		name         string
+		wantSudo     bool
+		wantNoPasswd bool
+		wantSource   string
+	}{
+		{"root", true, false, "/etc/sudoers:6"},
+		{"alice", true, false, "/etc/sudoers:7"},
+		{"bob", true, false, "/etc/sudoers:7"},
+		{"carol", true, true, "/etc/sudoers:8"},
+		{"dave", true, true, "/etc/sudoers.d/deploy:1"},
+		{"erin", true, false, "/etc/sudoers:10"},
+		{"frank", false, false, ""},
+		{"grace", false, false, ""},
+	}
+
+	for _, tt := range tests {
+		var account *Account
+		for i := range audit.Accounts {
+			if audit.Accounts[i].Name == tt.name {
+				account = &audit.Accounts[i]
+			}
+		}
+		if account == nil {
+			t.Fatalf("%s missing from the audit", tt.name)
+		}
+
+		if account.Sudo != tt.wantSudo || account.SudoNoPassword != tt.wantNoPasswd {
+			t.Errorf("%s: sudo %v nopasswd %v, want %v %v (rules %v)",
+				tt.name, account.Sudo, account.SudoNoPassword, tt.wantSudo, tt.wantNoPasswd, account.SudoRules)
+		}
+		if tt.wantSource != "" && (len(account.SudoRules) != 1 || !strings.HasSuffix(account.SudoRules[0], "("+tt.wantSource+")")) {
+			t.Errorf("%s: rules %v, want one from %s", tt.name, account.SudoRules, tt.wantSource)
+		}
+	}
+	if !audit.SudoersReadable {
+		t.Error("sudoers reported unreadable")
+	}
+}
+
+func TestApplyShadow(t *testing.T) {
+	now := time.Date(2026, time.January, 2, 12, 0, 0, 0, time.UTC)
+	today := int(now.Unix() / 86400)
+	day := func(offset int) string { return strconv.Itoa(today + offset) }
+
+	tests := []struct {
+		name        string
+		shadow      string
+		wantPass    string
+		wantChanged string
+		wantAge     int // -1 when unset
+		wantExpired bool
+		wantExpires string
+		wantAccount bool
+	}{
+		{"password set", "alice:$y$j9T$x:" + day(-30) + ":0:99999:7:::", passwordSet, "2025-12-03", 30, false, "", false},
+		{"empty password", "alice::" + day(-1) + ":0:99999:7:::", passwordEmpty, "2026-01-01", 1, false, "", false},
+		{"locked", "alice:!$y$j9T$x:" + day(-1) + "::::::", passwordLocked, "2026-01-01", 1, false, "", false},
+		{"disabled", "daemon:*:" + day(-1) + ":0:99999:7:::", passwordDisabled, "2026-01-01", 1, false, "", false},
+		{"never set", "alice:!:" + day(-1) + ":0:99999:7:::", passwordDisabled, "2026-01-01", 1, false, "", false},
+		{"change forced at next login", "alice:$y$j9T$x:0:0:99999:7:::", passwordSet, "", -1, true, "", false},
+		{"no last change date", "alice:$y$j9T$x::0:99999:7:::", passwordSet, "", -1, false, "", false},
+		{"maximum age exceeded", "alice:$y$j9T$x:" + day(-100) + ":0:90:7:::", passwordSet, "2025-09-24", 100, true, "2025-12-23", false},
+		{"maximum age not reached", "alice:$y$j9T$x:" + day(-10) + ":0:90:7:::", passwordSet, "2025-12-23", 10, false, "2026-03-23", false},
+		{"locked with maximum age exceeded", "alice:!$y$j9T$x:" + day(-100) + ":0:90:7:::", passwordLocked, "2025-09-24", 100, false, "2025-12-23", false},
+		{"account expired", "alice:$y$j9T$x:" + day(-1) + ":0:99999:7::" + day(0) + ":", passwordSet, "2026-01-01", 1, false, "", true},
+		{"account expires tomorrow", "alice:$y$j9T$x:" + day(-1) + ":0:99999:7::" + day(1) + ":", passwordSet, "2026-01-01", 1, false, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			account := Account{Name: "alice", Password: passwordUnknown}
+			applyShadow(&account, parseColonFile(tt.shadow, 9)[0], now)
+
+			if account.Password != tt.wantPass {
+				t.Errorf("password = %s, want %s", account.Password, tt.wantPass)
+			}
+			if account.PasswordChanged != tt.wantChanged {
+				t.Errorf("changed = %q, want %q", account.PasswordChanged, tt.wantChanged)
+			}
+			switch {
+			case tt.wantAge < 0 && account.PasswordAgeDays != nil:
+				t.Errorf("age = %d, want unset", *account.PasswordAgeDays)
+			case tt.wantAge >= 0 && (account.PasswordAgeDays == nil || *account.PasswordAgeDays != tt.wantAge):
+				t.Errorf("age = %v, want %d", account.PasswordAgeDays, tt.wantAge)
+			}
+			if account.PasswordExpired != tt.wantExpired || account.PasswordExpires != tt.wantExpires {
+				t.Errorf("password expires %q (expired %v), want %q (%v)",
+					account.PasswordExpires, account.PasswordExpired, tt.wantExpires, tt.wantExpired)
+			}
+			if account.AccountExpired != tt.wantAccount {
+				t.Errorf("account expired = %v, want %v", account.AccountExpired, tt.wantAccount)
+			}
+		})
+	}
+}
+
+func TestDiffAccounts(t *testing.T) {
+	alice := Account{Name: "alice", UID: 1000, GID: 1000, Groups: []string{"alice"}, Home: "/home/alice",
+		Shell: "/bin/bash", Password: passwordSet, PasswordChanged: "2025-12-01"}
+	with := func(account Account, change func(*Account)) Account {
+		change(&account)
+		return account
+	}
+
+	tests := []struct {
+		name   string
+		before []Account
+		after  []Account
+		want   []string
+	}{
+		{"unchanged", []Account{alice}, []Account{alice}, nil},
+		{"added", nil, []Account{alice}, []string{"alice added"}},
+		{"removed", []Account{alice}, nil, []string{"alice removed"}},
+		{
+			"sudo granted",
+			[]Account{alice},
+			[]Account{with(alice, func(a *Account) { a.Groups = []string{"alice", "sudo"}; a.Sudo = true })},
+			[]string{"alice changed groups,sudo"},
+		},
+		{
+			"password changed",
+			[]Account{alice},
+			[]Account{with(alice, func(a *Account) { a.PasswordChanged = "2026-01-02" })},
+			[]string{"alice changed password_changed"},
+		},
+		{
+			"shadow unreadable now",
+			[]Account{alice},
+			[]Account{with(alice, func(a *Account) { a.Password, a.PasswordChanged = passwordUnknown, "" })},
+			nil,
+		},
+		{
+			"age is not a change",
+			[]Account{alice},
+			[]Account{with(alice, func(a *Account) { age := 40; a.PasswordAgeDays, a.PasswordExpired = &age, true })},
+			nil,
+		},
+		{
+			"uid 0 and renamed",
+			[]Account{alice},
+			[]Account{with(alice, func(a *Account) { a.UID = 0 }), with(alice, func(a *Account) { a.Name = "alice2" })},
+			[]string{"alice changed uid", "alice2 added"},
+		},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, change := range DiffAccounts(tt.before, tt.after) {
+			text := change.Name + " " + change.Change
+			if len(change.Fields) > 0 {
+				text += " " + strings.Join(change.Fields, ",")
+			}
+			got = append(got, text)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: changes = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,718 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Alert states. Pending alerts are waiting out the rule's "for" duration and
+// are never sent to sinks.
+const (
+	AlertPending  = "pending"
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// metricModules maps every metric a rule can use to the collector that
+// produces it. Names match the watch series where both exist.
+var metricModules = map[string]string{
+	"cores":                   "performance",
+	"cpu_usage_percent":       "performance",
+	"cpu_iowait_percent":      "performance",
+	"cpu_steal_percent":       "performance",
+	"load1":                   "performance",
+	"load5":                   "performance",
+	"load15":                  "performance",
+	"memory_used_percent":     "performance",
+	"swap_used_percent":       "performance",
+	"disk_use_percent":        "performance",
+	"process_cpu_percent":     "performance",
+	"process_memory_percent":  "performance",
+	"rx_bytes_per_second":     "network",
+	"tx_bytes_per_second":     "network",
+	"rx_errors_per_second":    "network",
+	"tx_errors_per_second":    "network",
+	"connections_total":       "network",
+	"connections_established": "network",
+	"connections_listen":      "network",
+	"installed_packages":      "packages",
+	"outdated_packages":       "packages",
+	"security_updates":        "packages",
+	"package_vulnerabilities": "packages",
+	"open_ports":              "security",
+	"high_cpu_processes":      "security",
+	"suspicious_files":        "security",
+	"unusual_perms":           "security",
+	"setuid_binaries":         "security",
+	"modified_etc_files":      "security",
+	"security_score":          "security",
+	"security_findings":       "security",
+}
+
+// eventModules maps event rules to their collector. An event fires for each
+// item that was not present at the first evaluation (the baseline).
+var eventModules = map[string]string{
+	"new_setuid_binary":  "security",
+	"new_listening_port": "security",
+	"new_user":           "security",
+}
+
+// MetricSet holds the values of one evaluation, by metric and label.
+type MetricSet map[string]map[string]float64
+
+func (m MetricSet) add(metric, label string, value float64) {
+	if m[metric] == nil {
+		m[metric] = make(map[string]float64)
+	}
+	m[metric][label] = value
+}
+
+// scalar returns an unlabelled metric, e.g. cores.
+func (m MetricSet) scalar(metric string) (float64, bool) {
+	value, ok := m[metric][""]
+	return value, ok
+}
+
+// extractMetrics turns collector results into metrics and event items.
+// Failed collectors contribute nothing, so their rules keep their state.
+func extractMetrics(results []CollectorResult) (MetricSet, map[string][]string) {
+	metrics := make(MetricSet)
+	events := make(map[string][]string)
+
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+
+		switch data := result.Data.(type) {
+		case PerformanceInfo:
+			cores := len(data.CPUUsage.Cores)
+			if cores == 0 {
+				cores = 1
+			}
+			metrics.add("cores", "", float64(cores))
+			metrics.add("cpu_usage_percent", "", data.CPUUsage.Usage)
+			metrics.add("cpu_iowait_percent", "", data.CPUUsage.IOWait)
+			metrics.add("cpu_steal_percent", "", data.CPUUsage.Steal)
+			metrics.add("load1", "", data.LoadAverage.OneMin)
+			metrics.add("load5", "", data.LoadAverage.FiveMin)
+			metrics.add("load15", "", data.LoadAverage.FifteenMin)
+			if data.MemoryUsage.Total > 0 {
+				metrics.add("memory_used_percent", "", float64(data.MemoryUsage.Used)/float64(data.MemoryUsage.Total)*100)
+			}
+			if data.MemoryUsage.SwapTotal > 0 {
+				metrics.add("swap_used_percent", "", float64(data.MemoryUsage.SwapUsed)/float64(data.MemoryUsage.SwapTotal)*100)
+			}
+			for _, disk := range data.DiskUsage {
+				metrics.add("disk_use_percent", disk.MountPoint, disk.UsePercent)
+			}
+			for _, process := range data.ProcessInfo {
+				label := processLabel(process)
+				metrics.add("process_cpu_percent", label, process.CPU)
+				metrics.add("process_memory_percent", label, process.Memory)
+			}
+
+		case NetworkAnalysis:
+			for _, bw := range data.BandwidthUsage {
+				metrics.add("rx_bytes_per_second", bw.Interface, bw.RXRate)
+				metrics.add("tx_bytes_per_second", bw.Interface, bw.TXRate)
+				metrics.add("rx_errors_per_second", bw.Interface, bw.RXErrorRate)
+				metrics.add("tx_errors_per_second", bw.Interface, bw.TXErrorRate)
+			}
+			metrics.add("connections_total", "", float64(data.NetworkStats.TotalConnections))
+			metrics.add("connections_established", "", float64(data.NetworkStats.Established))
+			metrics.add("connections_listen", "", float64(data.NetworkStats.Listen))
+
+		case PackageInfo:
+			metrics.add("installed_packages", "", float64(len(data.InstalledPkgs)))
+			metrics.add("outdated_packages", "", float64(len(data.OutdatedPkgs)))
+			metrics.add("security_updates", "", float64(len(data.SecurityPkgs)))
+			for severity, count := range countVulnerabilities(data.Vulnerabilities) {
+				metrics.add("package_vulnerabilities", severity, float64(count))
+			}
+
+		case SecurityScan:
+			metrics.add("open_ports", "", float64(len(data.OpenPorts)))
+			metrics.add("high_cpu_processes", "", float64(len(data.HighCPUProcesses)))
+			metrics.add("suspicious_files", "", float64(len(data.SuspiciousFiles)))
+			metrics.add("unusual_perms", "", float64(len(data.UnusualPerms)))
+			metrics.add("setuid_binaries", "", float64(len(data.SetuidBinaries)))
+			metrics.add("modified_etc_files", "", float64(len(data.ModifiedFiles)))
+			metrics.add("security_score", "", float64(data.Score))
+			for severity, count := range countFindings(data.Findings) {
+				metrics.add("security_findings", severity, float64(count))
+			}
+
+			events["new_setuid_binary"] = append([]string{}, data.SetuidBinaries...)
+			ports := []string{}
+			for _, port := range data.OpenPorts {
+				ports = append(ports, strings.ToLower(port.Protocol)+"/"+port.Port)
+			}
+			events["new_listening_port"] = ports
+			users := []string{}
+			for _, user := range data.NewUsers {
+				users = append(users, user.Username)
+			}
+			events["new_user"] = users
+		}
+	}
+
+	return metrics, events
+}
+
+// processLabel is "pid command", e.g. "1044 /usr/bin/python3".
+func processLabel(process ProcessInfo) string {
+	command := strings.Fields(process.Command)
+	if len(command) == 0 {
+		return process.PID
+	}
+	return process.PID + " " + command[0]
+}
+
+// Rule is one line of a rules file:
+//
+//	[name:] metric[{label}] op threshold [for duration] [severity level]
+//	[name:] event [for duration] [severity level]
+//
+// The threshold is a number, a metric or a product such as cores*2.
+type Rule struct {
+	Name      string
+	Metric    string
+	Label     string
+	Op        string
+	Threshold []string
+	Event     string
+	For       time.Duration
+	Severity  string
+}
+
+func (r Rule) Expr() string {
+	if r.Event != "" {
+		return r.Event
+	}
+	metric := r.Metric
+	if r.Label != "" {
+		metric += "{" + r.Label + "}"
+	}
+	return fmt.Sprintf("%s %s %s", metric, r.Op, strings.Join(r.Threshold, "*"))
+}
+
+func (r Rule) Module() string {
+	if r.Event != "" {
+		return eventModules[r.Event]
+	}
+	return metricModules[r.Metric]
+}
+
+// threshold evaluates the right hand side against the current metrics.
+func (r Rule) threshold(metrics MetricSet) (float64, bool) {
+	value := 1.0
+	for _, factor := range r.Threshold {
+		if number, err := strconv.ParseFloat(factor, 64); err == nil {
+			value *= number
+			continue
+		}
+		number, ok := metrics.scalar(factor)
+		if !ok {
+			return 0, false
+		}
+		value *= number
+	}
+	return value, true
+}
+
+func compare(value float64, op string, threshold float64) bool {
+	switch op {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case "==":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	}
+	return false
+}
+
+// RuleSet is a parsed rules file.
+type RuleSet struct {
+	Rules []Rule
+	Sinks []AlertSink
+}
+
+// Modules returns the collectors the rules need, in registry order.
+func (rs RuleSet) Modules(registry *Registry) []string {
+	needed := make(map[string]bool)
+	for _, rule := range rs.Rules {
+		needed[rule.Module()] = true
+		for _, factor := range rule.Threshold {
+			if module, ok := metricModules[factor]; ok {
+				needed[module] = true
+			}
+		}
+	}
+	var modules []string
+	for _, c := range registry.Collectors() {
+		if needed[c.Name()] {
+			modules = append(modules, c.Name())
+		}
+	}
+	return modules
+}
+
+var (
+	ruleNamePattern = regexp.MustCompile(`^([A-Za-z0-9_.-]+):\s+(.*)$`)
+	ruleExprPattern = regexp.MustCompile(`^([a-z_][a-z0-9_]*)(?:\{([^}]*)\})?\s*(>=|<=|==|!=|>|<)\s*(.+)$`)
+	identPattern    = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+)
+
+// LoadRules reads a rules file. Besides rules it holds "notify" lines that
+// configure the sinks; without any, alerts go to stdout.
+func LoadRules(path string) (RuleSet, error) {
+	var rules RuleSet
+
+	file, err := os.Open(path)
+	if err != nil {
+		return rules, err
+	}
+	defer file.Close()
+
+	names := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if fields := strings.Fields(line); fields[0] == "notify" {
+			sink, err := parseSink(fields[1:])
+			if err != nil {
+				return rules, fmt.Errorf("%s:%d: %v", path, lineNo, err)
+			}
+			rules.Sinks = append(rules.Sinks, sink)
+			continue
+		}
+
+		rule, err := parseRule(line)
+		if err != nil {
+			return rules, fmt.Errorf("%s:%d: %v", path, lineNo, err)
+		}
+		if names[rule.Name] {
+			return rules, fmt.Errorf("%s:%d: duplicate rule %q", path, lineNo, rule.Name)
+		}
+		names[rule.Name] = true
+		rules.Rules = append(rules.Rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return rules, err
+	}
+
+	if len(rules.Rules) == 0 {
+		return rules, fmt.Errorf("%s: no rules", path)
+	}
+	if len(rules.Sinks) == 0 {
+		rules.Sinks = []AlertSink{stdoutSink{}}
+	}
+	return rules, nil
+}
+
+func parseRule(line string) (Rule, error) {
+	rule := Rule{Severity: SeverityMedium}
+
+	if match := ruleNamePattern.FindStringSubmatch(line); match != nil {
+		rule.Name = match[1]
+		line = match[2]
+	}
+
+	// Options are read from the end: ... for 5m severity critical
+	fields := strings.Fields(line)
+	for len(fields) >= 2 {
+		key, value := fields[len(fields)-2], fields[len(fields)-1]
+		switch key {
+		case "for":
+			duration, err := time.ParseDuration(value)
+			if err != nil || duration < 0 {
+				return rule, fmt.Errorf("invalid duration %q", value)
+			}
+			rule.For = duration
+		case "severity":
+			// Rules files from before alerts shared the finding scale
+			if value == "warning" {
+				value = SeverityMedium
+			}
+			if !validSeverity(value) {
+				return rule, fmt.Errorf("severity must be %s, not %q", severityList, value)
+			}
+			rule.Severity = value
+		default:
+			key = ""
+		}
+		if key == "" {
+			break
+		}
+		fields = fields[:len(fields)-2]
+	}
+	expr := strings.Join(fields, " ")
+
+	if _, ok := eventModules[expr]; ok {
+		rule.Event = expr
+	} else if match := ruleExprPattern.FindStringSubmatch(expr); match != nil {
+		rule.Metric, rule.Label, rule.Op = match[1], match[2], match[3]
+		if _, ok := metricModules[rule.Metric]; !ok {
+			return rule, fmt.Errorf("unknown metric %q", rule.Metric)
+		}
+		for _, factor := range strings.Split(strings.ReplaceAll(match[4], " ", ""), "*") {
+			if _, err := strconv.ParseFloat(factor, 64); err == nil {
+				rule.Threshold = append(rule.Threshold, factor)
+				continue
+			}
+			if !identPattern.MatchString(factor) {
+				return rule, fmt.Errorf("invalid threshold %q", match[4])
+			}
+			if _, ok := metricModules[factor]; !ok {
+				return rule, fmt.Errorf("unknown metric %q in threshold", factor)
+			}
+			rule.Threshold = append(rule.Threshold, factor)
+		}
+	} else if identPattern.MatchString(expr) {
+		return rule, fmt.Errorf("unknown event %q", expr)
+	} else {
+		return rule, fmt.Errorf("invalid rule %q", expr)
+	}
+
+	if rule.Name == "" {
+		rule.Name = rule.Expr()
+	}
+	return rule, nil
+}
+
+// Alert is one rule matching one series. It is what sinks receive.
+type Alert struct {
+	Rule       string     `json:"rule"`
+	Expr       string     `json:"expr"`
+	Label      string     `json:"label,omitempty"`
+	Severity   string     `json:"severity"`
+	State      string     `json:"state"`
+	Value      float64    `json:"value"`
+	Threshold  float64    `json:"threshold"`
+	Hostname   string     `json:"hostname"`
+	Since      time.Time  `json:"since"`
+	FiredAt    *time.Time `json:"fired_at,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+func (a Alert) key() string {
+	return a.Rule + "\x00" + a.Label
+}
+
+// AlertEngine evaluates rules and tracks alert state between evaluations.
+// Only state changes to firing and resolved reach the sinks, so an alert
+// that stays firing is sent once.
+type AlertEngine struct {
+	rules    RuleSet
+	hostname string
+
+	active    map[string]*Alert
+	baselines map[string][]string
+	statePath string
+}
+
+// alertState is the --state file.
+type alertState struct {
+	Alerts    map[string]*Alert   `json:"alerts"`
+	Baselines map[string][]string `json:"baselines"`
+}
+
+func NewAlertEngine(rules RuleSet, hostname string) *AlertEngine {
+	return &AlertEngine{
+		rules:     rules,
+		hostname:  hostname,
+		active:    make(map[string]*Alert),
+		baselines: make(map[string][]string),
+	}
+}
+
+// LoadState restores alerts and event baselines, so a restart neither
+// repeats notifications nor forgets what was new.
+func (e *AlertEngine) LoadState(path string) error {
+	e.statePath = path
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state alertState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("invalid alert state %s: %v", path, err)
+	}
+	// Alerts of rules that were removed from the file are dropped silently
+	rules := make(map[string]bool)
+	for _, rule := range e.rules.Rules {
+		rules[rule.Name] = true
+	}
+	for _, alert := range state.Alerts {
+		if rules[alert.Rule] {
+			e.active[alert.key()] = alert
+		}
+	}
+	if state.Baselines != nil {
+		e.baselines = state.Baselines
+	}
+	return nil
+}
+
+func (e *AlertEngine) saveState() error {
+	if e.statePath == "" {
+		return nil
+	}
+	state := alertState{Alerts: make(map[string]*Alert), Baselines: e.baselines}
+	for _, alert := range e.active {
+		state.Alerts[alert.Rule+"/"+alert.Label] = alert
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(e.statePath, data, 0644)
+}
+
+// Evaluate applies every rule to one set of results and returns the
+// alerts that changed to firing or resolved.
+func (e *AlertEngine) Evaluate(now time.Time, metrics MetricSet, events map[string][]string) []Alert {
+	var changed []Alert
+
+	for _, rule := range e.rules.Rules {
+		matches, evaluated := e.match(rule, metrics, events)
+		if !evaluated {
+			// The collector failed or the metric is missing: keep state
+			continue
+		}
+
+		for label, match := range matches {
+			alert, ok := e.active[rule.Name+"\x00"+label]
+			if !ok {
+				alert = &Alert{
+					Rule:     rule.Name,
+					Expr:     rule.Expr(),
+					Label:    label,
+					Severity: rule.Severity,
+					State:    AlertPending,
+					Hostname: e.hostname,
+					Since:    now,
+				}
+				e.active[alert.key()] = alert
+			}
+			alert.Value, alert.Threshold = match[0], match[1]
+
+			if alert.State == AlertPending && now.Sub(alert.Since) >= rule.For {
+				alert.State = AlertFiring
+				alert.FiredAt = &now
+				changed = append(changed, *alert)
+			}
+		}
+
+		for key, alert := range e.active {
+			if alert.Rule != rule.Name {
+				continue
+			}
+			if _, ok := matches[alert.Label]; ok {
+				continue
+			}
+			delete(e.active, key)
+			if alert.State == AlertFiring {
+				alert.State = AlertResolved
+				alert.ResolvedAt = &now
+				changed = append(changed, *alert)
+			}
+		}
+	}
+
+	sort.Slice(changed, func(i, j int) bool { return changed[i].key() < changed[j].key() })
+	return changed
+}
+
+// match returns the labels for which rule holds, with [value, threshold].
+// evaluated is false when the rule could not be checked at all.
+func (e *AlertEngine) match(rule Rule, metrics MetricSet, events map[string][]string) (map[string][2]float64, bool) {
+	matches := make(map[string][2]float64)
+
+	if rule.Event != "" {
+		items, ok := events[rule.Event]
+		if !ok {
+			return nil, false
+		}
+		baseline, seen := e.baselines[rule.Event]
+		if !seen {
+			e.baselines[rule.Event] = items
+			return matches, true
+		}
+		known := make(map[string]bool)
+		for _, item := range baseline {
+			known[item] = true
+		}
+		for _, item := range items {
+			if !known[item] {
+				matches[item] = [2]float64{1, 0}
+			}
+		}
+		return matches, true
+	}
+
+	series, ok := metrics[rule.Metric]
+	if !ok {
+		return nil, false
+	}
+	threshold, ok := rule.threshold(metrics)
+	if !ok {
+		return nil, false
+	}
+	for label, value := range series {
+		if rule.Label != "" && label != rule.Label {
+			continue
+		}
+		if compare(value, rule.Op, threshold) {
+			matches[label] = [2]float64{value, threshold}
+		}
+	}
+	return matches, true
+}
+
+// Notify sends alerts to every sink. A failing sink does not stop the others.
+func (e *AlertEngine) Notify(alerts []Alert) {
+	for _, alert := range alerts {
+		for _, sink := range e.rules.Sinks {
+			if err := sink.Notify(alert); err != nil {
+				fmt.Fprintf(os.Stderr, "⚠️  %s: %v\n", sink.Name(), err)
+			}
+		}
+	}
+}
+
+func formatAlert(alert Alert) string {
+	icon := "🔥"
+	if alert.State == AlertResolved {
+		icon = "✅"
+	}
+	subject := alert.Rule
+	if alert.Label != "" {
+		subject += " " + alert.Label
+	}
+	if _, ok := eventModules[alert.Expr]; ok {
+		return fmt.Sprintf("%s %s [%s] %s on %s", icon, strings.ToUpper(alert.State), alert.Severity, subject, alert.Hostname)
+	}
+	return fmt.Sprintf("%s %s [%s] %s on %s: %s (value %.2f, threshold %.2f)",
+		icon, strings.ToUpper(alert.State), alert.Severity, subject, alert.Hostname, alert.Expr, alert.Value, alert.Threshold)
+}
+
+// alertCommand implements "host-monitor alert" and returns the exit code.
+func alertCommand(args []string) int {
+	fs := flag.NewFlagSet("alert", flag.ContinueOnError)
+	fs.Usage = usage
+	rulesPath := fs.String("rules", "", "Rules file")
+	statePath := fs.String("state", "", "File to keep alert state across runs")
+	interval := fs.Duration("interval", time.Minute, "Time between evaluations")
+	count := fs.Int("count", 0, "Number of evaluations, 0 repeats until interrupted")
+	check := fs.Bool("check", false, "Validate the rules file and exit")
+	configPath := fs.String("config", "", "Collector config file (JSON)")
+	sample := fs.Duration("sample", defaultSampleInterval, "CPU and bandwidth sampling window, 0 for averages since boot")
+	applyHost := hostFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *rulesPath == "" {
+		fmt.Fprintln(os.Stderr, "❌ --rules is required")
+		return 2
+	}
+	if *count < 0 || *interval <= 0 {
+		fmt.Fprintln(os.Stderr, "❌ --count must be >= 0 and --interval > 0")
+		return 2
+	}
+	registry, err := newConfiguredRegistry(applyHost(), *sample, *configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+
+	rules, err := LoadRules(*rulesPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+
+	if *check {
+		for _, rule := range rules.Rules {
+			fmt.Printf("✅ %-24s %-40s for %-6v %-8s (%s)\n", rule.Name, rule.Expr(), rule.For, rule.Severity, rule.Module())
+		}
+		for _, sink := range rules.Sinks {
+			fmt.Printf("📣 %s\n", sink.Name())
+		}
+		return 0
+	}
+
+	selected, err := registry.Select(strings.Join(rules.Modules(registry), ","))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	warnPrivileges(selected)
+
+	engine := NewAlertEngine(rules, registry.Settings().Host.Hostname())
+	if *statePath != "" {
+		if err := engine.LoadState(*statePath); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for i := 0; *count == 0 || i < *count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return 0
+			case <-time.After(*interval):
+			}
+		}
+
+		results := registry.Run(ctx, selected)
+		for _, result := range results {
+			if result.Err != nil {
+				fmt.Fprintf(os.Stderr, "⚠️  %s failed: %v\n", result.Collector.Title(), result.Err)
+			} else if err := result.Incomplete(); err != nil {
+				fmt.Fprintf(os.Stderr, "⚠️  %s is incomplete: %v\n", result.Collector.Title(), err)
+			}
+		}
+
+		metrics, events := extractMetrics(results)
+		engine.Notify(engine.Evaluate(time.Now(), metrics, events))
+		if err := engine.saveState(); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Failed to save alert state: %v\n", err)
+		}
+	}
+
+	return 0
+}
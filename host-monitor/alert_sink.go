@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// AlertSink delivers firing and resolved alerts.
+type AlertSink interface {
+	Name() string
+	Notify(alert Alert) error
+}
+
+// parseSink parses the arguments of a "notify" line in a rules file:
+//
+//	notify stdout
+//	notify file /var/log/host-monitor/alerts.jsonl
+//	notify webhook https://hooks.example.com/host-monitor
+//	notify syslog [tag]
+func parseSink(args []string) (AlertSink, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("notify needs a sink: stdout, file, webhook or syslog")
+	}
+
+	switch args[0] {
+	case "stdout":
+		return stdoutSink{}, nil
+	case "file":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("usage: notify file <path>")
+		}
+		return &fileSink{path: args[1]}, nil
+	case "webhook":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("usage: notify webhook <url>")
+		}
+		u, err := url.Parse(args[1])
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid webhook URL %q", args[1])
+		}
+		return &webhookSink{url: args[1], client: &http.Client{Timeout: 10 * time.Second}}, nil
+	case "syslog":
+		tag := "host-monitor"
+		if len(args) > 1 {
+			tag = args[1]
+		}
+		return newSyslogSink(tag)
+	}
+	return nil, fmt.Errorf("unknown sink %q (use stdout, file, webhook or syslog)", args[0])
+}
+
+type stdoutSink struct{}
+
+func (stdoutSink) Name() string { return "stdout" }
+
+func (stdoutSink) Notify(alert Alert) error {
+	fmt.Println(formatAlert(alert))
+	return nil
+}
+
+// fileSink appends one JSON object per alert.
+type fileSink struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (s *fileSink) Name() string { return "file " + s.path }
+
+func (s *fileSink) Notify(alert Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// webhookSink POSTs the alert as JSON.
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *webhookSink) Name() string { return "webhook " + s.url }
+
+func (s *webhookSink) Notify(alert Alert) error {
+	data, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// newSyslogSink fails where Go's log/syslog is unavailable.
+func newSyslogSink(tag string) (AlertSink, error) {
+	return nil, fmt.Errorf("syslog is not available on %s; use the file or webhook sink", runtime.GOOS)
+}
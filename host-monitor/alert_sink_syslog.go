@@ -0,0 +1,51 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"log/syslog"
+	"sync"
+)
+
+// syslogSink writes to the local syslog daemon, mapping severities to
+// priorities. The connection is opened on first use.
+type syslogSink struct {
+	tag    string
+	mu     sync.Mutex
+	writer *syslog.Writer
+}
+
+func newSyslogSink(tag string) (AlertSink, error) {
+	return &syslogSink{tag: tag}, nil
+}
+
+func (s *syslogSink) Name() string { return "syslog " + s.tag }
+
+func (s *syslogSink) Notify(alert Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.writer == nil {
+		writer, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_WARNING, s.tag)
+		if err != nil {
+			return err
+		}
+		s.writer = writer
+	}
+
+	message := formatAlert(alert)
+	if alert.State == AlertResolved {
+		return s.writer.Notice(message)
+	}
+	switch alert.Severity {
+	case SeverityCritical:
+		return s.writer.Crit(message)
+	case SeverityHigh:
+		return s.writer.Err(message)
+	case SeverityLow:
+		return s.writer.Notice(message)
+	case SeverityInfo:
+		return s.writer.Info(message)
+	}
+	return s.writer.Warning(message)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		line string
+		want Rule
+		err  string
+	}{
+		{
+			line: "cpu_usage_percent > 90",
+			want: Rule{Name: "cpu_usage_percent > 90", Metric: "cpu_usage_percent", Op: ">",
+				Threshold: []string{"90"}, Severity: SeverityMedium},
+		},
+		{
+			line: "high_load: load5 >= cores*2 for 5m severity critical",
+			want: Rule{Name: "high_load", Metric: "load5", Op: ">=", Threshold: []string{"cores", "2"},
+				For: 5 * time.Minute, Severity: SeverityCritical},
+		},
+		{
+			line: "disk_use_percent{/var} > 85 severity info for 10m",
+			want: Rule{Name: "disk_use_percent{/var} > 85", Metric: "disk_use_percent", Label: "/var", Op: ">",
+				Threshold: []string{"85"}, For: 10 * time.Minute, Severity: SeverityInfo},
+		},
+		{
+			line: "new_user severity critical",
+			want: Rule{Name: "new_user", Event: "new_user", Severity: SeverityCritical},
+		},
+		{
+			line: "swap: swap_used_percent > 50 severity high",
+			want: Rule{Name: "swap", Metric: "swap_used_percent", Op: ">", Threshold: []string{"50"}, Severity: SeverityHigh},
+		},
+		{
+			line: "load1 > 4 severity warning",
+			want: Rule{Name: "load1 > 4", Metric: "load1", Op: ">", Threshold: []string{"4"}, Severity: SeverityMedium},
+		},
+		{line: "cpu_usage_percent > 90 for soon", err: "invalid duration"},
+		{line: "cpu_usage_percent > 90 severity urgent", err: "severity must be"},
+		{line: "cpu_temperature > 90", err: `unknown metric "cpu_temperature"`},
+		{line: "load1 > cores*bogus", err: `unknown metric "bogus" in threshold`},
+		{line: "load1 > cores*(2)", err: "invalid threshold"},
+		{line: "new_group", err: `unknown event "new_group"`},
+		{line: "load1 ~ 3", err: "invalid rule"},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRule(tt.line)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseRule(%q) error = %v, want %q", tt.line, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRule(%q): %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRule(%q) =\n%+v\nwant\n%+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+// new_setuid_binary must see every setuid binary, not the first ten find
+// happens to print, or a reordered walk looks like new binaries.
+func TestNewSetuidBinaryEvent(t *testing.T) {
+	commands := t.TempDir()
+	scanner := NewSecurityScanner()
+	scanner.SetHost(NewHost(t.TempDir(), commands))
+	evaluate := func(engine *AlertEngine, binaries []string) []Alert {
+		find := commandKey("find", "/usr/bin", "-type", "f", "-perm", "-4000")
+		output := strings.Join(binaries, "\n") + "\n"
+		if err := os.WriteFile(filepath.Join(commands, find), []byte(output), 0644); err != nil {
+			t.Fatal(err)
+		}
+		scan := SecurityScan{SetuidBinaries: scanner.getSetuidBinaries()}
+		metrics, events := extractMetrics([]CollectorResult{{Data: scan}})
+		return engine.Evaluate(time.Unix(0, 0), metrics, events)
+	}
+
+	rule, err := parseRule("new_setuid_binary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := NewAlertEngine(RuleSet{Rules: []Rule{rule}}, "web-01")
+
+	var binaries []string
+	for i := range 12 {
+		binaries = append(binaries, fmt.Sprintf("/usr/bin/tool%02d", i))
+	}
+	if alerts := evaluate(engine, binaries[:11]); len(alerts) != 0 {
+		t.Fatalf("baseline evaluation fired %v", alerts)
+	}
+
+	// find walks in another order and the twelfth binary is new
+	reordered := slices.Clone(binaries)
+	slices.Reverse(reordered)
+	alerts := evaluate(engine, reordered)
+	if len(alerts) != 1 || alerts[0].Label != "/usr/bin/tool11" || alerts[0].State != AlertFiring {
+		t.Errorf("alerts = %+v, want /usr/bin/tool11 firing", alerts)
+	}
+}
+
+func TestAlertEngineEvaluate(t *testing.T) {
+	start := time.Date(2026, time.January, 2, 9, 0, 0, 0, time.UTC)
+	cpu := func(value float64) MetricSet { return MetricSet{"cpu_usage_percent": {"": value}} }
+	disks := func(root, data float64) MetricSet {
+		return MetricSet{"disk_use_percent": {"/": root, "/data": data}}
+	}
+	users := func(names ...string) map[string][]string { return map[string][]string{"new_user": names} }
+
+	type step struct {
+		at      time.Duration
+		metrics MetricSet
+		events  map[string][]string
+		want    []string // "label state since", since as an offset from start
+	}
+	tests := []struct {
+		name  string
+		rule  string
+		steps []step
+	}{
+		{
+			name: "pending until for has passed, then sent once",
+			rule: "cpu_usage_percent > 90 for 5m",
+			steps: []step{
+				{at: 0, metrics: cpu(95)},
+				{at: 4 * time.Minute, metrics: cpu(97)},
+				{at: 5 * time.Minute, metrics: cpu(96), want: []string{" firing 0s"}},
+				{at: 6 * time.Minute, metrics: cpu(99)},
+				{at: 7 * time.Minute, metrics: cpu(50), want: []string{" resolved 0s"}},
+				{at: 8 * time.Minute, metrics: cpu(95)},
+				{at: 13 * time.Minute, metrics: cpu(95), want: []string{" firing 8m0s"}},
+			},
+		},
+		{
+			name: "pending alert that clears is never sent",
+			rule: "cpu_usage_percent > 90 for 5m",
+			steps: []step{
+				{at: 0, metrics: cpu(95)},
+				{at: 2 * time.Minute, metrics: cpu(40)},
+				{at: 3 * time.Minute, metrics: cpu(95)},
+				{at: 7 * time.Minute, metrics: cpu(95)},
+				{at: 8 * time.Minute, metrics: cpu(95), want: []string{" firing 3m0s"}},
+			},
+		},
+		{
+			name: "without for fires at once",
+			rule: "cpu_usage_percent > 90",
+			steps: []step{
+				{at: 0, metrics: cpu(91), want: []string{" firing 0s"}},
+				{at: time.Minute, metrics: cpu(91)},
+			},
+		},
+		{
+			name: "missing metric keeps the state",
+			rule: "cpu_usage_percent > 90",
+			steps: []step{
+				{at: 0, metrics: cpu(95), want: []string{" firing 0s"}},
+				{at: time.Minute, metrics: MetricSet{}},
+				{at: 2 * time.Minute, metrics: cpu(95)},
+				{at: 3 * time.Minute, metrics: cpu(10), want: []string{" resolved 0s"}},
+			},
+		},
+		{
+			name: "one alert per label",
+			rule: "disk_use_percent > 85",
+			steps: []step{
+				{at: 0, metrics: disks(50, 90), want: []string{"/data firing 0s"}},
+				{at: time.Minute, metrics: disks(95, 90), want: []string{"/ firing 1m0s"}},
+				{at: 2 * time.Minute, metrics: disks(95, 20), want: []string{"/data resolved 0s"}},
+			},
+		},
+		{
+			name: "label filter",
+			rule: "disk_use_percent{/} > 85",
+			steps: []step{
+				{at: 0, metrics: disks(50, 99)},
+				{at: time.Minute, metrics: disks(86, 99), want: []string{"/ firing 1m0s"}},
+			},
+		},
+		{
+			name: "event against the first evaluation",
+			rule: "new_user",
+			steps: []step{
+				{at: 0, events: users("root", "alice")},
+				{at: time.Minute, events: users("root", "alice", "mallory"), want: []string{"mallory firing 1m0s"}},
+				{at: 2 * time.Minute, events: users("root", "alice", "mallory")},
+				{at: 3 * time.Minute},
+				{at: 4 * time.Minute, events: users("root"), want: []string{"mallory resolved 1m0s"}},
+				{at: 5 * time.Minute, events: users("root", "bob", "alice"), want: []string{"bob firing 5m0s"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := parseRule(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			engine := NewAlertEngine(RuleSet{Rules: []Rule{rule}}, "web-01")
+
+			for _, step := range tt.steps {
+				now := start.Add(step.at)
+				var got []string
+				for _, alert := range engine.Evaluate(now, step.metrics, step.events) {
+					got = append(got, fmt.Sprintf("%s %s %s", alert.Label, alert.State, alert.Since.Sub(start)))
+					switch {
+					case alert.State == AlertFiring && (alert.FiredAt == nil || !alert.FiredAt.Equal(now)):
+						t.Errorf("at %s: fired at %v", step.at, alert.FiredAt)
+					case alert.State == AlertResolved && (alert.ResolvedAt == nil || !alert.ResolvedAt.Equal(now)):
+						t.Errorf("at %s: resolved at %v", step.at, alert.ResolvedAt)
+					}
+					if alert.Hostname != "web-01" || alert.Rule != rule.Name {
+						t.Errorf("at %s: alert %+v", step.at, alert)
+					}
+				}
+				if !slices.Equal(got, step.want) {
+					t.Errorf("at %s: alerts = %q, want %q", step.at, got, step.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,654 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// authLogFiles are the syslog files sshd, sudo and su write to: auth.log on
+// Debian and Ubuntu, secure on RHEL, Fedora and SUSE.
+var authLogFiles = []string{"/var/log/auth.log", "/var/log/secure"}
+
+// Auth event types. Failures have Success false.
+const (
+	authSSHLogin       = "ssh_login"
+	authSSHFailure     = "ssh_failure"
+	authSSHInvalidUser = "ssh_invalid_user"
+	authSudo           = "sudo"
+	authSudoFailure    = "sudo_failure"
+	authSu             = "su"
+	authSuFailure      = "su_failure"
+	authLogin          = "login"
+	authLoginFailure   = "login_failure"
+	authUserAdded      = "user_added"
+	authUserDeleted    = "user_deleted"
+)
+
+// Brute-force detection defaults: this many failures from one address
+// within the window.
+const (
+	defaultBruteForceThreshold = 5
+	defaultBruteForceWindow    = 10 * time.Minute
+)
+
+// AuthEvent is one authentication related log line. Raw keeps the line as
+// logged, or a syslog style rendering of a journal entry.
+type AuthEvent struct {
+	Time       time.Time `json:"time"`
+	Host       string    `json:"host"`
+	Program    string    `json:"program"`
+	PID        int       `json:"pid,omitempty"`
+	Type       string    `json:"type"`
+	Success    bool      `json:"success"`
+	User       string    `json:"user,omitempty"`
+	TargetUser string    `json:"target_user,omitempty"`
+	SourceIP   string    `json:"source_ip,omitempty"`
+	Port       int       `json:"port,omitempty"`
+	Method     string    `json:"method,omitempty"`
+	TTY        string    `json:"tty,omitempty"`
+	Command    string    `json:"command,omitempty"`
+	Raw        string    `json:"raw"`
+}
+
+// BruteForceAttempt is a burst of failed logins from one address. Failures
+// is the largest number seen within one window; Compromised is set when the
+// address logged in successfully after the burst started.
+type BruteForceAttempt struct {
+	SourceIP    string    `json:"source_ip"`
+	Failures    int       `json:"failures"`
+	Users       []string  `json:"users"`
+	First       time.Time `json:"first"`
+	Last        time.Time `json:"last"`
+	Compromised bool      `json:"compromised"`
+	LoginAs     string    `json:"login_as,omitempty"`
+}
+
+// AuthReport is the output of "host-monitor auth".
+type AuthReport struct {
+	Sources    []string            `json:"sources"`
+	Since      *time.Time          `json:"since,omitempty"`
+	Until      *time.Time          `json:"until,omitempty"`
+	Counts     map[string]int      `json:"counts"`
+	BruteForce []BruteForceAttempt `json:"brute_force"`
+	Events     []AuthEvent         `json:"events"`
+}
+
+var (
+	sshAcceptedPattern = regexp.MustCompile(`^Accepted (\S+) for (\S+) from (\S+) port (\d+)`)
+	sshFailedPattern   = regexp.MustCompile(`^Failed (\S+) for (invalid user )?(.*) from (\S+) port (\d+)`)
+	sshInvalidPattern  = regexp.MustCompile(`^Invalid user (.*) from (\S+) port (\d+)`)
+	repeatedPattern    = regexp.MustCompile(`^message repeated (\d+) times: \[ ?(.*?) ?\]$`)
+	suSessionPattern   = regexp.MustCompile(`^pam_unix\(su(?:-l)?:session\): session opened for user ([^(\s]+)(?:\(uid=\d+\))? by ([^(\s]*)`)
+	failedSuPattern    = regexp.MustCompile(`^FAILED SU \(to (\S+)\) (\S+) on (\S+)`)
+	failedLoginPattern = regexp.MustCompile(`^FAILED LOGIN \(\d+\) on '([^']*)' FOR '([^']*)'`)
+	loginOnPattern     = regexp.MustCompile(`^ROOT LOGIN ON (\S+)|^LOGIN ON (\S+) BY (\S+)`)
+	newUserPattern     = regexp.MustCompile(`^new user: name=([^,]+),`)
+	deleteUserPattern  = regexp.MustCompile(`^delete user '([^']+)'`)
+	syslogTagPattern   = regexp.MustCompile(`^([^\s\[:]+)(?:\[(\d+)\])?:\s?(.*)$`)
+)
+
+// maxRepeated caps the count of rsyslog's "message repeated N times", so a
+// single forged line cannot stand for any number of failed logins.
+const maxRepeated = 100
+
+// ParseAuthLine parses one syslog line in the traditional "Oct 18 08:14:02"
+// or the RFC 3339 format rsyslog uses on newer releases. Traditional
+// timestamps have no year; it is taken from now, or the year before when
+// that would put the line in the future or the date does not exist in
+// now's year. Lines that are not about authentication return no events;
+// rsyslog's "message repeated N times" returns N, at most maxRepeated.
+func ParseAuthLine(line string, now time.Time) []AuthEvent {
+	var stamp time.Time
+	var rest string
+
+	if fields := strings.SplitN(line, " ", 2); len(fields) == 2 && len(fields[0]) > 10 && fields[0][4] == '-' {
+		t, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return nil
+		}
+		stamp, rest = t, fields[1]
+	} else {
+		if len(line) < 16 {
+			return nil
+		}
+		// Parsed with the year, so Feb 29 of a year without one is rejected
+		// rather than rolled over into March
+		var err error
+		for _, year := range []int{now.Year(), now.Year() - 1} {
+			stamp, err = time.ParseInLocation("2006 Jan _2 15:04:05", strconv.Itoa(year)+" "+line[:15], now.Location())
+			if err == nil && !stamp.After(now.Add(24*time.Hour)) {
+				break
+			}
+		}
+		if err != nil {
+			return nil
+		}
+		rest = line[16:]
+	}
+
+	fields := strings.SplitN(rest, " ", 2)
+	if len(fields) != 2 {
+		return nil
+	}
+	match := syslogTagPattern.FindStringSubmatch(fields[1])
+	if match == nil {
+		return nil
+	}
+	pid, _ := strconv.Atoi(match[2])
+	return authEvents(AuthEvent{Time: stamp, Host: fields[0], Program: match[1], PID: pid, Raw: line}, match[3])
+}
+
+// authEvents fills in base from one message and returns it once per time it
+// was logged.
+func authEvents(base AuthEvent, message string) []AuthEvent {
+	count := 1
+	if match := repeatedPattern.FindStringSubmatch(message); match != nil {
+		count, _ = strconv.Atoi(match[1])
+		if count > maxRepeated || count < 0 {
+			count = maxRepeated
+		}
+		message = match[2]
+	}
+
+	event, ok := parseAuthMessage(base, strings.TrimSpace(message))
+	if !ok {
+		return nil
+	}
+	events := make([]AuthEvent, count)
+	for i := range events {
+		events[i] = event
+	}
+	return events
+}
+
+// parseAuthMessage recognizes the messages of sshd, sudo, su, login and the
+// shadow tools.
+func parseAuthMessage(event AuthEvent, message string) (AuthEvent, bool) {
+	switch event.Program {
+	case "sshd", "sshd-session":
+		if match := sshAcceptedPattern.FindStringSubmatch(message); match != nil {
+			event.Type, event.Success, event.Method, event.User, event.SourceIP = authSSHLogin, true, match[1], match[2], match[3]
+			event.Port, _ = strconv.Atoi(match[4])
+			return event, true
+		}
+		if match := sshFailedPattern.FindStringSubmatch(message); match != nil {
+			event.Type, event.Method, event.User, event.SourceIP = authSSHFailure, match[1], match[3], match[4]
+			event.Port, _ = strconv.Atoi(match[5])
+			return event, true
+		}
+		if match := sshInvalidPattern.FindStringSubmatch(message); match != nil {
+			event.Type, event.User, event.SourceIP = authSSHInvalidUser, match[1], match[2]
+			event.Port, _ = strconv.Atoi(match[3])
+			return event, true
+		}
+
+	case "sudo":
+		// "alice : TTY=pts/0 ; PWD=/home/alice ; USER=root ; COMMAND=/usr/bin/id"
+		// with "3 incorrect password attempts ; " or "user NOT in sudoers ; "
+		// before TTY when sudo refused
+		user, details, ok := strings.Cut(message, " : ")
+		if !ok || strings.Contains(user, " ") {
+			return event, false
+		}
+		event.Type, event.Success, event.User = authSudo, true, user
+		for _, part := range strings.Split(details, " ; ") {
+			key, value, ok := strings.Cut(part, "=")
+			if !ok {
+				event.Type, event.Success = authSudoFailure, false
+				continue
+			}
+			switch key {
+			case "TTY":
+				event.TTY = value
+			case "USER":
+				event.TargetUser = value
+			case "COMMAND":
+				event.Command = value
+			}
+		}
+		return event, true
+
+	case "su":
+		if match := suSessionPattern.FindStringSubmatch(message); match != nil {
+			event.Type, event.Success, event.TargetUser, event.User = authSu, true, match[1], match[2]
+			return event, true
+		}
+		if match := failedSuPattern.FindStringSubmatch(message); match != nil {
+			event.Type, event.TargetUser, event.User, event.TTY = authSuFailure, match[1], match[2], match[3]
+			return event, true
+		}
+
+	case "login":
+		if match := loginOnPattern.FindStringSubmatch(message); match != nil {
+			event.Type, event.Success = authLogin, true
+			if match[1] != "" {
+				event.User, event.TTY = "root", match[1]
+			} else {
+				event.User, event.TTY = match[3], match[2]
+			}
+			return event, true
+		}
+		if match := failedLoginPattern.FindStringSubmatch(message); match != nil {
+			event.Type, event.TTY, event.User = authLoginFailure, match[1], match[2]
+			return event, true
+		}
+
+	case "useradd":
+		if match := newUserPattern.FindStringSubmatch(message); match != nil {
+			event.Type, event.Success, event.User = authUserAdded, true, match[1]
+			return event, true
+		}
+
+	case "userdel":
+		if match := deleteUserPattern.FindStringSubmatch(message); match != nil {
+			event.Type, event.Success, event.User = authUserDeleted, true, match[1]
+			return event, true
+		}
+	}
+	return event, false
+}
+
+// ReadAuthLog parses a syslog file.
+func ReadAuthLog(r io.Reader, now time.Time) []AuthEvent {
+	var events []AuthEvent
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		events = append(events, ParseAuthLine(scanner.Text(), now)...)
+	}
+	return events
+}
+
+// ReadJournalExport parses "journalctl -o export" output: entries of
+// KEY=value lines separated by a blank line, where binary values are
+// written as the key, a newline, a little endian 64 bit length and the data.
+func ReadJournalExport(r io.Reader) []AuthEvent {
+	var events []AuthEvent
+	reader := bufio.NewReader(r)
+	entry := make(map[string]string)
+
+	flush := func() {
+		if len(entry) > 0 {
+			events = append(events, journalEvents(entry)...)
+			entry = make(map[string]string)
+		}
+	}
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		switch {
+		case len(line) == 0:
+			flush()
+		case bytes.IndexByte(line, '=') >= 0:
+			key, value, _ := bytes.Cut(line, []byte("="))
+			entry[string(key)] = string(value)
+		default:
+			var size uint64
+			if binary.Read(reader, binary.LittleEndian, &size) != nil || size > 1<<24 {
+				return events
+			}
+			value := make([]byte, size+1)
+			if _, err := io.ReadFull(reader, value); err != nil {
+				return events
+			}
+			entry[string(line)] = string(value[:size])
+		}
+		if err != nil {
+			flush()
+			return events
+		}
+	}
+}
+
+// journalEvents parses one journal entry.
+func journalEvents(entry map[string]string) []AuthEvent {
+	usec, err := strconv.ParseInt(entry["__REALTIME_TIMESTAMP"], 10, 64)
+	if err != nil {
+		return nil
+	}
+	program := entry["SYSLOG_IDENTIFIER"]
+	pid, _ := strconv.Atoi(firstNonEmpty(entry["SYSLOG_PID"], entry["_PID"]))
+	stamp := time.UnixMicro(usec)
+
+	tag := program
+	if pid > 0 {
+		tag += "[" + strconv.Itoa(pid) + "]"
+	}
+	base := AuthEvent{
+		Time:    stamp,
+		Host:    entry["_HOSTNAME"],
+		Program: program,
+		PID:     pid,
+		Raw:     stamp.Format(time.Stamp) + " " + entry["_HOSTNAME"] + " " + tag + ": " + entry["MESSAGE"],
+	}
+	return authEvents(base, entry["MESSAGE"])
+}
+
+// readAuthEvents parses the auth log files that exist below host. When
+// there are none, as on journald only systems, the auth and authpriv
+// facilities of the journal are read instead. It returns the sources read.
+func readAuthEvents(host *Host, files []string) ([]AuthEvent, []string) {
+	var events []AuthEvent
+	var sources []string
+	now := time.Now()
+
+	for _, path := range files {
+		file, err := host.Open(path)
+		if err != nil {
+			continue
+		}
+		events = append(events, ReadAuthLog(file, now)...)
+		file.Close()
+		sources = append(sources, path)
+	}
+
+	if len(sources) == 0 {
+		output, err := host.Output("journalctl", "-o", "export", "--no-pager", "-n", "10000", "SYSLOG_FACILITY=4", "SYSLOG_FACILITY=10")
+		if err == nil {
+			events = ReadJournalExport(bytes.NewReader(output))
+			sources = append(sources, "journal")
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events, sources
+}
+
+// FilterAuthEvents keeps events at or after since and before until; a zero
+// time leaves that end open.
+func FilterAuthEvents(events []AuthEvent, since, until time.Time) []AuthEvent {
+	var kept []AuthEvent
+	for _, event := range events {
+		if (!since.IsZero() && event.Time.Before(since)) || (!until.IsZero() && !event.Time.Before(until)) {
+			continue
+		}
+		kept = append(kept, event)
+	}
+	return kept
+}
+
+// DetectBruteForce reports addresses with at least threshold failed logins
+// within window. events must be sorted by time. An "Invalid user" line only
+// counts when its sshd process logged no password failures, so an attempt
+// is not counted twice.
+func DetectBruteForce(events []AuthEvent, threshold int, window time.Duration) []BruteForceAttempt {
+	failedPIDs := make(map[string]bool)
+	for _, event := range events {
+		if event.Type == authSSHFailure {
+			failedPIDs[event.Host+"/"+strconv.Itoa(event.PID)] = true
+		}
+	}
+
+	failures := make(map[string][]AuthEvent)
+	var order []string
+	for _, event := range events {
+		if event.SourceIP == "" || event.Success {
+			continue
+		}
+		if event.Type == authSSHInvalidUser && failedPIDs[event.Host+"/"+strconv.Itoa(event.PID)] {
+			continue
+		}
+		if failures[event.SourceIP] == nil {
+			order = append(order, event.SourceIP)
+		}
+		failures[event.SourceIP] = append(failures[event.SourceIP], event)
+	}
+
+	var attempts []BruteForceAttempt
+	for _, ip := range order {
+		list := failures[ip]
+		// Largest number of failures within any window, sliding its start
+		best, start := 0, 0
+		for end := range list {
+			for list[end].Time.Sub(list[start].Time) > window {
+				start++
+			}
+			if n := end - start + 1; n > best {
+				best = n
+			}
+		}
+		if best < threshold {
+			continue
+		}
+
+		attempt := BruteForceAttempt{SourceIP: ip, Failures: best, First: list[0].Time, Last: list[len(list)-1].Time}
+		seen := make(map[string]bool)
+		for _, event := range list {
+			if !seen[event.User] {
+				seen[event.User] = true
+				attempt.Users = append(attempt.Users, event.User)
+			}
+		}
+		for _, event := range events {
+			if event.Success && event.SourceIP == ip && !event.Time.Before(attempt.First) {
+				attempt.Compromised, attempt.LoginAs = true, event.User
+				break
+			}
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts
+}
+
+// lastEvents returns the raw lines of the last limit events of the given
+// types.
+func lastEvents(events []AuthEvent, limit int, types ...string) []string {
+	var lines []string
+	for i := len(events) - 1; i >= 0 && len(lines) < limit; i-- {
+		for _, t := range types {
+			if events[i].Type == t {
+				lines = append(lines, events[i].Raw)
+				break
+			}
+		}
+	}
+	// Back to log order
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines
+}
+
+// parseTimeArg accepts an RFC 3339 time, a local "2006-01-02 15:04:05",
+// "2006-01-02 15:04" or "2006-01-02", or a duration before now such as 90m,
+// 24h or 7d.
+func parseTimeArg(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use RFC 3339, YYYY-MM-DD [HH:MM[:SS]] or a duration such as 24h or 7d)", value)
+}
+
+func formatBruteForce(attempt BruteForceAttempt, window time.Duration) string {
+	text := fmt.Sprintf("%d failed logins from %s within %s (users %s, %s to %s)",
+		attempt.Failures, attempt.SourceIP, window, strings.Join(attempt.Users, ", "),
+		attempt.First.Format(time.Stamp), attempt.Last.Format(time.Stamp))
+	if attempt.Compromised {
+		text += ", then a successful login as " + attempt.LoginAs
+	}
+	return text
+}
+
+func formatAuthEvent(event AuthEvent) string {
+	icon := "✅"
+	if !event.Success {
+		icon = "❌"
+	}
+	text := fmt.Sprintf("%s %s %-16s %-10s", icon, event.Time.Format("2006-01-02 15:04:05"), event.Type, event.User)
+	if event.SourceIP != "" {
+		text += " from " + event.SourceIP
+	}
+	if event.Method != "" {
+		text += " (" + event.Method + ")"
+	}
+	if event.TargetUser != "" {
+		text += " as " + event.TargetUser
+	}
+	if event.Command != "" {
+		text += ": " + event.Command
+	}
+	return text
+}
+
+func printAuthReport(report AuthReport, window time.Duration) {
+	fmt.Printf("🔐 Auth events from %s: %d\n", strings.Join(report.Sources, ", "), len(report.Events))
+
+	types := make([]string, 0, len(report.Counts))
+	for t := range report.Counts {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		fmt.Printf("  %-16s %d\n", t, report.Counts[t])
+	}
+
+	if len(report.BruteForce) > 0 {
+		fmt.Println("\n🔥 Brute-force attempts:")
+		for _, attempt := range report.BruteForce {
+			fmt.Printf("  %s\n", formatBruteForce(attempt, window))
+		}
+	}
+
+	if len(report.Events) > 0 {
+		fmt.Println("\nEvents:")
+		for _, event := range report.Events {
+			fmt.Printf("  %s\n", formatAuthEvent(event))
+		}
+	}
+}
+
+// authCommand implements "host-monitor auth". It exits 1 when brute-force
+// attempts were found.
+func authCommand(args []string) int {
+	fs := flag.NewFlagSet("auth", flag.ContinueOnError)
+	fs.Usage = usage
+	logList := fs.String("log", strings.Join(authLogFiles, ","), "Comma separated syslog files to parse")
+	journal := fs.String("journal", "", "Parse \"journalctl -o export\" output from this file (- for stdin) instead")
+	since := fs.String("since", "", "Only events at or after this time, or this long ago (e.g. 24h, 7d)")
+	until := fs.String("until", "", "Only events before this time, or this long ago")
+	typeList := fs.String("type", "", "Comma separated event types to list (default all)")
+	user := fs.String("user", "", "Only events for this user")
+	threshold := fs.Int("threshold", defaultBruteForceThreshold, "Failed logins from one address that count as brute force")
+	window := fs.Duration("window", defaultBruteForceWindow, "Window the brute-force threshold applies to")
+	limit := fs.Int("limit", 50, "Show only the last N events, 0 for all (text format)")
+	format := fs.String("format", formatText, "Report format: text, json or yaml")
+	applyHost := hostFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	host := applyHost()
+
+	if !validFormat(*format) {
+		fmt.Fprintf(os.Stderr, "❌ Unknown format %q (use text, json or yaml)\n", *format)
+		return 2
+	}
+	if *threshold < 1 || *window <= 0 || *limit < 0 {
+		fmt.Fprintln(os.Stderr, "❌ --threshold must be >= 1, --window > 0 and --limit >= 0")
+		return 2
+	}
+
+	now := time.Now()
+	sinceTime, err := parseTimeArg(*since, now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ --since: %v\n", err)
+		return 2
+	}
+	untilTime, err := parseTimeArg(*until, now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ --until: %v\n", err)
+		return 2
+	}
+
+	var events []AuthEvent
+	var sources []string
+	switch *journal {
+	case "":
+		events, sources = readAuthEvents(host, splitList(*logList))
+	case "-":
+		events, sources = ReadJournalExport(os.Stdin), []string{"stdin"}
+	default:
+		file, err := os.Open(*journal)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+		events, sources = ReadJournalExport(file), []string{*journal}
+		file.Close()
+	}
+	if len(sources) == 0 {
+		fmt.Fprintln(os.Stderr, "❌ No auth log found (tried "+*logList+" and journalctl)")
+		return 2
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	events = FilterAuthEvents(events, sinceTime, untilTime)
+
+	report := AuthReport{
+		Sources:    sources,
+		Counts:     map[string]int{},
+		BruteForce: DetectBruteForce(events, *threshold, *window),
+		Events:     []AuthEvent{},
+	}
+	if !sinceTime.IsZero() {
+		report.Since = &sinceTime
+	}
+	if !untilTime.IsZero() {
+		report.Until = &untilTime
+	}
+	if report.BruteForce == nil {
+		report.BruteForce = []BruteForceAttempt{}
+	}
+
+	types := make(map[string]bool)
+	for _, t := range splitList(*typeList) {
+		types[t] = true
+	}
+	for _, event := range events {
+		if (len(types) > 0 && !types[event.Type]) || (*user != "" && event.User != *user) {
+			continue
+		}
+		report.Counts[event.Type]++
+		report.Events = append(report.Events, event)
+	}
+
+	if *format == formatText {
+		if *limit > 0 && len(report.Events) > *limit {
+			report.Events = report.Events[len(report.Events)-*limit:]
+		}
+		printAuthReport(report, *window)
+	} else if err := WriteReport(os.Stdout, *format, NewReport("auth", host.Hostname(), report)); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to write auth report: %v\n", err)
+		return 2
+	}
+
+	if len(report.BruteForce) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAuthLine(t *testing.T) {
+	now := time.Date(2026, time.January, 2, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		line      string
+		wantCount int
+		wantTime  time.Time
+		wantType  string
+		wantUser  string
+		wantIP    string
+	}{
+		{
+			"same year",
+			"Jan  2 09:15:00 web1 sshd[812]: Accepted publickey for alice from 192.0.2.10 port 51234 ssh2: ED25519 SHA256:abc",
+			1, time.Date(2026, time.January, 2, 9, 15, 0, 0, time.UTC), authSSHLogin, "alice", "192.0.2.10",
+		},
+		{
+			"year rollover",
+			"Dec 31 23:59:58 web1 sshd[813]: Failed password for root from 203.0.113.5 port 40022 ssh2",
+			1, time.Date(2025, time.December, 31, 23, 59, 58, 0, time.UTC), authSSHFailure, "root", "203.0.113.5",
+		},
+		{
+			"clock skew within a day stays this year",
+			"Jan  2 20:00:00 web1 sshd[814]: Invalid user admin from 203.0.113.5 port 40100",
+			1, time.Date(2026, time.January, 2, 20, 0, 0, 0, time.UTC), authSSHInvalidUser, "admin", "203.0.113.5",
+		},
+		{
+			"RFC 3339",
+			"2026-01-02T09:30:00.123456+01:00 web1 sudo: alice : TTY=pts/0 ; PWD=/home/alice ; USER=root ; COMMAND=/usr/bin/id",
+			1, time.Date(2026, time.January, 2, 8, 30, 0, 123456000, time.UTC), authSudo, "alice", "",
+		},
+		{
+			"message repeated",
+			"Jan  2 09:16:00 web1 sshd[815]: message repeated 3 times: [ Failed password for invalid user oracle from 203.0.113.5 port 40200 ssh2]",
+			3, time.Date(2026, time.January, 2, 9, 16, 0, 0, time.UTC), authSSHFailure, "oracle", "203.0.113.5",
+		},
+		{
+			"sudo refused",
+			"Jan  2 09:17:00 web1 sudo:      bob : 3 incorrect password attempts ; TTY=pts/1 ; PWD=/home/bob ; USER=root ; COMMAND=/bin/sh",
+			1, time.Date(2026, time.January, 2, 9, 17, 0, 0, time.UTC), authSudoFailure, "bob", "",
+		},
+		{
+			"su session",
+			"Jan  2 09:18:00 web1 su[900]: pam_unix(su-l:session): session opened for user root(uid=0) by alice(uid=1000)",
+			1, time.Date(2026, time.January, 2, 9, 18, 0, 0, time.UTC), authSu, "alice", "",
+		},
+		{"not about authentication", "Jan  2 09:19:00 web1 CRON[901]: (root) CMD (run-parts /etc/cron.hourly)", 0, time.Time{}, "", "", ""},
+		{"sshd noise", "Jan  2 09:19:00 web1 sshd[902]: Connection closed by 203.0.113.5 port 40300 [preauth]", 0, time.Time{}, "", "", ""},
+		{"invalid RFC 3339", "2026-13-02T09:30:00Z web1 sudo: alice : USER=root ; COMMAND=/usr/bin/id", 0, time.Time{}, "", "", ""},
+		{"too short", "Jan  2 09:19", 0, time.Time{}, "", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := ParseAuthLine(tt.line, now)
+			if len(events) != tt.wantCount {
+				t.Fatalf("got %d events, want %d: %+v", len(events), tt.wantCount, events)
+			}
+			for _, event := range events {
+				if !event.Time.Equal(tt.wantTime) {
+					t.Errorf("time = %v, want %v", event.Time, tt.wantTime)
+				}
+				if event.Type != tt.wantType || event.User != tt.wantUser || event.SourceIP != tt.wantIP {
+					t.Errorf("event = %s %q from %q, want %s %q from %q",
+						event.Type, event.User, event.SourceIP, tt.wantType, tt.wantUser, tt.wantIP)
+				}
+				if event.Raw != tt.line {
+					t.Errorf("raw = %q, want the line", event.Raw)
+				}
+			}
+		})
+	}
+}
+
+// Feb 29 only exists in leap years: it belongs to now's year when that is
+// one, to the year before after a leap year, and otherwise to no year within
+// reach, so the line is dropped rather than moved to Mar 1.
+func TestParseAuthLineLeapDay(t *testing.T) {
+	line := "Feb 29 12:00:00 web1 sshd[820]: Failed password for root from 203.0.113.5 port 40022 ssh2"
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{"leap year", time.Date(2028, time.March, 1, 8, 0, 0, 0, time.UTC), time.Date(2028, time.February, 29, 12, 0, 0, 0, time.UTC)},
+		{"year after a leap year", time.Date(2025, time.January, 10, 8, 0, 0, 0, time.UTC), time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC)},
+		{"leap year before the day", time.Date(2028, time.January, 10, 8, 0, 0, 0, time.UTC), time.Time{}},
+		{"no leap year within a year", time.Date(2026, time.March, 1, 8, 0, 0, 0, time.UTC), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		events := ParseAuthLine(line, tt.now)
+		switch {
+		case tt.want.IsZero() && len(events) != 0:
+			t.Errorf("%s: parsed at %v, want the line dropped", tt.name, events[0].Time)
+		case !tt.want.IsZero() && (len(events) != 1 || !events[0].Time.Equal(tt.want)):
+			t.Errorf("%s: events = %+v, want one at %v", tt.name, events, tt.want)
+		}
+	}
+}
+
+// A forged "message repeated" line counts at most maxRepeated failures, which
+// still reads as brute force, but not as a flood.
+func TestRepeatedMessageCap(t *testing.T) {
+	now := time.Date(2026, time.January, 2, 10, 0, 0, 0, time.UTC)
+	events := ParseAuthLine("Jan  2 09:16:00 web1 sshd[815]: message repeated 2147483648 times: "+
+		"[ Failed password for root from 203.0.113.5 port 40200 ssh2]", now)
+	if len(events) != maxRepeated {
+		t.Fatalf("got %d events, want %d", len(events), maxRepeated)
+	}
+
+	attempts := DetectBruteForce(events, defaultBruteForceThreshold, defaultBruteForceWindow)
+	if len(attempts) != 1 || attempts[0].Failures != maxRepeated {
+		t.Errorf("brute force = %+v, want one attempt with %d failures", attempts, maxRepeated)
+	}
+}
+
+// journalField writes a field the way "journalctl -o export" does, in the
+// binary form when the value contains a newline.
+func journalField(buf *bytes.Buffer, key, value string) {
+	if !strings.Contains(value, "\n") {
+		buf.WriteString(key + "=" + value + "\n")
+		return
+	}
+	buf.WriteString(key + "\n")
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value + "\n")
+}
+
+func TestReadJournalExport(t *testing.T) {
+	var export bytes.Buffer
+	entries := []map[string]string{
+		{"__REALTIME_TIMESTAMP": "1767344100000000", "_HOSTNAME": "web1", "SYSLOG_IDENTIFIER": "sshd", "SYSLOG_PID": "812",
+			"MESSAGE": "Accepted password for alice from 192.0.2.10 port 51234 ssh2"},
+		// Binary field with blank lines inside, which must not end the entry
+		{"__REALTIME_TIMESTAMP": "1767344160000000", "_HOSTNAME": "web1", "SYSLOG_IDENTIFIER": "sudo", "_PID": "900",
+			"MESSAGE": "alice : TTY=pts/0 ; PWD=/ ; USER=root ; COMMAND=/bin/echo a\n\nb"},
+		{"__REALTIME_TIMESTAMP": "1767344220000000", "_HOSTNAME": "web1", "SYSLOG_IDENTIFIER": "CRON",
+			"MESSAGE": "(root) CMD (true)"},
+		{"_HOSTNAME": "web1", "SYSLOG_IDENTIFIER": "sshd", "MESSAGE": "Failed password for root from 203.0.113.5 port 1 ssh2"},
+		{"__REALTIME_TIMESTAMP": "1767344280000000", "_HOSTNAME": "web1", "SYSLOG_IDENTIFIER": "sshd", "SYSLOG_PID": "813",
+			"MESSAGE": "Failed password for root from 203.0.113.5 port 40022 ssh2"},
+	}
+	for i, entry := range entries {
+		if i > 0 {
+			export.WriteString("\n")
+		}
+		keys := make([]string, 0, len(entry))
+		for key := range entry {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			journalField(&export, key, entry[key])
+		}
+	}
+
+	events := ReadJournalExport(&export)
+
+	want := []struct {
+		typ     string
+		user    string
+		pid     int
+		command string
+		time    time.Time
+	}{
+		{authSSHLogin, "alice", 812, "", time.UnixMicro(1767344100000000)},
+		{authSudo, "alice", 900, "/bin/echo a\n\nb", time.UnixMicro(1767344160000000)},
+		{authSSHFailure, "root", 813, "", time.UnixMicro(1767344280000000)},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, event := range events {
+		if event.Type != want[i].typ || event.User != want[i].user || event.PID != want[i].pid ||
+			event.Command != want[i].command || !event.Time.Equal(want[i].time) {
+			t.Errorf("event %d = %+v, want %+v", i, event, want[i])
+		}
+		if event.Host != "web1" {
+			t.Errorf("event %d: host = %q", i, event.Host)
+		}
+	}
+	if raw := events[0].Raw; !strings.HasSuffix(raw, " web1 sshd[812]: Accepted password for alice from 192.0.2.10 port 51234 ssh2") {
+		t.Errorf("raw = %q", raw)
+	}
+}
+
+func TestDetectBruteForce(t *testing.T) {
+	start := time.Date(2026, time.January, 2, 9, 0, 0, 0, time.UTC)
+	failure := func(minute, pid int, ip, user string) AuthEvent {
+		return AuthEvent{Time: start.Add(time.Duration(minute) * time.Minute), Host: "web1", PID: pid,
+			Type: authSSHFailure, User: user, SourceIP: ip}
+	}
+	invalid := func(minute, pid int, ip, user string) AuthEvent {
+		event := failure(minute, pid, ip, user)
+		event.Type = authSSHInvalidUser
+		return event
+	}
+	login := func(minute int, ip, user string) AuthEvent {
+		return AuthEvent{Time: start.Add(time.Duration(minute) * time.Minute), Host: "web1", Type: authSSHLogin,
+			Success: true, User: user, SourceIP: ip}
+	}
+
+	tests := []struct {
+		name            string
+		events          []AuthEvent
+		wantIP          string
+		wantFailures    int
+		wantUsers       []string
+		wantCompromised string
+	}{
+		{
+			name: "below threshold",
+			events: []AuthEvent{
+				failure(0, 1, "203.0.113.5", "root"), failure(1, 2, "203.0.113.5", "root"),
+				failure(2, 3, "203.0.113.5", "root"), failure(3, 4, "203.0.113.5", "root"),
+			},
+		},
+		{
+			name: "spread beyond the window",
+			events: []AuthEvent{
+				failure(0, 1, "203.0.113.5", "root"), failure(4, 2, "203.0.113.5", "root"),
+				failure(8, 3, "203.0.113.5", "root"), failure(12, 4, "203.0.113.5", "root"),
+				failure(16, 5, "203.0.113.5", "root"), failure(20, 6, "203.0.113.5", "root"),
+			},
+		},
+		{
+			name: "burst inside a longer run",
+			events: []AuthEvent{
+				failure(0, 1, "203.0.113.5", "root"), failure(30, 2, "203.0.113.5", "admin"),
+				failure(31, 3, "203.0.113.5", "root"), failure(32, 4, "203.0.113.5", "root"),
+				failure(33, 5, "203.0.113.5", "test"), failure(34, 6, "203.0.113.5", "root"),
+				failure(35, 7, "203.0.113.5", "root"), failure(60, 8, "203.0.113.5", "root"),
+			},
+			wantIP: "203.0.113.5", wantFailures: 6, wantUsers: []string{"root", "admin", "test"},
+		},
+		{
+			name: "invalid user counted once per connection",
+			events: []AuthEvent{
+				invalid(0, 1, "203.0.113.5", "a"), failure(0, 1, "203.0.113.5", "a"),
+				invalid(1, 2, "203.0.113.5", "b"), failure(1, 2, "203.0.113.5", "b"),
+				invalid(2, 3, "203.0.113.5", "c"), failure(2, 3, "203.0.113.5", "c"),
+				invalid(3, 4, "203.0.113.5", "d"), failure(3, 4, "203.0.113.5", "d"),
+			},
+		},
+		{
+			name: "invalid user without password failure counts",
+			events: []AuthEvent{
+				invalid(0, 1, "203.0.113.5", "a"), invalid(1, 2, "203.0.113.5", "b"),
+				invalid(2, 3, "203.0.113.5", "c"), failure(3, 4, "203.0.113.5", "root"),
+				invalid(4, 5, "203.0.113.5", "d"), failure(4, 5, "203.0.113.5", "d"),
+			},
+			wantIP: "203.0.113.5", wantFailures: 5, wantUsers: []string{"a", "b", "c", "root", "d"},
+		},
+		{
+			name: "login after the burst",
+			events: []AuthEvent{
+				login(0, "198.51.100.7", "deploy"),
+				failure(1, 1, "198.51.100.7", "root"), failure(2, 2, "198.51.100.7", "root"),
+				failure(3, 3, "198.51.100.7", "root"), failure(4, 4, "198.51.100.7", "root"),
+				failure(5, 5, "198.51.100.7", "root"), login(6, "198.51.100.7", "root"),
+			},
+			wantIP: "198.51.100.7", wantFailures: 5, wantUsers: []string{"root"}, wantCompromised: "root",
+		},
+		{
+			name: "login from another address",
+			events: []AuthEvent{
+				failure(1, 1, "203.0.113.5", "root"), failure(2, 2, "203.0.113.5", "root"),
+				failure(3, 3, "203.0.113.5", "root"), failure(4, 4, "203.0.113.5", "root"),
+				failure(5, 5, "203.0.113.5", "root"), login(6, "192.0.2.10", "root"),
+			},
+			wantIP: "203.0.113.5", wantFailures: 5, wantUsers: []string{"root"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := DetectBruteForce(tt.events, defaultBruteForceThreshold, defaultBruteForceWindow)
+			if tt.wantIP == "" {
+				if len(attempts) != 0 {
+					t.Fatalf("got %+v, want no attempts", attempts)
+				}
+				return
+			}
+			if len(attempts) != 1 {
+				t.Fatalf("got %d attempts, want 1: %+v", len(attempts), attempts)
+			}
+
+			attempt := attempts[0]
+			if attempt.SourceIP != tt.wantIP || attempt.Failures != tt.wantFailures {
+				t.Errorf("attempt = %d failures from %s, want %d from %s",
+					attempt.Failures, attempt.SourceIP, tt.wantFailures, tt.wantIP)
+			}
+			if !slices.Equal(attempt.Users, tt.wantUsers) {
+				t.Errorf("users = %v, want %v", attempt.Users, tt.wantUsers)
+			}
+			if attempt.Compromised != (tt.wantCompromised != "") || attempt.LoginAs != tt.wantCompromised {
+				t.Errorf("compromised = %v as %q, want %q", attempt.Compromised, attempt.LoginAs, tt.wantCompromised)
+			}
+		})
+	}
+}
@@ -0,0 +1,591 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const baselineSchemaVersion = 1
+
+// setuidDirs are searched for setuid/setgid binaries. They are flat
+// directories, so the baseline does not walk below them.
+var setuidDirs = []string{"/usr/bin", "/usr/sbin", "/bin", "/sbin", "/usr/local/bin", "/usr/local/sbin"}
+
+// sensitiveFiles have their mode and owner recorded in the baseline.
+var sensitiveFiles = []string{
+	"/etc/passwd", "/etc/shadow", "/etc/group", "/etc/gshadow",
+	"/etc/sudoers", "/etc/ssh/sshd_config", "/etc/crontab",
+}
+
+// Baseline is a snapshot of the security relevant state of a host.
+type Baseline struct {
+	SchemaVersion  int            `json:"schema_version"`
+	Hostname       string         `json:"hostname"`
+	CreatedAt      time.Time      `json:"created_at"`
+	ListeningPorts []BaselinePort `json:"listening_ports"`
+	SetuidBinaries []BaselineFile `json:"setuid_binaries"`
+	Users          []BaselineUser `json:"users"`
+	WorldWritable  []string       `json:"world_writable"`
+	Permissions    []BaselineFile `json:"permissions"`
+}
+
+type BaselinePort struct {
+	Protocol string `json:"protocol"`
+	Port     string `json:"port"`
+	Process  string `json:"process"`
+}
+
+func (p BaselinePort) String() string {
+	if p.Process == "" {
+		return strings.ToLower(p.Protocol) + "/" + p.Port
+	}
+	return fmt.Sprintf("%s/%s (%s)", strings.ToLower(p.Protocol), p.Port, p.Process)
+}
+
+type BaselineFile struct {
+	Path   string `json:"path"`
+	Mode   string `json:"mode"`
+	UID    int    `json:"uid"`
+	GID    int    `json:"gid"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+type BaselineUser struct {
+	Name  string `json:"name"`
+	UID   int    `json:"uid"`
+	GID   int    `json:"gid"`
+	Home  string `json:"home"`
+	Shell string `json:"shell"`
+}
+
+// SignedBaseline is the file written by "baseline save". Signature is an
+// ed25519 signature of the compact JSON of Baseline.
+type SignedBaseline struct {
+	Baseline  json.RawMessage `json:"baseline"`
+	KeyID     string          `json:"key_id"`
+	Signature string          `json:"signature"`
+}
+
+// TakeBaseline records the current state of the host.
+func TakeBaseline(host *Host, scan SecurityScan) Baseline {
+	baseline := Baseline{
+		SchemaVersion: baselineSchemaVersion,
+		Hostname:      host.Hostname(),
+		CreatedAt:     time.Now().UTC().Truncate(time.Second),
+	}
+
+	seen := make(map[BaselinePort]bool)
+	for _, port := range scan.OpenPorts {
+		p := BaselinePort{Protocol: strings.ToLower(port.Protocol), Port: port.Port, Process: port.Process}
+		if !seen[p] {
+			seen[p] = true
+			baseline.ListeningPorts = append(baseline.ListeningPorts, p)
+		}
+	}
+	sort.Slice(baseline.ListeningPorts, func(i, j int) bool {
+		return baseline.ListeningPorts[i].String() < baseline.ListeningPorts[j].String()
+	})
+
+	baseline.SetuidBinaries = findSetuidBinaries(host)
+	baseline.Users = readUsers(host)
+	baseline.WorldWritable = findWorldWritable(host, "/etc")
+
+	for _, path := range sensitiveFiles {
+		if file, ok := baselineFile(host, path, false); ok {
+			baseline.Permissions = append(baseline.Permissions, file)
+		}
+	}
+
+	return baseline
+}
+
+func findSetuidBinaries(host *Host) []BaselineFile {
+	var files []BaselineFile
+	seen := make(map[string]bool)
+
+	for _, dir := range setuidDirs {
+		// /bin is often a symlink to /usr/bin
+		real := dir
+		if target, err := host.Readlink(dir); err == nil {
+			real = target
+			if !filepath.IsAbs(real) {
+				real = filepath.Join(filepath.Dir(dir), real)
+			}
+		}
+		if seen[real] {
+			continue
+		}
+		seen[real] = true
+
+		entries, err := host.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil || info.Mode()&(fs.ModeSetuid|fs.ModeSetgid) == 0 {
+				continue
+			}
+			if file, ok := baselineFile(host, dir+"/"+entry.Name(), true); ok {
+				files = append(files, file)
+			}
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// findWorldWritable lists regular files below root that others can write.
+func findWorldWritable(host *Host, root string) []string {
+	var files []string
+	host.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Mode().Perm()&0o002 != 0 {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
+
+func baselineFile(host *Host, path string, hash bool) (BaselineFile, bool) {
+	info, err := host.Lstat(path)
+	if err != nil {
+		return BaselineFile{}, false
+	}
+
+	file := BaselineFile{Path: path, Mode: info.Mode().String()}
+	if uid, gid, ok := fileOwner(info); ok {
+		file.UID, file.GID = uid, gid
+	}
+
+	if hash {
+		if f, err := host.Open(path); err == nil {
+			sum := sha256.New()
+			if _, err := io.Copy(sum, f); err == nil {
+				file.SHA256 = hex.EncodeToString(sum.Sum(nil))
+			}
+			f.Close()
+		}
+	}
+	return file, true
+}
+
+// readUsers parses /etc/passwd.
+func readUsers(host *Host) []BaselineUser {
+	var users []BaselineUser
+
+	file, err := host.Open("/etc/passwd")
+	if err != nil {
+		return users
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// name:password:uid:gid:gecos:home:shell
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 7 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		uid, _ := strconv.Atoi(fields[2])
+		gid, _ := strconv.Atoi(fields[3])
+		users = append(users, BaselineUser{Name: fields[0], UID: uid, GID: gid, Home: fields[5], Shell: fields[6]})
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	return users
+}
+
+// Key files hold base64 encoded ed25519 keys.
+
+func generateBaselineKey(path string) error {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(private)+"\n"), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(path+".pub", []byte(base64.StdEncoding.EncodeToString(public)+"\n"), 0644)
+}
+
+func readKey(path string, size int) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != size {
+		return nil, fmt.Errorf("%s is not an ed25519 key", path)
+	}
+	return key, nil
+}
+
+func keyID(public ed25519.PublicKey) string {
+	sum := sha256.Sum256(public)
+	return hex.EncodeToString(sum[:8])
+}
+
+// SignBaseline signs the compact JSON of baseline.
+func SignBaseline(baseline Baseline, private ed25519.PrivateKey) (SignedBaseline, error) {
+	payload, err := json.Marshal(baseline)
+	if err != nil {
+		return SignedBaseline{}, err
+	}
+	return SignedBaseline{
+		Baseline:  payload,
+		KeyID:     keyID(private.Public().(ed25519.PublicKey)),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(private, payload)),
+	}, nil
+}
+
+// LoadBaseline reads a baseline file and checks its signature. The file may
+// be indented, so the payload is compacted before verifying.
+func LoadBaseline(path string, public ed25519.PublicKey) (Baseline, error) {
+	var baseline Baseline
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return baseline, err
+	}
+	var signed SignedBaseline
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return baseline, fmt.Errorf("invalid baseline %s: %v", path, err)
+	}
+
+	var payload bytes.Buffer
+	if err := json.Compact(&payload, signed.Baseline); err != nil {
+		return baseline, fmt.Errorf("invalid baseline %s: %v", path, err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil || !ed25519.Verify(public, payload.Bytes(), signature) {
+		return baseline, fmt.Errorf("baseline %s: signature does not match key %s", path, keyID(public))
+	}
+
+	if err := json.Unmarshal(payload.Bytes(), &baseline); err != nil {
+		return baseline, fmt.Errorf("invalid baseline %s: %v", path, err)
+	}
+	if baseline.SchemaVersion != baselineSchemaVersion {
+		return baseline, fmt.Errorf("baseline %s has schema version %d, expected %d", path, baseline.SchemaVersion, baselineSchemaVersion)
+	}
+	return baseline, nil
+}
+
+// BaselineDiff is the drift between a baseline and a later state, which may
+// be the live host or the baseline of another host.
+type BaselineDiff struct {
+	BaselineHost         string         `json:"baseline_host"`
+	BaselineCreatedAt    time.Time      `json:"baseline_created_at"`
+	CurrentHost          string         `json:"current_host"`
+	CurrentCreatedAt     time.Time      `json:"current_created_at"`
+	AddedPorts           []BaselinePort `json:"added_ports"`
+	RemovedPorts         []BaselinePort `json:"removed_ports"`
+	NewSetuidBinaries    []BaselineFile `json:"new_setuid_binaries"`
+	RemovedSetuid        []BaselineFile `json:"removed_setuid_binaries"`
+	ChangedSetuid        []FileChange   `json:"changed_setuid_binaries"`
+	NewUsers             []BaselineUser `json:"new_users"`
+	RemovedUsers         []BaselineUser `json:"removed_users"`
+	ChangedUsers         []UserChange   `json:"changed_users"`
+	NewWorldWritable     []string       `json:"new_world_writable"`
+	RemovedWorldWritable []string       `json:"removed_world_writable"`
+	PermissionChanges    []FileChange   `json:"permission_changes"`
+}
+
+type FileChange struct {
+	Path   string       `json:"path"`
+	Before BaselineFile `json:"before"`
+	After  BaselineFile `json:"after"`
+}
+
+type UserChange struct {
+	Name   string       `json:"name"`
+	Before BaselineUser `json:"before"`
+	After  BaselineUser `json:"after"`
+}
+
+// Changes counts every difference.
+func (d BaselineDiff) Changes() int {
+	return len(d.AddedPorts) + len(d.RemovedPorts) +
+		len(d.NewSetuidBinaries) + len(d.RemovedSetuid) + len(d.ChangedSetuid) +
+		len(d.NewUsers) + len(d.RemovedUsers) + len(d.ChangedUsers) +
+		len(d.NewWorldWritable) + len(d.RemovedWorldWritable) + len(d.PermissionChanges)
+}
+
+// DiffBaselines compares before with after.
+func DiffBaselines(before, after Baseline) BaselineDiff {
+	diff := BaselineDiff{
+		BaselineHost:      before.Hostname,
+		BaselineCreatedAt: before.CreatedAt,
+		CurrentHost:       after.Hostname,
+		CurrentCreatedAt:  after.CreatedAt,
+	}
+
+	diff.AddedPorts, diff.RemovedPorts = diffSets(before.ListeningPorts, after.ListeningPorts, BaselinePort.String)
+	diff.NewWorldWritable, diff.RemovedWorldWritable = diffSets(before.WorldWritable, after.WorldWritable, func(s string) string { return s })
+
+	byPath := func(f BaselineFile) string { return f.Path }
+	diff.NewSetuidBinaries, diff.RemovedSetuid = diffSets(before.SetuidBinaries, after.SetuidBinaries, byPath)
+	diff.ChangedSetuid = changedFiles(before.SetuidBinaries, after.SetuidBinaries)
+	diff.PermissionChanges = changedFiles(before.Permissions, after.Permissions)
+
+	byName := func(u BaselineUser) string { return u.Name }
+	diff.NewUsers, diff.RemovedUsers = diffSets(before.Users, after.Users, byName)
+	old := make(map[string]BaselineUser)
+	for _, user := range before.Users {
+		old[user.Name] = user
+	}
+	for _, user := range after.Users {
+		if prev, ok := old[user.Name]; ok && prev != user {
+			diff.ChangedUsers = append(diff.ChangedUsers, UserChange{Name: user.Name, Before: prev, After: user})
+		}
+	}
+
+	return diff
+}
+
+// diffSets returns the items only in after and only in before, by key.
+func diffSets[T any](before, after []T, key func(T) string) (added, removed []T) {
+	inBefore := make(map[string]bool)
+	for _, item := range before {
+		inBefore[key(item)] = true
+	}
+	inAfter := make(map[string]bool)
+	for _, item := range after {
+		inAfter[key(item)] = true
+		if !inBefore[key(item)] {
+			added = append(added, item)
+		}
+	}
+	for _, item := range before {
+		if !inAfter[key(item)] {
+			removed = append(removed, item)
+		}
+	}
+	return added, removed
+}
+
+// changedFiles returns files present in both lists whose mode, owner or
+// hash differ.
+func changedFiles(before, after []BaselineFile) []FileChange {
+	var changes []FileChange
+	old := make(map[string]BaselineFile)
+	for _, file := range before {
+		old[file.Path] = file
+	}
+	for _, file := range after {
+		if prev, ok := old[file.Path]; ok && prev != file {
+			changes = append(changes, FileChange{Path: file.Path, Before: prev, After: file})
+		}
+	}
+	return changes
+}
+
+func printBaselineDiff(diff BaselineDiff) {
+	fmt.Println("=== SECURITY BASELINE DIFF ===")
+	fmt.Printf("Baseline: %s (%s)\n", diff.BaselineHost, diff.BaselineCreatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Current:  %s (%s)\n", diff.CurrentHost, diff.CurrentCreatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Println("==========================================")
+
+	if diff.Changes() == 0 {
+		fmt.Println("✅ No drift from baseline")
+		return
+	}
+
+	section := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Printf("\n%s\n", title)
+		for _, line := range lines {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+	ports := func(prefix string, list []BaselinePort) []string {
+		var lines []string
+		for _, p := range list {
+			lines = append(lines, prefix+p.String())
+		}
+		return lines
+	}
+	files := func(prefix string, list []BaselineFile) []string {
+		var lines []string
+		for _, f := range list {
+			lines = append(lines, fmt.Sprintf("%s%s %s %d:%d", prefix, f.Path, f.Mode, f.UID, f.GID))
+		}
+		return lines
+	}
+	changes := func(list []FileChange) []string {
+		var lines []string
+		for _, c := range list {
+			line := fmt.Sprintf("~ %s %s %d:%d -> %s %d:%d", c.Path, c.Before.Mode, c.Before.UID, c.Before.GID, c.After.Mode, c.After.UID, c.After.GID)
+			if c.Before.SHA256 != c.After.SHA256 {
+				line += " (content changed)"
+			}
+			lines = append(lines, line)
+		}
+		return lines
+	}
+	users := func(prefix string, list []BaselineUser) []string {
+		var lines []string
+		for _, u := range list {
+			lines = append(lines, fmt.Sprintf("%s%s uid=%d gid=%d %s %s", prefix, u.Name, u.UID, u.GID, u.Home, u.Shell))
+		}
+		return lines
+	}
+	prefixed := func(prefix string, list []string) []string {
+		var lines []string
+		for _, s := range list {
+			lines = append(lines, prefix+s)
+		}
+		return lines
+	}
+
+	section("🔌 Listening ports:", append(ports("+ ", diff.AddedPorts), ports("- ", diff.RemovedPorts)...))
+	section("⚠️  Setuid binaries:", append(append(files("+ ", diff.NewSetuidBinaries), files("- ", diff.RemovedSetuid)...), changes(diff.ChangedSetuid)...))
+	var userLines []string
+	userLines = append(userLines, users("+ ", diff.NewUsers)...)
+	userLines = append(userLines, users("- ", diff.RemovedUsers)...)
+	for _, c := range diff.ChangedUsers {
+		userLines = append(userLines, fmt.Sprintf("~ %s uid=%d->%d gid=%d->%d shell=%s->%s", c.Name, c.Before.UID, c.After.UID, c.Before.GID, c.After.GID, c.Before.Shell, c.After.Shell))
+	}
+	section("👥 Users:", userLines)
+	section("📝 World-writable files in /etc:", append(prefixed("+ ", diff.NewWorldWritable), prefixed("- ", diff.RemovedWorldWritable)...))
+	section("🔐 Permissions:", changes(diff.PermissionChanges))
+
+	fmt.Printf("\n📊 %d change(s) since baseline\n", diff.Changes())
+}
+
+// baselineCommand implements "host-monitor baseline keygen|save|diff".
+// diff exits 1 when there is drift, so it can gate scripts and agents.
+func baselineCommand(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	fs := flag.NewFlagSet("baseline "+args[0], flag.ContinueOnError)
+	fs.Usage = usage
+	file := fs.String("file", "/var/lib/host-monitor/baseline.json", "Baseline file")
+	keyPath := fs.String("key", "/etc/host-monitor/baseline.key", "ed25519 private key (keygen, save)")
+	pubPath := fs.String("pub", "", "ed25519 public key to verify with (default: --key with .pub)")
+	against := fs.String("against", "", "Compare with this signed baseline instead of the live host")
+	format := fs.String("format", formatText, "Report format: text, json or yaml")
+	applyHost := hostFlags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	settings := DefaultSettings(applyHost())
+
+	if *pubPath == "" {
+		*pubPath = *keyPath + ".pub"
+	}
+	if !validFormat(*format) {
+		fmt.Fprintf(os.Stderr, "❌ Unknown format %q (use text, json or yaml)\n", *format)
+		return 2
+	}
+
+	switch args[0] {
+	case "keygen":
+		if _, err := os.Stat(*keyPath); err == nil {
+			fmt.Fprintf(os.Stderr, "❌ %s already exists\n", *keyPath)
+			return 2
+		}
+		if err := generateBaselineKey(*keyPath); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+		fmt.Printf("🔑 Wrote %s and %s.pub\n", *keyPath, *keyPath)
+		return 0
+
+	case "save":
+		private, err := readKey(*keyPath, ed25519.PrivateKeySize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+		warnPrivileges([]Collector{builtinCollector("security")})
+
+		baseline := TakeBaseline(settings.Host, settings.securityScanner().PerformSecurityScan())
+		signed, err := SignBaseline(baseline, ed25519.PrivateKey(private))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+		data, _ := json.MarshalIndent(signed, "", "  ")
+		if err := os.WriteFile(*file, append(data, '\n'), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+		fmt.Printf("💾 Baseline of %s saved to %s (key %s): %d ports, %d setuid binaries, %d users\n",
+			baseline.Hostname, *file, signed.KeyID, len(baseline.ListeningPorts), len(baseline.SetuidBinaries), len(baseline.Users))
+		return 0
+
+	case "diff":
+		public, err := readKey(*pubPath, ed25519.PublicKeySize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+		before, err := LoadBaseline(*file, ed25519.PublicKey(public))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+
+		var after Baseline
+		if *against != "" {
+			if after, err = LoadBaseline(*against, ed25519.PublicKey(public)); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+				return 2
+			}
+		} else {
+			warnPrivileges([]Collector{builtinCollector("security")})
+			after = TakeBaseline(settings.Host, settings.securityScanner().PerformSecurityScan())
+		}
+
+		diff := DiffBaselines(before, after)
+		if *format == formatText {
+			printBaselineDiff(diff)
+		} else if err := WriteReport(os.Stdout, *format, NewReport("baseline", after.Hostname, diff)); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Failed to write baseline report: %v\n", err)
+			return 2
+		}
+		if diff.Changes() > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "❌ Unknown baseline command %q (use keygen, save or diff)\n", args[0])
+	return 2
+}
+
+// builtinCollector looks up a built-in collector by name.
+func builtinCollector(name string) Collector {
+	c, _ := newDefaultRegistry().Lookup(name)
+	return c
+}
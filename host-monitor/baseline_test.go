@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testBaseline() Baseline {
+	return Baseline{
+		SchemaVersion: baselineSchemaVersion,
+		Hostname:      "web1",
+		CreatedAt:     time.Date(2026, time.January, 2, 9, 0, 0, 0, time.UTC),
+		ListeningPorts: []BaselinePort{
+			{Protocol: "TCP", Port: "22", Process: "sshd"},
+			{Protocol: "TCP", Port: "80", Process: "nginx"},
+		},
+		SetuidBinaries: []BaselineFile{{Path: "/usr/bin/passwd", Mode: "-rwsr-xr-x", SHA256: "aa"}},
+		Users:          []BaselineUser{{Name: "root", Home: "/root", Shell: "/bin/bash"}},
+	}
+}
+
+func TestLoadBaselineSignature(t *testing.T) {
+	private := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize))
+	other := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{2}, ed25519.SeedSize))
+	public := private.Public().(ed25519.PublicKey)
+
+	sign := func(baseline Baseline, key ed25519.PrivateKey) SignedBaseline {
+		signed, err := SignBaseline(baseline, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	encode := func(signed SignedBaseline) []byte {
+		data, _ := json.Marshal(signed)
+		return data
+	}
+
+	oldSchema := testBaseline()
+	oldSchema.SchemaVersion = 0
+
+	tests := []struct {
+		name    string
+		file    func() []byte
+		wantErr string
+	}{
+		{"valid", func() []byte { return encode(sign(testBaseline(), private)) }, ""},
+		{"indented", func() []byte {
+			data, _ := json.MarshalIndent(sign(testBaseline(), private), "", "  ")
+			return data
+		}, ""},
+		{"tampered", func() []byte {
+			signed := sign(testBaseline(), private)
+			signed.Baseline = bytes.Replace(signed.Baseline, []byte(`"80"`), []byte(`"8080"`), 1)
+			return encode(signed)
+		}, "signature does not match"},
+		{"signed with another key", func() []byte { return encode(sign(testBaseline(), other)) }, "signature does not match"},
+		{"signature not base64", func() []byte {
+			signed := sign(testBaseline(), private)
+			signed.Signature = "not base64!"
+			return encode(signed)
+		}, "signature does not match"},
+		{"unsigned", func() []byte {
+			signed := sign(testBaseline(), private)
+			signed.Signature = ""
+			return encode(signed)
+		}, "signature does not match"},
+		{"other schema version", func() []byte { return encode(sign(oldSchema, private)) }, "schema version 0"},
+		{"not JSON", func() []byte { return []byte("baseline") }, "invalid baseline"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "baseline.json")
+			if err := os.WriteFile(path, tt.file(), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			baseline, err := LoadBaseline(path, public)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := DiffBaselines(testBaseline(), baseline); got.Changes() != 0 || baseline.Hostname != "web1" {
+				t.Errorf("loaded baseline differs from the signed one: %+v", got)
+			}
+		})
+	}
+}
+
+func TestDiffBaselines(t *testing.T) {
+	ports := func(diff []BaselinePort) []string {
+		var names []string
+		for _, port := range diff {
+			names = append(names, port.String())
+		}
+		return names
+	}
+
+	tests := []struct {
+		name        string
+		change      func(*Baseline)
+		wantAdded   []string
+		wantRemoved []string
+		wantChanges int
+	}{
+		{"unchanged", func(b *Baseline) {}, nil, nil, 0},
+		{
+			"port added",
+			func(b *Baseline) {
+				b.ListeningPorts = append(b.ListeningPorts, BaselinePort{Protocol: "UDP", Port: "53"})
+			},
+			[]string{"udp/53"}, nil, 1,
+		},
+		{
+			"port removed",
+			func(b *Baseline) { b.ListeningPorts = b.ListeningPorts[:1] },
+			nil, []string{"tcp/80 (nginx)"}, 1,
+		},
+		{
+			"process replaced on a port",
+			func(b *Baseline) { b.ListeningPorts[1].Process = "nc" },
+			[]string{"tcp/80 (nc)"}, []string{"tcp/80 (nginx)"}, 2,
+		},
+		{
+			"order does not matter",
+			func(b *Baseline) { slices.Reverse(b.ListeningPorts) },
+			nil, nil, 0,
+		},
+		{
+			"setuid binary and user drift",
+			func(b *Baseline) {
+				b.SetuidBinaries[0].SHA256 = "bb"
+				b.SetuidBinaries = append(b.SetuidBinaries, BaselineFile{Path: "/tmp/sh", Mode: "-rwsr-xr-x"})
+				b.Users[0].Shell = "/bin/sh"
+				b.Users = append(b.Users, BaselineUser{Name: "backdoor", UID: 0})
+				b.WorldWritable = []string{"/etc/cron.d"}
+			},
+			nil, nil, 5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after := testBaseline()
+			after.Hostname = "web2"
+			tt.change(&after)
+
+			diff := DiffBaselines(testBaseline(), after)
+			if got := ports(diff.AddedPorts); !slices.Equal(got, tt.wantAdded) {
+				t.Errorf("added ports = %v, want %v", got, tt.wantAdded)
+			}
+			if got := ports(diff.RemovedPorts); !slices.Equal(got, tt.wantRemoved) {
+				t.Errorf("removed ports = %v, want %v", got, tt.wantRemoved)
+			}
+			if diff.Changes() != tt.wantChanges {
+				t.Errorf("changes = %d, want %d: %+v", diff.Changes(), tt.wantChanges, diff)
+			}
+			if diff.BaselineHost != "web1" || diff.CurrentHost != "web2" {
+				t.Errorf("hosts = %s, %s", diff.BaselineHost, diff.CurrentHost)
+			}
+		})
+	}
+}
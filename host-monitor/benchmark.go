@@ -0,0 +1,587 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Benchmark profiles. Containers share the host kernel and mounts, so the
+// container profile leaves out sysctl, mount and audit checks.
+const (
+	ProfileHost      = "host"
+	ProfileContainer = "container"
+	ProfileAuto      = "auto"
+)
+
+// Check results.
+const (
+	BenchmarkPass          = "pass"
+	BenchmarkFail          = "fail"
+	BenchmarkNotApplicable = "not_applicable"
+	BenchmarkError         = "error"
+)
+
+// Check kinds, each reading one source:
+//
+//	sshd        setting Key in /etc/ssh/sshd_config (and Include files), Default when unset
+//	login_defs  setting Key in /etc/login.defs
+//	sysctl      /proc/sys value of Key, e.g. net.ipv4.ip_forward
+//	mount       mount point Key in /proc/mounts; Op "mounted" or "has" an option
+//	file_mode   file Key has no permission bits beyond Want and is owned by root
+//	exists      one of the comma separated paths in Key exists
+//	process     a process named Key is running
+//	shadow      no account in /etc/shadow has an empty password
+//	uid0        no account but root in /etc/passwd has UID 0
+const (
+	checkSSHD      = "sshd"
+	checkLoginDefs = "login_defs"
+	checkSysctl    = "sysctl"
+	checkMount     = "mount"
+	checkFileMode  = "file_mode"
+	checkExists    = "exists"
+	checkProcess   = "process"
+	checkShadow    = "shadow"
+	checkUID0      = "uid0"
+)
+
+// BenchmarkCheck is one declarative hardening check. Op is one of "=",
+// "in" (Want is a comma separated list), "<=", ">=", "mounted" or "has".
+type BenchmarkCheck struct {
+	ID          string
+	Section     string
+	Title       string
+	Profiles    []string
+	Kind        string
+	Key         string
+	Op          string
+	Want        string
+	Default     string
+	Remediation string
+}
+
+var bothProfiles = []string{ProfileHost, ProfileContainer}
+var hostProfile = []string{ProfileHost}
+
+// benchmarkChecks is the check library, loosely following the CIS
+// distribution independent Linux benchmark.
+var benchmarkChecks = []BenchmarkCheck{
+	{"1.1", "Filesystems", "/tmp is a separate mount", hostProfile, checkMount, "/tmp", "mounted", "", "",
+		"Mount /tmp as its own partition or tmpfs (systemctl enable tmp.mount)."},
+	{"1.2", "Filesystems", "/tmp is mounted nodev", hostProfile, checkMount, "/tmp", "has", "nodev", "",
+		"Add nodev to the /tmp options in /etc/fstab and remount."},
+	{"1.3", "Filesystems", "/tmp is mounted nosuid", hostProfile, checkMount, "/tmp", "has", "nosuid", "",
+		"Add nosuid to the /tmp options in /etc/fstab and remount."},
+	{"1.4", "Filesystems", "/tmp is mounted noexec", hostProfile, checkMount, "/tmp", "has", "noexec", "",
+		"Add noexec to the /tmp options in /etc/fstab and remount."},
+	{"1.5", "Filesystems", "/dev/shm is mounted nodev", hostProfile, checkMount, "/dev/shm", "has", "nodev", "",
+		"Add nodev to the /dev/shm options in /etc/fstab and remount."},
+	{"1.6", "Filesystems", "/dev/shm is mounted nosuid", hostProfile, checkMount, "/dev/shm", "has", "nosuid", "",
+		"Add nosuid to the /dev/shm options in /etc/fstab and remount."},
+	{"1.7", "Filesystems", "/dev/shm is mounted noexec", hostProfile, checkMount, "/dev/shm", "has", "noexec", "",
+		"Add noexec to the /dev/shm options in /etc/fstab and remount."},
+
+	{"2.1", "Kernel", "IP forwarding is disabled", hostProfile, checkSysctl, "net.ipv4.ip_forward", "=", "0", "",
+		"Set net.ipv4.ip_forward = 0 in /etc/sysctl.d/ unless the host routes traffic (Docker and Kubernetes nodes need it)."},
+	{"2.2", "Kernel", "ICMP redirects are not sent", hostProfile, checkSysctl, "net.ipv4.conf.all.send_redirects", "=", "0", "",
+		"Set net.ipv4.conf.all.send_redirects = 0 in /etc/sysctl.d/."},
+	{"2.3", "Kernel", "ICMP redirects are not accepted", hostProfile, checkSysctl, "net.ipv4.conf.all.accept_redirects", "=", "0", "",
+		"Set net.ipv4.conf.all.accept_redirects = 0 in /etc/sysctl.d/."},
+	{"2.4", "Kernel", "Source routed packets are not accepted", hostProfile, checkSysctl, "net.ipv4.conf.all.accept_source_route", "=", "0", "",
+		"Set net.ipv4.conf.all.accept_source_route = 0 in /etc/sysctl.d/."},
+	{"2.5", "Kernel", "Reverse path filtering is enabled", hostProfile, checkSysctl, "net.ipv4.conf.all.rp_filter", "in", "1,2", "",
+		"Set net.ipv4.conf.all.rp_filter = 1 in /etc/sysctl.d/."},
+	{"2.6", "Kernel", "TCP SYN cookies are enabled", hostProfile, checkSysctl, "net.ipv4.tcp_syncookies", "=", "1", "",
+		"Set net.ipv4.tcp_syncookies = 1 in /etc/sysctl.d/."},
+	{"2.7", "Kernel", "Broadcast ICMP requests are ignored", hostProfile, checkSysctl, "net.ipv4.icmp_echo_ignore_broadcasts", "=", "1", "",
+		"Set net.ipv4.icmp_echo_ignore_broadcasts = 1 in /etc/sysctl.d/."},
+	{"2.8", "Kernel", "Address space layout randomization is enabled", hostProfile, checkSysctl, "kernel.randomize_va_space", "=", "2", "",
+		"Set kernel.randomize_va_space = 2 in /etc/sysctl.d/."},
+	{"2.9", "Kernel", "Core dumps of setuid programs are disabled", hostProfile, checkSysctl, "fs.suid_dumpable", "=", "0", "",
+		"Set fs.suid_dumpable = 0 in /etc/sysctl.d/."},
+
+	{"3.1", "Auditing", "auditd is installed", hostProfile, checkExists, "/sbin/auditd,/usr/sbin/auditd", "", "", "",
+		"Install auditd (apt install auditd, dnf install audit or apk add audit)."},
+	{"3.2", "Auditing", "auditd is running", hostProfile, checkProcess, "auditd", "", "", "",
+		"Enable and start auditd: systemctl enable --now auditd."},
+
+	{"4.1", "Cron", "/etc/crontab is only accessible by root", bothProfiles, checkFileMode, "/etc/crontab", "", "0600", "",
+		"chown root:root /etc/crontab && chmod 600 /etc/crontab"},
+	{"4.2", "Cron", "/etc/cron.hourly is only accessible by root", bothProfiles, checkFileMode, "/etc/cron.hourly", "", "0700", "",
+		"chown root:root /etc/cron.hourly && chmod 700 /etc/cron.hourly"},
+	{"4.3", "Cron", "/etc/cron.daily is only accessible by root", bothProfiles, checkFileMode, "/etc/cron.daily", "", "0700", "",
+		"chown root:root /etc/cron.daily && chmod 700 /etc/cron.daily"},
+	{"4.4", "Cron", "/etc/cron.weekly is only accessible by root", bothProfiles, checkFileMode, "/etc/cron.weekly", "", "0700", "",
+		"chown root:root /etc/cron.weekly && chmod 700 /etc/cron.weekly"},
+	{"4.5", "Cron", "/etc/cron.monthly is only accessible by root", bothProfiles, checkFileMode, "/etc/cron.monthly", "", "0700", "",
+		"chown root:root /etc/cron.monthly && chmod 700 /etc/cron.monthly"},
+	{"4.6", "Cron", "/etc/cron.d is only accessible by root", bothProfiles, checkFileMode, "/etc/cron.d", "", "0700", "",
+		"chown root:root /etc/cron.d && chmod 700 /etc/cron.d"},
+
+	{"5.1", "SSH", "sshd_config is only accessible by root", bothProfiles, checkFileMode, "/etc/ssh/sshd_config", "", "0600", "",
+		"chown root:root /etc/ssh/sshd_config && chmod 600 /etc/ssh/sshd_config"},
+	{"5.2", "SSH", "Root login is disabled", bothProfiles, checkSSHD, "PermitRootLogin", "=", "no", "prohibit-password",
+		"Set PermitRootLogin no in /etc/ssh/sshd_config."},
+	{"5.3", "SSH", "Password authentication is disabled", bothProfiles, checkSSHD, "PasswordAuthentication", "=", "no", "yes",
+		"Set PasswordAuthentication no in /etc/ssh/sshd_config and use keys."},
+	{"5.4", "SSH", "Empty passwords are not permitted", bothProfiles, checkSSHD, "PermitEmptyPasswords", "=", "no", "no",
+		"Set PermitEmptyPasswords no in /etc/ssh/sshd_config."},
+	{"5.5", "SSH", "X11 forwarding is disabled", bothProfiles, checkSSHD, "X11Forwarding", "=", "no", "no",
+		"Set X11Forwarding no in /etc/ssh/sshd_config."},
+	{"5.6", "SSH", "MaxAuthTries is 4 or less", bothProfiles, checkSSHD, "MaxAuthTries", "<=", "4", "6",
+		"Set MaxAuthTries 4 in /etc/ssh/sshd_config."},
+	{"5.7", "SSH", "rhosts files are ignored", bothProfiles, checkSSHD, "IgnoreRhosts", "=", "yes", "yes",
+		"Set IgnoreRhosts yes in /etc/ssh/sshd_config."},
+	{"5.8", "SSH", "Host based authentication is disabled", bothProfiles, checkSSHD, "HostbasedAuthentication", "=", "no", "no",
+		"Set HostbasedAuthentication no in /etc/ssh/sshd_config."},
+
+	{"6.1", "Password policy", "Passwords expire within 365 days", bothProfiles, checkLoginDefs, "PASS_MAX_DAYS", "<=", "365", "99999",
+		"Set PASS_MAX_DAYS 365 in /etc/login.defs and chage --maxdays 365 for existing users."},
+	{"6.2", "Password policy", "Passwords can be changed at most once a day", bothProfiles, checkLoginDefs, "PASS_MIN_DAYS", ">=", "1", "0",
+		"Set PASS_MIN_DAYS 1 in /etc/login.defs."},
+	{"6.3", "Password policy", "Users are warned 7 days before expiry", bothProfiles, checkLoginDefs, "PASS_WARN_AGE", ">=", "7", "7",
+		"Set PASS_WARN_AGE 7 in /etc/login.defs."},
+	{"6.4", "Password policy", "Passwords are hashed with SHA-512 or yescrypt", bothProfiles, checkLoginDefs, "ENCRYPT_METHOD", "in", "SHA512,YESCRYPT", "",
+		"Set ENCRYPT_METHOD SHA512 (or YESCRYPT) in /etc/login.defs."},
+
+	{"7.1", "Accounts", "No account has an empty password", bothProfiles, checkShadow, "/etc/shadow", "", "", "",
+		"Lock the accounts (passwd -l <user>) or set a password."},
+	{"7.2", "Accounts", "Only root has UID 0", bothProfiles, checkUID0, "/etc/passwd", "", "", "",
+		"Give the other accounts their own UID or remove them."},
+	{"7.3", "Accounts", "/etc/passwd is not writable by group or others", bothProfiles, checkFileMode, "/etc/passwd", "", "0644", "",
+		"chown root:root /etc/passwd && chmod 644 /etc/passwd"},
+	{"7.4", "Accounts", "/etc/shadow is not readable by others", bothProfiles, checkFileMode, "/etc/shadow", "", "0640", "",
+		"chown root:shadow /etc/shadow && chmod 640 /etc/shadow"},
+	{"7.5", "Accounts", "/etc/group is not writable by group or others", bothProfiles, checkFileMode, "/etc/group", "", "0644", "",
+		"chown root:root /etc/group && chmod 644 /etc/group"},
+}
+
+// BenchmarkConfig is the "benchmark" section of the collector config.
+type BenchmarkConfig struct {
+	Profile string   `json:"profile"`
+	Skip    []string `json:"skip"`
+}
+
+type BenchmarkResult struct {
+	ID          string `json:"id"`
+	Section     string `json:"section"`
+	Title       string `json:"title"`
+	Status      string `json:"status"`
+	Expected    string `json:"expected,omitempty"`
+	Actual      string `json:"actual,omitempty"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+type BenchmarkReport struct {
+	Profile       string            `json:"profile"`
+	Passed        int               `json:"passed"`
+	Failed        int               `json:"failed"`
+	NotApplicable int               `json:"not_applicable"`
+	Errors        int               `json:"errors"`
+	Score         int               `json:"score"`
+	Results       []BenchmarkResult `json:"results"`
+}
+
+type Benchmark struct {
+	host    *Host
+	profile string
+	skip    []string
+	mounts  map[string][]string
+}
+
+func NewBenchmark() *Benchmark {
+	return &Benchmark{host: LocalHost(), profile: ProfileAuto}
+}
+
+// SetHost points the Benchmark at another filesystem root or command runner.
+func (b *Benchmark) SetHost(host *Host) {
+	b.host = host
+}
+
+// Configure sets the profile and the check IDs or sections to skip.
+func (b *Benchmark) Configure(config BenchmarkConfig) {
+	if config.Profile != "" {
+		b.profile = config.Profile
+	}
+	b.skip = config.Skip
+}
+
+// DetectProfile guesses whether the root is a container from the marker
+// files container runtimes create and the cgroup of PID 1.
+func (b *Benchmark) DetectProfile() string {
+	for _, marker := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := b.host.Stat(marker); err == nil {
+			return ProfileContainer
+		}
+	}
+	cgroup := b.host.readTrimmed("/proc/1/cgroup")
+	for _, runtime := range []string{"docker", "kubepods", "containerd", "lxc", "libpod"} {
+		if strings.Contains(cgroup, runtime) {
+			return ProfileContainer
+		}
+	}
+	return ProfileHost
+}
+
+// RunBenchmark evaluates every check of the profile.
+func (b *Benchmark) RunBenchmark() BenchmarkReport {
+	profile := b.profile
+	if profile == "" || profile == ProfileAuto {
+		profile = b.DetectProfile()
+	}
+
+	report := BenchmarkReport{Profile: profile, Results: []BenchmarkResult{}}
+	b.mounts = nil
+	for _, check := range benchmarkChecks {
+		if !hasString(check.Profiles, profile) || hasString(b.skip, check.ID) || hasString(b.skip, check.Section) {
+			continue
+		}
+
+		result := BenchmarkResult{ID: check.ID, Section: check.Section, Title: check.Title}
+		result.Status, result.Expected, result.Actual = b.evaluate(check)
+		if result.Status == BenchmarkFail {
+			result.Remediation = check.Remediation
+		}
+
+		switch result.Status {
+		case BenchmarkPass:
+			report.Passed++
+		case BenchmarkFail:
+			report.Failed++
+		case BenchmarkNotApplicable:
+			report.NotApplicable++
+		default:
+			report.Errors++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	if total := report.Passed + report.Failed; total > 0 {
+		report.Score = report.Passed * 100 / total
+	}
+	return report
+}
+
+// evaluate returns the status, the expected value and what was found.
+func (b *Benchmark) evaluate(check BenchmarkCheck) (string, string, string) {
+	switch check.Kind {
+	case checkSSHD:
+		settings, err := b.sshdSettings()
+		if err != nil {
+			return readResult(err)
+		}
+		value, ok := settings[strings.ToLower(check.Key)]
+		if !ok {
+			value = check.Default
+		}
+		return compareSetting(check, value)
+
+	case checkLoginDefs:
+		settings, err := b.keyValues("/etc/login.defs")
+		if err != nil {
+			return readResult(err)
+		}
+		value, ok := settings[check.Key]
+		if !ok {
+			value = check.Default
+		}
+		return compareSetting(check, value)
+
+	case checkSysctl:
+		path := "/proc/sys/" + strings.ReplaceAll(check.Key, ".", "/")
+		data, err := b.host.ReadFile(path)
+		if err != nil {
+			return readResult(err)
+		}
+		return compareSetting(check, strings.Join(strings.Fields(string(data)), " "))
+
+	case checkMount:
+		options, mounted := b.mountOptions()[check.Key]
+		if check.Op == "mounted" {
+			if mounted {
+				return BenchmarkPass, "separate mount", strings.Join(options, ",")
+			}
+			return BenchmarkFail, "separate mount", "not mounted"
+		}
+		if !mounted {
+			return BenchmarkNotApplicable, check.Want, "not mounted"
+		}
+		if hasString(options, check.Want) {
+			return BenchmarkPass, check.Want, strings.Join(options, ",")
+		}
+		return BenchmarkFail, check.Want, strings.Join(options, ",")
+
+	case checkFileMode:
+		return b.checkFileMode(check)
+
+	case checkExists:
+		for _, path := range strings.Split(check.Key, ",") {
+			if _, err := b.host.Stat(path); err == nil {
+				return BenchmarkPass, "installed", path
+			}
+		}
+		return BenchmarkFail, "installed", "not found"
+
+	case checkProcess:
+		processes, err := b.host.readProcesses()
+		if err != nil {
+			return BenchmarkError, "running", err.Error()
+		}
+		for _, process := range processes {
+			if process.Name == check.Key {
+				return BenchmarkPass, "running", fmt.Sprintf("pid %d", process.PID)
+			}
+		}
+		return BenchmarkFail, "running", "not running"
+
+	case checkShadow:
+		return b.accountCheck(check.Key, 2, func(fields []string) bool { return fields[1] == "" })
+
+	case checkUID0:
+		return b.accountCheck(check.Key, 3, func(fields []string) bool { return fields[2] == "0" && fields[0] != "root" })
+	}
+
+	return BenchmarkError, "", "unknown check kind " + check.Kind
+}
+
+// readResult maps a read error to not applicable (the file or setting does
+// not exist here) or error (it exists but cannot be read).
+func readResult(err error) (string, string, string) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return BenchmarkNotApplicable, "", "not present"
+	case errors.Is(err, fs.ErrPermission):
+		return BenchmarkError, "", "permission denied, run as root"
+	}
+	return BenchmarkError, "", err.Error()
+}
+
+func compareSetting(check BenchmarkCheck, value string) (string, string, string) {
+	expected := check.Op + " " + check.Want
+	if value == "" {
+		return BenchmarkFail, expected, "not set"
+	}
+
+	pass := false
+	switch check.Op {
+	case "=":
+		pass = strings.EqualFold(value, check.Want)
+	case "in":
+		for _, want := range strings.Split(check.Want, ",") {
+			pass = pass || strings.EqualFold(value, want)
+		}
+	case "<=", ">=":
+		have, err := strconv.Atoi(value)
+		want, _ := strconv.Atoi(check.Want)
+		if err != nil {
+			return BenchmarkFail, expected, value
+		}
+		pass = (check.Op == "<=" && have <= want) || (check.Op == ">=" && have >= want)
+	}
+
+	if pass {
+		return BenchmarkPass, expected, value
+	}
+	return BenchmarkFail, expected, value
+}
+
+// sshdSettings reads sshd_config with its Include files. Like sshd, the
+// first value of a keyword wins. Match blocks are skipped, they only apply
+// to some connections.
+func (b *Benchmark) sshdSettings() (map[string]string, error) {
+	settings := make(map[string]string)
+	if err := b.readSSHDConfig("/etc/ssh/sshd_config", settings, 0); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func (b *Benchmark) readSSHDConfig(path string, settings map[string]string, depth int) error {
+	file, err := b.host.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(strings.ReplaceAll(scanner.Text(), "=", " "))
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		keyword := strings.ToLower(fields[0])
+		if keyword == "match" {
+			break
+		}
+		if keyword == "include" && depth < 4 {
+			for _, pattern := range fields[1:] {
+				if !strings.HasPrefix(pattern, "/") {
+					pattern = "/etc/ssh/" + pattern
+				}
+				matches, _ := b.host.Glob(pattern)
+				sort.Strings(matches)
+				for _, match := range matches {
+					b.readSSHDConfig(match, settings, depth+1)
+				}
+			}
+			continue
+		}
+		if _, ok := settings[keyword]; !ok {
+			settings[keyword] = fields[1]
+		}
+	}
+	return nil
+}
+
+// keyValues reads a "KEY value" file such as /etc/login.defs.
+func (b *Benchmark) keyValues(path string) (map[string]string, error) {
+	file, err := b.host.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && !strings.HasPrefix(fields[0], "#") {
+			values[fields[0]] = fields[1]
+		}
+	}
+	return values, nil
+}
+
+// mountOptions maps mount points to their options. Later mounts hide
+// earlier ones on the same point, so the last entry wins.
+func (b *Benchmark) mountOptions() map[string][]string {
+	if b.mounts != nil {
+		return b.mounts
+	}
+	b.mounts = make(map[string][]string)
+
+	data, err := b.host.ReadFile("/proc/mounts")
+	if err != nil {
+		return b.mounts
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		// device mountpoint type options dump pass
+		fields := strings.Fields(line)
+		if len(fields) >= 4 {
+			b.mounts[fields[1]] = strings.Split(fields[3], ",")
+		}
+	}
+	return b.mounts
+}
+
+// checkFileMode fails when the file has permission bits beyond the wanted
+// mode or is not owned by root. Ownership is only checked on the live host:
+// fixtures and copied trees do not keep it.
+func (b *Benchmark) checkFileMode(check BenchmarkCheck) (string, string, string) {
+	info, err := b.host.Stat(check.Key)
+	if err != nil {
+		return readResult(err)
+	}
+
+	want, _ := strconv.ParseUint(check.Want, 8, 32)
+	mode := info.Mode().Perm()
+	expected := fmt.Sprintf("mode %s or stricter", check.Want)
+	actual := fmt.Sprintf("mode %04o", mode)
+	pass := uint64(mode)&^want == 0
+
+	if uid, gid, ok := fileOwner(info); ok && b.host.Live() {
+		expected += ", owner root"
+		actual += fmt.Sprintf(", owner %d:%d", uid, gid)
+		pass = pass && uid == 0
+	}
+
+	if pass {
+		return BenchmarkPass, expected, actual
+	}
+	return BenchmarkFail, expected, actual
+}
+
+// accountCheck fails when match is true for an account in a colon
+// separated file, listing the accounts.
+func (b *Benchmark) accountCheck(path string, minFields int, match func([]string) bool) (string, string, string) {
+	data, err := b.host.ReadFile(path)
+	if err != nil {
+		return readResult(err)
+	}
+
+	var accounts []string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) > minFields && !strings.HasPrefix(line, "#") && match(fields) {
+			accounts = append(accounts, fields[0])
+		}
+	}
+	if len(accounts) > 0 {
+		return BenchmarkFail, "none", strings.Join(accounts, ", ")
+	}
+	return BenchmarkPass, "none", "none"
+}
+
+func (b *Benchmark) PrintBenchmarkReport() {
+	b.printBenchmarkReport(b.RunBenchmark())
+}
+
+// printBenchmarkReport writes the text report for an already collected result.
+func (b *Benchmark) printBenchmarkReport(report BenchmarkReport) {
+	fmt.Println("=== HARDENING BENCHMARK ===")
+	fmt.Printf("Profile: %s\n", report.Profile)
+	fmt.Println("==========================================")
+
+	section := ""
+	for _, result := range report.Results {
+		if result.Section != section {
+			section = result.Section
+			fmt.Printf("\n%s\n%s\n", strings.ToUpper(section), strings.Repeat("-", len(section)))
+		}
+
+		icon := "✅"
+		switch result.Status {
+		case BenchmarkFail:
+			icon = "❌"
+		case BenchmarkNotApplicable:
+			icon = "➖"
+		case BenchmarkError:
+			icon = "⚠️ "
+		}
+		fmt.Printf("  %s %-4s %s", icon, result.ID, result.Title)
+		if result.Actual != "" && result.Status != BenchmarkPass {
+			fmt.Printf(" (%s)", result.Actual)
+		}
+		fmt.Println()
+		if result.Remediation != "" {
+			fmt.Printf("         → %s\n", result.Remediation)
+		}
+	}
+
+	fmt.Printf("\n📊 Score: %d%% - %d passed, %d failed, %d not applicable, %d errors\n",
+		report.Score, report.Passed, report.Failed, report.NotApplicable, report.Errors)
+}
+
+// validateBenchmarkConfig rejects unknown profiles and skip entries.
+func validateBenchmarkConfig(config BenchmarkConfig) error {
+	switch config.Profile {
+	case "", ProfileAuto, ProfileHost, ProfileContainer:
+	default:
+		return fmt.Errorf("unknown benchmark profile %q (use auto, host or container)", config.Profile)
+	}
+
+	for _, skip := range config.Skip {
+		known := false
+		for _, check := range benchmarkChecks {
+			known = known || check.ID == skip || check.Section == skip
+		}
+		if !known {
+			return fmt.Errorf("benchmark skip: unknown check or section %q", skip)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage:
+  host-monitor [--format text|json|yaml] [--sample 1s] [--config file]
+               [--root /] [--commands dir]
+      Interactive menu.
+
+  host-monitor run [--modules all|system,security,benchmark,accounts,performance,network,packages]
+                   [--format text|json|yaml|sarif] [--interval 10s] [--count 1] [--sample 1s]
+                   [--config file] [--root /] [--commands dir]
+      Run modules without a terminal, e.g. from cron, systemd or an agent.
+      Aliases: sys, sec, bench, users, perf, net, pkg. --count 0 repeats until interrupted.
+      Exits 1 when a collector fails or times out. sarif writes the security
+      findings as SARIF 2.1.0.
+
+  host-monitor serve [--listen :9100] [--modules performance,network,packages,security]
+                     [--interval 30s] [--sample 1s] [--config file] [--root /] [--commands dir]
+      Expose the latest results as Prometheus / OpenMetrics on /metrics.
+
+  host-monitor watch [--interval 5s] [--windows 1m,5m,1h] [--report 1m] [--duration 0]
+                     [--capacity 0] [--persist file.jsonl] [--format text|json|yaml]
+                     [--root /] [--commands dir]
+      Sample CPU, load, memory, disk and bandwidth into a ring buffer and print
+      min/avg/max/p95 per window. --persist keeps samples across restarts.
+
+  host-monitor alert --rules file [--state file] [--interval 1m] [--count 0] [--check]
+                     [--sample 1s] [--config file] [--root /] [--commands dir]
+      Evaluate alert rules against the collectors they need and notify sinks.
+
+  host-monitor baseline keygen [--key /etc/host-monitor/baseline.key]
+  host-monitor baseline save [--file path] [--key file] [--root /] [--commands dir]
+  host-monitor baseline diff [--file path] [--pub file] [--against other.json]
+                             [--format text|json|yaml] [--root /] [--commands dir]
+      Record a signed snapshot of listening ports, setuid binaries, users and
+      /etc permissions, and report drift from it. diff exits 1 on drift.
+
+  host-monitor fim init|check|watch [--db file] [--paths /etc,/usr/bin] [--exclude patterns]
+                                    [--update] [--format text|json|yaml] [--config file]
+                                    [--root /] [--commands dir]
+      Hash files (SHA-256, mode, owner, size, xattrs) into a per-host database and
+      report added, removed and changed files. watch uses inotify (Linux).
+      check exits 1 when files changed.
+
+  host-monitor auth [--since 24h] [--until time] [--type ssh_failure,sudo] [--user name]
+                    [--threshold 5] [--window 10m] [--limit 50] [--log files | --journal file|-]
+                    [--format text|json|yaml] [--root /] [--commands dir]
+      Parse auth.log/secure (or journalctl -o export output) into SSH, sudo, su and
+      login events and detect brute force. Exits 1 when brute force was found.
+
+  host-monitor accounts [--state file] [--update] [--format text|json|yaml] [--root /] [--commands dir]
+      Audit passwd, shadow, group and sudoers: UID 0, login shells, password age,
+      locked/expired accounts and sudo users. Reports changes since the saved
+      state and exits 1 when accounts changed; --update saves the state.
+
+  host-monitor vulns import [--db file] [--all] osv-dir|osv.zip|tracker.json...
+  host-monitor vulns check [--db file] [--severity low] [--format text|json|yaml]
+                           [--config file] [--root /] [--commands dir]
+      Import OSV or Debian security tracker JSON dumps into a local database
+      (only this host's release unless --all) and match installed packages
+      against it with the package manager's version ordering. check exits 1
+      when a package is vulnerable.
+
+  host-monitor sbom [--format cyclonedx|spdx] [--output file] [--config file]
+                    [--root /] [--commands dir]
+      Write the installed packages as a CycloneDX 1.5 or SPDX 2.3 JSON SBOM
+      with package URLs, versions, architectures and the host's OS.
+
+  --root reads /proc, /sys, /etc and /var below another directory and runs no
+  tools unless --commands points at captured output (see testdata/README.md).
+
+  Config file (JSON):
+      {"default_timeout": "2m", "high_cpu_percent": 50,
+       "collectors": {"security": {"enabled": false}, "packages": {"timeout": "5m"}},
+       "fim": {"paths": ["/etc", "/usr/bin"], "exclude": ["*.swp"]},
+       "suppressions": [{"id": "HM008", "reason": "behind the load balancer", "expires": "2027-01-31"}],
+       "benchmark": {"profile": "auto", "skip": ["Auditing", "2.1"]},
+       "listeners": [{"name": "base", "expected": [{"port": "22", "process": "sshd"}]}],
+       "vulnerabilities": {"database": "/var/lib/host-monitor/vulns/db.json"}}
+`)
+}
+
+// runCommand implements "host-monitor run" and returns the exit code.
+func runCommand(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.Usage = usage
+	moduleList := fs.String("modules", "all", "Comma separated modules to run")
+	format := fs.String("format", formatText, "Report format: text, json, yaml or sarif (security findings)")
+	interval := fs.Duration("interval", 10*time.Second, "Time between runs when --count is not 1")
+	count := fs.Int("count", 1, "Number of runs, 0 repeats until interrupted")
+	configPath := fs.String("config", "", "Collector config file (JSON)")
+	sample := fs.Duration("sample", defaultSampleInterval, "CPU and bandwidth sampling window, 0 for averages since boot")
+	applyHost := hostFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if !validFormat(*format) && *format != formatSARIF {
+		fmt.Fprintf(os.Stderr, "❌ Unknown format %q (use text, json, yaml or sarif)\n", *format)
+		return 2
+	}
+	if *count < 0 || *interval <= 0 {
+		fmt.Fprintln(os.Stderr, "❌ --count must be >= 0 and --interval > 0")
+		return 2
+	}
+
+	registry, err := newConfiguredRegistry(applyHost(), *sample, *configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+
+	selected, err := registry.Select(*moduleList)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	warnPrivileges(selected)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	failed := false
+
+	for i := 0; *count == 0 || i < *count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				if failed {
+					return 1
+				}
+				return 0
+			case <-time.After(*interval):
+			}
+		}
+		results := registry.Run(ctx, selected)
+		for _, result := range results {
+			failed = failed || result.Incomplete() != nil
+		}
+		writeResults(registry.Settings(), *format, results)
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// runCollectors collects once and writes the results on stdout.
+func runCollectors(registry *Registry, format string, collectors []Collector) {
+	warnPrivileges(collectors)
+	writeResults(registry.Settings(), format, registry.Run(context.Background(), collectors))
+}
+
+// writeResults prints collected results as text reports or structured
+// documents on stdout.
+func writeResults(settings Settings, format string, results []CollectorResult) {
+	for _, result := range results {
+		if err := result.Incomplete(); err != nil && result.Err == nil {
+			fmt.Fprintf(os.Stderr, "⚠️  %s is incomplete: %v\n", result.Collector.Title(), err)
+		}
+	}
+	if format == formatSARIF {
+		if err := writeSARIF(os.Stdout, results); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Failed to write SARIF: %v\n", err)
+		}
+		return
+	}
+	if format != formatText {
+		for _, result := range results {
+			report := NewReport(result.Collector.Name(), settings.Host.Hostname(), result.Data)
+			if result.Err != nil {
+				report.Error = result.Err.Error()
+			}
+			if err := WriteReport(os.Stdout, format, report); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ Failed to write %s report: %v\n", result.Collector.Name(), err)
+			}
+		}
+		return
+	}
+
+	if len(results) == 1 {
+		fmt.Println("\n" + strings.Repeat("=", 50))
+		printResult(settings, results[0])
+		fmt.Println(strings.Repeat("=", 50) + "\n")
+		return
+	}
+
+	fmt.Println("\n" + strings.Repeat("=", 50))
+	fmt.Println("RUNNING ALL MODULES")
+	fmt.Println(strings.Repeat("=", 50))
+
+	for i, result := range results {
+		fmt.Printf("\n%d. %s\n", i+1, strings.ToUpper(result.Collector.Title()))
+		printResult(settings, result)
+	}
+
+	fmt.Println("\n" + strings.Repeat("=", 50))
+	fmt.Println("ALL MODULES COMPLETED")
+	fmt.Println(strings.Repeat("=", 50) + "\n")
+}
+
+func printResult(settings Settings, result CollectorResult) {
+	if result.Err != nil {
+		fmt.Printf("❌ %s failed: %v\n", result.Collector.Title(), result.Err)
+		return
+	}
+	result.Collector.PrintReport(settings, result.Data)
+}
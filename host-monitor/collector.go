@@ -0,0 +1,552 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Capabilities describe how a collector behaves, so callers can pick
+// collectors without knowing them.
+const (
+	CapabilityMetrics  = "metrics"  // exported by host-monitor serve
+	CapabilitySampling = "sampling" // blocks for the sample interval
+	CapabilitySlow     = "slow"     // scans filesystems or package databases
+)
+
+// PrivilegeRoot marks collectors that return incomplete results without root.
+const PrivilegeRoot = "root"
+
+const defaultCollectorTimeout = 2 * time.Minute
+
+// Collector is one host-monitor module.
+type Collector interface {
+	Name() string
+	Title() string
+	Aliases() []string
+	Capabilities() []string
+	Privileges() []string
+	// Collect returns the module's result struct, e.g. PerformanceInfo.
+	Collect(ctx context.Context, settings Settings) (interface{}, error)
+	// PrintReport writes the text report for a result of Collect.
+	PrintReport(settings Settings, data interface{})
+}
+
+// moduleCollector adapts a module's typed collect and print functions.
+type moduleCollector[T any] struct {
+	name         string
+	title        string
+	aliases      []string
+	capabilities []string
+	privileges   []string
+	collect      func(ctx context.Context, settings Settings) T
+	print        func(settings Settings, data T)
+}
+
+func (c *moduleCollector[T]) Name() string           { return c.name }
+func (c *moduleCollector[T]) Title() string          { return c.title }
+func (c *moduleCollector[T]) Aliases() []string      { return c.aliases }
+func (c *moduleCollector[T]) Capabilities() []string { return c.capabilities }
+func (c *moduleCollector[T]) Privileges() []string   { return c.privileges }
+
+func (c *moduleCollector[T]) Collect(ctx context.Context, settings Settings) (interface{}, error) {
+	return c.collect(ctx, settings), nil
+}
+
+func (c *moduleCollector[T]) PrintReport(settings Settings, data interface{}) {
+	if typed, ok := data.(T); ok {
+		c.print(settings, typed)
+	}
+}
+
+func hasString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// CollectorResult is the outcome of running one collector.
+type CollectorResult struct {
+	Collector Collector
+	Data      interface{}
+	Err       error
+	Duration  time.Duration
+	Collected time.Time
+}
+
+// partialResult is implemented by result structs that can be collected
+// with a part missing, such as packages without a readable vulnerability
+// database.
+type partialResult interface {
+	partialError() error
+}
+
+// Incomplete is the collector error, or else why part of the result is
+// missing. run exits 1 for either.
+func (r CollectorResult) Incomplete() error {
+	if r.Err != nil {
+		return r.Err
+	}
+	if partial, ok := r.Data.(partialResult); ok {
+		return partial.partialError()
+	}
+	return nil
+}
+
+// CollectorConfig enables, disables and limits collectors. It is read from
+// the JSON file given with --config:
+//
+//	{"default_timeout": "2m", "high_cpu_percent": 80, "collectors": {"security": {"enabled": false}}}
+type CollectorConfig struct {
+	DefaultTimeout  configDuration              `json:"default_timeout"`
+	HighCPUPercent  float64                     `json:"high_cpu_percent"`
+	Collectors      map[string]CollectorSetting `json:"collectors"`
+	FIM             FIMConfig                   `json:"fim"`
+	Suppressions    []Suppression               `json:"suppressions"`
+	Benchmark       BenchmarkConfig             `json:"benchmark"`
+	Listeners       []ListenerPolicy            `json:"listeners"`
+	Vulnerabilities VulnConfig                  `json:"vulnerabilities"`
+}
+
+type CollectorSetting struct {
+	Enabled *bool          `json:"enabled"`
+	Timeout configDuration `json:"timeout"`
+}
+
+// Settings configure the built-in collectors: the host they inspect, the
+// sampling window set by --sample and the module sections of the config
+// file. A Registry passes its settings to every collector it runs.
+type Settings struct {
+	Host            *Host
+	SampleInterval  time.Duration
+	HighCPUPercent  float64
+	Suppressions    []Suppression
+	Benchmark       BenchmarkConfig
+	Listeners       []ListenerPolicy
+	Vulnerabilities VulnConfig
+}
+
+func DefaultSettings(host *Host) Settings {
+	return Settings{
+		Host:           host,
+		SampleInterval: defaultSampleInterval,
+		HighCPUPercent: defaultHighCPUPercent,
+	}
+}
+
+// WithContext returns the settings with the host bound to ctx, see
+// Host.WithContext.
+func (s Settings) WithContext(ctx context.Context) Settings {
+	s.Host = s.Host.WithContext(ctx)
+	return s
+}
+
+func (s Settings) hostMonitor() *HostMonitor {
+	hm := NewHostMonitor()
+	hm.SetHost(s.Host)
+	return hm
+}
+
+func (s Settings) securityScanner() *SecurityScanner {
+	ss := NewSecurityScanner()
+	ss.SetHost(s.Host)
+	ss.SetHighCPUThreshold(s.HighCPUPercent)
+	ss.SetSuppressions(s.Suppressions)
+	ss.SetListenerPolicies(s.Listeners)
+	return ss
+}
+
+func (s Settings) benchmark() *Benchmark {
+	b := NewBenchmark()
+	b.SetHost(s.Host)
+	b.Configure(s.Benchmark)
+	return b
+}
+
+func (s Settings) accountAuditor() *AccountAuditor {
+	aa := NewAccountAuditor()
+	aa.SetHost(s.Host)
+	return aa
+}
+
+func (s Settings) performanceMonitor() *PerformanceMonitor {
+	pm := NewPerformanceMonitor()
+	pm.SetHost(s.Host)
+	pm.SetSampleInterval(s.SampleInterval)
+	return pm
+}
+
+func (s Settings) networkAnalyzer() *NetworkAnalyzer {
+	na := NewNetworkAnalyzer()
+	na.SetHost(s.Host)
+	na.SetSampleInterval(s.SampleInterval)
+	return na
+}
+
+func (s Settings) packageManager() *PackageManager {
+	pm := NewPackageManager()
+	pm.SetHost(s.Host)
+	pm.SetVulnDatabase(vulnDatabasePath(s.Vulnerabilities, s.Host))
+	return pm
+}
+
+// configDuration accepts "30s" style strings in JSON.
+type configDuration time.Duration
+
+func (d *configDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %v", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = configDuration(parsed)
+	return nil
+}
+
+func LoadCollectorConfig(path string) (CollectorConfig, error) {
+	var config CollectorConfig
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("invalid config %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// Registry holds the known collectors in registration order.
+type Registry struct {
+	mu             sync.RWMutex
+	collectors     []Collector
+	disabled       map[string]bool
+	timeouts       map[string]time.Duration
+	defaultTimeout time.Duration
+	settings       Settings
+}
+
+// NewRegistry returns an empty registry whose collectors inspect the local
+// host with the default settings.
+func NewRegistry() *Registry {
+	return &Registry{
+		disabled:       make(map[string]bool),
+		timeouts:       make(map[string]time.Duration),
+		defaultTimeout: defaultCollectorTimeout,
+		settings:       DefaultSettings(LocalHost()),
+	}
+}
+
+// SetHost points the collectors at another host, e.g. from --root.
+func (r *Registry) SetHost(host *Host) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.settings.Host = host
+}
+
+// SetSampleInterval sets the CPU and bandwidth sampling window. Zero
+// reports averages since boot.
+func (r *Registry) SetSampleInterval(interval time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.settings.SampleInterval = interval
+}
+
+// Settings returns what the collectors run with.
+func (r *Registry) Settings() Settings {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.settings
+}
+
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// Configure applies a config file. Unknown collector names are an error so
+// typos do not silently leave a collector enabled; invalid module sections
+// leave the registry unchanged.
+func (r *Registry) Configure(config CollectorConfig) error {
+	for name := range config.Collectors {
+		if _, ok := r.Lookup(name); !ok {
+			return fmt.Errorf("unknown collector %q in config", name)
+		}
+	}
+	if err := validateSuppressions(config.Suppressions); err != nil {
+		return err
+	}
+	if err := validateBenchmarkConfig(config.Benchmark); err != nil {
+		return err
+	}
+	if err := validateListenerPolicies(config.Listeners); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if config.HighCPUPercent > 0 {
+		r.settings.HighCPUPercent = config.HighCPUPercent
+	}
+	r.settings.Suppressions = config.Suppressions
+	r.settings.Benchmark = config.Benchmark
+	r.settings.Listeners = config.Listeners
+	r.settings.Vulnerabilities = config.Vulnerabilities
+
+	if config.DefaultTimeout > 0 {
+		r.defaultTimeout = time.Duration(config.DefaultTimeout)
+	}
+	for _, c := range r.collectors {
+		setting, ok := config.Collectors[c.Name()]
+		if !ok {
+			continue
+		}
+		if setting.Enabled != nil {
+			r.disabled[c.Name()] = !*setting.Enabled
+		}
+		if setting.Timeout > 0 {
+			r.timeouts[c.Name()] = time.Duration(setting.Timeout)
+		}
+	}
+	return nil
+}
+
+// Collectors returns every registered collector, enabled or not.
+func (r *Registry) Collectors() []Collector {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Collector(nil), r.collectors...)
+}
+
+func (r *Registry) Enabled() []Collector {
+	var enabled []Collector
+	for _, c := range r.Collectors() {
+		if r.IsEnabled(c) {
+			enabled = append(enabled, c)
+		}
+	}
+	return enabled
+}
+
+func (r *Registry) IsEnabled(c Collector) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !r.disabled[c.Name()]
+}
+
+// WithCapability returns the enabled collectors that have capability.
+func (r *Registry) WithCapability(capability string) []Collector {
+	var matching []Collector
+	for _, c := range r.Enabled() {
+		if hasString(c.Capabilities(), capability) {
+			matching = append(matching, c)
+		}
+	}
+	return matching
+}
+
+// Lookup finds a collector by name or alias.
+func (r *Registry) Lookup(name string) (Collector, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, c := range r.Collectors() {
+		if c.Name() == name || hasString(c.Aliases(), name) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// Select resolves a comma separated list of names or aliases. "all" means
+// every enabled collector; naming a disabled collector is an error.
+func (r *Registry) Select(list string) ([]Collector, error) {
+	if strings.TrimSpace(list) == "all" {
+		return r.Enabled(), nil
+	}
+
+	var selected []Collector
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+
+		c, ok := r.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown module %q", strings.TrimSpace(name))
+		}
+		if !r.IsEnabled(c) {
+			return nil, fmt.Errorf("module %q is disabled by config", c.Name())
+		}
+		if !seen[c.Name()] {
+			seen[c.Name()] = true
+			selected = append(selected, c)
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no modules selected")
+	}
+	return selected, nil
+}
+
+func (r *Registry) timeout(c Collector) time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if timeout, ok := r.timeouts[c.Name()]; ok {
+		return timeout
+	}
+	return r.defaultTimeout
+}
+
+// Run collects concurrently with the registry's settings, each collector
+// under its own timeout. Results keep the order of collectors. A collector
+// that times out gets a cancelled context, which kills its tools and stops
+// its walks; its result is discarded.
+func (r *Registry) Run(ctx context.Context, collectors []Collector) []CollectorResult {
+	results := make([]CollectorResult, len(collectors))
+
+	var wg sync.WaitGroup
+	for i, c := range collectors {
+		wg.Add(1)
+		go func(i int, c Collector) {
+			defer wg.Done()
+			results[i] = r.runOne(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func (r *Registry) runOne(ctx context.Context, c Collector) CollectorResult {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout(c))
+	defer cancel()
+
+	start := time.Now()
+	result := CollectorResult{Collector: c}
+
+	type outcome struct {
+		data interface{}
+		err  error
+	}
+	done := make(chan outcome, 1)
+	settings := r.Settings().WithContext(ctx)
+	go func() {
+		data, err := c.Collect(ctx, settings)
+		done <- outcome{data, err}
+	}()
+
+	select {
+	case o := <-done:
+		result.Data, result.Err = o.data, o.err
+	case <-ctx.Done():
+		result.Err = fmt.Errorf("%s: %v", c.Name(), ctx.Err())
+	}
+
+	result.Duration = time.Since(start)
+	result.Collected = time.Now()
+	return result
+}
+
+// warnPrivileges tells the user when a collector will return partial results.
+func warnPrivileges(collectors []Collector) {
+	if os.Geteuid() == 0 {
+		return
+	}
+	for _, c := range collectors {
+		if hasString(c.Privileges(), PrivilegeRoot) {
+			fmt.Fprintf(os.Stderr, "⚠️  %s runs without root, results may be incomplete\n", c.Title())
+		}
+	}
+}
+
+// newDefaultRegistry registers the built-in modules.
+func newDefaultRegistry() *Registry {
+	registry := NewRegistry()
+
+	registry.Register(&moduleCollector[SystemInfo]{
+		name:    "system",
+		title:   "System Monitor",
+		aliases: []string{"sys"},
+		collect: func(ctx context.Context, s Settings) SystemInfo {
+			return s.hostMonitor().GetSystemInfo()
+		},
+		print: func(s Settings, info SystemInfo) { s.hostMonitor().printSystemInfo(info) },
+	})
+	registry.Register(&moduleCollector[SecurityScan]{
+		name:         "security",
+		title:        "Security Scanner",
+		aliases:      []string{"sec"},
+		capabilities: []string{CapabilityMetrics, CapabilitySlow},
+		privileges:   []string{PrivilegeRoot},
+		collect: func(ctx context.Context, s Settings) SecurityScan {
+			return s.securityScanner().PerformSecurityScan()
+		},
+		print: func(s Settings, scan SecurityScan) { s.securityScanner().printSecurityScan(scan) },
+	})
+	registry.Register(&moduleCollector[BenchmarkReport]{
+		name:       "benchmark",
+		title:      "Hardening Benchmark",
+		aliases:    []string{"bench", "cis"},
+		privileges: []string{PrivilegeRoot},
+		collect: func(ctx context.Context, s Settings) BenchmarkReport {
+			return s.benchmark().RunBenchmark()
+		},
+		print: func(s Settings, report BenchmarkReport) { s.benchmark().printBenchmarkReport(report) },
+	})
+	registry.Register(&moduleCollector[AccountAudit]{
+		name:       "accounts",
+		title:      "Account Audit",
+		aliases:    []string{"users"},
+		privileges: []string{PrivilegeRoot},
+		collect: func(ctx context.Context, s Settings) AccountAudit {
+			return s.accountAuditor().Audit()
+		},
+		print: func(s Settings, audit AccountAudit) { s.accountAuditor().printAccountAudit(audit) },
+	})
+	registry.Register(&moduleCollector[PerformanceInfo]{
+		name:         "performance",
+		title:        "Performance Monitor",
+		aliases:      []string{"perf"},
+		capabilities: []string{CapabilityMetrics, CapabilitySampling},
+		collect: func(ctx context.Context, s Settings) PerformanceInfo {
+			return s.performanceMonitor().GetPerformanceInfo()
+		},
+		print: func(s Settings, info PerformanceInfo) { s.performanceMonitor().printPerformanceInfo(info) },
+	})
+	registry.Register(&moduleCollector[NetworkAnalysis]{
+		name:         "network",
+		title:        "Network Analyzer",
+		aliases:      []string{"net"},
+		capabilities: []string{CapabilityMetrics, CapabilitySampling},
+		privileges:   []string{PrivilegeRoot},
+		collect: func(ctx context.Context, s Settings) NetworkAnalysis {
+			return s.networkAnalyzer().AnalyzeNetwork()
+		},
+		print: func(s Settings, analysis NetworkAnalysis) { s.networkAnalyzer().printNetworkAnalysis(analysis) },
+	})
+	registry.Register(&moduleCollector[PackageInfo]{
+		name:         "packages",
+		title:        "Package Manager",
+		aliases:      []string{"pkg", "package"},
+		capabilities: []string{CapabilityMetrics, CapabilitySlow},
+		collect: func(ctx context.Context, s Settings) PackageInfo {
+			return s.packageManager().GetPackageInfo()
+		},
+		print: func(s Settings, info PackageInfo) { s.packageManager().printPackageInfo(info) },
+	})
+
+	return registry
+}
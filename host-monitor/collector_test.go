@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingRunner stands in for a stalled tool: it returns only when ctx is
+// done and then closes stopped.
+type blockingRunner struct {
+	stopped chan struct{}
+}
+
+func (r blockingRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	<-ctx.Done()
+	close(r.stopped)
+	return nil, ctx.Err()
+}
+
+func TestRegistryRunCancelsTimedOutCollector(t *testing.T) {
+	runner := blockingRunner{stopped: make(chan struct{})}
+	host := &Host{Root: "/", Runner: runner}
+
+	registry := NewRegistry()
+	registry.SetHost(host)
+	registry.Register(&moduleCollector[string]{
+		name: "stalled",
+		collect: func(ctx context.Context, s Settings) string {
+			output, _ := s.Host.Output("stalled-tool")
+			return string(output)
+		},
+	})
+	timeout := configDuration(10 * time.Millisecond)
+	if err := registry.Configure(CollectorConfig{Collectors: map[string]CollectorSetting{"stalled": {Timeout: timeout}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	results := registry.Run(context.Background(), registry.Enabled())
+	if len(results) != 1 || results[0].Err == nil {
+		t.Fatalf("Run = %+v, want a timeout error", results)
+	}
+
+	select {
+	case <-runner.stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the collector's command was not cancelled")
+	}
+}
+
+// Registries configured for different hosts run side by side: each passes
+// its own settings to the collectors.
+func TestRegistryRunUsesItsSettings(t *testing.T) {
+	hosts := map[string]string{"ubuntu": "web-01", "alpine": "edge-03", "container": "4f2c9a1e7b3d"}
+
+	var wg sync.WaitGroup
+	for fixture, hostname := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			registry, err := newConfiguredRegistry(NewHost(filepath.Join("testdata", fixture, "root"), ""), 0, "")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			selected, _ := registry.Select("system")
+			results := registry.Run(context.Background(), selected)
+			if info, ok := results[0].Data.(SystemInfo); !ok || info.Hostname != hostname {
+				t.Errorf("%s: system collector saw %+v, want hostname %s", fixture, results[0].Data, hostname)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestExecRunnerKillsOnCancel(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("no sleep binary")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := (ExecRunner{}).Output(ctx, "sleep", "10"); err == nil {
+		t.Error("Output succeeded after the context was cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("sleep ran for %v after the context was cancelled", elapsed)
+	}
+}
+
+func TestHostWalkDirStopsOnCancel(t *testing.T) {
+	host := newTestHost(t, map[string]string{"etc/a": "", "etc/b": "", "etc/c": ""})
+	ctx, cancel := context.WithCancel(context.Background())
+	host = host.WithContext(ctx)
+
+	var visited int
+	err := host.WalkDir("/etc", func(path string, d fs.DirEntry, err error) error {
+		visited++
+		cancel()
+		return err
+	})
+	if err != context.Canceled || visited != 1 {
+		t.Errorf("WalkDir = %v after %d entries, want %v after 1", err, visited, context.Canceled)
+	}
+}
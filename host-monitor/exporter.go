@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	metricPrefix = "host_monitor_"
+
+	contentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	contentTypePrometheus  = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+type metricSample struct {
+	labels []string // key, value pairs
+	value  float64
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	typ     string // gauge or counter
+	unit    string
+	samples []metricSample
+}
+
+func (f *metricFamily) add(value float64, labels ...string) {
+	f.samples = append(f.samples, metricSample{labels: labels, value: value})
+}
+
+// Exporter serves the latest collector results in the Prometheus text
+// format and OpenMetrics. Collection runs in the background because security
+// and package scans are too slow to run on every scrape.
+type Exporter struct {
+	registry   *Registry
+	collectors []Collector
+	interval   time.Duration
+
+	mu        sync.RWMutex
+	snapshots map[string]CollectorResult
+}
+
+func NewExporter(registry *Registry, collectors []Collector, interval time.Duration) *Exporter {
+	return &Exporter{
+		registry:   registry,
+		collectors: collectors,
+		interval:   interval,
+		snapshots:  make(map[string]CollectorResult),
+	}
+}
+
+// Run collects every collector now and then every interval until ctx is
+// done. Each collector runs on its own schedule, so a slow security or
+// package scan does not hold back the performance gauges. A failed
+// collection keeps the previous data so a single timeout does not blank the
+// metrics.
+func (e *Exporter) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, c := range e.collectors {
+		wg.Add(1)
+		go func(c Collector) {
+			defer wg.Done()
+			e.runCollector(ctx, c)
+		}(c)
+	}
+	wg.Wait()
+}
+
+func (e *Exporter) runCollector(ctx context.Context, c Collector) {
+	for {
+		result := e.registry.Run(ctx, []Collector{c})[0]
+
+		e.mu.Lock()
+		if result.Err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  %v\n", result.Err)
+			result.Data = e.snapshots[c.Name()].Data
+		} else if err := result.Incomplete(); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  %s is incomplete: %v\n", c.Title(), err)
+		}
+		e.snapshots[c.Name()] = result
+		e.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.interval):
+		}
+	}
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", contentTypeOpenMetrics)
+	} else {
+		w.Header().Set("Content-Type", contentTypePrometheus)
+	}
+
+	writeMetrics(w, e.families(), openMetrics)
+}
+
+// families converts the current snapshots into metric families.
+func (e *Exporter) families() []*metricFamily {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	duration := &metricFamily{name: "collect_duration_seconds", help: "Time taken by the last collection of a module.", typ: "gauge", unit: "seconds"}
+	collected := &metricFamily{name: "collect_timestamp_seconds", help: "Unix time of the last collection of a module.", typ: "gauge", unit: "seconds"}
+	success := &metricFamily{name: "collect_success", help: "Whether the last collection of a module succeeded.", typ: "gauge"}
+	families := []*metricFamily{duration, collected, success}
+
+	var names []string
+	for name := range e.snapshots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		snapshot := e.snapshots[name]
+		duration.add(snapshot.Duration.Seconds(), "module", name)
+		collected.add(float64(snapshot.Collected.UnixNano())/1e9, "module", name)
+		if snapshot.Err != nil {
+			success.add(0, "module", name)
+		} else {
+			success.add(1, "module", name)
+		}
+
+		switch data := snapshot.Data.(type) {
+		case PerformanceInfo:
+			families = append(families, performanceMetrics(data)...)
+		case NetworkAnalysis:
+			families = append(families, networkMetrics(data)...)
+		case PackageInfo:
+			families = append(families, packageMetrics(data)...)
+		case SecurityScan:
+			families = append(families, securityMetrics(data)...)
+		}
+	}
+
+	return families
+}
+
+func performanceMetrics(info PerformanceInfo) []*metricFamily {
+	cpu := &metricFamily{name: "cpu_usage_percent", help: "CPU time spent per mode over the sample interval.", typ: "gauge"}
+	cpu.add(info.CPUUsage.User, "mode", "user")
+	cpu.add(info.CPUUsage.Nice, "mode", "nice")
+	cpu.add(info.CPUUsage.System, "mode", "system")
+	cpu.add(info.CPUUsage.Idle, "mode", "idle")
+	cpu.add(info.CPUUsage.IOWait, "mode", "iowait")
+	cpu.add(info.CPUUsage.IRQ, "mode", "irq")
+	cpu.add(info.CPUUsage.SoftIRQ, "mode", "softirq")
+	cpu.add(info.CPUUsage.Steal, "mode", "steal")
+
+	cores := &metricFamily{name: "cpu_core_usage_percent", help: "Busy CPU time per core over the sample interval.", typ: "gauge"}
+	for _, core := range info.CPUUsage.Cores {
+		cores.add(core.Usage, "cpu", core.CPU)
+	}
+
+	// /proc/meminfo reports kB
+	memory := &metricFamily{name: "memory_bytes", help: "Memory and swap by type.", typ: "gauge", unit: "bytes"}
+	memory.add(float64(info.MemoryUsage.Total*1024), "type", "total")
+	memory.add(float64(info.MemoryUsage.Used*1024), "type", "used")
+	memory.add(float64(info.MemoryUsage.Free*1024), "type", "free")
+	memory.add(float64(info.MemoryUsage.Available*1024), "type", "available")
+	memory.add(float64(info.MemoryUsage.SwapTotal*1024), "type", "swap_total")
+	memory.add(float64(info.MemoryUsage.SwapUsed*1024), "type", "swap_used")
+
+	disk := &metricFamily{name: "disk_bytes", help: "Filesystem size by type.", typ: "gauge", unit: "bytes"}
+	diskPercent := &metricFamily{name: "disk_usage_percent", help: "Filesystem usage as reported by df.", typ: "gauge"}
+	for _, d := range info.DiskUsage {
+		disk.add(float64(d.Total), "device", d.Device, "mountpoint", d.MountPoint, "type", "total")
+		disk.add(float64(d.Used), "device", d.Device, "mountpoint", d.MountPoint, "type", "used")
+		disk.add(float64(d.Available), "device", d.Device, "mountpoint", d.MountPoint, "type", "available")
+		diskPercent.add(d.UsePercent, "device", d.Device, "mountpoint", d.MountPoint)
+	}
+
+	load := &metricFamily{name: "load_average", help: "System load average.", typ: "gauge"}
+	load.add(info.LoadAverage.OneMin, "period", "1m")
+	load.add(info.LoadAverage.FiveMin, "period", "5m")
+	load.add(info.LoadAverage.FifteenMin, "period", "15m")
+
+	return []*metricFamily{cpu, cores, memory, disk, diskPercent, load}
+}
+
+func networkMetrics(analysis NetworkAnalysis) []*metricFamily {
+	families := []*metricFamily{
+		{name: "network_receive_bytes", help: "Bytes received per interface.", typ: "counter", unit: "bytes"},
+		{name: "network_transmit_bytes", help: "Bytes transmitted per interface.", typ: "counter", unit: "bytes"},
+		{name: "network_receive_packets", help: "Packets received per interface.", typ: "counter"},
+		{name: "network_transmit_packets", help: "Packets transmitted per interface.", typ: "counter"},
+		{name: "network_receive_errors", help: "Receive errors per interface.", typ: "counter"},
+		{name: "network_transmit_errors", help: "Transmit errors per interface.", typ: "counter"},
+	}
+	for _, iface := range analysis.Interfaces {
+		families[0].add(float64(iface.RXBytes), "interface", iface.Name)
+		families[1].add(float64(iface.TXBytes), "interface", iface.Name)
+		families[2].add(float64(iface.RXPackets), "interface", iface.Name)
+		families[3].add(float64(iface.TXPackets), "interface", iface.Name)
+		families[4].add(float64(iface.RXErrors), "interface", iface.Name)
+		families[5].add(float64(iface.TXErrors), "interface", iface.Name)
+	}
+
+	rate := &metricFamily{name: "network_rate_bytes_per_second", help: "Traffic rate per interface over the sample interval.", typ: "gauge"}
+	for _, bw := range analysis.BandwidthUsage {
+		rate.add(bw.RXRate, "interface", bw.Interface, "direction", "receive")
+		rate.add(bw.TXRate, "interface", bw.Interface, "direction", "transmit")
+	}
+
+	connections := &metricFamily{name: "network_connections", help: "Network connections by kind.", typ: "gauge"}
+	connections.add(float64(analysis.NetworkStats.TotalConnections), "kind", "total")
+	connections.add(float64(analysis.NetworkStats.TCPConnections), "kind", "tcp")
+	connections.add(float64(analysis.NetworkStats.UDPConnections), "kind", "udp")
+	connections.add(float64(analysis.NetworkStats.Established), "kind", "established")
+	connections.add(float64(analysis.NetworkStats.Listen), "kind", "listen")
+
+	return append(families, rate, connections)
+}
+
+func packageMetrics(info PackageInfo) []*metricFamily {
+	packages := &metricFamily{name: "packages", help: "Packages by state.", typ: "gauge"}
+	packages.add(float64(info.PackageStats.TotalInstalled), "state", "installed")
+	packages.add(float64(info.PackageStats.TotalAvailable), "state", "available")
+	packages.add(float64(info.PackageStats.TotalOutdated), "state", "outdated")
+	packages.add(float64(info.PackageStats.TotalSecurity), "state", "security")
+
+	if info.Vulnerabilities == nil {
+		return []*metricFamily{packages}
+	}
+	vulnerabilities := &metricFamily{name: "package_vulnerabilities", help: "Vulnerabilities of installed packages by severity.", typ: "gauge"}
+	counts := countVulnerabilities(info.Vulnerabilities)
+	for _, severity := range []string{SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow, SeverityInfo, SeverityUnknown} {
+		vulnerabilities.add(float64(counts[severity]), "severity", severity)
+	}
+	return []*metricFamily{packages, vulnerabilities}
+}
+
+func securityMetrics(scan SecurityScan) []*metricFamily {
+	findings := &metricFamily{name: "security_findings", help: "Items reported by each security check.", typ: "gauge"}
+	findings.add(float64(len(scan.OpenPorts)), "check", "open_ports")
+	findings.add(float64(len(scan.SuspiciousFiles)), "check", "suspicious_files")
+	findings.add(float64(len(scan.HighCPUProcesses)), "check", "high_cpu_processes")
+	findings.add(float64(len(scan.NetworkConnections)), "check", "network_connections")
+	findings.add(float64(len(scan.NewUsers)), "check", "new_users")
+	findings.add(float64(len(scan.ModifiedFiles)), "check", "modified_files")
+	findings.add(float64(len(scan.UnusualPerms)), "check", "unusual_permissions")
+	findings.add(float64(len(scan.SetuidBinaries)), "check", "setuid_binaries")
+	findings.add(float64(len(scan.ListeningServices)), "check", "listening_services")
+
+	severities := &metricFamily{name: "security_findings_by_severity", help: "Unsuppressed security findings by severity.", typ: "gauge"}
+	counts := countFindings(scan.Findings)
+	for _, severity := range []string{SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow, SeverityInfo} {
+		severities.add(float64(counts[severity]), "severity", severity)
+	}
+	score := &metricFamily{name: "security_score", help: "Security score from 0 to 100.", typ: "gauge"}
+	score.add(float64(scan.Score))
+
+	return []*metricFamily{findings, severities, score}
+}
+
+// writeMetrics renders families in the Prometheus text format, or in
+// OpenMetrics which adds units, _total only on counter samples and # EOF.
+func writeMetrics(w io.Writer, families []*metricFamily, openMetrics bool) {
+	for _, f := range families {
+		if len(f.samples) == 0 {
+			continue
+		}
+
+		name := metricPrefix + f.name
+		sampleName := name
+		if f.typ == "counter" {
+			sampleName += "_total"
+			if !openMetrics {
+				name = sampleName
+			}
+		}
+
+		fmt.Fprintf(w, "# HELP %s %s\n", name, f.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, f.typ)
+		if openMetrics && f.unit != "" {
+			fmt.Fprintf(w, "# UNIT %s %s\n", name, f.unit)
+		}
+
+		for _, s := range f.samples {
+			fmt.Fprintf(w, "%s%s %s\n", sampleName, formatLabels(s.labels), formatValue(s.value))
+		}
+	}
+
+	if openMetrics {
+		fmt.Fprintln(w, "# EOF")
+	}
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var parts []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1])
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, labels[i], value))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// metricCollectors resolves --modules for serve. "all" means every enabled
+// collector with metrics; naming a collector without metrics is an error
+// rather than an exporter that never exports it.
+func metricCollectors(registry *Registry, list string) ([]Collector, error) {
+	if strings.TrimSpace(list) == "all" {
+		return registry.WithCapability(CapabilityMetrics), nil
+	}
+
+	selected, err := registry.Select(list)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range selected {
+		if !hasString(c.Capabilities(), CapabilityMetrics) {
+			return nil, fmt.Errorf("module %q has no metrics to export", c.Name())
+		}
+	}
+	return selected, nil
+}
+
+// serveCommand implements "host-monitor serve" and returns the exit code.
+func serveCommand(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.Usage = usage
+	listen := fs.String("listen", ":9100", "Address for the metrics endpoint")
+	moduleList := fs.String("modules", "all", "Comma separated modules to export, all means every collector with metrics")
+	configPath := fs.String("config", "", "Collector config file (JSON)")
+	interval := fs.Duration("interval", 30*time.Second, "Time between collections")
+	sample := fs.Duration("sample", defaultSampleInterval, "CPU and bandwidth sampling window, 0 for averages since boot")
+	applyHost := hostFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *interval <= 0 {
+		fmt.Fprintln(os.Stderr, "❌ --interval must be > 0")
+		return 2
+	}
+
+	registry, err := newConfiguredRegistry(applyHost(), *sample, *configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+
+	selected, err := metricCollectors(registry, *moduleList)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	warnPrivileges(selected)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	exporter := NewExporter(registry, selected, *interval)
+	go exporter.Run(ctx)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, "host-monitor exporter, metrics at /metrics")
+	})
+
+	server := &http.Server{Addr: *listen, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "📈 Serving metrics on %s/metrics (collecting every %v)\n", *listen, *interval)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFamilies() []*metricFamily {
+	received := &metricFamily{name: "network_receive_bytes", help: "Bytes received per interface.", typ: "counter", unit: "bytes"}
+	received.add(1024, "interface", "eth0")
+	received.add(0, "interface", `we"ird\name`+"\n")
+
+	load := &metricFamily{name: "load_average", help: "System load average.", typ: "gauge"}
+	load.add(0.25, "period", "1m")
+
+	odd := &metricFamily{name: "odd_values", help: "Values that are not finite.", typ: "gauge"}
+	odd.add(math.NaN(), "kind", "nan")
+	odd.add(math.Inf(1), "kind", "inf")
+	odd.add(math.Inf(-1), "kind", "-inf")
+
+	score := &metricFamily{name: "security_score", help: "Security score from 0 to 100.", typ: "gauge"}
+	score.add(85)
+
+	empty := &metricFamily{name: "empty", help: "Skipped without samples.", typ: "gauge"}
+	return []*metricFamily{received, load, odd, score, empty}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	tests := []struct {
+		name        string
+		openMetrics bool
+		want        string
+	}{
+		{
+			name: "prometheus",
+			want: `# HELP host_monitor_network_receive_bytes_total Bytes received per interface.
+# TYPE host_monitor_network_receive_bytes_total counter
+host_monitor_network_receive_bytes_total{interface="eth0"} 1024
+host_monitor_network_receive_bytes_total{interface="we\"ird\\name\n"} 0
+# HELP host_monitor_load_average System load average.
+# TYPE host_monitor_load_average gauge
+host_monitor_load_average{period="1m"} 0.25
+# HELP host_monitor_odd_values Values that are not finite.
+# TYPE host_monitor_odd_values gauge
+host_monitor_odd_values{kind="nan"} NaN
+host_monitor_odd_values{kind="inf"} +Inf
+host_monitor_odd_values{kind="-inf"} -Inf
+# HELP host_monitor_security_score Security score from 0 to 100.
+# TYPE host_monitor_security_score gauge
+host_monitor_security_score 85
+`,
+		},
+		{
+			name:        "openmetrics",
+			openMetrics: true,
+			want: `# HELP host_monitor_network_receive_bytes Bytes received per interface.
+# TYPE host_monitor_network_receive_bytes counter
+# UNIT host_monitor_network_receive_bytes bytes
+host_monitor_network_receive_bytes_total{interface="eth0"} 1024
+host_monitor_network_receive_bytes_total{interface="we\"ird\\name\n"} 0
+# HELP host_monitor_load_average System load average.
+# TYPE host_monitor_load_average gauge
+host_monitor_load_average{period="1m"} 0.25
+# HELP host_monitor_odd_values Values that are not finite.
+# TYPE host_monitor_odd_values gauge
+host_monitor_odd_values{kind="nan"} NaN
+host_monitor_odd_values{kind="inf"} +Inf
+host_monitor_odd_values{kind="-inf"} -Inf
+# HELP host_monitor_security_score Security score from 0 to 100.
+# TYPE host_monitor_security_score gauge
+host_monitor_security_score 85
+# EOF
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		writeMetrics(&out, testFamilies(), tt.openMetrics)
+		if out.String() != tt.want {
+			t.Errorf("%s: writeMetrics =\n%s\nwant\n%s", tt.name, out.String(), tt.want)
+		}
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	tests := []struct {
+		labels []string
+		want   string
+	}{
+		{labels: nil, want: ""},
+		{labels: []string{"module", "performance"}, want: `{module="performance"}`},
+		{labels: []string{"device", "/dev/sda1", "mountpoint", "/"}, want: `{device="/dev/sda1",mountpoint="/"}`},
+		{labels: []string{"path", `C:\temp`}, want: `{path="C:\\temp"}`},
+		{labels: []string{"name", `say "hi"`}, want: `{name="say \"hi\""}`},
+		{labels: []string{"name", "two\nlines"}, want: `{name="two\nlines"}`},
+	}
+
+	for _, tt := range tests {
+		if got := formatLabels(tt.labels); got != tt.want {
+			t.Errorf("formatLabels(%q) = %s, want %s", tt.labels, got, tt.want)
+		}
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		value float64
+		want  string
+	}{
+		{value: 0, want: "0"},
+		{value: 42, want: "42"},
+		{value: 0.125, want: "0.125"},
+		{value: -3.5, want: "-3.5"},
+		{value: 1.7e10, want: "17000000000"},
+		{value: math.NaN(), want: "NaN"},
+		{value: math.Inf(1), want: "+Inf"},
+		{value: math.Inf(-1), want: "-Inf"},
+	}
+
+	for _, tt := range tests {
+		if got := formatValue(tt.value); got != tt.want {
+			t.Errorf("formatValue(%v) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestExporterServeHTTP(t *testing.T) {
+	exporter := NewExporter(NewRegistry(), nil, time.Minute)
+	exporter.snapshots["performance"] = CollectorResult{
+		Data:      PerformanceInfo{LoadAverage: LoadAverage{OneMin: 0.5}},
+		Collected: time.Unix(1714564800, 0),
+	}
+
+	tests := []struct {
+		accept      string
+		contentType string
+		eof         bool
+	}{
+		{accept: "", contentType: contentTypePrometheus},
+		{accept: "text/plain", contentType: contentTypePrometheus},
+		{accept: "application/openmetrics-text; version=1.0.0,text/plain;q=0.5", contentType: contentTypeOpenMetrics, eof: true},
+	}
+
+	for _, tt := range tests {
+		request := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if tt.accept != "" {
+			request.Header.Set("Accept", tt.accept)
+		}
+		recorder := httptest.NewRecorder()
+		exporter.ServeHTTP(recorder, request)
+
+		if got := recorder.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("Accept %q: Content-Type = %q, want %q", tt.accept, got, tt.contentType)
+		}
+		body := recorder.Body.String()
+		if !strings.Contains(body, `host_monitor_load_average{period="1m"} 0.5`+"\n") {
+			t.Errorf("Accept %q: body has no load average:\n%s", tt.accept, body)
+		}
+		if !strings.Contains(body, `host_monitor_collect_success{module="performance"} 1`+"\n") {
+			t.Errorf("Accept %q: body has no collect_success:\n%s", tt.accept, body)
+		}
+		if got := strings.HasSuffix(body, "# EOF\n"); got != tt.eof {
+			t.Errorf("Accept %q: ends with # EOF = %v, want %v", tt.accept, got, tt.eof)
+		}
+	}
+}
+
+// A slow collector must not hold back the others: each runs on its own
+// schedule.
+func TestExporterRunSchedulesCollectorsIndependently(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	registry := NewRegistry()
+	slow := &moduleCollector[SecurityScan]{
+		name: "slow",
+		collect: func(ctx context.Context, s Settings) SecurityScan {
+			select {
+			case <-release:
+			case <-ctx.Done():
+			}
+			return SecurityScan{}
+		},
+	}
+	fast := &moduleCollector[PerformanceInfo]{
+		name: "fast",
+		collect: func(ctx context.Context, s Settings) PerformanceInfo {
+			return PerformanceInfo{}
+		},
+	}
+	registry.Register(slow)
+	registry.Register(fast)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	exporter := NewExporter(registry, []Collector{slow, fast}, 5*time.Millisecond)
+	go exporter.Run(ctx)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		exporter.mu.RLock()
+		first := exporter.snapshots["fast"].Collected
+		exporter.mu.RUnlock()
+		if !first.IsZero() {
+			time.Sleep(50 * time.Millisecond)
+			exporter.mu.RLock()
+			second := exporter.snapshots["fast"].Collected
+			_, slowDone := exporter.snapshots["slow"]
+			exporter.mu.RUnlock()
+			if !second.After(first) {
+				t.Error("fast collector was not collected again while the slow one was running")
+			}
+			if slowDone {
+				t.Error("slow collector finished before it was released")
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("fast collector was never collected while the slow one was running")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMetricCollectors(t *testing.T) {
+	registry, err := newConfiguredRegistry(NewHost(filepath.Join("testdata", "container", "root"), ""), 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		list    string
+		want    []string
+		wantErr string
+	}{
+		{list: "all", want: []string{"security", "performance", "network", "packages"}},
+		{list: "perf,net", want: []string{"performance", "network"}},
+		{list: "system", wantErr: `module "system" has no metrics to export`},
+		{list: "performance,accounts", wantErr: `module "accounts" has no metrics to export`},
+		{list: "nope", wantErr: `unknown module "nope"`},
+	}
+
+	for _, tt := range tests {
+		selected, err := metricCollectors(registry, tt.list)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("metricCollectors(%q) error = %v, want %q", tt.list, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("metricCollectors(%q): %v", tt.list, err)
+			continue
+		}
+		var names []string
+		for _, c := range selected {
+			names = append(names, c.Name())
+		}
+		if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("metricCollectors(%q) = %v, want %v", tt.list, names, tt.want)
+		}
+	}
+}
@@ -0,0 +1,612 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const fimSchemaVersion = 1
+
+// defaultFIMPaths are hashed when neither --paths nor the config sets any.
+var defaultFIMPaths = []string{
+	"/etc", "/bin", "/sbin", "/usr/bin", "/usr/sbin", "/usr/local/bin", "/usr/local/sbin",
+	"/root/.ssh", "/var/spool/cron",
+}
+
+// defaultFIMExclude skips files that change in normal operation.
+var defaultFIMExclude = []string{
+	"/etc/mtab", "/etc/adjtime", "/etc/ld.so.cache", "/etc/resolv.conf", "*.swp", "*~",
+}
+
+// FIMConfig is the "fim" section of the collector config.
+type FIMConfig struct {
+	Paths    []string `json:"paths"`
+	Exclude  []string `json:"exclude"`
+	Database string   `json:"database"`
+}
+
+// FIMEntry holds the attributes of one file. Modification times are kept
+// for display but not compared, since they are trivial to forge. Error says
+// why a regular file could not be hashed; its SHA256 is then empty.
+type FIMEntry struct {
+	Path    string            `json:"path"`
+	Type    string            `json:"type"`
+	Mode    string            `json:"mode"`
+	UID     int               `json:"uid"`
+	GID     int               `json:"gid"`
+	Size    int64             `json:"size"`
+	ModTime time.Time         `json:"mtime"`
+	SHA256  string            `json:"sha256,omitempty"`
+	Target  string            `json:"target,omitempty"`
+	Xattrs  map[string]string `json:"xattrs,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// FIMDatabase is the stored state of one host.
+type FIMDatabase struct {
+	SchemaVersion int                  `json:"schema_version"`
+	Hostname      string               `json:"hostname"`
+	UpdatedAt     time.Time            `json:"updated_at"`
+	Paths         []string             `json:"paths"`
+	Exclude       []string             `json:"exclude"`
+	Entries       map[string]*FIMEntry `json:"entries"`
+}
+
+// FIMChange is one difference between the database and the host. Fields
+// names the attributes that differ for a changed file.
+type FIMChange struct {
+	Path   string    `json:"path"`
+	Change string    `json:"change"`
+	Fields []string  `json:"fields,omitempty"`
+	Before *FIMEntry `json:"before,omitempty"`
+	After  *FIMEntry `json:"after,omitempty"`
+}
+
+const (
+	fimAdded   = "added"
+	fimRemoved = "removed"
+	fimChanged = "changed"
+)
+
+// FIMReport is the result of "fim check".
+type FIMReport struct {
+	Database  string      `json:"database"`
+	UpdatedAt time.Time   `json:"database_updated_at"`
+	Files     int         `json:"files"`
+	Changes   []FIMChange `json:"changes"`
+}
+
+type FIMScanner struct {
+	host    *Host
+	paths   []string
+	exclude []string
+}
+
+func NewFIMScanner(host *Host, paths, exclude []string) *FIMScanner {
+	return &FIMScanner{host: host, paths: paths, exclude: exclude}
+}
+
+// Excluded matches a host path against the exclude patterns, either the
+// whole path or its base name.
+func (f *FIMScanner) Excluded(path string) bool {
+	for _, pattern := range f.exclude {
+		if pattern == path || strings.HasPrefix(path, strings.TrimSuffix(pattern, "/")+"/") {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Scan hashes every configured path. Symlinks are recorded, not followed.
+func (f *FIMScanner) Scan() map[string]*FIMEntry {
+	entries := make(map[string]*FIMEntry)
+	for _, root := range f.paths {
+		f.scanTree(root, entries)
+	}
+	return entries
+}
+
+func (f *FIMScanner) scanTree(root string, entries map[string]*FIMEntry) {
+	f.host.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if f.Excluded(path) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry, ok := f.Entry(path); ok {
+			entries[path] = entry
+		}
+		return nil
+	})
+}
+
+// Entry reads the attributes of one file.
+func (f *FIMScanner) Entry(path string) (*FIMEntry, bool) {
+	info, err := f.host.Lstat(path)
+	if err != nil {
+		return nil, false
+	}
+
+	entry := &FIMEntry{
+		Path:    path,
+		Type:    fileType(info.Mode()),
+		Mode:    info.Mode().String(),
+		ModTime: info.ModTime().UTC(),
+	}
+	if uid, gid, ok := fileOwner(info); ok {
+		entry.UID, entry.GID = uid, gid
+	}
+
+	switch {
+	case info.Mode().IsRegular():
+		entry.Size = info.Size()
+		if hash, err := f.hash(path); err != nil {
+			// The path error would name the file below --root
+			var pathErr *fs.PathError
+			if errors.As(err, &pathErr) {
+				err = pathErr.Err
+			}
+			entry.Error = err.Error()
+		} else {
+			entry.SHA256 = hash
+		}
+		entry.Xattrs = f.xattrs(path)
+	case info.IsDir():
+		entry.Xattrs = f.xattrs(path)
+	case info.Mode()&fs.ModeSymlink != 0:
+		entry.Target, _ = f.host.Readlink(path)
+	}
+	return entry, true
+}
+
+func (f *FIMScanner) xattrs(path string) map[string]string {
+	resolved, err := f.host.Path(path)
+	if err != nil {
+		return nil
+	}
+	return readXattrs(resolved)
+}
+
+func (f *FIMScanner) hash(path string) (string, error) {
+	file, err := f.host.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	sum := sha256.New()
+	if _, err := io.Copy(sum, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+func fileType(mode fs.FileMode) string {
+	switch {
+	case mode.IsRegular():
+		return "file"
+	case mode.IsDir():
+		return "dir"
+	case mode&fs.ModeSymlink != 0:
+		return "symlink"
+	}
+	return "other"
+}
+
+// DiffFIM compares two sets of entries, sorted by path.
+func DiffFIM(before, after map[string]*FIMEntry) []FIMChange {
+	var changes []FIMChange
+	for path, old := range before {
+		current, ok := after[path]
+		if !ok {
+			changes = append(changes, FIMChange{Path: path, Change: fimRemoved, Before: old})
+			continue
+		}
+		if fields := changedFields(old, current); len(fields) > 0 {
+			changes = append(changes, FIMChange{Path: path, Change: fimChanged, Fields: fields, Before: old, After: current})
+		}
+	}
+	for path, current := range after {
+		if _, ok := before[path]; !ok {
+			changes = append(changes, FIMChange{Path: path, Change: fimAdded, After: current})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func changedFields(before, after *FIMEntry) []string {
+	var fields []string
+	check := func(name string, differs bool) {
+		if differs {
+			fields = append(fields, name)
+		}
+	}
+	check("type", before.Type != after.Type)
+	check("mode", before.Mode != after.Mode)
+	check("owner", before.UID != after.UID || before.GID != after.GID)
+	check("size", before.Size != after.Size)
+	// A file that could not be read on one side has no hash to compare, which
+	// is not the same as new content
+	check("sha256", before.Error == "" && after.Error == "" && before.SHA256 != after.SHA256)
+	check("target", before.Target != after.Target)
+	check("xattrs", !equalXattrs(before.Xattrs, after.Xattrs))
+	return fields
+}
+
+func equalXattrs(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if other, ok := b[name]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// defaultFIMDatabase keeps one database per host, so a shared directory can
+// hold several.
+func defaultFIMDatabase(hostname string) string {
+	return filepath.Join("/var/lib/host-monitor/fim", hostname+".json")
+}
+
+func LoadFIMDatabase(path string) (*FIMDatabase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var db FIMDatabase
+	if err := json.Unmarshal(data, &db); err != nil {
+		return nil, fmt.Errorf("invalid FIM database %s: %v", path, err)
+	}
+	if db.SchemaVersion != fimSchemaVersion {
+		return nil, fmt.Errorf("FIM database %s has schema version %d, expected %d", path, db.SchemaVersion, fimSchemaVersion)
+	}
+	if db.Entries == nil {
+		db.Entries = make(map[string]*FIMEntry)
+	}
+	return &db, nil
+}
+
+// Save writes the database atomically.
+func (db *FIMDatabase) Save(path string) error {
+	db.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(db)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+func formatFIMChange(change FIMChange) string {
+	switch change.Change {
+	case fimAdded:
+		return fmt.Sprintf("➕ %s %s", change.Path, describeFIMEntry(change.After))
+	case fimRemoved:
+		return fmt.Sprintf("➖ %s %s", change.Path, describeFIMEntry(change.Before))
+	}
+
+	var parts []string
+	for _, field := range change.Fields {
+		b, a := change.Before, change.After
+		switch field {
+		case "type":
+			parts = append(parts, fmt.Sprintf("type %s -> %s", b.Type, a.Type))
+		case "mode":
+			parts = append(parts, fmt.Sprintf("mode %s -> %s", b.Mode, a.Mode))
+		case "owner":
+			parts = append(parts, fmt.Sprintf("owner %d:%d -> %d:%d", b.UID, b.GID, a.UID, a.GID))
+		case "size":
+			parts = append(parts, fmt.Sprintf("size %d -> %d", b.Size, a.Size))
+		case "sha256":
+			parts = append(parts, fmt.Sprintf("sha256 %s -> %s", shortHash(b.SHA256), shortHash(a.SHA256)))
+		case "target":
+			parts = append(parts, fmt.Sprintf("target %s -> %s", b.Target, a.Target))
+		case "xattrs":
+			parts = append(parts, "xattrs changed")
+		}
+	}
+	return fmt.Sprintf("✏️  %s %s", change.Path, strings.Join(parts, ", "))
+}
+
+func describeFIMEntry(entry *FIMEntry) string {
+	description := fmt.Sprintf("%s %d:%d", entry.Mode, entry.UID, entry.GID)
+	if entry.Type == "file" {
+		description += fmt.Sprintf(" %d bytes %s", entry.Size, shortHash(entry.SHA256))
+	}
+	if entry.Error != "" {
+		description += " (unreadable)"
+	}
+	if entry.Target != "" {
+		description += " -> " + entry.Target
+	}
+	return description
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+func printFIMReport(report FIMReport) {
+	fmt.Println("=== FILE INTEGRITY CHECK ===")
+	fmt.Printf("Database: %s (%s)\n", report.Database, report.UpdatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Files: %d\n", report.Files)
+	fmt.Println("==========================================")
+
+	if len(report.Changes) == 0 {
+		fmt.Println("✅ No changes")
+		return
+	}
+	for _, change := range report.Changes {
+		fmt.Println(formatFIMChange(change))
+	}
+	fmt.Printf("\n📊 %d change(s)\n", len(report.Changes))
+}
+
+// fimCommand implements "host-monitor fim init|check|watch". check exits 1
+// when files changed.
+func fimCommand(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	fs := flag.NewFlagSet("fim "+args[0], flag.ContinueOnError)
+	fs.Usage = usage
+	dbPath := fs.String("db", "", "Hash database (default /var/lib/host-monitor/fim/<hostname>.json)")
+	pathList := fs.String("paths", "", "Comma separated paths to hash (default: config or built-in list)")
+	excludeList := fs.String("exclude", "", "Comma separated paths or glob patterns to skip")
+	update := fs.Bool("update", false, "Write the current state to the database after reporting")
+	format := fs.String("format", formatText, "Report format: text, json or yaml")
+	configPath := fs.String("config", "", "Collector config file (JSON) with a \"fim\" section")
+	applyHost := hostFlags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	host := applyHost()
+
+	if !validFormat(*format) {
+		fmt.Fprintf(os.Stderr, "❌ Unknown format %q (use text, json or yaml)\n", *format)
+		return 2
+	}
+
+	var config FIMConfig
+	if *configPath != "" {
+		collectorConfig, err := LoadCollectorConfig(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+		config = collectorConfig.FIM
+	}
+
+	hostname := host.Hostname()
+	path := firstNonEmpty(*dbPath, config.Database, defaultFIMDatabase(hostname))
+	paths := config.Paths
+	if *pathList != "" {
+		paths = splitList(*pathList)
+	}
+	exclude := config.Exclude
+	if *excludeList != "" {
+		exclude = splitList(*excludeList)
+	}
+
+	switch args[0] {
+	case "init":
+		if len(paths) == 0 {
+			paths = defaultFIMPaths
+		}
+		if exclude == nil {
+			exclude = defaultFIMExclude
+		}
+		db := &FIMDatabase{
+			SchemaVersion: fimSchemaVersion,
+			Hostname:      hostname,
+			Paths:         paths,
+			Exclude:       exclude,
+			Entries:       NewFIMScanner(host, paths, exclude).Scan(),
+		}
+		if err := db.Save(path); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+		fmt.Printf("💾 Recorded %d entries below %s in %s\n", len(db.Entries), strings.Join(paths, ", "), path)
+		return 0
+
+	case "check", "watch":
+		db, err := LoadFIMDatabase(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v (run \"host-monitor fim init\" first)\n", err)
+			return 2
+		}
+		// The database remembers what it covers unless overridden
+		if len(paths) == 0 {
+			paths = db.Paths
+		}
+		if exclude == nil {
+			exclude = db.Exclude
+		}
+		scanner := NewFIMScanner(host, paths, exclude)
+
+		if args[0] == "watch" {
+			return watchFIMCommand(scanner, db, path, *update)
+		}
+
+		current := scanner.Scan()
+		report := FIMReport{Database: path, UpdatedAt: db.UpdatedAt, Files: len(current), Changes: DiffFIM(db.Entries, current)}
+		if report.Changes == nil {
+			report.Changes = []FIMChange{}
+		}
+
+		if *format == formatText {
+			printFIMReport(report)
+		} else if err := WriteReport(os.Stdout, *format, NewReport("fim", hostname, report)); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Failed to write FIM report: %v\n", err)
+			return 2
+		}
+
+		if *update && len(report.Changes) > 0 {
+			db.Paths, db.Exclude, db.Entries = paths, exclude, current
+			if err := db.Save(path); err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+				return 2
+			}
+		}
+		if len(report.Changes) > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "❌ Unknown fim command %q (use init, check or watch)\n", args[0])
+	return 2
+}
+
+// fimDebounce groups the burst of events an editor or package manager
+// produces for one change.
+const fimDebounce = 500 * time.Millisecond
+
+// watchFIMCommand reports changes as inotify sees them. Each reported change
+// is folded into the in-memory database, so it is reported once; --update
+// also saves it.
+func watchFIMCommand(scanner *FIMScanner, db *FIMDatabase, path string, update bool) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	events := make(chan string, 256)
+	errs := make(chan error, 1)
+	watched, err := watchPaths(ctx, scanner, events, errs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	fmt.Printf("👀 Watching %d directories below %s (Ctrl+C to stop)\n", watched, strings.Join(scanner.paths, ", "))
+
+	pending := make(map[string]bool)
+	timer := time.NewTimer(fimDebounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return 0
+		case err := <-errs:
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		case changed, ok := <-events:
+			if !ok {
+				// The watcher stopped; its error, if any, is on errs
+				events = nil
+				continue
+			}
+			pending[changed] = true
+			timer.Reset(fimDebounce)
+		case <-timer.C:
+			changes := scanner.Rescan(db.Entries, pending)
+			pending = make(map[string]bool)
+			for _, change := range changes {
+				fmt.Printf("[%s] %s\n", time.Now().Format("15:04:05"), formatFIMChange(change))
+			}
+			if update && len(changes) > 0 {
+				if err := db.Save(path); err != nil {
+					fmt.Fprintf(os.Stderr, "⚠️  %v\n", err)
+				}
+			}
+		}
+	}
+}
+
+// Rescan rereads the given paths, and everything below those that are
+// directories, then applies the changes to entries and returns them.
+func (f *FIMScanner) Rescan(entries map[string]*FIMEntry, paths map[string]bool) []FIMChange {
+	before := make(map[string]*FIMEntry)
+	after := make(map[string]*FIMEntry)
+	for path := range paths {
+		if f.Excluded(path) {
+			continue
+		}
+		for known, entry := range entries {
+			if known == path || strings.HasPrefix(known, path+"/") {
+				before[known] = entry
+			}
+		}
+		f.scanTree(path, after)
+	}
+
+	changes := DiffFIM(before, after)
+	for _, change := range changes {
+		if change.Change == fimRemoved {
+			delete(entries, change.Path)
+		} else {
+			entries[change.Path] = change.After
+		}
+	}
+	return changes
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place, so an interrupted write never leaves a truncated file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
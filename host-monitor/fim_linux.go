@@ -0,0 +1,186 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// readXattrs returns the extended attributes of a file (security.selinux,
+// security.capability, user.*). Binary values are base64 encoded.
+func readXattrs(path string) map[string]string {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil || size <= 0 {
+		return nil
+	}
+	names := make([]byte, size)
+	if size, err = syscall.Listxattr(path, names); err != nil {
+		return nil
+	}
+
+	xattrs := make(map[string]string)
+	for _, name := range strings.Split(string(names[:size]), "\x00") {
+		if name == "" {
+			continue
+		}
+		length, err := syscall.Getxattr(path, name, nil)
+		if err != nil {
+			continue
+		}
+		value := make([]byte, length)
+		if length, err = syscall.Getxattr(path, name, value); err != nil {
+			continue
+		}
+		value = bytes.TrimRight(value[:length], "\x00")
+		if utf8.Valid(value) && bytes.IndexFunc(value, func(r rune) bool { return r < ' ' }) < 0 {
+			xattrs[name] = string(value)
+		} else {
+			xattrs[name] = "base64:" + base64.StdEncoding.EncodeToString(value)
+		}
+	}
+	if len(xattrs) == 0 {
+		return nil
+	}
+	return xattrs
+}
+
+const fimWatchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_CLOSE_WRITE | syscall.IN_ATTRIB |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// watchPaths adds an inotify watch on every directory below the scanner's
+// paths and sends the host path of each changed file to events. New
+// directories are watched as they appear. It returns the number of watched
+// directories. The watch stops when ctx is done, and events is closed once
+// it has.
+func watchPaths(ctx context.Context, scanner *FIMScanner, events chan<- string, errs chan<- error) (int, error) {
+	// A non-blocking descriptor goes through the runtime poller, so closing
+	// the file wakes a pending read
+	fd, err := syscall.InotifyInit1(syscall.IN_NONBLOCK | syscall.IN_CLOEXEC)
+	if err != nil {
+		return 0, fmt.Errorf("inotify: %v", err)
+	}
+	inotify := os.NewFile(uintptr(fd), "inotify")
+	conn, err := inotify.SyscallConn()
+	if err != nil {
+		inotify.Close()
+		return 0, fmt.Errorf("inotify: %v", err)
+	}
+
+	dirs := make(map[int]string)
+	add := func(root string) {
+		scanner.host.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return nil
+			}
+			if scanner.Excluded(path) {
+				return filepath.SkipDir
+			}
+			resolved, err := scanner.host.Path(path)
+			if err != nil {
+				return nil
+			}
+			// Watch descriptors are reused for the same directory
+			var wd int
+			var watchErr error
+			if err := conn.Control(func(fd uintptr) {
+				wd, watchErr = syscall.InotifyAddWatch(int(fd), resolved, fimWatchMask)
+			}); err == nil && watchErr == nil {
+				dirs[wd] = path
+			}
+			return nil
+		})
+	}
+	for _, path := range scanner.paths {
+		add(path)
+	}
+	if len(dirs) == 0 {
+		inotify.Close()
+		return 0, fmt.Errorf("none of %s can be watched", strings.Join(scanner.paths, ", "))
+	}
+	watched := len(dirs)
+
+	go func() {
+		<-ctx.Done()
+		inotify.Close()
+	}()
+
+	// send gives up when ctx is done, as nobody may be reading any more
+	send := func(path string) bool {
+		select {
+		case events <- path:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	go func() {
+		defer close(events)
+
+		buffer := make([]byte, 64*1024)
+		for {
+			n, err := inotify.Read(buffer)
+			if err != nil {
+				if ctx.Err() == nil {
+					select {
+					case errs <- fmt.Errorf("inotify: %v", err):
+					case <-ctx.Done():
+					}
+				}
+				return
+			}
+			if n < syscall.SizeofInotifyEvent {
+				continue
+			}
+
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+				nameStart := offset + syscall.SizeofInotifyEvent
+				name := strings.TrimRight(string(buffer[nameStart:nameStart+int(event.Len)]), "\x00")
+				offset = nameStart + int(event.Len)
+
+				if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+					// Events were lost, rescan everything
+					for _, path := range scanner.paths {
+						if !send(path) {
+							return
+						}
+					}
+					continue
+				}
+
+				dir, ok := dirs[int(event.Wd)]
+				if !ok {
+					continue
+				}
+				if event.Mask&syscall.IN_IGNORED != 0 {
+					delete(dirs, int(event.Wd))
+					continue
+				}
+
+				path := dir
+				if name != "" {
+					path = filepath.Join(dir, name)
+				}
+				if event.Mask&syscall.IN_ISDIR != 0 && event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+					add(path)
+				}
+				if !send(path) {
+					return
+				}
+			}
+		}
+	}()
+
+	return watched, nil
+}
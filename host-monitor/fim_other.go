@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// readXattrs is only implemented on Linux.
+func readXattrs(path string) map[string]string {
+	return nil
+}
+
+// watchPaths needs inotify, use "fim check" from cron elsewhere.
+func watchPaths(ctx context.Context, scanner *FIMScanner, events chan<- string, errs chan<- error) (int, error) {
+	return 0, fmt.Errorf("real-time watch needs inotify (Linux); run \"host-monitor fim check\" periodically instead")
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffFIM(t *testing.T) {
+	file := func(path, hash string) *FIMEntry {
+		return &FIMEntry{Path: path, Type: "file", Mode: "-rw-r--r--", Size: 4, SHA256: hash,
+			ModTime: time.Date(2026, time.January, 2, 9, 0, 0, 0, time.UTC)}
+	}
+	with := func(entry *FIMEntry, change func(*FIMEntry)) *FIMEntry {
+		copied := *entry
+		change(&copied)
+		return &copied
+	}
+	passwd := file("/etc/passwd", "aa")
+	shadow := file("/etc/shadow", "bb")
+
+	tests := []struct {
+		name   string
+		before []*FIMEntry
+		after  []*FIMEntry
+		want   []string
+	}{
+		{"unchanged", []*FIMEntry{passwd, shadow}, []*FIMEntry{passwd, shadow}, nil},
+		{"added and removed", []*FIMEntry{shadow}, []*FIMEntry{passwd}, []string{"/etc/passwd added", "/etc/shadow removed"}},
+		{
+			"content",
+			[]*FIMEntry{passwd},
+			[]*FIMEntry{with(passwd, func(e *FIMEntry) { e.SHA256, e.Size = "cc", 5 })},
+			[]string{"/etc/passwd changed size,sha256"},
+		},
+		{
+			"mode and owner",
+			[]*FIMEntry{passwd},
+			[]*FIMEntry{with(passwd, func(e *FIMEntry) { e.Mode, e.GID = "-rw-rw-rw-", 42 })},
+			[]string{"/etc/passwd changed mode,owner"},
+		},
+		{
+			"replaced by a symlink",
+			[]*FIMEntry{passwd},
+			[]*FIMEntry{{Path: "/etc/passwd", Type: "symlink", Mode: "Lrwxrwxrwx", Target: "/tmp/passwd"}},
+			[]string{"/etc/passwd changed type,mode,size,sha256,target"},
+		},
+		{
+			"xattrs",
+			[]*FIMEntry{with(passwd, func(e *FIMEntry) { e.Xattrs = map[string]string{"security.selinux": "etc_t"} })},
+			[]*FIMEntry{with(passwd, func(e *FIMEntry) { e.Xattrs = map[string]string{"security.selinux": "shadow_t"} })},
+			[]string{"/etc/passwd changed xattrs"},
+		},
+		{
+			"became unreadable",
+			[]*FIMEntry{passwd},
+			[]*FIMEntry{with(passwd, func(e *FIMEntry) { e.SHA256, e.Error = "", "permission denied" })},
+			nil,
+		},
+		{
+			"readable again",
+			[]*FIMEntry{with(passwd, func(e *FIMEntry) { e.SHA256, e.Error = "", "permission denied" })},
+			[]*FIMEntry{passwd},
+			nil,
+		},
+		{
+			"unreadable and resized",
+			[]*FIMEntry{passwd},
+			[]*FIMEntry{with(passwd, func(e *FIMEntry) { e.SHA256, e.Size, e.Error = "", 9, "input/output error" })},
+			[]string{"/etc/passwd changed size"},
+		},
+		{
+			"modification time alone",
+			[]*FIMEntry{passwd},
+			[]*FIMEntry{with(passwd, func(e *FIMEntry) { e.ModTime = e.ModTime.Add(time.Hour) })},
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		index := func(entries []*FIMEntry) map[string]*FIMEntry {
+			m := make(map[string]*FIMEntry)
+			for _, entry := range entries {
+				m[entry.Path] = entry
+			}
+			return m
+		}
+
+		var got []string
+		for _, change := range DiffFIM(index(tt.before), index(tt.after)) {
+			text := change.Path + " " + change.Change
+			if len(change.Fields) > 0 {
+				text += " " + strings.Join(change.Fields, ",")
+			}
+			got = append(got, text)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: changes = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Rescan only looks at the paths it is given: files elsewhere keep their
+// entries even when they changed, and a sibling sharing the directory's
+// name as a prefix is not part of the subtree.
+func TestFIMRescan(t *testing.T) {
+	host := newTestHost(t, map[string]string{
+		"etc/app/a.conf":     "a",
+		"etc/app/sub/b.conf": "b",
+		"etc/apple":          "apple",
+		"etc/other.conf":     "other",
+		"etc/app/a.conf.swp": "swap",
+	})
+	scanner := NewFIMScanner(host, []string{"/etc"}, []string{"*.swp"})
+	entries := scanner.Scan()
+	if _, ok := entries["/etc/app/sub/b.conf"]; !ok {
+		t.Fatalf("scan missed /etc/app/sub/b.conf: %v", slices.Sorted(maps.Keys(entries)))
+	}
+	other := entries["/etc/other.conf"]
+
+	write := func(path, content string) {
+		if err := os.WriteFile(filepath.Join(host.Root, path), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("etc/app/a.conf", "changed")
+	write("etc/app/c.conf", "new")
+	write("etc/other.conf", "changed outside")
+	write("etc/apple", "changed sibling")
+	if err := os.RemoveAll(filepath.Join(host.Root, "etc/app/sub")); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := scanner.Rescan(entries, map[string]bool{"/etc/app": true, "/etc/app/a.conf.swp": true})
+
+	var got []string
+	for _, change := range changes {
+		got = append(got, change.Path+" "+change.Change)
+	}
+	want := []string{
+		"/etc/app/a.conf changed",
+		"/etc/app/c.conf added",
+		"/etc/app/sub removed",
+		"/etc/app/sub/b.conf removed",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("changes = %q, want %q", got, want)
+	}
+
+	for _, path := range []string{"/etc/app/sub", "/etc/app/sub/b.conf", "/etc/app/a.conf.swp"} {
+		if _, ok := entries[path]; ok {
+			t.Errorf("%s still in the entries", path)
+		}
+	}
+	if entries["/etc/app/c.conf"] == nil || entries["/etc/app/a.conf"].Size != int64(len("changed")) {
+		t.Errorf("rescanned entries not applied: %v", slices.Sorted(maps.Keys(entries)))
+	}
+	if entries["/etc/other.conf"] != other {
+		t.Error("/etc/other.conf was rescanned")
+	}
+	if entries["/etc/apple"] == nil || entries["/etc/apple"].Size != int64(len("apple")) {
+		t.Error("/etc/apple was rescanned as part of /etc/app")
+	}
+}
+
+func TestFIMEntryUnreadable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read any file")
+	}
+	host := newTestHost(t, map[string]string{"etc/shadow": "secret"})
+	if err := os.Chmod(filepath.Join(host.Root, "etc/shadow"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, ok := NewFIMScanner(host, nil, nil).Entry("/etc/shadow")
+	if !ok {
+		t.Fatal("no entry for an unreadable file")
+	}
+	if entry.SHA256 != "" || entry.Error != "permission denied" || entry.Size != 6 {
+		t.Errorf("entry = %+v, want size 6, no hash and a permission error", entry)
+	}
+}
+
+// Once ctx is done the watcher stops even when nobody reads its events any
+// more, and closes events to say so.
+func TestWatchPathsStopsOnCancel(t *testing.T) {
+	host := newTestHost(t, map[string]string{"etc/app/a.conf": "a"})
+	scanner := NewFIMScanner(host, []string{"/etc"}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan string)
+	errs := make(chan error, 1)
+	if _, err := watchPaths(ctx, scanner, events, errs); err != nil {
+		t.Skip(err)
+	}
+
+	write := func(name string) {
+		if err := os.WriteFile(filepath.Join(host.Root, "etc/app", name), []byte("changed"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.conf")
+	select {
+	case path := <-events:
+		if path != "/etc/app/a.conf" {
+			t.Errorf("event for %s, want /etc/app/a.conf", path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event for a changed file")
+	}
+
+	// Leave the next event unread so the watcher is blocked sending it
+	write("b.conf")
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	select {
+	case path, ok := <-events:
+		if ok {
+			t.Errorf("watcher still sent %s after the context was cancelled", path)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watcher did not stop after the context was cancelled")
+	}
+	select {
+	case err := <-errs:
+		t.Errorf("cancelling reported %v", err)
+	default:
+	}
+}
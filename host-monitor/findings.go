@@ -0,0 +1,375 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Severities of findings, alerts and vulnerabilities, in increasing order.
+const (
+	SeverityInfo     = "info"
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+var severityRank = map[string]int{
+	SeverityInfo: 0, SeverityLow: 1, SeverityMedium: 2, SeverityHigh: 3, SeverityCritical: 4,
+}
+
+// severityList is for usage and error messages.
+const severityList = "info, low, medium, high or critical"
+
+func validSeverity(severity string) bool {
+	_, ok := severityRank[severity]
+	return ok
+}
+
+// severityPenalty is subtracted from a score of 100 for each unsuppressed
+// finding.
+var severityPenalty = map[string]int{
+	SeverityInfo: 0, SeverityLow: 2, SeverityMedium: 5, SeverityHigh: 10, SeverityCritical: 25,
+}
+
+// Finding is one issue reported by a security check. Path is set when the
+// finding is about a file and is what path suppressions match. Subject
+// names what the finding is about (a path, port, user, address or
+// process) without the measurements and timestamps of Evidence, so it stays
+// the same from scan to scan.
+type Finding struct {
+	ID          string `json:"id"`
+	Severity    string `json:"severity"`
+	Title       string `json:"title"`
+	Evidence    string `json:"evidence"`
+	Remediation string `json:"remediation"`
+	Subject     string `json:"subject,omitempty"`
+	Path        string `json:"path,omitempty"`
+	Suppressed  bool   `json:"suppressed,omitempty"`
+	Reason      string `json:"suppression_reason,omitempty"`
+}
+
+// FindingRule describes a check. Every finding of a rule shares its
+// severity, title and remediation.
+type FindingRule struct {
+	ID          string
+	Severity    string
+	Title       string
+	Description string
+	Remediation string
+}
+
+// findingRules is the catalog of security checks, in report order.
+var findingRules = []FindingRule{
+	{"HM001", SeverityCritical, "Rootkit indicator present",
+		"A file or directory known from rootkits exists.",
+		"Investigate the file offline, compare the host with a known good image and reinstall if it is compromised."},
+	{"HM013", SeverityCritical, "Suspicious listener",
+		"A shell, netcat style relay, deleted executable or binary in a temporary directory accepts connections.",
+		"Treat the host as compromised: capture the process (ls -l /proc/<pid>/exe, /proc/<pid>/cmdline), kill it and investigate how it started."},
+	{"HM002", SeverityHigh, "World-writable file in /etc",
+		"Any local user can modify a system configuration file.",
+		"Remove write permission for others: chmod o-w <file>."},
+	{"HM003", SeverityHigh, "No active firewall",
+		"Neither ufw nor iptables filters incoming traffic.",
+		"Enable a default-deny firewall, e.g. ufw default deny incoming && ufw enable."},
+	{"HM004", SeverityHigh, "Insecure service listening",
+		"A cleartext or legacy remote access service accepts connections.",
+		"Stop and disable the service and use SSH or an encrypted alternative."},
+	{"HM011", SeverityHigh, "Brute-force login attempts",
+		"One address failed to log in many times within a short window.",
+		"Block the address, disable password authentication in sshd_config and check whether any login from it succeeded."},
+	{"HM012", SeverityHigh, "Unexpected listener",
+		"A listening socket is not in the expected listeners policy for this host.",
+		"Stop the service if it is not needed, or add it to the \"listeners\" policy in the config."},
+	{"HM005", SeverityMedium, "Unexpected setuid binary",
+		"A setuid binary outside the usual system set runs with its owner's privileges.",
+		"Check which package owns the binary and remove the setuid bit if it is not needed: chmod u-s <file>."},
+	{"HM006", SeverityMedium, "Failed sudo attempt",
+		"sudo rejected a user, which may be password guessing or privilege escalation.",
+		"Review the user's activity in the auth log and lock the account if the attempt was not theirs."},
+	{"HM007", SeverityMedium, "Process with high CPU usage",
+		"A process uses more CPU than the configured cutoff, a common sign of crypto miners.",
+		"Identify the binary and its parent and stop it if it is not expected."},
+	{"HM008", SeverityLow, "Service listening on all interfaces",
+		"A TCP service accepts connections on every address.",
+		"Bind the service to the addresses that need it or restrict it in the firewall."},
+	{"HM009", SeverityLow, "Recently created user",
+		"useradd created an account in the last 30 days.",
+		"Confirm the account was created on purpose and remove it otherwise."},
+	{"HM010", SeverityInfo, "Recently modified configuration",
+		"A file in /etc changed in the last 7 days.",
+		"Confirm the change was planned; use host-monitor fim for tamper evident tracking."},
+}
+
+func findingRule(id string) (FindingRule, bool) {
+	for _, rule := range findingRules {
+		if rule.ID == id {
+			return rule, true
+		}
+	}
+	return FindingRule{}, false
+}
+
+// standardSetuid are setuid binaries shipped by common distributions.
+var standardSetuid = map[string]bool{
+	"chfn": true, "chsh": true, "gpasswd": true, "mount": true, "newgrp": true, "passwd": true,
+	"su": true, "sudo": true, "umount": true, "ping": true, "ping6": true, "pkexec": true,
+	"fusermount": true, "fusermount3": true, "newgidmap": true, "newuidmap": true, "crontab": true,
+	"at": true, "expiry": true, "chage": true, "unix_chkpwd": true, "ssh-keysign": true,
+	"dbus-daemon-launch-helper": true, "Xorg.wrap": true, "bwrap": true, "busybox": true, "bbsuid": true,
+}
+
+// insecurePorts are legacy cleartext services.
+var insecurePorts = map[string]string{
+	"21": "ftp", "23": "telnet", "69": "tftp", "111": "rpcbind", "512": "rexec", "513": "rlogin", "514": "rsh",
+}
+
+// Suppression hides findings by rule ID, path glob or both. Suppressed
+// findings stay in the report but do not count toward the score.
+type Suppression struct {
+	ID      string `json:"id"`
+	Path    string `json:"path"`
+	Reason  string `json:"reason"`
+	Expires string `json:"expires"`
+}
+
+// Matches reports whether the suppression applies to finding at now. An
+// expired suppression (YYYY-MM-DD, inclusive) matches nothing.
+func (s Suppression) Matches(finding Finding, now time.Time) bool {
+	if s.ID == "" && s.Path == "" {
+		return false
+	}
+	if s.Expires != "" {
+		// The expiry date is a day in now's time zone
+		expires, err := time.ParseInLocation("2006-01-02", s.Expires, now.Location())
+		if err != nil || !now.Before(expires.AddDate(0, 0, 1)) {
+			return false
+		}
+	}
+	if s.ID != "" && s.ID != finding.ID {
+		return false
+	}
+	if s.Path != "" {
+		if finding.Path == "" {
+			return false
+		}
+		if ok, _ := filepath.Match(s.Path, finding.Path); !ok && s.Path != finding.Path {
+			return false
+		}
+	}
+	return true
+}
+
+// pidSuffix is the " (pid 812)" or " (pid 812, root)" after a listener.
+var pidSuffix = regexp.MustCompile(` \(pid [0-9]+[^)]*\)`)
+
+// sudoUserPatterns find the user in sudo's own log lines
+// ("sudo: alice : 3 incorrect password attempts ; ...") and in pam_unix
+// lines ("... authentication failure; logname=alice ... user=alice").
+var sudoUserPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`sudo(?:\[[0-9]+\])?: +([^ :;]+) +: `),
+	regexp.MustCompile(`\buser=([^ ;]+)`),
+}
+
+// sudoUser returns the user of a sudo log line, or the line without its
+// syslog timestamp and host when it names none.
+func sudoUser(line string) string {
+	for _, pattern := range sudoUserPatterns {
+		if match := pattern.FindStringSubmatch(line); match != nil {
+			return match[1]
+		}
+	}
+	if i := strings.Index(line, "sudo"); i >= 0 {
+		return line[i:]
+	}
+	return strings.TrimSpace(line)
+}
+
+// validateSuppressions rejects unknown rule IDs and bad dates, so a typo
+// does not silently suppress nothing.
+func validateSuppressions(suppressions []Suppression) error {
+	for i, s := range suppressions {
+		if s.ID == "" && s.Path == "" {
+			return fmt.Errorf("suppression %d needs an id or a path", i+1)
+		}
+		if _, ok := findingRule(s.ID); s.ID != "" && !ok {
+			return fmt.Errorf("suppression %d: unknown rule %q", i+1, s.ID)
+		}
+		if _, err := filepath.Match(s.Path, ""); err != nil {
+			return fmt.Errorf("suppression %d: invalid path pattern %q", i+1, s.Path)
+		}
+		if _, err := time.Parse("2006-01-02", s.Expires); s.Expires != "" && err != nil {
+			return fmt.Errorf("suppression %d: expires must be YYYY-MM-DD", i+1)
+		}
+	}
+	return nil
+}
+
+// findings turns the results of every check into findings.
+func (ss *SecurityScanner) findings(scan SecurityScan) []Finding {
+	findings := []Finding{}
+	add := func(id, evidence, subject, path string) {
+		rule, _ := findingRule(id)
+		findings = append(findings, Finding{
+			ID:          rule.ID,
+			Severity:    rule.Severity,
+			Title:       rule.Title,
+			Evidence:    evidence,
+			Remediation: rule.Remediation,
+			Subject:     subject,
+			Path:        path,
+		})
+	}
+
+	for _, file := range scan.SuspiciousFiles {
+		add("HM001", file+" exists", file, file)
+	}
+	for _, file := range scan.UnusualPerms {
+		add("HM002", file+" is writable by others", file, file)
+	}
+
+	status := strings.ToLower(scan.FirewallStatus)
+	if status == "" || strings.Contains(status, "no firewall detected") || strings.Contains(status, "status: inactive") {
+		add("HM003", strings.TrimSpace(strings.SplitN(scan.FirewallStatus, "\n", 2)[0]), "firewall", "")
+	}
+
+	seen := make(map[string]bool)
+	for _, port := range scan.OpenPorts {
+		service, ok := insecurePorts[port.Port]
+		key := port.Protocol + "/" + port.Port
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		evidence := fmt.Sprintf("%s port %s (%s) is open", port.Protocol, port.Port, service)
+		if port.Process != "" {
+			evidence += " by " + port.Process
+		}
+		add("HM004", evidence, key, "")
+	}
+
+	for _, attempt := range scan.BruteForce {
+		add("HM011", formatBruteForce(attempt, defaultBruteForceWindow), attempt.SourceIP, "")
+	}
+	for _, listener := range scan.Listeners {
+		subject := strings.TrimSpace(fmt.Sprintf("%s %s %s", listener.Protocol,
+			net.JoinHostPort(listener.Address, strconv.Itoa(listener.Port)), listener.Process))
+		switch {
+		case listener.Suspicious != "":
+			add("HM013", listener.String()+": "+listener.Suspicious, subject, listener.Exe)
+		case listener.Unexpected:
+			add("HM012", listener.String()+" is not expected", subject, listener.Exe)
+		}
+	}
+	for _, binary := range scan.SetuidBinaries {
+		if !standardSetuid[filepath.Base(binary)] {
+			add("HM005", binary+" has the setuid bit", binary, binary)
+		}
+	}
+	for _, line := range scan.SudoLogs {
+		if strings.Contains(line, "authentication failure") || strings.Contains(line, "incorrect password") ||
+			strings.Contains(line, "NOT in sudoers") {
+			add("HM006", strings.TrimSpace(line), sudoUser(line), "")
+		}
+	}
+	for _, process := range scan.HighCPUProcesses {
+		add("HM007", fmt.Sprintf("pid %s (%s) uses %.1f%% CPU: %s", process.PID, process.User, process.CPU, process.Command),
+			process.User+" "+process.Command, "")
+	}
+	for _, service := range scan.ListeningServices {
+		service = strings.Join(strings.Fields(service), " ")
+		add("HM008", service, pidSuffix.ReplaceAllString(service, ""), "")
+	}
+	for _, user := range scan.NewUsers {
+		add("HM009", fmt.Sprintf("user %s created %s", user.Username, user.Created), user.Username, "")
+	}
+	for _, file := range scan.ModifiedFiles {
+		add("HM010", file+" modified in the last 7 days", file, file)
+	}
+
+	now := time.Now()
+	for i := range findings {
+		for _, s := range ss.suppressions {
+			if s.Matches(findings[i], now) {
+				findings[i].Suppressed = true
+				findings[i].Reason = s.Reason
+				break
+			}
+		}
+	}
+
+	// Most severe first, catalog order within a severity
+	sort.SliceStable(findings, func(i, j int) bool {
+		return severityRank[findings[i].Severity] > severityRank[findings[j].Severity]
+	})
+	return findings
+}
+
+// SecurityScore is 100 minus the penalty of every unsuppressed finding,
+// never below 0.
+func SecurityScore(findings []Finding) int {
+	score := 100
+	for _, finding := range findings {
+		if !finding.Suppressed {
+			score -= severityPenalty[finding.Severity]
+		}
+	}
+	if score < 0 {
+		return 0
+	}
+	return score
+}
+
+// countFindings counts unsuppressed findings per severity.
+func countFindings(findings []Finding) map[string]int {
+	counts := map[string]int{}
+	for severity := range severityRank {
+		counts[severity] = 0
+	}
+	for _, finding := range findings {
+		if !finding.Suppressed {
+			counts[finding.Severity]++
+		}
+	}
+	return counts
+}
+
+func severityIcon(severity string) string {
+	switch severity {
+	case SeverityCritical:
+		return "🔥"
+	case SeverityHigh:
+		return "❌"
+	case SeverityMedium:
+		return "⚠️ "
+	case SeverityLow:
+		return "🔸"
+	}
+	return "ℹ️ "
+}
+
+func printFindings(findings []Finding, score int) {
+	counts := countFindings(findings)
+	fmt.Printf("Security score: %d/100 (critical %d, high %d, medium %d, low %d, info %d)\n",
+		score, counts[SeverityCritical], counts[SeverityHigh], counts[SeverityMedium], counts[SeverityLow], counts[SeverityInfo])
+
+	suppressed := 0
+	for _, finding := range findings {
+		if finding.Suppressed {
+			suppressed++
+			continue
+		}
+		fmt.Printf("  %s [%s] %s %s: %s\n", severityIcon(finding.Severity), strings.ToUpper(finding.Severity), finding.ID, finding.Title, finding.Evidence)
+		fmt.Printf("      → %s\n", finding.Remediation)
+	}
+	if suppressed > 0 {
+		fmt.Printf("  (%d suppressed)\n", suppressed)
+	}
+}
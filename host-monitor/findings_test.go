@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// HM005 exists to catch one odd setuid binary among the standard ones, so it
+// must see it wherever find lists it.
+func TestUnexpectedSetuidFinding(t *testing.T) {
+	commands := t.TempDir()
+	standard := []string{"chfn", "chsh", "gpasswd", "mount", "newgrp", "passwd",
+		"su", "sudo", "umount", "ping", "pkexec", "crontab"}
+	var output strings.Builder
+	for _, name := range standard {
+		output.WriteString("/usr/bin/" + name + "\n")
+	}
+	output.WriteString("/usr/bin/rootshell\n")
+	find := commandKey("find", "/usr/bin", "-type", "f", "-perm", "-4000")
+	if err := os.WriteFile(filepath.Join(commands, find), []byte(output.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := NewSecurityScanner()
+	scanner.SetHost(NewHost(t.TempDir(), commands))
+	scan := SecurityScan{SetuidBinaries: scanner.getSetuidBinaries()}
+
+	var subjects []string
+	for _, finding := range scanner.findings(scan) {
+		if finding.ID == "HM005" {
+			subjects = append(subjects, finding.Subject)
+		}
+	}
+	if len(subjects) != 1 || subjects[0] != "/usr/bin/rootshell" {
+		t.Errorf("HM005 subjects = %v, want [/usr/bin/rootshell]", subjects)
+	}
+}
+
+func TestSuppressionMatches(t *testing.T) {
+	shadow := Finding{ID: "HM002", Path: "/etc/shadow"}
+	firewall := Finding{ID: "HM003"}
+	local := time.FixedZone("UTC+2", 2*60*60)
+	noon := time.Date(2026, time.March, 10, 12, 0, 0, 0, local)
+
+	tests := []struct {
+		name        string
+		suppression Suppression
+		finding     Finding
+		now         time.Time
+		want        bool
+	}{
+		{"id", Suppression{ID: "HM002"}, shadow, noon, true},
+		{"other id", Suppression{ID: "HM001"}, shadow, noon, false},
+		{"path glob", Suppression{Path: "/etc/sha*"}, shadow, noon, true},
+		{"exact path", Suppression{Path: "/etc/shadow"}, shadow, noon, true},
+		{"glob stops at slashes", Suppression{Path: "/*"}, shadow, noon, false},
+		{"id and path", Suppression{ID: "HM002", Path: "/etc/*"}, shadow, noon, true},
+		{"id and other path", Suppression{ID: "HM002", Path: "/var/*"}, shadow, noon, false},
+		{"path and other id", Suppression{ID: "HM001", Path: "/etc/*"}, shadow, noon, false},
+		{"path against a finding without one", Suppression{Path: "*"}, firewall, noon, false},
+		{"id against a finding without a path", Suppression{ID: "HM003"}, firewall, noon, true},
+		{"empty", Suppression{}, shadow, noon, false},
+		{"expires later", Suppression{ID: "HM002", Expires: "2026-03-11"}, shadow, noon, true},
+		{"expires today", Suppression{ID: "HM002", Expires: "2026-03-10"}, shadow, noon, true},
+		{
+			"last second of the expiry date",
+			Suppression{ID: "HM002", Expires: "2026-03-10"}, shadow,
+			time.Date(2026, time.March, 10, 23, 59, 59, 0, local), true,
+		},
+		{
+			"midnight after the expiry date",
+			Suppression{ID: "HM002", Expires: "2026-03-10"}, shadow,
+			time.Date(2026, time.March, 11, 0, 0, 0, 0, local), false,
+		},
+		{"expired yesterday", Suppression{ID: "HM002", Expires: "2026-03-09"}, shadow, noon, false},
+		{"bad expiry date", Suppression{ID: "HM002", Expires: "10/03/2026"}, shadow, noon, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.suppression.Matches(tt.finding, tt.now); got != tt.want {
+			t.Errorf("%s: Matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateSuppressions(t *testing.T) {
+	tests := []struct {
+		name        string
+		suppression Suppression
+		wantErr     string
+	}{
+		{"id", Suppression{ID: "HM005", Reason: "vendor tool"}, ""},
+		{"path with expiry", Suppression{Path: "/opt/*/bin/*", Expires: "2026-12-31"}, ""},
+		{"neither", Suppression{Reason: "everything"}, "needs an id or a path"},
+		{"unknown id", Suppression{ID: "HM999"}, `unknown rule "HM999"`},
+		{"lower case id", Suppression{ID: "hm005"}, `unknown rule "hm005"`},
+		{"bad glob", Suppression{Path: "/etc/[shadow"}, `invalid path pattern "/etc/[shadow"`},
+		{"bad date", Suppression{ID: "HM005", Expires: "31.12.2026"}, "expires must be YYYY-MM-DD"},
+		{"impossible date", Suppression{ID: "HM005", Expires: "2026-02-30"}, "expires must be YYYY-MM-DD"},
+	}
+
+	for _, tt := range tests {
+		err := validateSuppressions([]Suppression{{ID: "HM001"}, tt.suppression})
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), "suppression 2") ||
+			!strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: error = %v, want suppression 2 ... %s", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSecurityScore(t *testing.T) {
+	finding := func(severity string, suppressed bool) Finding {
+		return Finding{Severity: severity, Suppressed: suppressed}
+	}
+
+	tests := []struct {
+		name     string
+		findings []Finding
+		want     int
+	}{
+		{"none", nil, 100},
+		{"one of each", []Finding{
+			finding(SeverityCritical, false), finding(SeverityHigh, false), finding(SeverityMedium, false),
+			finding(SeverityLow, false), finding(SeverityInfo, false),
+		}, 58},
+		{"suppressed", []Finding{finding(SeverityCritical, true), finding(SeverityHigh, false)}, 90},
+		{"all suppressed", []Finding{finding(SeverityCritical, true), finding(SeverityCritical, true)}, 100},
+		{"exactly zero", []Finding{
+			finding(SeverityCritical, false), finding(SeverityCritical, false),
+			finding(SeverityCritical, false), finding(SeverityCritical, false),
+		}, 0},
+		{"clamped", []Finding{
+			finding(SeverityCritical, false), finding(SeverityCritical, false), finding(SeverityCritical, false),
+			finding(SeverityCritical, false), finding(SeverityCritical, false),
+		}, 0},
+	}
+
+	for _, tt := range tests {
+		if got := SecurityScore(tt.findings); got != tt.want {
+			t.Errorf("%s: score = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
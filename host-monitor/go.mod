@@ -0,0 +1,3 @@
+module host-monitor
+
+go 1.24
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+type goldenMask struct {
+	pattern *regexp.Regexp
+	replace string
+}
+
+// Timestamps and sample durations change on every run, password ages daily.
+var goldenMasks = map[string][]goldenMask{
+	formatJSON: {
+		{regexp.MustCompile(`("(generated_at|date|timestamp)": )"[^"]*"`), `$1"<time>"`},
+		{regexp.MustCompile(`("interval_ns": )[0-9]+`), `${1}0`},
+		{regexp.MustCompile(`("password_age_days": )[0-9-]+`), `${1}0`},
+	},
+	formatYAML: {
+		{regexp.MustCompile(`(?m)^(\s*(- )?(generated_at|date|timestamp): ).+$`), `$1<time>`},
+		{regexp.MustCompile(`(?m)^(\s*(- )?interval_ns: )[0-9]+$`), `${1}0`},
+		{regexp.MustCompile(`(?m)^(\s*(- )?password_age_days: )[0-9-]+$`), `${1}0`},
+	},
+}
+
+// TestGolden runs every collector against each fixture in testdata and
+// compares the JSON and YAML reports with its golden.json and golden.yaml.
+// config.json points the package collector at testdata/vulndb.json,
+// relative to this directory.
+//
+//	go test -run TestGolden . -update
+func TestGolden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "*", "root"))
+	if err != nil || len(fixtures) == 0 {
+		t.Fatalf("no fixtures in testdata: %v", err)
+	}
+
+	for _, fixture := range fixtures {
+		dir := filepath.Dir(fixture)
+		for _, format := range []string{formatJSON, formatYAML} {
+			t.Run(filepath.Base(dir)+"/"+format, func(t *testing.T) {
+				root := copyFixture(t, fixture)
+				output, code := captureStdout(t, func() int {
+					return runCommand([]string{
+						"--root", root, "--commands", filepath.Join(dir, "commands"),
+						"--config", filepath.Join("testdata", "config.json"),
+						"--sample", "0", "--format", format, "--modules", "all",
+					})
+				})
+				if code != 0 {
+					t.Errorf("run exited with %d", code)
+				}
+				for _, mask := range goldenMasks[format] {
+					output = mask.pattern.ReplaceAll(output, []byte(mask.replace))
+				}
+				output = append(bytes.TrimRight(output, "\n"), '\n')
+
+				golden := filepath.Join(dir, "golden."+format)
+				if *update {
+					if err := os.WriteFile(golden, output, 0644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(output, want) {
+					t.Errorf("output differs from %s; run go test -run TestGolden . -update and review git diff\n%s",
+						golden, firstDifference(want, output))
+				}
+			})
+		}
+	}
+}
+
+// copyFixture copies a fixture root into a temporary directory with fixed
+// modes: git only keeps the executable bit, so a checkout's modes depend on
+// the umask, and the benchmark's permission checks report them. Directories
+// and executables get 0755, other files 0644; symlinks are kept as they are.
+func copyFixture(t *testing.T, src string) string {
+	t.Helper()
+	dst := filepath.Join(t.TempDir(), "root")
+	err := filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case entry.IsDir():
+			if err := os.Mkdir(target, 0755); err != nil {
+				return err
+			}
+			return os.Chmod(target, 0755)
+		case entry.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		mode := os.FileMode(0644)
+		if info.Mode()&0111 != 0 {
+			mode = 0755
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, data, mode); err != nil {
+			return err
+		}
+		return os.Chmod(target, mode)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dst
+}
+
+// captureStdout runs fn with os.Stdout redirected and returns what it wrote.
+func captureStdout(t *testing.T, fn func() int) ([]byte, int) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- data
+	}()
+
+	code := fn()
+	w.Close()
+	return <-done, code
+}
+
+// firstDifference returns the first line where got differs from want.
+func firstDifference(want, got []byte) string {
+	wantLines, gotLines := bytes.Split(want, []byte("\n")), bytes.Split(got, []byte("\n"))
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g []byte
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if !bytes.Equal(w, g) {
+			return fmt.Sprintf("line %d:\n- %s\n+ %s", i+1, w, g)
+		}
+	}
+	return ""
+}
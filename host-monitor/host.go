@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CommandRunner runs external tools. Collectors never call os/exec
+// directly, so fixtures can replay captured output. A cancelled ctx kills
+// the tool.
+type CommandRunner interface {
+	Output(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// ExecRunner runs commands on the live system.
+type ExecRunner struct{}
+
+func (ExecRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).Output()
+}
+
+// NoCommands reports every tool as missing. It is used when --root points
+// at another filesystem, so live command output is never mixed in.
+type NoCommands struct{}
+
+func (NoCommands) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return nil, &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+// FixtureRunner replays command output captured in Dir. Each command is a
+// file named by commandKey, e.g. "df -B1" is stored in "df_-B1". A missing
+// file behaves like a missing tool.
+type FixtureRunner struct {
+	Dir string
+}
+
+func (r FixtureRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(r.Dir, commandKey(name, args...)))
+	if err != nil {
+		return nil, &exec.Error{Name: name, Err: exec.ErrNotFound}
+	}
+	return data, nil
+}
+
+var unsafeKeyChars = regexp.MustCompile(`[^A-Za-z0-9._+%=-]+`)
+
+// commandKey turns a command line into a file name.
+func commandKey(name string, args ...string) string {
+	return unsafeKeyChars.ReplaceAllString(strings.Join(append([]string{name}, args...), "_"), "_")
+}
+
+// Host is the system a collector inspects: a filesystem root and a command
+// runner. LocalHost is the machine host-monitor runs on; any other root is
+// treated as an offline copy, e.g. a fixture or a mounted image.
+type Host struct {
+	Root   string
+	Runner CommandRunner
+
+	// ctx bounds one collection, see WithContext
+	ctx context.Context
+
+	usersOnce sync.Once
+	users     map[int]string
+}
+
+func LocalHost() *Host {
+	return &Host{Root: "/", Runner: ExecRunner{}}
+}
+
+// NewHost returns a host rooted at root. Without a command directory no
+// external tools are run.
+func NewHost(root, commandDir string) *Host {
+	if root == "" || root == "/" {
+		host := LocalHost()
+		if commandDir != "" {
+			host.Runner = FixtureRunner{Dir: commandDir}
+		}
+		return host
+	}
+
+	host := &Host{Root: root, Runner: NoCommands{}}
+	if commandDir != "" {
+		host.Runner = FixtureRunner{Dir: commandDir}
+	}
+	return host
+}
+
+// WithContext returns a copy of the host whose commands, walks and sleeps
+// stop when ctx is done. Collectors get one per run, so a timed out
+// collector does not leave tools or walks running.
+func (h *Host) WithContext(ctx context.Context) *Host {
+	return &Host{Root: h.Root, Runner: h.Runner, ctx: ctx}
+}
+
+// Context returns the host's context, Background unless set by WithContext.
+func (h *Host) Context() context.Context {
+	if h.ctx == nil {
+		return context.Background()
+	}
+	return h.ctx
+}
+
+// Sleep waits for d or until the host's context is done.
+func (h *Host) Sleep(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-h.Context().Done():
+	}
+}
+
+func (h *Host) Live() bool {
+	return h.Root == "/"
+}
+
+// maxSymlinks bounds the links followed while resolving one path, like
+// the kernel's limit of 40.
+const maxSymlinks = 40
+
+// errSymlinkLoop is ELOOP's message; syscall.ELOOP is missing on plan9.
+var errSymlinkLoop = errors.New("too many levels of symbolic links")
+
+// Path maps an absolute host path below the root. Symlinks are resolved
+// inside the root, so an offline copy's absolute link such as
+// /etc/localtime -> /usr/share/zoneinfo/UTC never reaches the live host
+// and ".." stops at the root.
+func (h *Host) Path(path string) (string, error) {
+	return h.resolve(path, true)
+}
+
+// resolve walks path one component at a time below the root, following
+// symlinks except, with followLast false, the last component. Missing
+// components are appended as they are.
+func (h *Host) resolve(path string, followLast bool) (string, error) {
+	if h.Live() {
+		return path, nil
+	}
+	root := filepath.Clean(h.Root)
+
+	current, rest := "/", path
+	for links := 0; ; {
+		var part string
+		part, rest, _ = strings.Cut(strings.TrimLeft(rest, "/"), "/")
+		if part == "" {
+			break
+		}
+		if part == "." {
+			continue
+		}
+		if part == ".." {
+			current = filepath.Dir(current)
+			continue
+		}
+
+		next := filepath.Join(current, part)
+		if rest == "" && !followLast {
+			current = next
+			break
+		}
+		info, err := os.Lstat(filepath.Join(root, next))
+		if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+			current = next
+			continue
+		}
+
+		if links++; links > maxSymlinks {
+			return "", &fs.PathError{Op: "resolve", Path: path, Err: errSymlinkLoop}
+		}
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			current = "/"
+		}
+		rest = target + "/" + rest
+	}
+
+	return filepath.Join(root, current), nil
+}
+
+func (h *Host) ReadFile(path string) ([]byte, error) {
+	resolved, err := h.Path(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(resolved)
+}
+
+func (h *Host) Open(path string) (*os.File, error) {
+	resolved, err := h.Path(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(resolved)
+}
+
+func (h *Host) ReadDir(path string) ([]os.DirEntry, error) {
+	resolved, err := h.Path(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadDir(resolved)
+}
+
+func (h *Host) Stat(path string) (os.FileInfo, error) {
+	resolved, err := h.Path(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(resolved)
+}
+
+func (h *Host) Lstat(path string) (os.FileInfo, error) {
+	resolved, err := h.resolve(path, false)
+	if err != nil {
+		return nil, err
+	}
+	return os.Lstat(resolved)
+}
+
+func (h *Host) Readlink(path string) (string, error) {
+	resolved, err := h.resolve(path, false)
+	if err != nil {
+		return "", err
+	}
+	return os.Readlink(resolved)
+}
+
+// hostPath turns a path below the root back into a host path.
+func (h *Host) hostPath(path string) string {
+	if h.Live() {
+		return path
+	}
+	return "/" + strings.TrimPrefix(strings.TrimPrefix(path, filepath.Clean(h.Root)), "/")
+}
+
+// Glob matches pattern below the root and returns host paths. The
+// directory before the first wildcard is resolved like Path; matches reached
+// through another symlink are dropped, so none of them leave the root.
+func (h *Host) Glob(pattern string) ([]string, error) {
+	if h.Live() {
+		return filepath.Glob(pattern)
+	}
+
+	dir, rest := filepath.Dir(pattern), filepath.Base(pattern)
+	for strings.ContainsAny(dir, "*?[\\") {
+		rest = filepath.Join(filepath.Base(dir), rest)
+		dir = filepath.Dir(dir)
+	}
+	resolved, err := h.Path(dir)
+	if err != nil {
+		return nil, nil
+	}
+
+	matches, err := filepath.Glob(filepath.Join(resolved, rest))
+	if err != nil {
+		return nil, err
+	}
+	var contained []string
+	for _, match := range matches {
+		hostPath := filepath.Join(dir, strings.TrimPrefix(match, resolved))
+		if real, err := h.resolve(hostPath, false); err == nil && real == match {
+			contained = append(contained, hostPath)
+		}
+	}
+	return contained, nil
+}
+
+// WalkDir walks a tree below the root, passing host paths to fn. Like
+// filepath.WalkDir it does not follow symlinks below root. The walk stops
+// with the context's error when the host's context is done.
+func (h *Host) WalkDir(root string, fn fs.WalkDirFunc) error {
+	resolved, err := h.Path(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	ctx := h.Context()
+	return filepath.WalkDir(resolved, func(path string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return fn(h.hostPath(path), d, err)
+	})
+}
+
+func (h *Host) Output(name string, args ...string) ([]byte, error) {
+	return h.Runner.Output(h.Context(), name, args...)
+}
+
+// Hostname returns the live hostname, or /etc/hostname below the root.
+func (h *Host) Hostname() string {
+	if h.Live() {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return "unknown"
+		}
+		return hostname
+	}
+
+	data, err := h.ReadFile("/etc/hostname")
+	if err != nil || strings.TrimSpace(string(data)) == "" {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// UserName resolves a uid through /etc/passwd below the root, falling back
+// to the number.
+func (h *Host) UserName(uid int) string {
+	h.usersOnce.Do(func() {
+		h.users = make(map[int]string)
+
+		file, err := h.Open("/etc/passwd")
+		if err != nil {
+			return
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			// name:password:uid:gid:gecos:home:shell
+			fields := strings.Split(scanner.Text(), ":")
+			if len(fields) < 3 {
+				continue
+			}
+			if id, err := strconv.Atoi(fields[2]); err == nil {
+				if _, seen := h.users[id]; !seen {
+					h.users[id] = fields[0]
+				}
+			}
+		}
+	})
+
+	if name, ok := h.users[uid]; ok {
+		return name
+	}
+	return strconv.Itoa(uid)
+}
+
+// OSRelease identifies the distribution, as read from os-release.
+type OSRelease struct {
+	ID        string   `json:"id"`
+	IDLike    []string `json:"id_like,omitempty"`
+	VersionID string   `json:"version_id"`
+	Codename  string   `json:"codename,omitempty"`
+	Name      string   `json:"name"`
+}
+
+// OSRelease reads /etc/os-release, or /usr/lib/os-release when it is
+// missing. The result is empty when neither exists.
+func (h *Host) OSRelease() OSRelease {
+	var release OSRelease
+	data, err := h.ReadFile("/etc/os-release")
+	if err != nil {
+		if data, err = h.ReadFile("/usr/lib/os-release"); err != nil {
+			return release
+		}
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, "'")
+		}
+		switch key {
+		case "ID":
+			release.ID = value
+		case "ID_LIKE":
+			release.IDLike = strings.Fields(value)
+		case "VERSION_ID":
+			release.VersionID = value
+		case "VERSION_CODENAME":
+			release.Codename = value
+		case "PRETTY_NAME":
+			release.Name = value
+		}
+	}
+	return release
+}
+
+func (h *Host) String() string {
+	if h.Live() {
+		return "local host"
+	}
+	return fmt.Sprintf("root %s", h.Root)
+}
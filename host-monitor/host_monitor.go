@@ -3,65 +3,70 @@ package main
 import (
 	"bufio"
 	"fmt"
-	"os"
-	"os/exec"
 	"strconv"
 	"strings"
 	"time"
 )
 
 type SystemInfo struct {
-	Hostname    string
-	Date        string
-	CPUInfo     CPUInfo
-	RAMInfo     RAMInfo
-	DiskInfo    []DiskInfo
-	NetworkInfo []NetworkInfo
-	Temperature TemperatureInfo
+	Hostname    string          `json:"hostname"`
+	Date        string          `json:"date"`
+	CPUInfo     CPUInfo         `json:"cpu_info"`
+	RAMInfo     RAMInfo         `json:"ram_info"`
+	DiskInfo    []DiskInfo      `json:"disk_info"`
+	NetworkInfo []NetworkInfo   `json:"network_info"`
+	Temperature TemperatureInfo `json:"temperature"`
 }
 
 type CPUInfo struct {
-	ModelName string
-	Sockets   string
-	Threads   string
-	Cores     string
-	CPUs      string
-	MHz       string
+	ModelName string `json:"model_name"`
+	Sockets   string `json:"sockets"`
+	Threads   string `json:"threads"`
+	Cores     string `json:"cores"`
+	CPUs      string `json:"cpus"`
+	MHz       string `json:"mhz"`
 }
 
 type RAMInfo struct {
-	Total     string
-	Used      string
-	Free      string
-	Available string
+	Total     string `json:"total"`
+	Used      string `json:"used"`
+	Free      string `json:"free"`
+	Available string `json:"available"`
 }
 
 type DiskInfo struct {
-	Filesystem string
-	Size       string
-	Used       string
-	Available  string
-	UsePercent string
-	Mounted    string
+	Filesystem string `json:"filesystem"`
+	Size       string `json:"size"`
+	Used       string `json:"used"`
+	Available  string `json:"available"`
+	UsePercent string `json:"use_percent"`
+	Mounted    string `json:"mounted"`
 }
 
 type NetworkInfo struct {
-	Interface string
-	IP        string
-	MAC       string
-	RXBytes   int64
-	TXBytes   int64
+	Interface string `json:"interface"`
+	IP        string `json:"ip"`
+	MAC       string `json:"mac"`
+	RXBytes   int64  `json:"rx_bytes"`
+	TXBytes   int64  `json:"tx_bytes"`
 }
 
 type TemperatureInfo struct {
-	CPUTemp  string
-	DiskTemp []string
+	CPUTemp  string   `json:"cpu_temp"`
+	DiskTemp []string `json:"disk_temp"`
 }
 
-type HostMonitor struct{}
+type HostMonitor struct {
+	host *Host
+}
 
 func NewHostMonitor() *HostMonitor {
-	return &HostMonitor{}
+	return &HostMonitor{host: LocalHost()}
+}
+
+// SetHost points the HostMonitor at another filesystem root or command runner.
+func (hm *HostMonitor) SetHost(host *Host) {
+	hm.host = host
 }
 
 func (hm *HostMonitor) GetSystemInfo() SystemInfo {
@@ -80,18 +85,14 @@ func (hm *HostMonitor) GetSystemInfo() SystemInfo {
 }
 
 func (hm *HostMonitor) getHostname() string {
-	hostname, err := os.Hostname()
-	if err != nil {
-		return "unknown"
-	}
-	return hostname
+	return hm.host.Hostname()
 }
 
 func (hm *HostMonitor) getCPUInfo() CPUInfo {
 	info := CPUInfo{}
 
 	// Read /proc/cpuinfo
-	file, err := os.Open("/proc/cpuinfo")
+	file, err := hm.host.Open("/proc/cpuinfo")
 	if err != nil {
 		return info
 	}
@@ -114,8 +115,7 @@ func (hm *HostMonitor) getCPUInfo() CPUInfo {
 }
 
 func (hm *HostMonitor) getCPUCount() string {
-	cmd := exec.Command("nproc")
-	output, err := cmd.Output()
+	output, err := hm.host.Output("nproc")
 	if err != nil {
 		return "unknown"
 	}
@@ -123,8 +123,7 @@ func (hm *HostMonitor) getCPUCount() string {
 }
 
 func (hm *HostMonitor) getCPUCores() string {
-	cmd := exec.Command("nproc", "--all")
-	output, err := cmd.Output()
+	output, err := hm.host.Output("nproc", "--all")
 	if err != nil {
 		return "unknown"
 	}
@@ -132,8 +131,7 @@ func (hm *HostMonitor) getCPUCores() string {
 }
 
 func (hm *HostMonitor) getCPUThreads() string {
-	cmd := exec.Command("nproc")
-	output, err := cmd.Output()
+	output, err := hm.host.Output("nproc")
 	if err != nil {
 		return "unknown"
 	}
@@ -143,7 +141,7 @@ func (hm *HostMonitor) getCPUThreads() string {
 func (hm *HostMonitor) getRAMInfo() RAMInfo {
 	info := RAMInfo{}
 
-	file, err := os.Open("/proc/meminfo")
+	file, err := hm.host.Open("/proc/meminfo")
 	if err != nil {
 		return info
 	}
@@ -184,8 +182,7 @@ func (hm *HostMonitor) getRAMInfo() RAMInfo {
 func (hm *HostMonitor) getDiskInfo() []DiskInfo {
 	var disks []DiskInfo
 
-	cmd := exec.Command("df", "-hT")
-	output, err := cmd.Output()
+	output, err := hm.host.Output("df", "-hT")
 	if err != nil {
 		return disks
 	}
@@ -197,13 +194,14 @@ func (hm *HostMonitor) getDiskInfo() []DiskInfo {
 		}
 
 		fields := strings.Fields(line)
-		if len(fields) >= 7 && !strings.Contains(fields[6], "tmpfs") {
+		// Filesystem Type Size Used Avail Use% Mounted on
+		if len(fields) >= 7 && !strings.Contains(fields[1], "tmpfs") {
 			disk := DiskInfo{
 				Filesystem: fields[0],
-				Size:       fields[1],
-				Used:       fields[2],
-				Available:  fields[3],
-				UsePercent: fields[4],
+				Size:       fields[2],
+				Used:       fields[3],
+				Available:  fields[4],
+				UsePercent: fields[5],
 				Mounted:    fields[6],
 			}
 			disks = append(disks, disk)
@@ -217,7 +215,7 @@ func (hm *HostMonitor) getNetworkInfo() []NetworkInfo {
 	var networks []NetworkInfo
 
 	// Get network interfaces
-	interfaces, err := os.ReadDir("/sys/class/net")
+	interfaces, err := hm.host.ReadDir("/sys/class/net")
 	if err != nil {
 		return networks
 	}
@@ -246,8 +244,7 @@ func (hm *HostMonitor) getNetworkInfo() []NetworkInfo {
 }
 
 func (hm *HostMonitor) getInterfaceIP(iface string) string {
-	cmd := exec.Command("ip", "addr", "show", iface)
-	output, err := cmd.Output()
+	output, err := hm.host.Output("ip", "addr", "show", iface)
 	if err != nil {
 		return "N/A"
 	}
@@ -268,7 +265,7 @@ func (hm *HostMonitor) getInterfaceIP(iface string) string {
 }
 
 func (hm *HostMonitor) getInterfaceMAC(iface string) string {
-	data, err := os.ReadFile(fmt.Sprintf("/sys/class/net/%s/address", iface))
+	data, err := hm.host.ReadFile(fmt.Sprintf("/sys/class/net/%s/address", iface))
 	if err != nil {
 		return "N/A"
 	}
@@ -276,7 +273,7 @@ func (hm *HostMonitor) getInterfaceMAC(iface string) string {
 }
 
 func (hm *HostMonitor) getInterfaceRXBytes(iface string) int64 {
-	data, err := os.ReadFile(fmt.Sprintf("/sys/class/net/%s/statistics/rx_bytes", iface))
+	data, err := hm.host.ReadFile(fmt.Sprintf("/sys/class/net/%s/statistics/rx_bytes", iface))
 	if err != nil {
 		return 0
 	}
@@ -285,7 +282,7 @@ func (hm *HostMonitor) getInterfaceRXBytes(iface string) int64 {
 }
 
 func (hm *HostMonitor) getInterfaceTXBytes(iface string) int64 {
-	data, err := os.ReadFile(fmt.Sprintf("/sys/class/net/%s/statistics/tx_bytes", iface))
+	data, err := hm.host.ReadFile(fmt.Sprintf("/sys/class/net/%s/statistics/tx_bytes", iface))
 	if err != nil {
 		return 0
 	}
@@ -296,9 +293,21 @@ func (hm *HostMonitor) getInterfaceTXBytes(iface string) int64 {
 func (hm *HostMonitor) getTemperatureInfo() TemperatureInfo {
 	info := TemperatureInfo{}
 
+	if sensors, err := hm.host.readHwmonTemperatures(); err == nil {
+		for _, sensor := range sensors {
+			if sensor.diskChip() {
+				info.DiskTemp = append(info.DiskTemp, sensor.String())
+			} else if info.CPUTemp == "" && sensor.cpuChip() {
+				info.CPUTemp = sensor.String()
+			}
+		}
+		if info.CPUTemp != "" || len(info.DiskTemp) > 0 {
+			return info
+		}
+	}
+
 	// Try to get CPU temperature using sensors
-	cmd := exec.Command("sensors")
-	output, err := cmd.Output()
+	output, err := hm.host.Output("sensors")
 	if err == nil {
 		lines := strings.Split(string(output), "\n")
 		for _, line := range lines {
@@ -310,8 +319,7 @@ func (hm *HostMonitor) getTemperatureInfo() TemperatureInfo {
 	}
 
 	// Try to get disk temperature using hddtemp
-	cmd = exec.Command("hddtemp", "/dev/sda")
-	output, err = cmd.Output()
+	output, err = hm.host.Output("hddtemp", "/dev/sda")
 	if err == nil {
 		info.DiskTemp = append(info.DiskTemp, strings.TrimSpace(string(output)))
 	}
@@ -320,8 +328,11 @@ func (hm *HostMonitor) getTemperatureInfo() TemperatureInfo {
 }
 
 func (hm *HostMonitor) PrintSystemReport() {
-	info := hm.GetSystemInfo()
+	hm.printSystemInfo(hm.GetSystemInfo())
+}
 
+// printSystemInfo writes the text report for an already collected result.
+func (hm *HostMonitor) printSystemInfo(info SystemInfo) {
 	fmt.Println("=== SYSTEM MONITORING REPORT ===")
 	fmt.Printf("Date: %s\n", info.Date)
 	fmt.Printf("Hostname: %s\n", info.Hostname)
@@ -381,8 +392,7 @@ func (hm *HostMonitor) PrintSystemReport() {
 	}
 
 	// Active connections
-	cmd := exec.Command("ss", "-tunap")
-	output, err := cmd.Output()
+	output, err := hm.host.Output("ss", "-tunap")
 	if err == nil {
 		lines := strings.Split(string(output), "\n")
 		fmt.Printf("\nActive network connections: %d\n", len(lines)-1)
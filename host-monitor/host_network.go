@@ -2,74 +2,112 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"io"
+	"math"
 	"net"
 	"os"
-	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
 type NetworkAnalysis struct {
-	Date              string
-	Hostname          string
-	Interfaces        []InterfaceInfo
-	RoutingTable      []RouteInfo
-	DNSInfo           DNSInfo
-	ActiveConnections []ConnectionInfo
-	NetworkStats      NetworkStats
-	FirewallRules     []string
-	BandwidthUsage    []BandwidthInfo
+	Date              string           `json:"date"`
+	Hostname          string           `json:"hostname"`
+	Interfaces        []InterfaceInfo  `json:"interfaces"`
+	RoutingTable      []RouteInfo      `json:"routing_table"`
+	DNSInfo           DNSInfo          `json:"dns_info"`
+	ActiveConnections []ConnectionInfo `json:"active_connections"`
+	NetworkStats      NetworkStats     `json:"network_stats"`
+	FirewallRules     []string         `json:"firewall_rules"`
+	BandwidthUsage    []BandwidthInfo  `json:"bandwidth_usage"`
 }
 
 type InterfaceInfo struct {
-	Name      string
-	IP        string
-	Netmask   string
-	MAC       string
-	Status    string
-	MTU       string
-	RXBytes   int64
-	TXBytes   int64
-	RXPackets int64
-	TXPackets int64
-	RXErrors  int64
-	TXErrors  int64
+	Name      string `json:"name"`
+	IP        string `json:"ip"`
+	Netmask   string `json:"netmask"`
+	MAC       string `json:"mac"`
+	Status    string `json:"status"`
+	MTU       string `json:"mtu"`
+	RXBytes   int64  `json:"rx_bytes"`
+	TXBytes   int64  `json:"tx_bytes"`
+	RXPackets int64  `json:"rx_packets"`
+	TXPackets int64  `json:"tx_packets"`
+	RXErrors  int64  `json:"rx_errors"`
+	TXErrors  int64  `json:"tx_errors"`
 }
 
 type RouteInfo struct {
-	Destination string
-	Gateway     string
-	Interface   string
-	Flags       string
+	Destination string `json:"destination"`
+	Gateway     string `json:"gateway"`
+	Interface   string `json:"interface"`
+	Flags       string `json:"flags"`
 }
 
 type DNSInfo struct {
-	Nameservers []string
-	Domain      string
-	Search      []string
+	Nameservers []string `json:"nameservers"`
+	Domain      string   `json:"domain"`
+	Search      []string `json:"search"`
 }
 
 type NetworkStats struct {
-	TotalConnections int
-	TCPConnections   int
-	UDPConnections   int
-	Established      int
-	Listen           int
+	TotalConnections int `json:"total_connections"`
+	TCPConnections   int `json:"tcp_connections"`
+	UDPConnections   int `json:"udp_connections"`
+	Established      int `json:"established"`
+	Listen           int `json:"listen"`
 }
 
+// BandwidthInfo holds per-second rates measured over Interval.
 type BandwidthInfo struct {
-	Interface string
-	RXRate    int64
-	TXRate    int64
-	Timestamp time.Time
+	Interface    string        `json:"interface"`
+	RXRate       float64       `json:"rx_rate"` // bytes/s
+	TXRate       float64       `json:"tx_rate"` // bytes/s
+	RXPacketRate float64       `json:"rx_packet_rate"`
+	TXPacketRate float64       `json:"tx_packet_rate"`
+	RXErrorRate  float64       `json:"rx_error_rate"`
+	TXErrorRate  float64       `json:"tx_error_rate"`
+	RXDropRate   float64       `json:"rx_drop_rate"`
+	TXDropRate   float64       `json:"tx_drop_rate"`
+	Interval     time.Duration `json:"interval_ns"`
+	Timestamp    time.Time     `json:"timestamp"`
 }
 
-type NetworkAnalyzer struct{}
+// interfaceCounters is one snapshot of /sys/class/net/<iface>/statistics.
+type interfaceCounters struct {
+	rxBytes   uint64
+	txBytes   uint64
+	rxPackets uint64
+	txPackets uint64
+	rxErrors  uint64
+	txErrors  uint64
+	rxDropped uint64
+	txDropped uint64
+	taken     time.Time
+}
+
+type NetworkAnalyzer struct {
+	host           *Host
+	sampleInterval time.Duration
+}
 
 func NewNetworkAnalyzer() *NetworkAnalyzer {
-	return &NetworkAnalyzer{}
+	return &NetworkAnalyzer{host: LocalHost(), sampleInterval: defaultSampleInterval}
+}
+
+// SetHost points the NetworkAnalyzer at another filesystem root or command runner.
+func (na *NetworkAnalyzer) SetHost(host *Host) {
+	na.host = host
+}
+
+// SetSampleInterval sets the window over which bandwidth rates are measured.
+// A zero interval falls back to averages since boot.
+func (na *NetworkAnalyzer) SetSampleInterval(interval time.Duration) {
+	na.sampleInterval = interval
 }
 
 func (na *NetworkAnalyzer) AnalyzeNetwork() NetworkAnalysis {
@@ -90,16 +128,17 @@ func (na *NetworkAnalyzer) AnalyzeNetwork() NetworkAnalysis {
 }
 
 func (na *NetworkAnalyzer) getHostname() string {
-	hostname, err := os.Hostname()
-	if err != nil {
-		return "unknown"
-	}
-	return hostname
+	return na.host.Hostname()
 }
 
 func (na *NetworkAnalyzer) getInterfaces() []InterfaceInfo {
 	var interfaces []InterfaceInfo
 
+	// net.Interfaces only sees the live kernel
+	if !na.host.Live() {
+		return na.getInterfacesFromSysfs()
+	}
+
 	// Get network interfaces
 	ifaces, err := net.Interfaces()
 	if err != nil {
@@ -152,8 +191,61 @@ func (na *NetworkAnalyzer) getInterfaces() []InterfaceInfo {
 	return interfaces
 }
 
+// getInterfacesFromSysfs reads interfaces below the host root, taking the
+// address from "ip addr show".
+func (na *NetworkAnalyzer) getInterfacesFromSysfs() []InterfaceInfo {
+	var interfaces []InterfaceInfo
+
+	entries, err := na.host.ReadDir("/sys/class/net")
+	if err != nil {
+		return interfaces
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == "lo" {
+			continue
+		}
+
+		info := InterfaceInfo{
+			Name:   name,
+			MAC:    na.host.readTrimmed(fmt.Sprintf("/sys/class/net/%s/address", name)),
+			MTU:    na.host.readTrimmed(fmt.Sprintf("/sys/class/net/%s/mtu", name)),
+			Status: "down",
+		}
+		if state := na.host.readTrimmed(fmt.Sprintf("/sys/class/net/%s/operstate", name)); state == "up" || state == "unknown" {
+			info.Status = "up"
+		}
+
+		if output, err := na.host.Output("ip", "addr", "show", name); err == nil {
+			for _, line := range strings.Split(string(output), "\n") {
+				fields := strings.Fields(line)
+				if len(fields) < 2 || fields[0] != "inet" {
+					continue
+				}
+				if _, ipnet, err := net.ParseCIDR(fields[1]); err == nil {
+					info.IP = strings.Split(fields[1], "/")[0]
+					info.Netmask = net.IP(ipnet.Mask).String()
+				}
+				break
+			}
+		}
+
+		info.RXBytes = na.getInterfaceStat(name, "rx_bytes")
+		info.TXBytes = na.getInterfaceStat(name, "tx_bytes")
+		info.RXPackets = na.getInterfaceStat(name, "rx_packets")
+		info.TXPackets = na.getInterfaceStat(name, "tx_packets")
+		info.RXErrors = na.getInterfaceStat(name, "rx_errors")
+		info.TXErrors = na.getInterfaceStat(name, "tx_errors")
+
+		interfaces = append(interfaces, info)
+	}
+
+	return interfaces
+}
+
 func (na *NetworkAnalyzer) getInterfaceStat(iface, stat string) int64 {
-	data, err := os.ReadFile(fmt.Sprintf("/sys/class/net/%s/statistics/%s", iface, stat))
+	data, err := na.host.ReadFile(fmt.Sprintf("/sys/class/net/%s/statistics/%s", iface, stat))
 	if err != nil {
 		return 0
 	}
@@ -164,8 +256,7 @@ func (na *NetworkAnalyzer) getInterfaceStat(iface, stat string) int64 {
 func (na *NetworkAnalyzer) getRoutingTable() []RouteInfo {
 	var routes []RouteInfo
 
-	cmd := exec.Command("ip", "route", "show")
-	output, err := cmd.Output()
+	output, err := na.host.Output("ip", "route", "show")
 	if err != nil {
 		return routes
 	}
@@ -201,7 +292,7 @@ func (na *NetworkAnalyzer) getDNSInfo() DNSInfo {
 	info := DNSInfo{}
 
 	// Read /etc/resolv.conf
-	file, err := os.Open("/etc/resolv.conf")
+	file, err := na.host.Open("/etc/resolv.conf")
 	if err != nil {
 		return info
 	}
@@ -232,10 +323,34 @@ func (na *NetworkAnalyzer) getDNSInfo() DNSInfo {
 }
 
 func (na *NetworkAnalyzer) getActiveConnections() []ConnectionInfo {
+	sockets, err := na.host.readProcSockets()
+	if err != nil {
+		return na.getActiveConnectionsFromSS()
+	}
+
+	var connections []ConnectionInfo
+	owners := na.host.socketOwners()
+	for _, socket := range sockets {
+		conn := ConnectionInfo{
+			Protocol:   socket.Protocol,
+			LocalAddr:  socket.LocalAddr(),
+			RemoteAddr: socket.RemoteAddr(),
+			State:      socket.State,
+		}
+		if owner, ok := owners[socket.Inode]; ok {
+			conn.PID = strconv.Itoa(owner.PID)
+			conn.Program = owner.Name
+		}
+		connections = append(connections, conn)
+	}
+
+	return connections
+}
+
+func (na *NetworkAnalyzer) getActiveConnectionsFromSS() []ConnectionInfo {
 	var connections []ConnectionInfo
 
-	cmd := exec.Command("ss", "-tunap")
-	output, err := cmd.Output()
+	output, err := na.host.Output("ss", "-tunap")
 	if err != nil {
 		return connections
 	}
@@ -283,10 +398,33 @@ func (na *NetworkAnalyzer) getActiveConnections() []ConnectionInfo {
 }
 
 func (na *NetworkAnalyzer) getNetworkStats() NetworkStats {
+	sockets, err := na.host.readProcSockets()
+	if err != nil {
+		return na.getNetworkStatsFromSS()
+	}
+
+	stats := NetworkStats{TotalConnections: len(sockets)}
+	for _, socket := range sockets {
+		if socket.Protocol == "tcp" {
+			stats.TCPConnections++
+		} else {
+			stats.UDPConnections++
+		}
+
+		if socket.State == "ESTABLISHED" {
+			stats.Established++
+		} else if socket.State == "LISTEN" {
+			stats.Listen++
+		}
+	}
+
+	return stats
+}
+
+func (na *NetworkAnalyzer) getNetworkStatsFromSS() NetworkStats {
 	stats := NetworkStats{}
 
-	cmd := exec.Command("ss", "-tunap")
-	output, err := cmd.Output()
+	output, err := na.host.Output("ss", "-tunap")
 	if err != nil {
 		return stats
 	}
@@ -322,8 +460,7 @@ func (na *NetworkAnalyzer) getFirewallRules() []string {
 	var rules []string
 
 	// Check iptables
-	cmd := exec.Command("iptables", "-L", "-n")
-	output, err := cmd.Output()
+	output, err := na.host.Output("iptables", "-L", "-n")
 	if err == nil {
 		lines := strings.Split(string(output), "\n")
 		for i, line := range lines {
@@ -334,8 +471,7 @@ func (na *NetworkAnalyzer) getFirewallRules() []string {
 	}
 
 	// Check UFW
-	cmd = exec.Command("ufw", "status")
-	output, err = cmd.Output()
+	output, err = na.host.Output("ufw", "status")
 	if err == nil {
 		lines := strings.Split(string(output), "\n")
 		for i, line := range lines {
@@ -349,37 +485,180 @@ func (na *NetworkAnalyzer) getFirewallRules() []string {
 }
 
 func (na *NetworkAnalyzer) getBandwidthUsage() []BandwidthInfo {
-	var bandwidth []BandwidthInfo
+	if na.sampleInterval > 0 {
+		before := na.readCounters()
+		na.host.Sleep(na.sampleInterval)
+		return bandwidthRates(before, na.readCounters())
+	}
+
+	// Like CPU usage, no window means averages since boot, when every
+	// counter started at zero
+	uptime := na.host.readUptimeSeconds()
+	if uptime <= 0 {
+		return nil
+	}
+	after := na.readCounters()
+	before := make(map[string]interfaceCounters)
+	for name, counters := range after {
+		before[name] = interfaceCounters{taken: counters.taken.Add(-time.Duration(uptime * float64(time.Second)))}
+	}
+	return bandwidthRates(before, after)
+}
+
+// WatchBandwidth writes bandwidth rates to w every sample interval until
+// ctx is cancelled. Each sample reuses the previous snapshot as its
+// baseline. A zero interval, which means since boot for a single report,
+// watches at the default interval. The menu passes its own writer, so under
+// --format json or yaml the watch stays off stdout.
+func (na *NetworkAnalyzer) WatchBandwidth(ctx context.Context, w io.Writer) {
+	interval := na.sampleInterval
+	if interval <= 0 {
+		interval = defaultSampleInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	fmt.Fprintf(w, "📡 Watching bandwidth every %v (Ctrl+C to stop)\n", interval)
+	previous := na.readCounters()
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(w, "\n⏹️  Bandwidth watch stopped")
+			return
+		case <-ticker.C:
+		}
+
+		current := na.readCounters()
+		fmt.Fprintf(w, "\n[%s]\n", time.Now().Format("15:04:05"))
+		for _, bw := range bandwidthRates(previous, current) {
+			printBandwidth(w, bw)
+		}
+		previous = current
+	}
+}
+
+// readCounters snapshots the statistics of every interface except loopback.
+func (na *NetworkAnalyzer) readCounters() map[string]interfaceCounters {
+	counters := make(map[string]interfaceCounters)
 
-	interfaces, err := os.ReadDir("/sys/class/net")
+	interfaces, err := na.host.ReadDir("/sys/class/net")
 	if err != nil {
-		return bandwidth
+		return counters
 	}
 
 	for _, iface := range interfaces {
-		if iface.Name() == "lo" {
+		name := iface.Name()
+		if name == "lo" {
 			continue
 		}
 
-		rxBytes := na.getInterfaceStat(iface.Name(), "rx_bytes")
-		txBytes := na.getInterfaceStat(iface.Name(), "tx_bytes")
+		stat := func(stat string) uint64 {
+			return uint64(na.getInterfaceStat(name, stat))
+		}
+		counters[name] = interfaceCounters{
+			rxBytes:   stat("rx_bytes"),
+			txBytes:   stat("tx_bytes"),
+			rxPackets: stat("rx_packets"),
+			txPackets: stat("tx_packets"),
+			rxErrors:  stat("rx_errors"),
+			txErrors:  stat("tx_errors"),
+			rxDropped: stat("rx_dropped"),
+			txDropped: stat("tx_dropped"),
+			taken:     time.Now(),
+		}
+	}
+
+	return counters
+}
 
-		info := BandwidthInfo{
-			Interface: iface.Name(),
-			RXRate:    rxBytes,
-			TXRate:    txBytes,
-			Timestamp: time.Now(),
+// bandwidthRates turns two counter snapshots into per-second rates.
+// Interfaces that appeared between the snapshots are skipped.
+func bandwidthRates(before, after map[string]interfaceCounters) []BandwidthInfo {
+	var names []string
+	for name := range after {
+		if _, ok := before[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var bandwidth []BandwidthInfo
+	for _, name := range names {
+		prev, cur := before[name], after[name]
+		elapsed := cur.taken.Sub(prev.taken)
+		if elapsed <= 0 {
+			continue
 		}
 
-		bandwidth = append(bandwidth, info)
+		rate := func(a, b uint64) float64 {
+			return float64(counterDelta(a, b)) / elapsed.Seconds()
+		}
+		bandwidth = append(bandwidth, BandwidthInfo{
+			Interface:    name,
+			RXRate:       rate(prev.rxBytes, cur.rxBytes),
+			TXRate:       rate(prev.txBytes, cur.txBytes),
+			RXPacketRate: rate(prev.rxPackets, cur.rxPackets),
+			TXPacketRate: rate(prev.txPackets, cur.txPackets),
+			RXErrorRate:  rate(prev.rxErrors, cur.rxErrors),
+			TXErrorRate:  rate(prev.txErrors, cur.txErrors),
+			RXDropRate:   rate(prev.rxDropped, cur.rxDropped),
+			TXDropRate:   rate(prev.txDropped, cur.txDropped),
+			Interval:     elapsed,
+			Timestamp:    cur.taken,
+		})
 	}
 
 	return bandwidth
 }
 
+// counterWrapMargin is how close to 2^32 a counter must have been for a
+// decrease to count as a 32-bit wrap: 256 MiB, far more than a driver with
+// 32-bit counters moves in one sample interval.
+const counterWrapMargin = 1 << 28
+
+// counterDelta returns how far a kernel counter advanced. The counters in
+// /sys/class/net are 64-bit on current kernels, so a smaller value almost
+// always means a reset (the interface was recreated, the driver reloaded or
+// the host rebooted) and the new value is the best estimate. Only a counter
+// that was just below 2^32 and is now just above zero is taken to be a
+// 32-bit driver counter that wrapped.
+func counterDelta(prev, cur uint64) uint64 {
+	if cur >= prev {
+		return cur - prev
+	}
+	if prev <= math.MaxUint32 && prev > math.MaxUint32-counterWrapMargin && cur < counterWrapMargin {
+		return cur + (math.MaxUint32 - prev) + 1
+	}
+	return cur
+}
+
+// formatRate renders a bytes/s rate with a binary unit.
+func formatRate(bytesPerSec float64) string {
+	units := []string{"B/s", "KiB/s", "MiB/s", "GiB/s"}
+	i := 0
+	for bytesPerSec >= 1024 && i < len(units)-1 {
+		bytesPerSec /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", bytesPerSec, units[i])
+}
+
+func printBandwidth(w io.Writer, bw BandwidthInfo) {
+	fmt.Fprintf(w, "Interface: %s, RX: %s (%.1f pkt/s), TX: %s (%.1f pkt/s)\n",
+		bw.Interface, formatRate(bw.RXRate), bw.RXPacketRate, formatRate(bw.TXRate), bw.TXPacketRate)
+	if bw.RXErrorRate+bw.TXErrorRate+bw.RXDropRate+bw.TXDropRate > 0 {
+		fmt.Fprintf(w, "  ⚠️  Errors: %.1f/s RX, %.1f/s TX; Drops: %.1f/s RX, %.1f/s TX\n",
+			bw.RXErrorRate, bw.TXErrorRate, bw.RXDropRate, bw.TXDropRate)
+	}
+}
+
 func (na *NetworkAnalyzer) PrintNetworkReport() {
-	analysis := na.AnalyzeNetwork()
+	na.printNetworkAnalysis(na.AnalyzeNetwork())
+}
 
+// printNetworkAnalysis writes the text report for an already collected result.
+func (na *NetworkAnalyzer) printNetworkAnalysis(analysis NetworkAnalysis) {
 	fmt.Println("=== NETWORK ANALYSIS REPORT ===")
 	fmt.Printf("Date: %s\n", analysis.Date)
 	fmt.Printf("Hostname: %s\n", analysis.Hostname)
@@ -447,9 +726,13 @@ func (na *NetworkAnalyzer) PrintNetworkReport() {
 	// Bandwidth Usage
 	fmt.Println("\n7. BANDWIDTH USAGE")
 	fmt.Println("------------------")
+	if na.sampleInterval > 0 {
+		fmt.Printf("Sample interval: %v\n", na.sampleInterval)
+	} else {
+		fmt.Println("Sample interval: since boot")
+	}
 	for _, bw := range analysis.BandwidthUsage {
-		fmt.Printf("Interface: %s, RX: %d bytes, TX: %d bytes\n",
-			bw.Interface, bw.RXRate, bw.TXRate)
+		printBandwidth(os.Stdout, bw)
 	}
 
 	fmt.Println("\n=== NETWORK ANALYSIS COMPLETED ===")
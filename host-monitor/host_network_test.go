@@ -0,0 +1,110 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCounterDelta(t *testing.T) {
+	tests := []struct {
+		name      string
+		prev, cur uint64
+		want      uint64
+	}{
+		{name: "increase", prev: 1000, cur: 5000, want: 4000},
+		{name: "unchanged", prev: 1000, cur: 1000, want: 0},
+		{name: "64-bit increase", prev: math.MaxUint32, cur: math.MaxUint32 + 100, want: 100},
+		{name: "reset", prev: 3_000_000, cur: 2000, want: 2000},
+		{name: "reset of a 64-bit counter", prev: 1 << 40, cur: 2000, want: 2000},
+		{name: "reset just below the wrap margin", prev: math.MaxUint32 - counterWrapMargin, cur: 100, want: 100},
+		{name: "32-bit wrap", prev: math.MaxUint32 - 99, cur: 50, want: 150},
+		{name: "wrap to zero", prev: math.MaxUint32, cur: 0, want: 1},
+		{name: "reset near the top to a large value", prev: math.MaxUint32 - 10, cur: counterWrapMargin + 1, want: counterWrapMargin + 1},
+	}
+
+	for _, tt := range tests {
+		if got := counterDelta(tt.prev, tt.cur); got != tt.want {
+			t.Errorf("%s: counterDelta(%d, %d) = %d, want %d", tt.name, tt.prev, tt.cur, got, tt.want)
+		}
+	}
+}
+
+func TestBandwidthRates(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	later := start.Add(2 * time.Second)
+
+	tests := []struct {
+		name          string
+		before, after map[string]interfaceCounters
+		want          []BandwidthInfo
+	}{
+		{
+			name: "increase",
+			before: map[string]interfaceCounters{
+				"eth0": {rxBytes: 1000, txBytes: 500, rxPackets: 10, txPackets: 4, taken: start},
+			},
+			after: map[string]interfaceCounters{
+				"eth0": {rxBytes: 5000, txBytes: 1500, rxPackets: 30, txPackets: 8, rxErrors: 2, txDropped: 4, taken: later},
+			},
+			want: []BandwidthInfo{{
+				Interface: "eth0", RXRate: 2000, TXRate: 500, RXPacketRate: 10, TXPacketRate: 2,
+				RXErrorRate: 1, TXDropRate: 2, Interval: 2 * time.Second, Timestamp: later,
+			}},
+		},
+		{
+			name: "reset",
+			before: map[string]interfaceCounters{
+				"veth1": {rxBytes: 3_000_000, txBytes: 2_000_000, taken: start},
+			},
+			after: map[string]interfaceCounters{
+				"veth1": {rxBytes: 400, txBytes: 200, taken: later},
+			},
+			want: []BandwidthInfo{{
+				Interface: "veth1", RXRate: 200, TXRate: 100, Interval: 2 * time.Second, Timestamp: later,
+			}},
+		},
+		{
+			name: "32-bit wrap",
+			before: map[string]interfaceCounters{
+				"eth0": {rxBytes: math.MaxUint32 - 999, taken: start},
+			},
+			after: map[string]interfaceCounters{
+				"eth0": {rxBytes: 1000, taken: later},
+			},
+			want: []BandwidthInfo{{
+				Interface: "eth0", RXRate: 1000, Interval: 2 * time.Second, Timestamp: later,
+			}},
+		},
+		{
+			name: "new and vanished interfaces are skipped",
+			before: map[string]interfaceCounters{
+				"eth1": {rxBytes: 100, taken: start},
+				"eth0": {rxBytes: 100, taken: start},
+			},
+			after: map[string]interfaceCounters{
+				"eth0":    {rxBytes: 300, taken: later},
+				"docker0": {rxBytes: 900, taken: later},
+			},
+			want: []BandwidthInfo{{
+				Interface: "eth0", RXRate: 100, Interval: 2 * time.Second, Timestamp: later,
+			}},
+		},
+		{
+			name: "no elapsed time",
+			before: map[string]interfaceCounters{
+				"eth0": {rxBytes: 100, taken: start},
+			},
+			after: map[string]interfaceCounters{
+				"eth0": {rxBytes: 300, taken: start},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := bandwidthRates(tt.before, tt.after); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: bandwidthRates = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
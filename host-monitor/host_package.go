@@ -1,224 +1,154 @@
 package main
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"strconv"
 	"strings"
 	"time"
 )
 
 type PackageInfo struct {
-	Date          string
-	Hostname      string
-	InstalledPkgs []Package
-	AvailablePkgs []Package
-	OutdatedPkgs  []Package
-	SecurityPkgs  []Package
-	PackageStats  PackageStats
-	Repositories  []Repository
-	UpdateHistory []UpdateRecord
+	Date          string         `json:"date"`
+	Hostname      string         `json:"hostname"`
+	OS            OSRelease      `json:"os"`
+	Manager       string         `json:"manager"`
+	InstalledPkgs []Package      `json:"installed_pkgs"`
+	AvailablePkgs []Package      `json:"available_pkgs"`
+	OutdatedPkgs  []Package      `json:"outdated_pkgs"`
+	SecurityPkgs  []Package      `json:"security_pkgs"`
+	PackageStats  PackageStats   `json:"package_stats"`
+	Repositories  []Repository   `json:"repositories"`
+	UpdateHistory []UpdateRecord `json:"update_history"`
+	// Vulnerabilities is nil without a vulnerability database.
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+	// VulnerabilityError is why an existing database could not be read.
+	VulnerabilityError string `json:"vulnerability_error,omitempty"`
+}
+
+func (info PackageInfo) partialError() error {
+	if info.VulnerabilityError != "" {
+		return errors.New(info.VulnerabilityError)
+	}
+	return nil
 }
 
 type Package struct {
-	Name         string
-	Version      string
-	Architecture string
-	Size         string
-	Description  string
-	Status       string
-	Priority     string
-	Section      string
+	Name         string `json:"name"`
+	Version      string `json:"version"`
+	Architecture string `json:"architecture"`
+	Size         string `json:"size"`
+	Description  string `json:"description"`
+	Status       string `json:"status"`
+	Priority     string `json:"priority"`
+	Section      string `json:"section"`
+	Source       string `json:"source,omitempty"`
 }
 
 type PackageStats struct {
-	TotalInstalled int
-	TotalAvailable int
-	TotalOutdated  int
-	TotalSecurity  int
-	TotalSize      int64
+	TotalInstalled  int   `json:"total_installed"`
+	TotalAvailable  int   `json:"total_available"`
+	TotalOutdated   int   `json:"total_outdated"`
+	TotalSecurity   int   `json:"total_security"`
+	TotalSize       int64 `json:"total_size"`
+	TotalVulnerable int   `json:"total_vulnerabilities"`
 }
 
 type Repository struct {
-	Name     string
-	URL      string
-	Enabled  bool
-	Priority int
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Enabled  bool   `json:"enabled"`
+	Priority int    `json:"priority"`
 }
 
 type UpdateRecord struct {
-	Package    string
-	OldVersion string
-	NewVersion string
-	Date       string
+	Package    string `json:"package"`
+	OldVersion string `json:"old_version"`
+	NewVersion string `json:"new_version"`
+	Date       string `json:"date"`
 }
 
-type PackageManager struct{}
+type PackageManager struct {
+	host         *Host
+	vulnDatabase string
+}
 
 func NewPackageManager() *PackageManager {
-	return &PackageManager{}
+	return &PackageManager{host: LocalHost()}
 }
 
-func (pm *PackageManager) GetPackageInfo() PackageInfo {
-	info := PackageInfo{
-		Date:     time.Now().Format("2006-01-02 15:04:05"),
-		Hostname: pm.getHostname(),
-	}
-
-	info.InstalledPkgs = pm.getInstalledPackages()
-	info.AvailablePkgs = pm.getAvailablePackages()
-	info.OutdatedPkgs = pm.getOutdatedPackages()
-	info.SecurityPkgs = pm.getSecurityPackages()
-	info.PackageStats = pm.getPackageStats(info)
-	info.Repositories = pm.getRepositories()
-	info.UpdateHistory = pm.getUpdateHistory()
-
-	return info
+// SetHost points the PackageManager at another filesystem root or command runner.
+func (pm *PackageManager) SetHost(host *Host) {
+	pm.host = host
 }
 
-func (pm *PackageManager) getHostname() string {
-	hostname, err := os.Hostname()
-	if err != nil {
-		return "unknown"
-	}
-	return hostname
+// SetVulnDatabase sets the vulnerability database installed packages are
+// matched against; "" or a missing file skips matching.
+func (pm *PackageManager) SetVulnDatabase(path string) {
+	pm.vulnDatabase = path
 }
 
-func (pm *PackageManager) getInstalledPackages() []Package {
-	var packages []Package
-
-	cmd := exec.Command("dpkg", "-l")
-	output, err := cmd.Output()
-	if err != nil {
-		return packages
-	}
-
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(line, "ii") {
-			fields := strings.Fields(line)
-			if len(fields) >= 4 {
-				pkg := Package{
-					Name:         fields[1],
-					Version:      fields[2],
-					Architecture: fields[3],
-					Description:  strings.Join(fields[4:], " "),
-					Status:       "installed",
-				}
-				packages = append(packages, pkg)
-			}
-		}
+func (pm *PackageManager) GetPackageInfo() PackageInfo {
+	info := PackageInfo{
+		Date:     time.Now().Format("2006-01-02 15:04:05"),
+		Hostname: pm.getHostname(),
+		OS:       pm.host.OSRelease(),
 	}
 
-	return packages
-}
-
-func (pm *PackageManager) getAvailablePackages() []Package {
-	var packages []Package
-
-	cmd := exec.Command("apt", "list", "--upgradable")
-	output, err := cmd.Output()
-	if err != nil {
-		return packages
+	backend := detectPackageBackend(pm.host, info.OS)
+	if backend == nil {
+		return info
 	}
-
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "/") && !strings.HasPrefix(line, "WARNING") {
-			parts := strings.Split(line, "/")
-			if len(parts) >= 2 {
-				nameParts := strings.Split(parts[0], " ")
-				if len(nameParts) >= 1 {
-					pkg := Package{
-						Name:    nameParts[0],
-						Status:  "available",
-						Section: parts[1],
-					}
-					packages = append(packages, pkg)
-				}
-			}
+	info.Manager = backend.Name()
+
+	info.InstalledPkgs = backend.Installed(pm.host)
+	for _, pkg := range backend.Updates(pm.host) {
+		info.AvailablePkgs = append(info.AvailablePkgs, Package{
+			Name:         pkg.Name,
+			Version:      pkg.Version,
+			Architecture: pkg.Architecture,
+			Status:       "available",
+			Section:      pkg.Section,
+		})
+		info.OutdatedPkgs = append(info.OutdatedPkgs, Package{Name: pkg.Name, Status: "outdated"})
+		if pkg.Status == "security" {
+			info.SecurityPkgs = append(info.SecurityPkgs, Package{Name: pkg.Name, Status: "security"})
 		}
 	}
-
-	return packages
-}
-
-func (pm *PackageManager) getOutdatedPackages() []Package {
-	var packages []Package
-
-	cmd := exec.Command("apt", "list", "--upgradable")
-	output, err := cmd.Output()
-	if err != nil {
-		return packages
-	}
-
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "/") && !strings.HasPrefix(line, "WARNING") {
-			parts := strings.Split(line, "/")
-			if len(parts) >= 2 {
-				nameParts := strings.Split(parts[0], " ")
-				if len(nameParts) >= 1 {
-					pkg := Package{
-						Name:   nameParts[0],
-						Status: "outdated",
-					}
-					packages = append(packages, pkg)
-				}
-			}
+	if pm.vulnDatabase != "" {
+		db, err := LoadVulnDatabase(pm.vulnDatabase)
+		switch {
+		case err == nil:
+			info.Vulnerabilities = MatchVulnerabilities(db.Advisories, info.OS, info.InstalledPkgs, backend.CompareVersions)
+		case !errors.Is(err, os.ErrNotExist):
+			info.VulnerabilityError = err.Error()
 		}
 	}
+	info.PackageStats = pm.getPackageStats(info, backend.CacheDir())
+	info.Repositories = backend.Repositories(pm.host)
+	info.UpdateHistory = backend.History(pm.host)
 
-	return packages
+	return info
 }
 
-func (pm *PackageManager) getSecurityPackages() []Package {
-	var packages []Package
-
-	cmd := exec.Command("apt", "list", "--upgradable")
-	output, err := cmd.Output()
-	if err != nil {
-		return packages
-	}
-
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "/") && !strings.HasPrefix(line, "WARNING") {
-			parts := strings.Split(line, "/")
-			if len(parts) >= 2 {
-				nameParts := strings.Split(parts[0], " ")
-				if len(nameParts) >= 1 {
-					// Check if it's a security update
-					if strings.Contains(strings.ToLower(line), "security") {
-						pkg := Package{
-							Name:   nameParts[0],
-							Status: "security",
-						}
-						packages = append(packages, pkg)
-					}
-				}
-			}
-		}
-	}
-
-	return packages
+func (pm *PackageManager) getHostname() string {
+	return pm.host.Hostname()
 }
 
-func (pm *PackageManager) getPackageStats(info PackageInfo) PackageStats {
+func (pm *PackageManager) getPackageStats(info PackageInfo, cacheDir string) PackageStats {
 	stats := PackageStats{
-		TotalInstalled: len(info.InstalledPkgs),
-		TotalAvailable: len(info.AvailablePkgs),
-		TotalOutdated:  len(info.OutdatedPkgs),
-		TotalSecurity:  len(info.SecurityPkgs),
+		TotalInstalled:  len(info.InstalledPkgs),
+		TotalAvailable:  len(info.AvailablePkgs),
+		TotalOutdated:   len(info.OutdatedPkgs),
+		TotalSecurity:   len(info.SecurityPkgs),
+		TotalVulnerable: len(info.Vulnerabilities),
 	}
 
 	// Calculate total size
-	cmd := exec.Command("du", "-sh", "/var/cache/apt/archives")
-	output, err := cmd.Output()
-	if err == nil {
-		stats.TotalSize = pm.parseSize(strings.TrimSpace(string(output)))
+	output, err := pm.host.Output("du", "-sh", cacheDir)
+	if fields := strings.Fields(string(output)); err == nil && len(fields) > 0 {
+		stats.TotalSize = pm.parseSize(fields[0])
 	}
 
 	return stats
@@ -246,98 +176,24 @@ func (pm *PackageManager) parseSize(sizeStr string) int64 {
 	return 0
 }
 
-func (pm *PackageManager) getRepositories() []Repository {
-	var repos []Repository
-
-	// Read sources.list
-	file, err := os.Open("/etc/apt/sources.list")
-	if err != nil {
-		return repos
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if !strings.HasPrefix(line, "#") && strings.TrimSpace(line) != "" {
-			fields := strings.Fields(line)
-			if len(fields) >= 3 {
-				repo := Repository{
-					Name:    fields[2],
-					URL:     fields[1],
-					Enabled: true,
-				}
-				repos = append(repos, repo)
-			}
-		}
-	}
-
-	// Read sources.list.d
-	dir, err := os.ReadDir("/etc/apt/sources.list.d")
-	if err == nil {
-		for _, file := range dir {
-			if strings.HasSuffix(file.Name(), ".list") {
-				filePath := fmt.Sprintf("/etc/apt/sources.list.d/%s", file.Name())
-				content, err := os.ReadFile(filePath)
-				if err == nil {
-					lines := strings.Split(string(content), "\n")
-					for _, line := range lines {
-						if !strings.HasPrefix(line, "#") && strings.TrimSpace(line) != "" {
-							fields := strings.Fields(line)
-							if len(fields) >= 3 {
-								repo := Repository{
-									Name:    fields[2],
-									URL:     fields[1],
-									Enabled: true,
-								}
-								repos = append(repos, repo)
-							}
-						}
-					}
-				}
-			}
-		}
-	}
-
-	return repos
-}
-
-func (pm *PackageManager) getUpdateHistory() []UpdateRecord {
-	var history []UpdateRecord
-
-	// Read dpkg log
-	file, err := os.Open("/var/log/dpkg.log")
-	if err != nil {
-		return history
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, "upgrade") {
-			fields := strings.Fields(line)
-			if len(fields) >= 4 {
-				record := UpdateRecord{
-					Package: fields[3],
-					Date:    fields[0] + " " + fields[1],
-				}
-				history = append(history, record)
-			}
-		}
-	}
-
-	return history
-}
-
 func (pm *PackageManager) PrintPackageReport() {
-	info := pm.GetPackageInfo()
+	pm.printPackageInfo(pm.GetPackageInfo())
+}
 
+// printPackageInfo writes the text report for an already collected result.
+func (pm *PackageManager) printPackageInfo(info PackageInfo) {
 	fmt.Println("=== PACKAGE MANAGER REPORT ===")
 	fmt.Printf("Date: %s\n", info.Date)
 	fmt.Printf("Hostname: %s\n", info.Hostname)
 	fmt.Println("==========================================")
 
+	distribution := firstNonEmpty(info.OS.Name, info.OS.ID, "unknown distribution")
+	if info.Manager == "" {
+		fmt.Printf("\n⚠️  %s: no supported package manager (dpkg, rpm, apk, pacman)\n", distribution)
+	} else {
+		fmt.Printf("\n📦 %s (%s)\n", distribution, info.Manager)
+	}
+
 	// Package Statistics
 	fmt.Println("\n1. PACKAGE STATISTICS")
 	fmt.Println("----------------------")
@@ -361,7 +217,11 @@ func (pm *PackageManager) PrintPackageReport() {
 	fmt.Println("\n3. AVAILABLE UPDATES")
 	fmt.Println("--------------------")
 	for _, pkg := range info.AvailablePkgs {
-		fmt.Printf("%s (%s)\n", pkg.Name, pkg.Section)
+		if pkg.Section != "" {
+			fmt.Printf("%s %s (%s)\n", pkg.Name, pkg.Version, pkg.Section)
+		} else {
+			fmt.Printf("%s %s\n", pkg.Name, pkg.Version)
+		}
 	}
 
 	// Outdated Packages
@@ -395,6 +255,17 @@ func (pm *PackageManager) PrintPackageReport() {
 		fmt.Printf("%s: %s\n", record.Date, record.Package)
 	}
 
+	// Vulnerabilities
+	if info.Vulnerabilities != nil || info.VulnerabilityError != "" {
+		fmt.Println("\n8. VULNERABILITIES")
+		fmt.Println("------------------")
+		if info.VulnerabilityError != "" {
+			fmt.Printf("❌ %s\n", info.VulnerabilityError)
+		} else {
+			printVulnerabilities(info.Vulnerabilities)
+		}
+	}
+
 	fmt.Println("\n=== PACKAGE MANAGER REPORT COMPLETED ===")
 	fmt.Printf("Report completed at: %s\n", time.Now().Format("2006-01-02 15:04:05"))
 }
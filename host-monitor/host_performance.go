@@ -3,69 +3,119 @@ package main
 import (
 	"bufio"
 	"fmt"
-	"os"
-	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
 type PerformanceInfo struct {
-	Date         string
-	Hostname     string
-	CPUUsage     CPUUsage
-	MemoryUsage  MemoryUsage
-	DiskUsage    []DiskUsage
-	NetworkUsage []NetworkUsage
-	ProcessInfo  []ProcessInfo
-	LoadAverage  LoadAverage
-	Uptime       string
-	Temperature  string
+	Date         string         `json:"date"`
+	Hostname     string         `json:"hostname"`
+	CPUUsage     CPUUsage       `json:"cpu_usage"`
+	MemoryUsage  MemoryUsage    `json:"memory_usage"`
+	DiskUsage    []DiskUsage    `json:"disk_usage"`
+	NetworkUsage []NetworkUsage `json:"network_usage"`
+	ProcessInfo  []ProcessInfo  `json:"process_info"`
+	LoadAverage  LoadAverage    `json:"load_average"`
+	Uptime       string         `json:"uptime"`
+	Temperature  string         `json:"temperature"`
 }
 
+// CPUUsage holds utilisation percentages over the sampling interval, or
+// since boot when Interval is 0. Usage is everything except idle and iowait.
 type CPUUsage struct {
-	User   float64
-	System float64
-	Idle   float64
-	IOWait float64
+	Interval time.Duration `json:"interval_ns"`
+	User     float64       `json:"user"`
+	Nice     float64       `json:"nice"`
+	System   float64       `json:"system"`
+	Idle     float64       `json:"idle"`
+	IOWait   float64       `json:"io_wait"`
+	IRQ      float64       `json:"irq"`
+	SoftIRQ  float64       `json:"soft_irq"`
+	Steal    float64       `json:"steal"`
+	Usage    float64       `json:"usage"`
+	Cores    []CoreUsage   `json:"cores"`
+}
+
+type CoreUsage struct {
+	CPU     string  `json:"cpu"`
+	User    float64 `json:"user"`
+	Nice    float64 `json:"nice"`
+	System  float64 `json:"system"`
+	Idle    float64 `json:"idle"`
+	IOWait  float64 `json:"io_wait"`
+	IRQ     float64 `json:"irq"`
+	SoftIRQ float64 `json:"soft_irq"`
+	Steal   float64 `json:"steal"`
+	Usage   float64 `json:"usage"`
+}
+
+// cpuTimes are the cumulative jiffies of one cpu line in /proc/stat. Guest
+// time is already included in user and nice.
+type cpuTimes struct {
+	user    uint64
+	nice    uint64
+	system  uint64
+	idle    uint64
+	iowait  uint64
+	irq     uint64
+	softirq uint64
+	steal   uint64
 }
 
 type MemoryUsage struct {
-	Total     int64
-	Used      int64
-	Free      int64
-	Available int64
-	SwapTotal int64
-	SwapUsed  int64
+	Total     int64 `json:"total"`
+	Used      int64 `json:"used"`
+	Free      int64 `json:"free"`
+	Available int64 `json:"available"`
+	SwapTotal int64 `json:"swap_total"`
+	SwapUsed  int64 `json:"swap_used"`
 }
 
 type DiskUsage struct {
-	Device     string
-	MountPoint string
-	Total      int64
-	Used       int64
-	Available  int64
-	UsePercent float64
+	Device     string  `json:"device"`
+	MountPoint string  `json:"mount_point"`
+	Total      int64   `json:"total"`
+	Used       int64   `json:"used"`
+	Available  int64   `json:"available"`
+	UsePercent float64 `json:"use_percent"`
 }
 
 type NetworkUsage struct {
-	Interface string
-	RXBytes   int64
-	TXBytes   int64
-	RXPackets int64
-	TXPackets int64
+	Interface string `json:"interface"`
+	RXBytes   int64  `json:"rx_bytes"`
+	TXBytes   int64  `json:"tx_bytes"`
+	RXPackets int64  `json:"rx_packets"`
+	TXPackets int64  `json:"tx_packets"`
 }
 
 type LoadAverage struct {
-	OneMin     float64
-	FiveMin    float64
-	FifteenMin float64
+	OneMin     float64 `json:"one_min"`
+	FiveMin    float64 `json:"five_min"`
+	FifteenMin float64 `json:"fifteen_min"`
 }
 
-type PerformanceMonitor struct{}
+const defaultSampleInterval = time.Second
+
+type PerformanceMonitor struct {
+	host           *Host
+	sampleInterval time.Duration
+}
 
 func NewPerformanceMonitor() *PerformanceMonitor {
-	return &PerformanceMonitor{}
+	return &PerformanceMonitor{host: LocalHost(), sampleInterval: defaultSampleInterval}
+}
+
+// SetHost points the PerformanceMonitor at another filesystem root or command runner.
+func (pm *PerformanceMonitor) SetHost(host *Host) {
+	pm.host = host
+}
+
+// SetSampleInterval sets the window over which CPU utilisation is measured.
+// A zero interval falls back to averages since boot.
+func (pm *PerformanceMonitor) SetSampleInterval(interval time.Duration) {
+	pm.sampleInterval = interval
 }
 
 func (pm *PerformanceMonitor) GetPerformanceInfo() PerformanceInfo {
@@ -87,51 +137,129 @@ func (pm *PerformanceMonitor) GetPerformanceInfo() PerformanceInfo {
 }
 
 func (pm *PerformanceMonitor) getHostname() string {
-	hostname, err := os.Hostname()
-	if err != nil {
-		return "unknown"
-	}
-	return hostname
+	return pm.host.Hostname()
 }
 
 func (pm *PerformanceMonitor) getCPUUsage() CPUUsage {
 	usage := CPUUsage{}
 
-	file, err := os.Open("/proc/stat")
-	if err != nil {
+	// Two snapshots of /proc/stat give the utilisation over the interval
+	before, order := pm.readCPUTimes()
+	if len(order) == 0 {
 		return usage
 	}
+	after := before
+	if pm.sampleInterval > 0 {
+		pm.host.Sleep(pm.sampleInterval)
+		after, _ = pm.readCPUTimes()
+		usage.Interval = pm.sampleInterval
+	} else {
+		before = map[string]cpuTimes{}
+	}
+
+	for _, name := range order {
+		core := cpuPercentages(name, before[name], after[name])
+		if name == "cpu" {
+			usage.User = core.User
+			usage.Nice = core.Nice
+			usage.System = core.System
+			usage.Idle = core.Idle
+			usage.IOWait = core.IOWait
+			usage.IRQ = core.IRQ
+			usage.SoftIRQ = core.SoftIRQ
+			usage.Steal = core.Steal
+			usage.Usage = core.Usage
+		} else {
+			usage.Cores = append(usage.Cores, core)
+		}
+	}
+
+	return usage
+}
+
+// readCPUTimes parses the aggregate and per-core cpu lines of /proc/stat.
+func (pm *PerformanceMonitor) readCPUTimes() (map[string]cpuTimes, []string) {
+	times := make(map[string]cpuTimes)
+	var order []string
+
+	file, err := pm.host.Open("/proc/stat")
+	if err != nil {
+		return times, order
+	}
 	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
-	if scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "cpu ") {
-			fields := strings.Fields(line)
-			if len(fields) >= 5 {
-				user, _ := strconv.ParseFloat(fields[1], 64)
-				system, _ := strconv.ParseFloat(fields[3], 64)
-				idle, _ := strconv.ParseFloat(fields[4], 64)
-				iowait, _ := strconv.ParseFloat(fields[5], 64)
-
-				total := user + system + idle + iowait
-				if total > 0 {
-					usage.User = (user / total) * 100
-					usage.System = (system / total) * 100
-					usage.Idle = (idle / total) * 100
-					usage.IOWait = (iowait / total) * 100
-				}
-			}
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
 		}
+
+		values := make([]uint64, 8)
+		for i := 1; i < len(fields) && i <= len(values); i++ {
+			values[i-1], _ = strconv.ParseUint(fields[i], 10, 64)
+		}
+
+		times[fields[0]] = cpuTimes{
+			user:    values[0],
+			nice:    values[1],
+			system:  values[2],
+			idle:    values[3],
+			iowait:  values[4],
+			irq:     values[5],
+			softirq: values[6],
+			steal:   values[7],
+		}
+		order = append(order, fields[0])
 	}
 
-	return usage
+	return times, order
+}
+
+// cpuPercentages converts the difference between two snapshots into
+// percentages of the elapsed jiffies.
+func cpuPercentages(name string, before, after cpuTimes) CoreUsage {
+	core := CoreUsage{CPU: name}
+
+	delta := func(a, b uint64) float64 {
+		if b < a {
+			// Counter reset, e.g. a CPU was hot-plugged
+			return 0
+		}
+		return float64(b - a)
+	}
+
+	user := delta(before.user, after.user)
+	nice := delta(before.nice, after.nice)
+	system := delta(before.system, after.system)
+	idle := delta(before.idle, after.idle)
+	iowait := delta(before.iowait, after.iowait)
+	irq := delta(before.irq, after.irq)
+	softirq := delta(before.softirq, after.softirq)
+	steal := delta(before.steal, after.steal)
+
+	total := user + nice + system + idle + iowait + irq + softirq + steal
+	if total == 0 {
+		return core
+	}
+
+	core.User = user / total * 100
+	core.Nice = nice / total * 100
+	core.System = system / total * 100
+	core.Idle = idle / total * 100
+	core.IOWait = iowait / total * 100
+	core.IRQ = irq / total * 100
+	core.SoftIRQ = softirq / total * 100
+	core.Steal = steal / total * 100
+	core.Usage = 100 - core.Idle - core.IOWait
+
+	return core
 }
 
 func (pm *PerformanceMonitor) getMemoryUsage() MemoryUsage {
 	usage := MemoryUsage{}
 
-	file, err := os.Open("/proc/meminfo")
+	file, err := pm.host.Open("/proc/meminfo")
 	if err != nil {
 		return usage
 	}
@@ -177,8 +305,7 @@ func (pm *PerformanceMonitor) getMemoryUsage() MemoryUsage {
 func (pm *PerformanceMonitor) getDiskUsage() []DiskUsage {
 	var disks []DiskUsage
 
-	cmd := exec.Command("df", "-B1")
-	output, err := cmd.Output()
+	output, err := pm.host.Output("df", "-B1")
 	if err != nil {
 		return disks
 	}
@@ -214,7 +341,7 @@ func (pm *PerformanceMonitor) getDiskUsage() []DiskUsage {
 func (pm *PerformanceMonitor) getNetworkUsage() []NetworkUsage {
 	var networks []NetworkUsage
 
-	interfaces, err := os.ReadDir("/sys/class/net")
+	interfaces, err := pm.host.ReadDir("/sys/class/net")
 	if err != nil {
 		return networks
 	}
@@ -245,7 +372,7 @@ func (pm *PerformanceMonitor) getNetworkUsage() []NetworkUsage {
 }
 
 func (pm *PerformanceMonitor) readNetworkStat(iface, stat string) int64 {
-	data, err := os.ReadFile(fmt.Sprintf("/sys/class/net/%s/statistics/%s", iface, stat))
+	data, err := pm.host.ReadFile(fmt.Sprintf("/sys/class/net/%s/statistics/%s", iface, stat))
 	if err != nil {
 		return 0
 	}
@@ -254,10 +381,37 @@ func (pm *PerformanceMonitor) readNetworkStat(iface, stat string) int64 {
 }
 
 func (pm *PerformanceMonitor) getTopProcesses() []ProcessInfo {
+	procs, err := pm.host.readProcesses()
+	if err != nil {
+		return pm.getTopProcessesFromPS()
+	}
+
+	sort.Slice(procs, func(i, j int) bool {
+		return procs[i].CPU > procs[j].CPU
+	})
+
+	var processes []ProcessInfo
+	for _, p := range procs {
+		processes = append(processes, ProcessInfo{
+			PID:     strconv.Itoa(p.PID),
+			User:    p.User,
+			CPU:     p.CPU,
+			Memory:  p.Memory,
+			Command: p.Cmdline,
+		})
+
+		if len(processes) >= 10 {
+			break
+		}
+	}
+
+	return processes
+}
+
+func (pm *PerformanceMonitor) getTopProcessesFromPS() []ProcessInfo {
 	var processes []ProcessInfo
 
-	cmd := exec.Command("ps", "aux", "--sort=-%cpu")
-	output, err := cmd.Output()
+	output, err := pm.host.Output("ps", "aux", "--sort=-%cpu")
 	if err != nil {
 		return processes
 	}
@@ -294,7 +448,7 @@ func (pm *PerformanceMonitor) getTopProcesses() []ProcessInfo {
 func (pm *PerformanceMonitor) getLoadAverage() LoadAverage {
 	load := LoadAverage{}
 
-	file, err := os.Open("/proc/loadavg")
+	file, err := pm.host.Open("/proc/loadavg")
 	if err != nil {
 		return load
 	}
@@ -315,7 +469,7 @@ func (pm *PerformanceMonitor) getLoadAverage() LoadAverage {
 }
 
 func (pm *PerformanceMonitor) getUptime() string {
-	file, err := os.Open("/proc/uptime")
+	file, err := pm.host.Open("/proc/uptime")
 	if err != nil {
 		return "unknown"
 	}
@@ -338,8 +492,16 @@ func (pm *PerformanceMonitor) getUptime() string {
 }
 
 func (pm *PerformanceMonitor) getTemperature() string {
-	cmd := exec.Command("sensors")
-	output, err := cmd.Output()
+	if sensors, err := pm.host.readHwmonTemperatures(); err == nil {
+		for _, sensor := range sensors {
+			if sensor.cpuChip() {
+				return sensor.String()
+			}
+		}
+		return sensors[0].String()
+	}
+
+	output, err := pm.host.Output("sensors")
 	if err != nil {
 		return "No temperature info available"
 	}
@@ -355,8 +517,11 @@ func (pm *PerformanceMonitor) getTemperature() string {
 }
 
 func (pm *PerformanceMonitor) PrintPerformanceReport() {
-	info := pm.GetPerformanceInfo()
+	pm.printPerformanceInfo(pm.GetPerformanceInfo())
+}
 
+// printPerformanceInfo writes the text report for an already collected result.
+func (pm *PerformanceMonitor) printPerformanceInfo(info PerformanceInfo) {
 	fmt.Println("=== PERFORMANCE MONITORING REPORT ===")
 	fmt.Printf("Date: %s\n", info.Date)
 	fmt.Printf("Hostname: %s\n", info.Hostname)
@@ -366,10 +531,26 @@ func (pm *PerformanceMonitor) PrintPerformanceReport() {
 	// CPU Information
 	fmt.Println("\n1. CPU USAGE")
 	fmt.Println("-------------")
+	if info.CPUUsage.Interval > 0 {
+		fmt.Printf("Sample interval: %v\n", info.CPUUsage.Interval)
+	} else {
+		fmt.Println("Sample interval: since boot")
+	}
+	fmt.Printf("Usage: %.2f%%\n", info.CPUUsage.Usage)
 	fmt.Printf("User: %.2f%%\n", info.CPUUsage.User)
+	fmt.Printf("Nice: %.2f%%\n", info.CPUUsage.Nice)
 	fmt.Printf("System: %.2f%%\n", info.CPUUsage.System)
 	fmt.Printf("Idle: %.2f%%\n", info.CPUUsage.Idle)
 	fmt.Printf("I/O Wait: %.2f%%\n", info.CPUUsage.IOWait)
+	fmt.Printf("IRQ: %.2f%%\n", info.CPUUsage.IRQ)
+	fmt.Printf("SoftIRQ: %.2f%%\n", info.CPUUsage.SoftIRQ)
+	fmt.Printf("Steal: %.2f%%\n", info.CPUUsage.Steal)
+
+	fmt.Println("\nPer-core usage:")
+	for _, core := range info.CPUUsage.Cores {
+		fmt.Printf("  %s: %.2f%% (user %.2f%%, system %.2f%%, iowait %.2f%%, steal %.2f%%)\n",
+			core.CPU, core.Usage, core.User, core.System, core.IOWait, core.Steal)
+	}
 
 	// Load Average
 	fmt.Printf("\nLoad Average: %.2f, %.2f, %.2f\n",
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadCPUTimes(t *testing.T) {
+	pm := NewPerformanceMonitor()
+	pm.SetHost(newTestHost(t, map[string]string{
+		"proc/stat": `cpu  4705 356 584 3699 23 0 10 2 0 0
+cpu0 2350 178 292 1850 12 0 5 1 0 0
+cpu1 2355 178 292 1849 11 0 5 1 0 0
+intr 114930548 113199788 3 0 5 263 0 4 [... lots more numbers ...]
+ctxt 1990473
+cpu2 1 2 3
+procs_running 2
+`,
+	}))
+
+	times, order := pm.readCPUTimes()
+
+	if want := []string{"cpu", "cpu0", "cpu1"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+	want := cpuTimes{user: 2350, nice: 178, system: 292, idle: 1850, iowait: 12, softirq: 5, steal: 1}
+	if times["cpu0"] != want {
+		t.Errorf("cpu0 = %+v, want %+v", times["cpu0"], want)
+	}
+	if _, ok := times["cpu2"]; ok {
+		t.Error("short cpu2 line was parsed")
+	}
+
+	pm.SetHost(newTestHost(t, nil))
+	if times, order := pm.readCPUTimes(); len(times) != 0 || len(order) != 0 {
+		t.Errorf("missing /proc/stat = %v, %v; want nothing", times, order)
+	}
+}
+
+func TestCPUPercentages(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after cpuTimes
+		want          CoreUsage
+	}{
+		{
+			name:   "busy",
+			before: cpuTimes{user: 100, system: 50, idle: 800, iowait: 50},
+			after:  cpuTimes{user: 150, system: 75, idle: 800, iowait: 75},
+			want:   CoreUsage{User: 50, System: 25, IOWait: 25, Usage: 75},
+		},
+		{
+			name:   "all fields",
+			before: cpuTimes{},
+			after:  cpuTimes{user: 10, nice: 10, system: 10, idle: 40, iowait: 10, irq: 5, softirq: 5, steal: 10},
+			want:   CoreUsage{User: 10, Nice: 10, System: 10, Idle: 40, IOWait: 10, IRQ: 5, SoftIRQ: 5, Steal: 10, Usage: 50},
+		},
+		{
+			name:   "no ticks",
+			before: cpuTimes{user: 100, idle: 100},
+			after:  cpuTimes{user: 100, idle: 100},
+			want:   CoreUsage{},
+		},
+		{
+			name:   "counter reset",
+			before: cpuTimes{user: 500, idle: 500},
+			after:  cpuTimes{user: 10, idle: 600},
+			want:   CoreUsage{Idle: 100},
+		},
+	}
+
+	for _, tt := range tests {
+		tt.want.CPU = "cpu0"
+		if got := cpuPercentages("cpu0", tt.before, tt.after); got != tt.want {
+			t.Errorf("%s: cpuPercentages = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// The --sample window reaches the collector through the registry.
+func TestSampleIntervalWiring(t *testing.T) {
+	for _, sample := range []time.Duration{0, 10 * time.Millisecond} {
+		registry, err := newConfiguredRegistry(NewHost(filepath.Join("testdata", "ubuntu", "root"), ""), sample, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		selected, _ := registry.Select("performance")
+		info, ok := registry.Run(context.Background(), selected)[0].Data.(PerformanceInfo)
+		if !ok || info.CPUUsage.Interval != sample {
+			t.Errorf("--sample %v: CPU usage sampled over %v", sample, info.CPUUsage.Interval)
+		}
+	}
+
+	if _, err := newConfiguredRegistry(LocalHost(), -time.Second, ""); err == nil {
+		t.Error("negative --sample was accepted")
+	}
+}
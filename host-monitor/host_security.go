@@ -2,42 +2,74 @@ package main
 
 import (
 	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
 type SecurityScan struct {
-	Date               string
-	Hostname           string
-	OpenPorts          []PortInfo
-	SuspiciousFiles    []string
-	HighCPUProcesses   []ProcessInfo
-	NetworkConnections []ConnectionInfo
-	SudoLogs           []string
-	UserLogins         []string
-	NewUsers           []UserInfo
-	ModifiedFiles      []string
-	UnusualPerms       []string
-	SetuidBinaries     []string
-	FirewallStatus     string
-	ListeningServices  []string
+	Date               string              `json:"date"`
+	Hostname           string              `json:"hostname"`
+	OpenPorts          []PortInfo          `json:"open_ports"`
+	SuspiciousFiles    []string            `json:"suspicious_files"`
+	HighCPUProcesses   []ProcessInfo       `json:"high_cpu_processes"`
+	NetworkConnections []ConnectionInfo    `json:"network_connections"`
+	SudoLogs           []string            `json:"sudo_logs"`
+	UserLogins         []string            `json:"user_logins"`
+	BruteForce         []BruteForceAttempt `json:"brute_force"`
+	NewUsers           []UserInfo          `json:"new_users"`
+	ModifiedFiles      []string            `json:"modified_files"`
+	UnusualPerms       []string            `json:"unusual_perms"`
+	SetuidBinaries     []string            `json:"setuid_binaries"`
+	FirewallStatus     string              `json:"firewall_status"`
+	ListeningServices  []string            `json:"listening_services"`
+	Listeners          []Listener          `json:"listeners"`
+	Findings           []Finding           `json:"findings"`
+	Score              int                 `json:"score"`
 }
 
 type PortInfo struct {
-	Protocol string
-	Port     string
-	Process  string
-	PID      string
+	Protocol string `json:"protocol"`
+	Port     string `json:"port"`
+	Process  string `json:"process"`
+	PID      string `json:"pid"`
 }
 
-type SecurityScanner struct{}
+// defaultHighCPUPercent is the CPU usage above which a process is listed in
+// HighCPUProcesses.
+const defaultHighCPUPercent = 50.0
+
+type SecurityScanner struct {
+	host             *Host
+	highCPUThreshold float64
+	suppressions     []Suppression
+	listenerPolicies []ListenerPolicy
+}
 
 func NewSecurityScanner() *SecurityScanner {
-	return &SecurityScanner{}
+	return &SecurityScanner{host: LocalHost(), highCPUThreshold: defaultHighCPUPercent}
+}
+
+// SetHost points the SecurityScanner at another filesystem root or command runner.
+func (ss *SecurityScanner) SetHost(host *Host) {
+	ss.host = host
+}
+
+// SetHighCPUThreshold sets the CPU percentage above which processes are reported.
+func (ss *SecurityScanner) SetHighCPUThreshold(percent float64) {
+	ss.highCPUThreshold = percent
+}
+
+// SetSuppressions hides matching findings from the score.
+func (ss *SecurityScanner) SetSuppressions(suppressions []Suppression) {
+	ss.suppressions = suppressions
+}
+
+// SetListenerPolicies sets the listeners expected on this host.
+func (ss *SecurityScanner) SetListenerPolicies(policies []ListenerPolicy) {
+	ss.listenerPolicies = policies
 }
 
 func (ss *SecurityScanner) PerformSecurityScan() SecurityScan {
@@ -50,32 +82,73 @@ func (ss *SecurityScanner) PerformSecurityScan() SecurityScan {
 	scan.SuspiciousFiles = ss.checkSuspiciousFiles()
 	scan.HighCPUProcesses = ss.getHighCPUProcesses()
 	scan.NetworkConnections = ss.getNetworkConnections()
-	scan.SudoLogs = ss.getSudoLogs()
-	scan.UserLogins = ss.getUserLogins()
-	scan.NewUsers = ss.getNewUsers()
+	authEvents, _ := readAuthEvents(ss.host, authLogFiles)
+	scan.SudoLogs = ss.getSudoLogs(authEvents)
+	scan.UserLogins = ss.getUserLogins(authEvents)
+	scan.BruteForce = DetectBruteForce(authEvents, defaultBruteForceThreshold, defaultBruteForceWindow)
+	scan.NewUsers = ss.getNewUsers(authEvents)
 	scan.ModifiedFiles = ss.getModifiedFiles()
 	scan.UnusualPerms = ss.getUnusualPermissions()
 	scan.SetuidBinaries = ss.getSetuidBinaries()
 	scan.FirewallStatus = ss.getFirewallStatus()
 	scan.ListeningServices = ss.getListeningServices()
+	scan.Listeners = ss.getListeners(scan.Hostname)
+	scan.Findings = ss.findings(scan)
+	scan.Score = SecurityScore(scan.Findings)
 
 	return scan
 }
 
 func (ss *SecurityScanner) getHostname() string {
-	hostname, err := os.Hostname()
+	return ss.host.Hostname()
+}
+
+func (ss *SecurityScanner) getOpenPorts() []PortInfo {
+	sockets, err := ss.host.readProcSockets()
 	if err != nil {
-		return "unknown"
+		return ss.getOpenPortsFromSS()
 	}
-	return hostname
+
+	var ports []PortInfo
+	owners := ss.host.socketOwners()
+	for _, socket := range sockets {
+		if !socket.Listening() {
+			continue
+		}
+
+		port := PortInfo{
+			Protocol: strings.ToUpper(socket.Protocol),
+			Port:     strconv.Itoa(socket.LocalPort),
+		}
+		if owner, ok := owners[socket.Inode]; ok {
+			port.Process = owner.Name
+			port.PID = strconv.Itoa(owner.PID)
+		}
+		ports = append(ports, port)
+	}
+
+	return ports
 }
 
-func (ss *SecurityScanner) getOpenPorts() []PortInfo {
+// ssProcessPattern matches the first process of the ss -p column
+// users:(("sshd",pid=812,fd=3),...).
+var ssProcessPattern = regexp.MustCompile(`users:\(\("([^"]*)",pid=(\d+)`)
+
+// parseSSProcess returns the name and PID of the process owning a socket in
+// ss -p output; both are empty when ss could not see it.
+func parseSSProcess(line string) (string, string) {
+	match := ssProcessPattern.FindStringSubmatch(line)
+	if match == nil {
+		return "", ""
+	}
+	return match[1], match[2]
+}
+
+func (ss *SecurityScanner) getOpenPortsFromSS() []PortInfo {
 	var ports []PortInfo
 
 	// Get TCP listening ports
-	cmd := exec.Command("ss", "-tlnp")
-	output, err := cmd.Output()
+	output, err := ss.host.Output("ss", "-tlnp")
 	if err == nil {
 		lines := strings.Split(string(output), "\n")
 		for _, line := range lines {
@@ -87,8 +160,8 @@ func (ss *SecurityScanner) getOpenPorts() []PortInfo {
 						port := PortInfo{
 							Protocol: "TCP",
 							Port:     addrParts[len(addrParts)-1],
-							Process:  fields[len(fields)-1],
 						}
+						port.Process, port.PID = parseSSProcess(line)
 						ports = append(ports, port)
 					}
 				}
@@ -97,8 +170,7 @@ func (ss *SecurityScanner) getOpenPorts() []PortInfo {
 	}
 
 	// Get UDP listening ports
-	cmd = exec.Command("ss", "-ulnp")
-	output, err = cmd.Output()
+	output, err = ss.host.Output("ss", "-ulnp")
 	if err == nil {
 		lines := strings.Split(string(output), "\n")
 		for _, line := range lines {
@@ -110,8 +182,8 @@ func (ss *SecurityScanner) getOpenPorts() []PortInfo {
 						port := PortInfo{
 							Protocol: "UDP",
 							Port:     addrParts[len(addrParts)-1],
-							Process:  fields[len(fields)-1],
 						}
+						port.Process, port.PID = parseSSProcess(line)
 						ports = append(ports, port)
 					}
 				}
@@ -135,7 +207,7 @@ func (ss *SecurityScanner) checkSuspiciousFiles() []string {
 	}
 
 	for _, path := range suspiciousPaths {
-		if _, err := os.Stat(path); err == nil {
+		if _, err := ss.host.Stat(path); err == nil {
 			suspicious = append(suspicious, path)
 		}
 	}
@@ -144,17 +216,38 @@ func (ss *SecurityScanner) checkSuspiciousFiles() []string {
 }
 
 func (ss *SecurityScanner) getHighCPUProcesses() []ProcessInfo {
+	procs, err := ss.host.readProcesses()
+	if err != nil {
+		return ss.getHighCPUProcessesFromPS()
+	}
+
 	var processes []ProcessInfo
+	for _, p := range procs {
+		if p.CPU > ss.highCPUThreshold {
+			processes = append(processes, ProcessInfo{
+				PID:     strconv.Itoa(p.PID),
+				User:    p.User,
+				CPU:     p.CPU,
+				Memory:  p.Memory,
+				Command: p.Cmdline,
+			})
+		}
+	}
 
-	cmd := exec.Command("ps", "aux")
-	output, err := cmd.Output()
+	return processes
+}
+
+func (ss *SecurityScanner) getHighCPUProcessesFromPS() []ProcessInfo {
+	var processes []ProcessInfo
+
+	output, err := ss.host.Output("ps", "aux")
 	if err == nil {
 		lines := strings.Split(string(output), "\n")
 		for _, line := range lines {
 			fields := strings.Fields(line)
 			if len(fields) >= 3 {
 				cpu, err := strconv.ParseFloat(fields[2], 64)
-				if err == nil && cpu > 50.0 {
+				if err == nil && cpu > ss.highCPUThreshold {
 					process := ProcessInfo{
 						PID:     fields[1],
 						User:    fields[0],
@@ -171,10 +264,38 @@ func (ss *SecurityScanner) getHighCPUProcesses() []ProcessInfo {
 }
 
 func (ss *SecurityScanner) getNetworkConnections() []ConnectionInfo {
+	sockets, err := ss.host.readProcSockets()
+	if err != nil {
+		return ss.getNetworkConnectionsFromSS()
+	}
+
+	// Count connections per remote address
+	ipCount := make(map[string]int)
+	for _, socket := range sockets {
+		if socket.Listening() || socket.RemoteIP.IsUnspecified() {
+			continue
+		}
+		ipCount[socket.RemoteIP.String()]++
+	}
+
+	var connections []ConnectionInfo
+	for ip, count := range ipCount {
+		connections = append(connections, ConnectionInfo{
+			RemoteIP: ip,
+			Count:    count,
+		})
+	}
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].Count > connections[j].Count
+	})
+
+	return connections
+}
+
+func (ss *SecurityScanner) getNetworkConnectionsFromSS() []ConnectionInfo {
 	var connections []ConnectionInfo
 
-	cmd := exec.Command("ss", "-tun")
-	output, err := cmd.Output()
+	output, err := ss.host.Output("ss", "-tun")
 	if err == nil {
 		lines := strings.Split(string(output), "\n")
 		ipCount := make(map[string]int)
@@ -204,76 +325,36 @@ func (ss *SecurityScanner) getNetworkConnections() []ConnectionInfo {
 	return connections
 }
 
-func (ss *SecurityScanner) getSudoLogs() []string {
-	var logs []string
-
-	logFiles := []string{"/var/log/auth.log", "/var/log/secure"}
-
-	for _, logFile := range logFiles {
-		if _, err := os.Stat(logFile); err == nil {
-			cmd := exec.Command("grep", "sudo:", logFile)
-			output, err := cmd.Output()
-			if err == nil {
-				lines := strings.Split(string(output), "\n")
-				for i, line := range lines {
-					if i < 20 && line != "" {
-						logs = append(logs, line)
-					}
-				}
-			}
-		}
-	}
-
-	return logs
+// getSudoLogs returns the last 20 sudo commands and refusals.
+func (ss *SecurityScanner) getSudoLogs(events []AuthEvent) []string {
+	return lastEvents(events, 20, authSudo, authSudoFailure)
 }
 
-func (ss *SecurityScanner) getUserLogins() []string {
-	var logins []string
-
-	logFiles := []string{"/var/log/auth.log", "/var/log/secure"}
-
-	for _, logFile := range logFiles {
-		if _, err := os.Stat(logFile); err == nil {
-			cmd := exec.Command("grep", "session opened", logFile)
-			output, err := cmd.Output()
-			if err == nil {
-				lines := strings.Split(string(output), "\n")
-				for i, line := range lines {
-					if i < 10 && line != "" {
-						logins = append(logins, line)
-					}
-				}
-			}
-		}
-	}
-
-	return logins
+// getUserLogins returns the last 10 SSH, console and su logins.
+func (ss *SecurityScanner) getUserLogins(events []AuthEvent) []string {
+	return lastEvents(events, 10, authSSHLogin, authLogin, authSu)
 }
 
-func (ss *SecurityScanner) getNewUsers() []UserInfo {
+// getNewUsers lists accounts in /etc/passwd that useradd created in the
+// last 30 days, according to the auth log. Accounts older than the log are
+// covered by "host-monitor accounts", which compares with a saved state.
+func (ss *SecurityScanner) getNewUsers(events []AuthEvent) []UserInfo {
 	var users []UserInfo
 
-	cmd := exec.Command("find", "/home", "-maxdepth", "1", "-type", "d", "-mtime", "-30")
-	output, err := cmd.Output()
-	if err == nil {
-		lines := strings.Split(string(output), "\n")
-		for _, line := range lines {
-			if line != "" {
-				username := filepath.Base(line)
-				if username != "lost+found" {
-					cmd := exec.Command("stat", "-c", "%y", line)
-					statOutput, err := cmd.Output()
-					if err == nil {
-						created := strings.Fields(string(statOutput))[0]
-						user := UserInfo{
-							Username: username,
-							Created:  created,
-						}
-						users = append(users, user)
-					}
-				}
-			}
+	existing := make(map[string]bool)
+	for _, user := range readUsers(ss.host) {
+		existing[user.Name] = true
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -30)
+	for _, event := range events {
+		if event.Type != authUserAdded || event.Time.Before(cutoff) || !existing[event.User] {
+			continue
 		}
+		users = append(users, UserInfo{
+			Username: event.User,
+			Created:  event.Time.Format("2006-01-02"),
+		})
 	}
 
 	return users
@@ -282,8 +363,7 @@ func (ss *SecurityScanner) getNewUsers() []UserInfo {
 func (ss *SecurityScanner) getModifiedFiles() []string {
 	var files []string
 
-	cmd := exec.Command("find", "/etc", "-type", "f", "-mtime", "-7")
-	output, err := cmd.Output()
+	output, err := ss.host.Output("find", "/etc", "-type", "f", "-mtime", "-7")
 	if err == nil {
 		lines := strings.Split(string(output), "\n")
 		for i, line := range lines {
@@ -299,8 +379,7 @@ func (ss *SecurityScanner) getModifiedFiles() []string {
 func (ss *SecurityScanner) getUnusualPermissions() []string {
 	var files []string
 
-	cmd := exec.Command("find", "/etc", "-type", "f", "-perm", "/o+w")
-	output, err := cmd.Output()
+	output, err := ss.host.Output("find", "/etc", "-type", "f", "-perm", "/o+w")
 	if err == nil {
 		lines := strings.Split(string(output), "\n")
 		for i, line := range lines {
@@ -313,38 +392,38 @@ func (ss *SecurityScanner) getUnusualPermissions() []string {
 	return files
 }
 
+// getSetuidBinaries lists every setuid binary, sorted: alert rules and HM005
+// treat each one not seen before as new, so the list must be complete and
+// must not depend on the order find walks in.
 func (ss *SecurityScanner) getSetuidBinaries() []string {
 	var binaries []string
 
 	paths := []string{"/usr/bin", "/usr/sbin", "/bin", "/sbin"}
 
 	for _, path := range paths {
-		cmd := exec.Command("find", path, "-type", "f", "-perm", "-4000")
-		output, err := cmd.Output()
+		output, err := ss.host.Output("find", path, "-type", "f", "-perm", "-4000")
 		if err == nil {
-			lines := strings.Split(string(output), "\n")
-			for i, line := range lines {
-				if i < 10 && line != "" {
+			for _, line := range strings.Split(string(output), "\n") {
+				if line != "" {
 					binaries = append(binaries, line)
 				}
 			}
 		}
 	}
 
+	sort.Strings(binaries)
 	return binaries
 }
 
 func (ss *SecurityScanner) getFirewallStatus() string {
 	// Check UFW
-	cmd := exec.Command("ufw", "status")
-	output, err := cmd.Output()
+	output, err := ss.host.Output("ufw", "status")
 	if err == nil {
 		return string(output)
 	}
 
 	// Check iptables
-	cmd = exec.Command("iptables", "-L")
-	output, err = cmd.Output()
+	output, err = ss.host.Output("iptables", "-L")
 	if err == nil {
 		lines := strings.Split(string(output), "\n")
 		if len(lines) > 20 {
@@ -357,10 +436,33 @@ func (ss *SecurityScanner) getFirewallStatus() string {
 }
 
 func (ss *SecurityScanner) getListeningServices() []string {
+	sockets, err := ss.host.readProcSockets()
+	if err != nil {
+		return ss.getListeningServicesFromSS()
+	}
+
+	// TCP services reachable on every address
+	var services []string
+	owners := ss.host.socketOwners()
+	for _, socket := range sockets {
+		if socket.Protocol != "tcp" || !socket.Listening() || !socket.LocalIP.IsUnspecified() {
+			continue
+		}
+
+		service := fmt.Sprintf("tcp %s", socket.LocalAddr())
+		if owner, ok := owners[socket.Inode]; ok {
+			service += fmt.Sprintf(" %s (pid %d)", owner.Name, owner.PID)
+		}
+		services = append(services, service)
+	}
+
+	return services
+}
+
+func (ss *SecurityScanner) getListeningServicesFromSS() []string {
 	var services []string
 
-	cmd := exec.Command("ss", "-tlnp")
-	output, err := cmd.Output()
+	output, err := ss.host.Output("ss", "-tlnp")
 	if err == nil {
 		lines := strings.Split(string(output), "\n")
 		for _, line := range lines {
@@ -373,9 +475,20 @@ func (ss *SecurityScanner) getListeningServices() []string {
 	return services
 }
 
+// getListeners attributes listening sockets to processes and checks them
+// against the listener policies.
+func (ss *SecurityScanner) getListeners(hostname string) []Listener {
+	listeners := ss.host.readListeners()
+	ApplyListenerPolicies(listeners, ss.listenerPolicies, hostname)
+	return listeners
+}
+
 func (ss *SecurityScanner) PrintSecurityReport() {
-	scan := ss.PerformSecurityScan()
+	ss.printSecurityScan(ss.PerformSecurityScan())
+}
 
+// printSecurityScan writes the text report for an already collected result.
+func (ss *SecurityScanner) printSecurityScan(scan SecurityScan) {
 	fmt.Println("=== SECURITY SCAN REPORT ===")
 	fmt.Printf("Date: %s\n", scan.Date)
 	fmt.Printf("Hostname: %s\n", scan.Hostname)
@@ -432,6 +545,11 @@ func (ss *SecurityScanner) PrintSecurityReport() {
 		fmt.Printf("  %s\n", login)
 	}
 
+	fmt.Printf("\nBrute-force attempts (%d+ failures in %s):\n", defaultBruteForceThreshold, defaultBruteForceWindow)
+	for _, attempt := range scan.BruteForce {
+		fmt.Printf("  🔥 %s\n", formatBruteForce(attempt, defaultBruteForceWindow))
+	}
+
 	fmt.Println("\nUsers created in last 30 days:")
 	for _, user := range scan.NewUsers {
 		fmt.Printf("  New user: %s (created: %s)\n", user.Username, user.Created)
@@ -468,6 +586,34 @@ func (ss *SecurityScanner) PrintSecurityReport() {
 		fmt.Printf("  %s\n", service)
 	}
 
+	fmt.Println("\nListening sockets:")
+	for _, listener := range scan.Listeners {
+		icon := "  "
+		switch {
+		case listener.Suspicious != "":
+			icon = "🔥"
+		case listener.Unexpected:
+			icon = "❌"
+		}
+		fmt.Printf("  %s %s\n", icon, listener)
+		var details []string
+		for _, detail := range []string{listener.Exe, listener.Unit, listener.Container, listener.Suspicious} {
+			if detail != "" {
+				details = append(details, detail)
+			}
+		}
+		if listener.SHA256 != "" {
+			details = append(details, "sha256:"+listener.SHA256[:12])
+		}
+		if len(details) > 0 {
+			fmt.Printf("       %s\n", strings.Join(details, ", "))
+		}
+	}
+
+	fmt.Println("\n6. FINDINGS")
+	fmt.Println("-----------")
+	printFindings(scan.Findings, scan.Score)
+
 	fmt.Println("\n=== SECURITY SCAN COMPLETED ===")
 	fmt.Printf("Scan completed at: %s\n", time.Now().Format("2006-01-02 15:04:05"))
 }
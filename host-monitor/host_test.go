@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newTestHost writes files (path below the root -> content) into a
+// temporary root and returns an offline host for it.
+func newTestHost(t *testing.T, files map[string]string) *Host {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewHost(root, "")
+}
+
+func TestHostPathStaysInRoot(t *testing.T) {
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "shadow"), []byte("live host"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	host := newTestHost(t, map[string]string{
+		"etc/hostname":                   "fixture\n",
+		"usr/share/zoneinfo/UTC":         "TZif",
+		filepath.Join(outside, "shadow"): "fixture shadow",
+	})
+	links := map[string]string{
+		"etc/localtime": "/usr/share/zoneinfo/UTC",
+		"etc/absolute":  filepath.Join(outside, "shadow"),
+		"etc/relative":  "../../../../../../../../" + filepath.Join(outside, "shadow"),
+		"etc/escape":    outside,
+		"etc/loop":      "loop",
+		"lib":           "usr/lib",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(host.Root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path string
+		want string // content, "" when reading must fail
+	}{
+		{"/etc/hostname", "fixture\n"},
+		{"/etc/localtime", "TZif"},
+		{"/etc/../../../etc/hostname", "fixture\n"},
+		{"/etc/absolute", "fixture shadow"},
+		{"/etc/relative", "fixture shadow"},
+		{"/etc/escape/shadow", "fixture shadow"},
+		{"/etc/loop", ""},
+		{"/lib/missing", ""},
+	}
+	for _, tt := range tests {
+		data, err := host.ReadFile(tt.path)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("ReadFile(%q) = %q, want an error", tt.path, data)
+			}
+			continue
+		}
+		if err != nil || string(data) != tt.want {
+			t.Errorf("ReadFile(%q) = %q, %v; want %q", tt.path, data, err, tt.want)
+		}
+	}
+
+	if target, err := host.Readlink("/etc/absolute"); err != nil || target != filepath.Join(outside, "shadow") {
+		t.Errorf("Readlink = %q, %v", target, err)
+	}
+	if info, err := host.Lstat("/etc/localtime"); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Lstat followed the link: %v, %v", info, err)
+	}
+
+	globs := []struct {
+		pattern string
+		want    []string
+	}{
+		{"/etc/escape/*", []string{"/etc/escape/shadow"}},
+		// etc/escape is only followed on the live host after the wildcard
+		{"/e*/escape/*", nil},
+		{"/etc/host*", []string{"/etc/hostname"}},
+	}
+	for _, tt := range globs {
+		matches, err := host.Glob(tt.pattern)
+		if err != nil || !reflect.DeepEqual(matches, tt.want) {
+			t.Errorf("Glob(%q) = %q, %v; want %q", tt.pattern, matches, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Listener is a listening socket with the process that owns it. The
+// process fields are empty when the owner is not visible, e.g. a socket of
+// another user without root.
+type Listener struct {
+	Protocol   string `json:"protocol"`
+	Address    string `json:"address"`
+	Port       int    `json:"port"`
+	UID        int    `json:"uid"`
+	User       string `json:"user"`
+	PID        int    `json:"pid,omitempty"`
+	Process    string `json:"process,omitempty"`
+	Cmdline    string `json:"cmdline,omitempty"`
+	Exe        string `json:"exe,omitempty"`
+	ExeDeleted bool   `json:"exe_deleted,omitempty"`
+	SHA256     string `json:"sha256,omitempty"`
+	Cgroup     string `json:"cgroup,omitempty"`
+	Unit       string `json:"unit,omitempty"`
+	Container  string `json:"container,omitempty"`
+	Runtime    string `json:"runtime,omitempty"`
+	Policy     string `json:"policy,omitempty"`
+	Unexpected bool   `json:"unexpected"`
+	Suspicious string `json:"suspicious,omitempty"`
+}
+
+func (l Listener) String() string {
+	text := fmt.Sprintf("%s %s", l.Protocol, net.JoinHostPort(l.Address, strconv.Itoa(l.Port)))
+	if l.Process != "" {
+		text += fmt.Sprintf(" %s (pid %d, %s)", l.Process, l.PID, l.User)
+	} else {
+		text += fmt.Sprintf(" (%s)", l.User)
+	}
+	return text
+}
+
+// ListenerPolicy lists the listeners expected on the hosts whose name
+// matches one of the Hosts globs; no Hosts means every host.
+type ListenerPolicy struct {
+	Name     string             `json:"name"`
+	Hosts    []string           `json:"hosts"`
+	Expected []ExpectedListener `json:"expected"`
+}
+
+// ExpectedListener matches listeners on every field that is set. Port is a
+// number, a range like 8000-8099 or "*"; Address is an IP or "loopback";
+// Process (the process name) and Exe are globs.
+type ExpectedListener struct {
+	Port     string `json:"port"`
+	Protocol string `json:"protocol"`
+	Address  string `json:"address"`
+	Process  string `json:"process"`
+	Exe      string `json:"exe"`
+	User     string `json:"user"`
+}
+
+// Process names that should never accept connections: shells and relays
+// are what reverse and bind shells run as.
+var (
+	shellNames = map[string]bool{
+		"sh": true, "bash": true, "dash": true, "zsh": true, "ksh": true, "ash": true, "csh": true, "tcsh": true, "fish": true,
+	}
+	relayNames = map[string]bool{"nc": true, "ncat": true, "netcat": true, "socat": true}
+	// Directories anyone can write to
+	tempDirs = []string{"/tmp/", "/var/tmp/", "/dev/shm/"}
+)
+
+// containerCgroupPattern finds the container ID in the cgroup paths of
+// Docker, containerd, CRI-O and Podman.
+var containerCgroupPattern = regexp.MustCompile(`(docker|cri-containerd|crio|libpod)[-/]([0-9a-f]{12,64})(?:\.scope)?`)
+
+// readListeners returns every listening TCP and UDP socket with its owner.
+// Executables are hashed once per path.
+func (h *Host) readListeners() []Listener {
+	sockets, err := h.readProcSockets()
+	if err != nil {
+		return nil
+	}
+
+	owners := h.socketOwners()
+	processes := make(map[int]procProcess)
+	hashes := make(map[string]string)
+
+	var listeners []Listener
+	for _, socket := range sockets {
+		if !socket.Listening() {
+			continue
+		}
+		listener := Listener{
+			Protocol: socket.Protocol,
+			Address:  socket.LocalIP.String(),
+			Port:     socket.LocalPort,
+			UID:      socket.UID,
+			User:     h.UserName(socket.UID),
+		}
+
+		if owner, ok := owners[socket.Inode]; ok {
+			process, ok := processes[owner.PID]
+			if !ok {
+				process, _ = h.readProcess(owner.PID, 0, 0)
+				processes[owner.PID] = process
+			}
+			listener.PID, listener.Process, listener.Cmdline = owner.PID, owner.Name, process.Cmdline
+			listener.Exe, listener.ExeDeleted = h.processExe(owner.PID)
+			if listener.Exe != "" {
+				if _, ok := hashes[listener.Exe]; !ok {
+					hashes[listener.Exe] = h.hashExecutable(owner.PID, listener.Exe, listener.ExeDeleted)
+				}
+				listener.SHA256 = hashes[listener.Exe]
+			}
+			listener.Cgroup, listener.Unit, listener.Container, listener.Runtime = parseCgroup(h.readTrimmed(filepath.Join("/proc", strconv.Itoa(owner.PID), "cgroup")))
+		}
+		listener.Suspicious = suspiciousListener(listener)
+		listeners = append(listeners, listener)
+	}
+	return listeners
+}
+
+// processExe returns the executable of pid and whether it was deleted (or
+// replaced) since the process started.
+func (h *Host) processExe(pid int) (string, bool) {
+	target, err := h.Readlink(filepath.Join("/proc", strconv.Itoa(pid), "exe"))
+	if err != nil {
+		return "", false
+	}
+	if path, ok := strings.CutSuffix(target, " (deleted)"); ok {
+		return path, true
+	}
+	return target, false
+}
+
+// hashExecutable hashes the binary a process runs. On the live host that is
+// /proc/[pid]/exe, which still reads a deleted binary; below another root
+// it is the file at the link target, if the root has it.
+func (h *Host) hashExecutable(pid int, exe string, deleted bool) string {
+	path := exe
+	if h.Live() {
+		path = filepath.Join("/proc", strconv.Itoa(pid), "exe")
+	} else if deleted {
+		return ""
+	}
+
+	file, err := h.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// parseCgroup picks the cgroup of a /proc/[pid]/cgroup file, preferring the
+// unified (v2) hierarchy, and derives the systemd unit and container from
+// it.
+func parseCgroup(content string) (cgroup, unit, container, runtime string) {
+	var unified, systemd, first string
+	for _, line := range strings.Split(content, "\n") {
+		// hierarchy-ID:controllers:path
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		switch {
+		case fields[0] == "0" && fields[1] == "":
+			unified = fields[2]
+		case fields[1] == "name=systemd":
+			systemd = fields[2]
+		case first == "":
+			first = fields[2]
+		}
+	}
+	cgroup = firstNonEmpty(unified, systemd, first)
+
+	if match := containerCgroupPattern.FindStringSubmatch(cgroup); match != nil {
+		runtime, container = match[1], match[2][:12]
+		if runtime == "libpod" {
+			runtime = "podman"
+		}
+	} else if strings.Contains(cgroup, "/kubepods") {
+		runtime = "kubernetes"
+	}
+	for _, part := range strings.Split(cgroup, "/") {
+		if strings.HasSuffix(part, ".service") {
+			unit = part
+		}
+	}
+	return cgroup, unit, container, runtime
+}
+
+// suspiciousListener returns why a listener looks like a backdoor, or "".
+func suspiciousListener(listener Listener) string {
+	switch {
+	case listener.ExeDeleted:
+		return "executable was deleted after start"
+	case shellNames[listener.Process]:
+		return "shell accepting connections"
+	case relayNames[listener.Process]:
+		return "netcat style relay"
+	}
+	for _, dir := range tempDirs {
+		if strings.HasPrefix(listener.Exe, dir) {
+			return "executable in " + strings.TrimSuffix(dir, "/")
+		}
+	}
+	return ""
+}
+
+// ApplyListenerPolicies marks listeners that no policy for hostname
+// expects. Without a policy for the host nothing is unexpected.
+func ApplyListenerPolicies(listeners []Listener, policies []ListenerPolicy, hostname string) {
+	var applicable []ListenerPolicy
+	for _, policy := range policies {
+		if len(policy.Hosts) == 0 {
+			applicable = append(applicable, policy)
+			continue
+		}
+		for _, pattern := range policy.Hosts {
+			if ok, _ := filepath.Match(pattern, hostname); ok {
+				applicable = append(applicable, policy)
+				break
+			}
+		}
+	}
+	if len(applicable) == 0 {
+		return
+	}
+
+	for i := range listeners {
+		listeners[i].Unexpected = true
+	policies:
+		for _, policy := range applicable {
+			for _, expected := range policy.Expected {
+				if expected.Matches(listeners[i]) {
+					listeners[i].Unexpected = false
+					listeners[i].Policy = policy.Name
+					break policies
+				}
+			}
+		}
+	}
+}
+
+// Matches reports whether the listener fits every field that is set.
+func (e ExpectedListener) Matches(listener Listener) bool {
+	if e.Protocol != "" && e.Protocol != listener.Protocol {
+		return false
+	}
+	if e.Port != "" && e.Port != "*" {
+		low, high, _ := parsePortRange(e.Port)
+		if listener.Port < low || listener.Port > high {
+			return false
+		}
+	}
+	if e.Address == "loopback" {
+		if ip := net.ParseIP(listener.Address); ip == nil || !ip.IsLoopback() {
+			return false
+		}
+	} else if e.Address != "" && !net.ParseIP(e.Address).Equal(net.ParseIP(listener.Address)) {
+		return false
+	}
+	if ok, _ := filepath.Match(e.Process, listener.Process); e.Process != "" && !ok {
+		return false
+	}
+	if ok, _ := filepath.Match(e.Exe, listener.Exe); e.Exe != "" && !ok {
+		return false
+	}
+	if e.User != "" && e.User != listener.User {
+		return false
+	}
+	return true
+}
+
+func parsePortRange(value string) (int, int, error) {
+	lowText, highText, isRange := strings.Cut(value, "-")
+	low, err := strconv.Atoi(lowText)
+	if err != nil {
+		return 0, 0, err
+	}
+	high := low
+	if isRange {
+		if high, err = strconv.Atoi(highText); err != nil {
+			return 0, 0, err
+		}
+	}
+	if low < 1 || high > 65535 || low > high {
+		return 0, 0, fmt.Errorf("out of range")
+	}
+	return low, high, nil
+}
+
+// validateListenerPolicies rejects bad ports, protocols, addresses and
+// globs, so a typo does not silently expect nothing.
+func validateListenerPolicies(policies []ListenerPolicy) error {
+	for i, policy := range policies {
+		name := policy.Name
+		if name == "" {
+			name = strconv.Itoa(i + 1)
+		}
+		for _, pattern := range policy.Hosts {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("listener policy %s: invalid host pattern %q", name, pattern)
+			}
+		}
+		for j, expected := range policy.Expected {
+			if _, _, err := parsePortRange(expected.Port); expected.Port != "" && expected.Port != "*" && err != nil {
+				return fmt.Errorf("listener policy %s, entry %d: invalid port %q (use 22, 8000-8099 or *)", name, j+1, expected.Port)
+			}
+			if expected.Protocol != "" && expected.Protocol != "tcp" && expected.Protocol != "udp" {
+				return fmt.Errorf("listener policy %s, entry %d: protocol must be tcp or udp", name, j+1)
+			}
+			if expected.Address != "" && expected.Address != "loopback" && net.ParseIP(expected.Address) == nil {
+				return fmt.Errorf("listener policy %s, entry %d: invalid address %q", name, j+1, expected.Address)
+			}
+			for _, pattern := range []string{expected.Process, expected.Exe} {
+				if _, err := filepath.Match(pattern, ""); err != nil {
+					return fmt.Errorf("listener policy %s, entry %d: invalid pattern %q", name, j+1, pattern)
+				}
+			}
+		}
+	}
+	return nil
+}
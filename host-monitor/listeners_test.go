@@ -0,0 +1,266 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		value     string
+		low, high int
+		wantErr   bool
+	}{
+		{value: "22", low: 22, high: 22},
+		{value: "8000-8099", low: 8000, high: 8099},
+		{value: "1-65535", low: 1, high: 65535},
+		{value: "443-443", low: 443, high: 443},
+		{value: "0", wantErr: true},
+		{value: "65536", wantErr: true},
+		{value: "9000-8000", wantErr: true},
+		{value: "8000-", wantErr: true},
+		{value: "-80", wantErr: true},
+		{value: "ssh", wantErr: true},
+		{value: "*", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		low, high, err := parsePortRange(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePortRange(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (low != tt.low || high != tt.high) {
+			t.Errorf("parsePortRange(%q) = %d, %d; want %d, %d", tt.value, low, high, tt.low, tt.high)
+		}
+	}
+}
+
+func TestExpectedListenerMatches(t *testing.T) {
+	sshd := Listener{Protocol: "tcp", Address: "0.0.0.0", Port: 22, User: "root", Process: "sshd", Exe: "/usr/sbin/sshd"}
+	redis := Listener{Protocol: "tcp", Address: "127.0.0.1", Port: 6379, User: "redis", Process: "redis-server", Exe: "/usr/bin/redis-server"}
+	redis6 := Listener{Protocol: "tcp", Address: "::1", Port: 6379, User: "redis", Process: "redis-server"}
+	mapped := Listener{Protocol: "tcp", Address: "::ffff:127.0.0.1", Port: 6379, Process: "redis-server"}
+	public6 := Listener{Protocol: "tcp", Address: "::", Port: 6379, Process: "redis-server"}
+	dns := Listener{Protocol: "udp", Address: "127.0.0.53", Port: 53, User: "systemd-resolve", Process: "systemd-resolve"}
+	app := Listener{Protocol: "tcp", Address: "10.0.2.15", Port: 8042, User: "app", Process: "gunicorn", Exe: "/opt/app/venv/bin/python3.11"}
+
+	tests := []struct {
+		name     string
+		expected ExpectedListener
+		listener Listener
+		want     bool
+	}{
+		{name: "empty matches anything", expected: ExpectedListener{}, listener: app, want: true},
+		{name: "port", expected: ExpectedListener{Port: "22"}, listener: sshd, want: true},
+		{name: "other port", expected: ExpectedListener{Port: "2222"}, listener: sshd, want: false},
+		{name: "star port", expected: ExpectedListener{Port: "*", Process: "sshd"}, listener: sshd, want: true},
+		{name: "range low end", expected: ExpectedListener{Port: "8042-8099"}, listener: app, want: true},
+		{name: "range high end", expected: ExpectedListener{Port: "8000-8042"}, listener: app, want: true},
+		{name: "below range", expected: ExpectedListener{Port: "8043-8099"}, listener: app, want: false},
+		{name: "above range", expected: ExpectedListener{Port: "8000-8041"}, listener: app, want: false},
+		{name: "protocol", expected: ExpectedListener{Port: "53", Protocol: "udp"}, listener: dns, want: true},
+		{name: "other protocol", expected: ExpectedListener{Port: "53", Protocol: "tcp"}, listener: dns, want: false},
+		{name: "loopback IPv4", expected: ExpectedListener{Address: "loopback"}, listener: redis, want: true},
+		{name: "loopback 127.0.0.53", expected: ExpectedListener{Address: "loopback"}, listener: dns, want: true},
+		{name: "loopback IPv6", expected: ExpectedListener{Address: "loopback"}, listener: redis6, want: true},
+		{name: "loopback IPv4-mapped", expected: ExpectedListener{Address: "loopback"}, listener: mapped, want: true},
+		{name: "loopback does not match any address", expected: ExpectedListener{Address: "loopback"}, listener: sshd, want: false},
+		{name: "loopback does not match IPv6 any", expected: ExpectedListener{Address: "loopback"}, listener: public6, want: false},
+		{name: "exact address", expected: ExpectedListener{Address: "10.0.2.15"}, listener: app, want: true},
+		{name: "IPv6 address spelled differently", expected: ExpectedListener{Address: "0:0:0:0:0:0:0:1"}, listener: redis6, want: true},
+		{name: "other address", expected: ExpectedListener{Address: "10.0.2.16"}, listener: app, want: false},
+		{name: "process glob", expected: ExpectedListener{Process: "redis-*"}, listener: redis, want: true},
+		{name: "process glob mismatch", expected: ExpectedListener{Process: "redis-*"}, listener: sshd, want: false},
+		{name: "exe glob", expected: ExpectedListener{Exe: "/opt/app/*/bin/python3*"}, listener: app, want: true},
+		{name: "exe glob needs an exe", expected: ExpectedListener{Exe: "/usr/bin/*"}, listener: redis6, want: false},
+		{name: "user", expected: ExpectedListener{Port: "6379", User: "redis"}, listener: redis, want: true},
+		{name: "other user", expected: ExpectedListener{Port: "6379", User: "root"}, listener: redis, want: false},
+		{
+			name:     "every field",
+			expected: ExpectedListener{Port: "22", Protocol: "tcp", Address: "0.0.0.0", Process: "sshd", Exe: "/usr/sbin/sshd", User: "root"},
+			listener: sshd, want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.expected.Matches(tt.listener); got != tt.want {
+			t.Errorf("%s: Matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApplyListenerPolicies(t *testing.T) {
+	listeners := func() []Listener {
+		return []Listener{
+			{Protocol: "tcp", Address: "0.0.0.0", Port: 22, Process: "sshd"},
+			{Protocol: "tcp", Address: "127.0.0.1", Port: 5432, Process: "postgres"},
+			{Protocol: "tcp", Address: "0.0.0.0", Port: 4444, Process: "nc"},
+		}
+	}
+	base := ListenerPolicy{Name: "base", Expected: []ExpectedListener{{Port: "22", Process: "sshd"}}}
+	database := ListenerPolicy{Name: "database", Hosts: []string{"db-*", "pg.example.com"},
+		Expected: []ExpectedListener{{Port: "5432", Address: "loopback"}}}
+	web := ListenerPolicy{Name: "web", Hosts: []string{"web-*"}, Expected: []ExpectedListener{{Port: "80"}, {Port: "443"}}}
+
+	tests := []struct {
+		name     string
+		policies []ListenerPolicy
+		hostname string
+		// policy per listener, "!" for unexpected and "" for not checked
+		want []string
+	}{
+		{name: "no policies", policies: nil, hostname: "db-01", want: []string{"", "", ""}},
+		{name: "no policy for the host", policies: []ListenerPolicy{database, web}, hostname: "cache-01", want: []string{"", "", ""}},
+		{name: "host glob", policies: []ListenerPolicy{database}, hostname: "db-01", want: []string{"!", "database", "!"}},
+		{name: "second host pattern", policies: []ListenerPolicy{database}, hostname: "pg.example.com", want: []string{"!", "database", "!"}},
+		{name: "glob does not match", policies: []ListenerPolicy{database, web}, hostname: "web-01", want: []string{"!", "!", "!"}},
+		{name: "policy without hosts applies everywhere", policies: []ListenerPolicy{base}, hostname: "cache-01", want: []string{"base", "!", "!"}},
+		{name: "policies add up", policies: []ListenerPolicy{base, database, web}, hostname: "db-01", want: []string{"base", "database", "!"}},
+		{name: "first matching policy wins", policies: []ListenerPolicy{database, {Name: "any", Expected: []ExpectedListener{{Port: "*"}}}}, hostname: "db-01",
+			want: []string{"any", "database", "any"}},
+	}
+
+	for _, tt := range tests {
+		got := listeners()
+		ApplyListenerPolicies(got, tt.policies, tt.hostname)
+		for i, listener := range got {
+			policy := listener.Policy
+			if listener.Unexpected {
+				policy = "!"
+			}
+			if policy != tt.want[i] {
+				t.Errorf("%s: %s = %q, want %q", tt.name, listener, policy, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestValidateListenerPolicies(t *testing.T) {
+	tests := []struct {
+		policy  ListenerPolicy
+		wantErr string
+	}{
+		{policy: ListenerPolicy{Name: "ok", Hosts: []string{"web-*"}, Expected: []ExpectedListener{
+			{Port: "22"}, {Port: "8000-8099"}, {Port: "*"}, {Address: "loopback"}, {Address: "::1", Protocol: "udp"},
+		}}},
+		{policy: ListenerPolicy{Name: "hosts", Hosts: []string{"web-["}}, wantErr: `invalid host pattern "web-["`},
+		{policy: ListenerPolicy{Expected: []ExpectedListener{{Port: "http"}}}, wantErr: `listener policy 1, entry 1: invalid port "http"`},
+		{policy: ListenerPolicy{Name: "p", Expected: []ExpectedListener{{}, {Protocol: "sctp"}}}, wantErr: "entry 2: protocol must be tcp or udp"},
+		{policy: ListenerPolicy{Name: "p", Expected: []ExpectedListener{{Address: "localhost"}}}, wantErr: `invalid address "localhost"`},
+		{policy: ListenerPolicy{Name: "p", Expected: []ExpectedListener{{Exe: "/usr/[bin"}}}, wantErr: `invalid pattern "/usr/[bin"`},
+	}
+
+	for _, tt := range tests {
+		err := validateListenerPolicies([]ListenerPolicy{tt.policy})
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: %v", tt.policy.Name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: error = %v, want %q", tt.policy.Name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseCgroup(t *testing.T) {
+	const id = "4f2c9a1e7b3d8c6a5e0f1b2d3c4a5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1c2d"
+
+	tests := []struct {
+		name                             string
+		content                          string
+		cgroup, unit, container, runtime string
+	}{
+		{
+			name:    "v2 systemd service",
+			content: "0::/system.slice/nginx.service\n",
+			cgroup:  "/system.slice/nginx.service", unit: "nginx.service",
+		},
+		{
+			name:    "v2 docker with systemd driver",
+			content: "0::/system.slice/docker-" + id + ".scope\n",
+			cgroup:  "/system.slice/docker-" + id + ".scope", container: id[:12], runtime: "docker",
+		},
+		{
+			name:    "v2 docker with cgroupfs driver",
+			content: "0::/docker/" + id + "\n",
+			cgroup:  "/docker/" + id, container: id[:12], runtime: "docker",
+		},
+		{
+			name: "v1 docker",
+			content: "12:pids:/docker/" + id + "\n" +
+				"11:memory:/docker/" + id + "\n" +
+				"1:name=systemd:/docker/" + id + "\n",
+			cgroup: "/docker/" + id, container: id[:12], runtime: "docker",
+		},
+		{
+			name: "v1 prefers name=systemd",
+			content: "4:cpu,cpuacct:/\n" +
+				"1:name=systemd:/system.slice/ssh.service\n",
+			cgroup: "/system.slice/ssh.service", unit: "ssh.service",
+		},
+		{
+			name: "hybrid prefers the unified hierarchy",
+			content: "1:name=systemd:/system.slice/old.service\n" +
+				"0::/system.slice/containerd.service\n",
+			cgroup: "/system.slice/containerd.service", unit: "containerd.service",
+		},
+		{
+			name:      "cri-containerd in a kubepods slice",
+			content:   "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1a2b.slice/cri-containerd-" + id + ".scope\n",
+			cgroup:    "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1a2b.slice/cri-containerd-" + id + ".scope",
+			container: id[:12], runtime: "cri-containerd",
+		},
+		{
+			name:    "crio",
+			content: "0::/kubepods.slice/kubepods-pod9f8e.slice/crio-" + id + ".scope\n",
+			cgroup:  "/kubepods.slice/kubepods-pod9f8e.slice/crio-" + id + ".scope", container: id[:12], runtime: "crio",
+		},
+		{
+			name:    "podman",
+			content: "0::/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-" + id + ".scope/container\n",
+			cgroup:  "/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-" + id + ".scope/container",
+			unit:    "user@1000.service", container: id[:12], runtime: "podman",
+		},
+		{
+			name:    "kubepods without a known runtime",
+			content: "11:memory:/kubepods/besteffort/pod1a2b3c4d/abcdef\n",
+			cgroup:  "/kubepods/besteffort/pod1a2b3c4d/abcdef", runtime: "kubernetes",
+		},
+		{
+			name:    "short hex is not a container",
+			content: "0::/docker/abc123\n",
+			cgroup:  "/docker/abc123",
+		},
+		{name: "empty", content: ""},
+	}
+
+	for _, tt := range tests {
+		cgroup, unit, container, runtime := parseCgroup(tt.content)
+		if cgroup != tt.cgroup || unit != tt.unit || container != tt.container || runtime != tt.runtime {
+			t.Errorf("%s: parseCgroup = %q, %q, %q, %q; want %q, %q, %q, %q", tt.name,
+				cgroup, unit, container, runtime, tt.cgroup, tt.unit, tt.container, tt.runtime)
+		}
+	}
+}
+
+func TestSuspiciousListener(t *testing.T) {
+	tests := []struct {
+		listener Listener
+		want     string
+	}{
+		{listener: Listener{Process: "sshd", Exe: "/usr/sbin/sshd"}, want: ""},
+		{listener: Listener{Process: "nginx", Exe: "/usr/sbin/nginx", ExeDeleted: true}, want: "executable was deleted after start"},
+		{listener: Listener{Process: "bash", Exe: "/usr/bin/bash"}, want: "shell accepting connections"},
+		{listener: Listener{Process: "ncat", Exe: "/usr/bin/ncat"}, want: "netcat style relay"},
+		{listener: Listener{Process: "kworker", Exe: "/dev/shm/.x/kworker"}, want: "executable in /dev/shm"},
+		{listener: Listener{Process: "updater", Exe: "/var/tmp/updater"}, want: "executable in /var/tmp"},
+		{listener: Listener{Process: "app", Exe: "/tmpfs/app"}, want: ""},
+		{listener: Listener{}, want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := suspiciousListener(tt.listener); got != tt.want {
+			t.Errorf("suspiciousListener(%s %s) = %q, want %q", tt.listener.Process, tt.listener.Exe, got, tt.want)
+		}
+	}
+}
@@ -2,104 +2,156 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// hostFlags registers --root and --commands; the returned function builds
+// the host after parsing.
+func hostFlags(fs *flag.FlagSet) func() *Host {
+	root := fs.String("root", "/", "Filesystem root to inspect, e.g. a fixture or mounted image")
+	commands := fs.String("commands", "", "Directory of captured command output to use instead of running tools")
+	return func() *Host {
+		return NewHost(*root, *commands)
+	}
+}
+
+// newConfiguredRegistry returns the built-in collectors inspecting host with
+// the --sample window and the --config file, if one was given.
+func newConfiguredRegistry(host *Host, sample time.Duration, configPath string) (*Registry, error) {
+	if sample < 0 {
+		return nil, fmt.Errorf("--sample must be >= 0 (0 reports averages since boot)")
+	}
+	registry := newDefaultRegistry()
+	registry.SetHost(host)
+	registry.SetSampleInterval(sample)
+	if configPath == "" {
+		return registry, nil
+	}
+	config, err := LoadCollectorConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := registry.Configure(config); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %v", configPath, err)
+	}
+	return registry, nil
+}
+
 func main() {
-	fmt.Println("🎯 HOST MONITORING SYSTEM")
-	fmt.Println("Available monitoring modules:")
-	fmt.Println("  1. System Monitor")
-	fmt.Println("  2. Security Scanner")
-	fmt.Println("  3. Performance Monitor")
-	fmt.Println("  4. Network Analyzer")
-	fmt.Println("  5. Package Manager")
-	fmt.Println("  6. All Modules")
-	fmt.Println("  7. Exit")
-	fmt.Println()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "run":
+			os.Exit(runCommand(os.Args[2:]))
+		case "serve":
+			os.Exit(serveCommand(os.Args[2:]))
+		case "watch":
+			os.Exit(watchCommand(os.Args[2:]))
+		case "alert":
+			os.Exit(alertCommand(os.Args[2:]))
+		case "baseline":
+			os.Exit(baselineCommand(os.Args[2:]))
+		case "fim":
+			os.Exit(fimCommand(os.Args[2:]))
+		case "auth":
+			os.Exit(authCommand(os.Args[2:]))
+		case "accounts":
+			os.Exit(accountsCommand(os.Args[2:]))
+		case "vulns":
+			os.Exit(vulnsCommand(os.Args[2:]))
+		case "sbom":
+			os.Exit(sbomCommand(os.Args[2:]))
+		}
+	}
+
+	format := flag.String("format", formatText, "Report format: text, json or yaml")
+	configPath := flag.String("config", "", "Collector config file (JSON)")
+	sample := flag.Duration("sample", defaultSampleInterval, "CPU and bandwidth sampling window, 0 for averages since boot")
+	applyHost := hostFlags(flag.CommandLine)
+	flag.Usage = usage
+	flag.Parse()
+
+	registry, err := newConfiguredRegistry(applyHost(), *sample, *configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		os.Exit(2)
+	}
+
+	if !validFormat(*format) {
+		fmt.Fprintf(os.Stderr, "❌ Unknown format %q (use text, json or yaml)\n", *format)
+		os.Exit(2)
+	}
+
+	// Structured reports own stdout, so the menu moves to stderr
+	var menu io.Writer = os.Stdout
+	if *format != formatText {
+		menu = os.Stderr
+	}
+
+	collectors := registry.Collectors()
+	allOption := len(collectors) + 1
+	watchOption := len(collectors) + 2
+	exitOption := len(collectors) + 3
+
+	fmt.Fprintln(menu, "🎯 HOST MONITORING SYSTEM")
+	fmt.Fprintln(menu, "Available monitoring modules:")
+	for i, c := range collectors {
+		if registry.IsEnabled(c) {
+			fmt.Fprintf(menu, "  %d. %s\n", i+1, c.Title())
+		} else {
+			fmt.Fprintf(menu, "  %d. %s (disabled)\n", i+1, c.Title())
+		}
+	}
+	fmt.Fprintf(menu, "  %d. All Modules\n", allOption)
+	fmt.Fprintf(menu, "  %d. Bandwidth Watch\n", watchOption)
+	fmt.Fprintf(menu, "  %d. Exit\n", exitOption)
+	fmt.Fprintln(menu)
 
 	scanner := bufio.NewScanner(os.Stdin)
 
 	for {
-		fmt.Print("💻 Select module (1-7): ")
+		fmt.Fprintf(menu, "💻 Select module (1-%d): ", exitOption)
 		if !scanner.Scan() {
 			break
 		}
 
-		input := strings.TrimSpace(scanner.Text())
-
-		switch input {
-		case "1":
-			fmt.Println("\n" + strings.Repeat("=", 50))
-			monitor := NewHostMonitor()
-			monitor.PrintSystemReport()
-			fmt.Println(strings.Repeat("=", 50) + "\n")
-
-		case "2":
-			fmt.Println("\n" + strings.Repeat("=", 50))
-			scanner := NewSecurityScanner()
-			scanner.PrintSecurityReport()
-			fmt.Println(strings.Repeat("=", 50) + "\n")
-
-		case "3":
-			fmt.Println("\n" + strings.Repeat("=", 50))
-			perfMonitor := NewPerformanceMonitor()
-			perfMonitor.PrintPerformanceReport()
-			fmt.Println(strings.Repeat("=", 50) + "\n")
-
-		case "4":
-			fmt.Println("\n" + strings.Repeat("=", 50))
-			netAnalyzer := NewNetworkAnalyzer()
-			netAnalyzer.PrintNetworkReport()
-			fmt.Println(strings.Repeat("=", 50) + "\n")
-
-		case "5":
-			fmt.Println("\n" + strings.Repeat("=", 50))
-			pkgManager := NewPackageManager()
-			pkgManager.PrintPackageReport()
-			fmt.Println(strings.Repeat("=", 50) + "\n")
-
-		case "6":
-			fmt.Println("\n" + strings.Repeat("=", 50))
-			fmt.Println("RUNNING ALL MODULES")
-			fmt.Println(strings.Repeat("=", 50))
-
-			// System Monitor
-			fmt.Println("\n1. SYSTEM MONITOR")
-			monitor := NewHostMonitor()
-			monitor.PrintSystemReport()
-
-			// Security Scanner
-			fmt.Println("\n2. SECURITY SCANNER")
-			scanner := NewSecurityScanner()
-			scanner.PrintSecurityReport()
-
-			// Performance Monitor
-			fmt.Println("\n3. PERFORMANCE MONITOR")
-			perfMonitor := NewPerformanceMonitor()
-			perfMonitor.PrintPerformanceReport()
-
-			// Network Analyzer
-			fmt.Println("\n4. NETWORK ANALYZER")
-			netAnalyzer := NewNetworkAnalyzer()
-			netAnalyzer.PrintNetworkReport()
-
-			// Package Manager
-			fmt.Println("\n5. PACKAGE MANAGER")
-			pkgManager := NewPackageManager()
-			pkgManager.PrintPackageReport()
-
-			fmt.Println("\n" + strings.Repeat("=", 50))
-			fmt.Println("ALL MODULES COMPLETED")
-			fmt.Println(strings.Repeat("=", 50) + "\n")
-
-		case "7":
-			fmt.Println("👋 Goodbye!")
+		choice, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+		if err != nil {
+			choice = 0
+		}
+
+		switch {
+		case choice >= 1 && choice <= len(collectors):
+			c := collectors[choice-1]
+			if !registry.IsEnabled(c) {
+				fmt.Fprintf(menu, "❌ %s is disabled by config.\n", c.Title())
+				continue
+			}
+			runCollectors(registry, *format, []Collector{c})
+
+		case choice == allOption:
+			runCollectors(registry, *format, registry.Enabled())
+
+		case choice == watchOption:
+			fmt.Fprintln(menu, "\n"+strings.Repeat("=", 50))
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			registry.Settings().networkAnalyzer().WatchBandwidth(ctx, menu)
+			stop()
+			fmt.Fprintln(menu, strings.Repeat("=", 50)+"\n")
+
+		case choice == exitOption:
+			fmt.Fprintln(menu, "👋 Goodbye!")
 			return
 
 		default:
-			fmt.Println("❌ Invalid option. Please select 1-7.")
+			fmt.Fprintf(menu, "❌ Invalid option. Please select 1-%d.\n", exitOption)
 		}
 	}
 }
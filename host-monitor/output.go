@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// reportSchemaVersion is bumped whenever a field is renamed or removed, so
+// consumers of stored reports can tell old documents apart.
+const reportSchemaVersion = 1
+
+// Output formats accepted by --format.
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatYAML = "yaml"
+)
+
+// Report is the envelope around every structured module result.
+type Report struct {
+	SchemaVersion int         `json:"schema_version"`
+	Module        string      `json:"module"`
+	Hostname      string      `json:"hostname"`
+	GeneratedAt   time.Time   `json:"generated_at"`
+	Error         string      `json:"error,omitempty"`
+	Data          interface{} `json:"data"`
+}
+
+func NewReport(module, hostname string, data interface{}) Report {
+	return Report{
+		SchemaVersion: reportSchemaVersion,
+		Module:        module,
+		Hostname:      hostname,
+		GeneratedAt:   time.Now(),
+		Data:          data,
+	}
+}
+
+func validFormat(format string) bool {
+	return format == formatText || format == formatJSON || format == formatYAML
+}
+
+// WriteReport writes one report as a JSON or YAML document. Several reports
+// written to the same stream form a JSON stream or a multi-document YAML file.
+func WriteReport(w io.Writer, format string, report Report) error {
+	switch format {
+	case formatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case formatYAML:
+		_, err := io.WriteString(w, "---\n"+EncodeYAML(report))
+		return err
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// EncodeYAML renders v as block-style YAML using the same field names as
+// encoding/json. Values match the JSON report too: nil slices and maps are
+// null, []byte is a base64 string and floats use the same digits, with
+// NaN and infinities written the YAML way (.nan, .inf, -.inf).
+func EncodeYAML(v interface{}) string {
+	lines, _ := yamlLines(reflect.ValueOf(v))
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// yamlLines returns the lines for v and whether v fits on the line of its key.
+func yamlLines(v reflect.Value) ([]string, bool) {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return []string{"null"}, true
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return []string{"null"}, true
+	}
+
+	if t, ok := v.Interface().(time.Time); ok {
+		return []string{t.Format(time.RFC3339Nano)}, true
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return []string{strconv.FormatBool(v.Bool())}, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return []string{strconv.FormatInt(v.Int(), 10)}, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return []string{strconv.FormatUint(v.Uint(), 10)}, true
+	case reflect.Float32:
+		return []string{yamlFloat(v.Float(), 32)}, true
+	case reflect.Float64:
+		return []string{yamlFloat(v.Float(), 64)}, true
+	case reflect.String:
+		return []string{yamlString(v.String())}, true
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return []string{"null"}, true
+		}
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return []string{yamlString(base64.StdEncoding.EncodeToString(v.Bytes()))}, true
+		}
+		if v.Len() == 0 {
+			return []string{"[]"}, true
+		}
+		var lines []string
+		for i := 0; i < v.Len(); i++ {
+			item, _ := yamlLines(v.Index(i))
+			lines = append(lines, "- "+item[0])
+			for _, line := range item[1:] {
+				lines = append(lines, "  "+line)
+			}
+		}
+		return lines, false
+
+	case reflect.Map:
+		if v.IsNil() {
+			return []string{"null"}, true
+		}
+		keys := v.MapKeys()
+		if len(keys) == 0 {
+			return []string{"{}"}, true
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		var lines []string
+		for _, key := range keys {
+			lines = appendYAMLField(lines, fmt.Sprint(key.Interface()), v.MapIndex(key))
+		}
+		return lines, false
+
+	case reflect.Struct:
+		var lines []string
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, omitEmpty := jsonFieldName(field)
+			if name == "-" || (omitEmpty && v.Field(i).IsZero()) {
+				continue
+			}
+			lines = appendYAMLField(lines, name, v.Field(i))
+		}
+		if len(lines) == 0 {
+			return []string{"{}"}, true
+		}
+		return lines, false
+	}
+
+	return []string{yamlString(fmt.Sprint(v.Interface()))}, true
+}
+
+// yamlFloat formats like encoding/json, which switches to an exponent only
+// for very small or large values, and spells out what JSON cannot hold.
+func yamlFloat(f float64, bits int) string {
+	switch {
+	case math.IsNaN(f):
+		return ".nan"
+	case math.IsInf(f, 1):
+		return ".inf"
+	case math.IsInf(f, -1):
+		return "-.inf"
+	}
+
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (bits == 64 && (abs < 1e-6 || abs >= 1e21) ||
+		bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21)) {
+		format = 'e'
+	}
+	formatted := strconv.FormatFloat(f, format, -1, bits)
+	if format == 'e' {
+		// 1e-07 to 1e-7, as encoding/json does
+		if n := len(formatted); n >= 4 && formatted[n-4] == 'e' && formatted[n-3] == '-' && formatted[n-2] == '0' {
+			formatted = formatted[:n-2] + formatted[n-1:]
+		}
+	}
+	return formatted
+}
+
+func appendYAMLField(lines []string, key string, value reflect.Value) []string {
+	child, inline := yamlLines(value)
+	if inline {
+		return append(lines, yamlString(key)+": "+child[0])
+	}
+	lines = append(lines, yamlString(key)+":")
+	for _, line := range child {
+		lines = append(lines, "  "+line)
+	}
+	return lines
+}
+
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "" {
+		return field.Name, false
+	}
+	name, options, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name, strings.Contains(options, "omitempty")
+}
+
+// yamlString quotes s whenever a plain scalar would be read back as
+// something else (a number, a bool, a comment, a nested structure...).
+func yamlString(s string) string {
+	if s == "" || strings.TrimSpace(s) != s {
+		return strconv.Quote(s)
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "y", "n", "on", "off", "null", "~":
+		return strconv.Quote(s)
+	}
+	// Numbers, dates, times and versions all start with a digit
+	if unicode.IsDigit(rune(s[0])) {
+		return strconv.Quote(s)
+	}
+	if strings.ContainsAny(s[:1], ".+-?:,[]{}#&*!|>'\"%@`") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") {
+		return strconv.Quote(s)
+	}
+	for _, r := range s {
+		if !unicode.IsPrint(r) || r == '"' || r == '\\' {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
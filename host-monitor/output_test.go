@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestYAMLString(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{in: "web-01", want: "web-01"},
+		{in: "Intel(R) Xeon(R) CPU @ 2.50GHz", want: "Intel(R) Xeon(R) CPU @ 2.50GHz"},
+		{in: "/usr/bin/sudo", want: "/usr/bin/sudo"},
+		{in: "", want: `""`},
+		{in: " padded", want: `" padded"`},
+		{in: "yes", want: `"yes"`},
+		{in: "No", want: `"No"`},
+		{in: "y", want: `"y"`},
+		{in: "on", want: `"on"`},
+		{in: "TRUE", want: `"TRUE"`},
+		{in: "null", want: `"null"`},
+		{in: "Null", want: `"Null"`},
+		{in: "~", want: `"~"`},
+		{in: "-rwxr-xr-x", want: `"-rwxr-xr-x"`},
+		{in: "- item", want: `"- item"`},
+		{in: ":port", want: `":port"`},
+		{in: "#comment", want: `"#comment"`},
+		{in: "key: value", want: `"key: value"`},
+		{in: "trailing:", want: `"trailing:"`},
+		{in: "value #comment", want: `"value #comment"`},
+		{in: "a#b", want: "a#b"},
+		{in: "42", want: `"42"`},
+		{in: "3.14", want: `"3.14"`},
+		{in: "1e10", want: `"1e10"`},
+		{in: "0x1F", want: `"0x1F"`},
+		{in: "2024-05-01", want: `"2024-05-01"`},
+		{in: "-5", want: `"-5"`},
+		{in: "+5", want: `"+5"`},
+		{in: ".5", want: `".5"`},
+		{in: ".inf", want: `".inf"`},
+		{in: "[1, 2]", want: `"[1, 2]"`},
+		{in: "{a: b}", want: `"{a: b}"`},
+		{in: "*alias", want: `"*alias"`},
+		{in: "!tag", want: `"!tag"`},
+		{in: "|", want: `"|"`},
+		{in: "two\nlines", want: `"two\nlines"`},
+		{in: "tab\there", want: `"tab\there"`},
+		{in: `say "hi"`, want: `"say \"hi\""`},
+		{in: `C:\temp`, want: `"C:\\temp"`},
+		{in: "naïve", want: "naïve"},
+	}
+
+	for _, tt := range tests {
+		if got := yamlString(tt.in); got != tt.want {
+			t.Errorf("yamlString(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestYAMLFloatMatchesJSON(t *testing.T) {
+	for _, f := range []float64{0, 1, -1, 0.1, 2.5, 100, 1e6, 123456789, 1e20, 1e21, 1.5e300, 1e-6, 1e-7, 1.25e-10, -3.75e-8} {
+		want, err := json.Marshal(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := yamlFloat(f, 64); got != string(want) {
+			t.Errorf("yamlFloat(%v) = %s, want %s as in JSON", f, got, want)
+		}
+	}
+	for _, f := range []float32{0.1, 3.3, 1e-7, 1e21} {
+		want, err := json.Marshal(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := yamlFloat(float64(f), 32); got != string(want) {
+			t.Errorf("yamlFloat(float32 %v) = %s, want %s as in JSON", f, got, want)
+		}
+	}
+
+	for f, want := range map[float64]string{math.Inf(1): ".inf", math.Inf(-1): "-.inf"} {
+		if got := yamlFloat(f, 64); got != want {
+			t.Errorf("yamlFloat(%v) = %s, want %s", f, got, want)
+		}
+	}
+	if got := yamlFloat(math.NaN(), 64); got != ".nan" {
+		t.Errorf("yamlFloat(NaN) = %s, want .nan", got)
+	}
+}
+
+func TestEncodeYAML(t *testing.T) {
+	type item struct {
+		Name  string   `json:"name"`
+		Tags  []string `json:"tags,omitempty"`
+		Score float64  `json:"score"`
+	}
+	type document struct {
+		Hash    []byte            `json:"hash"`
+		Empty   []byte            `json:"empty"`
+		Nil     []string          `json:"nil"`
+		None    []string          `json:"none"`
+		Labels  map[string]string `json:"labels"`
+		NoMap   map[string]string `json:"no_map"`
+		Items   []item            `json:"items"`
+		Ratio   float64           `json:"ratio"`
+		Small   float32           `json:"small"`
+		Pointer *item             `json:"pointer"`
+		Skipped string            `json:"-"`
+		hidden  string
+	}
+
+	got := EncodeYAML(document{
+		Hash:   []byte("host-monitor"),
+		Empty:  []byte{},
+		None:   []string{},
+		Labels: map[string]string{"zone": "eu-1", "role": "yes"},
+		Items: []item{
+			{Name: "first", Tags: []string{"a", "b"}, Score: 0.5},
+			{Name: "second", Score: 1e21},
+		},
+		Ratio:   math.Inf(-1),
+		Small:   0.1,
+		Skipped: "skipped",
+		hidden:  "hidden",
+	})
+	want := `hash: aG9zdC1tb25pdG9y
+empty: ""
+nil: null
+none: []
+labels:
+  role: "yes"
+  zone: eu-1
+no_map: null
+items:
+  - name: first
+    tags:
+      - a
+      - b
+    score: 0.5
+  - name: second
+    score: 1e+21
+ratio: -.inf
+small: 0.1
+pointer: null
+`
+	if got != want {
+		t.Errorf("EncodeYAML =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,784 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os/exec"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// packageBackend reads the packages of one package manager. Installed
+// packages come from the local database where its format allows, updates
+// from the manager's own tool, since only it knows the synced repositories.
+type packageBackend interface {
+	Name() string
+	// Database is the path whose presence shows the manager is in use.
+	Database() string
+	// CacheDir holds downloaded packages.
+	CacheDir() string
+	Installed(h *Host) []Package
+	// Updates lists pending updates with Status "security" or "available".
+	Updates(h *Host) []Package
+	Repositories(h *Host) []Repository
+	History(h *Host) []UpdateRecord
+	// CompareVersions orders two versions the way the manager does.
+	CompareVersions(a, b string) int
+}
+
+// packageBackends are tried in this order when os-release does not say
+// which one to use.
+var packageBackends = []packageBackend{dpkgBackend{}, rpmBackend{}, apkBackend{}, pacmanBackend{}}
+
+// Distribution IDs, from ID and ID_LIKE of os-release, and their backend.
+var distroBackends = map[string]packageBackend{
+	"debian": dpkgBackend{}, "ubuntu": dpkgBackend{},
+	"rhel": rpmBackend{}, "fedora": rpmBackend{}, "centos": rpmBackend{}, "rocky": rpmBackend{},
+	"almalinux": rpmBackend{}, "amzn": rpmBackend{}, "ol": rpmBackend{}, "suse": rpmBackend{},
+	"alpine": apkBackend{},
+	"arch":   pacmanBackend{},
+}
+
+// detectPackageBackend picks the backend for the distribution, falling back
+// to the first backend whose database exists. It returns nil when there is
+// none, e.g. in a distroless container.
+func detectPackageBackend(h *Host, release OSRelease) packageBackend {
+	for _, id := range append([]string{release.ID}, release.IDLike...) {
+		if backend, ok := distroBackends[id]; ok {
+			return backend
+		}
+	}
+	for _, backend := range packageBackends {
+		if _, err := h.Stat(backend.Database()); err == nil {
+			return backend
+		}
+	}
+	return nil
+}
+
+// logDate shortens "2024-03-12T10:15:42+0000" to "2024-03-12 10:15:42", the
+// format of dpkg.log.
+func logDate(timestamp string) string {
+	timestamp = strings.Replace(timestamp, "T", " ", 1)
+	if len(timestamp) > 19 {
+		timestamp = timestamp[:19]
+	}
+	return timestamp
+}
+
+// dpkgBackend reads Debian and Ubuntu hosts.
+type dpkgBackend struct{}
+
+func (dpkgBackend) Name() string                    { return "dpkg" }
+func (dpkgBackend) Database() string                { return "/var/lib/dpkg/status" }
+func (dpkgBackend) CacheDir() string                { return "/var/cache/apt/archives" }
+func (dpkgBackend) CompareVersions(a, b string) int { return compareDebianVersions(a, b) }
+
+// Installed parses the dpkg status database, falling back to dpkg -l.
+func (b dpkgBackend) Installed(h *Host) []Package {
+	file, err := h.Open(b.Database())
+	if err != nil {
+		return b.listInstalled(h)
+	}
+	defer file.Close()
+
+	var packages []Package
+	fields := make(map[string]string)
+	flush := func() {
+		// Status: want flag state, e.g. "install ok installed"
+		status := strings.Fields(fields["Status"])
+		if len(status) == 3 && status[2] == "installed" {
+			pkg := Package{
+				Name:         fields["Package"],
+				Version:      fields["Version"],
+				Architecture: fields["Architecture"],
+				Description:  fields["Description"],
+				Status:       "installed",
+				Priority:     fields["Priority"],
+				Section:      fields["Section"],
+				Source:       strings.Fields(fields["Source"] + " " + fields["Package"])[0],
+			}
+			if status[0] == "hold" {
+				pkg.Status = "held"
+			}
+			// Installed-Size is in KiB
+			if size, err := strconv.ParseInt(fields["Installed-Size"], 10, 64); err == nil {
+				pkg.Size = strconv.FormatInt(size*1024, 10)
+			}
+			packages = append(packages, pkg)
+		}
+		fields = make(map[string]string)
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		// Continuation lines belong to the description or conffiles
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			fields[key] = strings.TrimSpace(value)
+		}
+	}
+	flush()
+	return packages
+}
+
+// listInstalled parses dpkg -l, which lacks sizes, sections and sources.
+func (dpkgBackend) listInstalled(h *Host) []Package {
+	var packages []Package
+
+	output, err := h.Output("dpkg", "-l")
+	if err != nil {
+		return packages
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		// Desired state and "i" for installed, e.g. ii or hi (held)
+		if len(line) < 2 || line[1] != 'i' || !strings.Contains("uih", line[:1]) {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) >= 4 {
+			pkg := Package{
+				Name:         strings.Split(fields[1], ":")[0],
+				Version:      fields[2],
+				Architecture: fields[3],
+				Description:  strings.Join(fields[4:], " "),
+				Status:       "installed",
+			}
+			if line[0] == 'h' {
+				pkg.Status = "held"
+			}
+			packages = append(packages, pkg)
+		}
+	}
+
+	return packages
+}
+
+// Updates parses apt list --upgradable:
+//
+//	openssl/jammy-updates,jammy-security 3.0.2-0ubuntu1.19 amd64 [upgradable from: 3.0.2-0ubuntu1.18]
+func (dpkgBackend) Updates(h *Host) []Package {
+	var packages []Package
+
+	output, err := h.Output("apt", "list", "--upgradable")
+	if err != nil {
+		return packages
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		name, rest, ok := strings.Cut(line, "/")
+		if !ok || strings.HasPrefix(line, "WARNING") {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		pkg := Package{Name: name, Status: "available", Section: fields[0]}
+		if len(fields) >= 3 {
+			pkg.Version, pkg.Architecture = fields[1], fields[2]
+		}
+		if strings.Contains(strings.ToLower(pkg.Section), "security") {
+			pkg.Status = "security"
+		}
+		packages = append(packages, pkg)
+	}
+
+	return packages
+}
+
+func (dpkgBackend) Repositories(h *Host) []Repository {
+	var repos []Repository
+
+	files := []string{"/etc/apt/sources.list"}
+	if dir, err := h.ReadDir("/etc/apt/sources.list.d"); err == nil {
+		for _, file := range dir {
+			if strings.HasSuffix(file.Name(), ".list") {
+				files = append(files, path.Join("/etc/apt/sources.list.d", file.Name()))
+			}
+		}
+	}
+
+	for _, file := range files {
+		content, err := h.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if repo, ok := parseSourceLine(line); ok {
+				repos = append(repos, repo)
+			}
+		}
+	}
+
+	return repos
+}
+
+// parseSourceLine parses a one-line apt source:
+//
+//	deb [signed-by=/etc/apt/keyrings/docker.gpg] https://download.docker.com/linux/ubuntu jammy stable
+func parseSourceLine(line string) (Repository, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return Repository{}, false
+	}
+
+	// Drop the [option=value ...] block
+	if open := strings.Index(line, "["); open >= 0 {
+		if end := strings.Index(line[open:], "]"); end >= 0 {
+			line = line[:open] + line[open+end+1:]
+		}
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return Repository{}, false
+	}
+	return Repository{
+		Name:    fields[2],
+		URL:     fields[1],
+		Enabled: true,
+	}, true
+}
+
+// History reads upgrades from /var/log/dpkg.log:
+//
+//	2025-10-14 06:25:12 upgrade libssl3:amd64 3.0.2-0ubuntu1.18 3.0.2-0ubuntu1.19
+func (dpkgBackend) History(h *Host) []UpdateRecord {
+	var history []UpdateRecord
+
+	file, err := h.Open("/var/log/dpkg.log")
+	if err != nil {
+		return history
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 4 && fields[2] == "upgrade" {
+			record := UpdateRecord{
+				Package: fields[3],
+				Date:    fields[0] + " " + fields[1],
+			}
+			if len(fields) >= 6 {
+				record.OldVersion = fields[4]
+				record.NewVersion = fields[5]
+			}
+			history = append(history, record)
+		}
+	}
+
+	return history
+}
+
+// rpmBackend reads RHEL, Fedora, Amazon Linux and SUSE hosts. The rpm
+// database is SQLite or Berkeley DB, so installed packages come from rpm
+// itself and updates from dnf, or yum on older releases.
+type rpmBackend struct{}
+
+func (rpmBackend) Name() string                    { return "rpm" }
+func (rpmBackend) Database() string                { return "/var/lib/rpm" }
+func (rpmBackend) CacheDir() string                { return "/var/cache/dnf" }
+func (rpmBackend) CompareVersions(a, b string) int { return compareRPMVersions(a, b) }
+
+// rpmQueryFormat prints one tab separated line per package; rpm expands
+// the \t and \n itself.
+const rpmQueryFormat = `%{NAME}\t%{EPOCHNUM}:%{VERSION}-%{RELEASE}\t%{ARCH}\t%{SIZE}\t%{GROUP}\t%{SOURCERPM}\t%{SUMMARY}\n`
+
+func (rpmBackend) Installed(h *Host) []Package {
+	var packages []Package
+
+	output, err := h.Output("rpm", "-qa", "--queryformat", rpmQueryFormat)
+	if err != nil {
+		return packages
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 || fields[0] == "gpg-pubkey" {
+			continue
+		}
+		pkg := Package{
+			Name:         fields[0],
+			Version:      strings.TrimPrefix(fields[1], "0:"),
+			Architecture: fields[2],
+			Size:         fields[3],
+			Description:  fields[6],
+			Status:       "installed",
+		}
+		// Newer packages leave the group unset
+		if fields[4] != "Unspecified" {
+			pkg.Section = fields[4]
+		}
+		// openssl-3.0.7-24.el9.src.rpm
+		pkg.Source, _, _ = splitNEVRA(strings.TrimSuffix(fields[5], ".rpm"))
+		packages = append(packages, pkg)
+	}
+
+	return packages
+}
+
+// dnfOutput runs dnf, or yum where there is no dnf. check-update exits with
+// 100 when updates are available, which is not an error.
+func dnfOutput(h *Host, args ...string) ([]byte, error) {
+	output, err := h.Output("dnf", args...)
+	var notFound *exec.Error
+	if errors.As(err, &notFound) {
+		output, err = h.Output("yum", args...)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 100 {
+		err = nil
+	}
+	return output, err
+}
+
+// Updates parses dnf check-update, marking the packages that dnf updateinfo
+// lists as security updates:
+//
+//	openssl.x86_64    1:3.0.7-25.el9_3    baseos
+//	RHSA-2024:1234 Important/Sec. openssl-1:3.0.7-25.el9_3.x86_64
+func (rpmBackend) Updates(h *Host) []Package {
+	var packages []Package
+
+	output, err := dnfOutput(h, "check-update", "-q")
+	if err != nil {
+		return packages
+	}
+
+	security := make(map[string]bool)
+	if advisories, err := dnfOutput(h, "updateinfo", "list", "--security", "-q"); err == nil {
+		for _, line := range strings.Split(string(advisories), "\n") {
+			if fields := strings.Fields(line); len(fields) == 3 {
+				if name, _, _ := splitNEVRA(fields[2]); name != "" {
+					security[name] = true
+				}
+			}
+		}
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		// Obsoleted packages follow the updates
+		if strings.HasPrefix(line, "Obsoleting") {
+			break
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		name, arch, ok := strings.Cut(fields[0], ".")
+		if !ok {
+			continue
+		}
+		pkg := Package{
+			Name:         name,
+			Version:      strings.TrimPrefix(fields[1], "0:"),
+			Architecture: arch,
+			Section:      fields[2],
+			Status:       "available",
+		}
+		if security[name] {
+			pkg.Status = "security"
+		}
+		packages = append(packages, pkg)
+	}
+
+	return packages
+}
+
+// splitNEVRA splits name-[epoch:]version-release.arch into the name, the
+// [epoch:]version-release and the arch.
+func splitNEVRA(nevra string) (name, version, arch string) {
+	dot := strings.LastIndex(nevra, ".")
+	if dot < 0 {
+		return "", "", ""
+	}
+	nevr, arch := nevra[:dot], nevra[dot+1:]
+	release := strings.LastIndex(nevr, "-")
+	if release < 0 {
+		return "", "", ""
+	}
+	dash := strings.LastIndex(nevr[:release], "-")
+	if dash < 0 {
+		return "", "", ""
+	}
+	return nevr[:dash], nevr[dash+1:], arch
+}
+
+// Repositories reads the .repo files in /etc/yum.repos.d:
+//
+//	[baseos]
+//	name=Rocky Linux $releasever - BaseOS
+//	mirrorlist=https://mirrors.rockylinux.org/mirrorlist?arch=$basearch&repo=BaseOS-$releasever
+//	enabled=1
+func (rpmBackend) Repositories(h *Host) []Repository {
+	var repos []Repository
+
+	files, _ := h.Glob("/etc/yum.repos.d/*.repo")
+	sort.Strings(files)
+	for _, file := range files {
+		content, err := h.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var repo *Repository
+		for _, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+				repos = append(repos, Repository{Name: strings.Trim(line, "[]"), Enabled: true, Priority: 99})
+				repo = &repos[len(repos)-1]
+				continue
+			}
+			key, value, ok := strings.Cut(line, "=")
+			if !ok || repo == nil {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			switch strings.TrimSpace(key) {
+			case "baseurl", "mirrorlist", "metalink":
+				if urls := strings.Fields(value); repo.URL == "" && len(urls) > 0 {
+					repo.URL = urls[0]
+				}
+			case "enabled":
+				repo.Enabled = value == "1" || value == "true"
+			case "priority":
+				if priority, err := strconv.Atoi(value); err == nil {
+					repo.Priority = priority
+				}
+			}
+		}
+	}
+
+	return repos
+}
+
+// History pairs the Upgrade and Upgraded lines of /var/log/dnf.rpm.log:
+//
+//	2024-03-12T10:15:42+0000 SUBDEBUG Upgrade: openssl-1:3.0.7-25.el9_3.x86_64
+//	2024-03-12T10:15:43+0000 SUBDEBUG Upgraded: openssl-1:3.0.7-24.el9.x86_64
+func (rpmBackend) History(h *Host) []UpdateRecord {
+	var history []UpdateRecord
+
+	file, err := h.Open("/var/log/dnf.rpm.log")
+	if err != nil {
+		return history
+	}
+	defer file.Close()
+
+	pending := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 {
+			continue
+		}
+		name, version, _ := splitNEVRA(fields[3])
+		if name == "" {
+			continue
+		}
+		switch fields[2] {
+		case "Upgrade:":
+			pending[name] = len(history)
+			history = append(history, UpdateRecord{Package: name, NewVersion: version, Date: logDate(fields[0])})
+		case "Upgraded:":
+			if i, ok := pending[name]; ok {
+				history[i].OldVersion = version
+				delete(pending, name)
+			}
+		}
+	}
+
+	return history
+}
+
+// apkBackend reads Alpine hosts.
+type apkBackend struct{}
+
+func (apkBackend) Name() string                    { return "apk" }
+func (apkBackend) Database() string                { return "/lib/apk/db/installed" }
+func (apkBackend) CacheDir() string                { return "/var/cache/apk" }
+func (apkBackend) CompareVersions(a, b string) int { return compareApkVersions(a, b) }
+
+// Installed parses the apk database, one block of "X:value" lines per
+// package.
+func (b apkBackend) Installed(h *Host) []Package {
+	var packages []Package
+
+	file, err := h.Open(b.Database())
+	if err != nil {
+		return packages
+	}
+	defer file.Close()
+
+	var pkg Package
+	flush := func() {
+		if pkg.Name != "" {
+			pkg.Status = "installed"
+			packages = append(packages, pkg)
+		}
+		pkg = Package{}
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "P":
+			pkg.Name = value
+		case "V":
+			pkg.Version = value
+		case "A":
+			pkg.Architecture = value
+		case "I":
+			pkg.Size = value
+		case "T":
+			pkg.Description = value
+		case "o":
+			pkg.Source = value
+		}
+	}
+	flush()
+	return packages
+}
+
+// apkNameVersion splits name-version; Alpine versions always end in -rN.
+var apkNameVersion = regexp.MustCompile(`^(.+)-([0-9][^-]*-r[0-9]+)$`)
+
+// Updates parses apk list --upgradable:
+//
+//	busybox-1.36.1-r7 x86_64 {busybox} (GPL-2.0-only) [upgradable from: busybox-1.36.1-r5]
+func (apkBackend) Updates(h *Host) []Package {
+	var packages []Package
+
+	output, err := h.Output("apk", "list", "--upgradable")
+	if err != nil {
+		return packages
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		match := apkNameVersion.FindStringSubmatch(fields[0])
+		if match == nil {
+			continue
+		}
+		packages = append(packages, Package{
+			Name:         match[1],
+			Version:      match[2],
+			Architecture: fields[1],
+			Status:       "available",
+		})
+	}
+
+	return packages
+}
+
+// Repositories reads /etc/apk/repositories, one URL per line, optionally
+// tagged: "@edge https://dl-cdn.alpinelinux.org/alpine/edge/main".
+func (apkBackend) Repositories(h *Host) []Repository {
+	var repos []Repository
+
+	content, err := h.ReadFile("/etc/apk/repositories")
+	if err != nil {
+		return repos
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		url := fields[len(fields)-1]
+		// .../alpine/v3.18/main is v3.18/main
+		name := path.Join(path.Base(path.Dir(url)), path.Base(url))
+		if strings.HasPrefix(fields[0], "@") {
+			name = fields[0] + " " + name
+		}
+		repos = append(repos, Repository{Name: name, URL: url, Enabled: true})
+	}
+
+	return repos
+}
+
+// History is empty: apk keeps no log of upgrades.
+func (apkBackend) History(h *Host) []UpdateRecord {
+	return nil
+}
+
+// pacmanBackend reads Arch Linux hosts.
+type pacmanBackend struct{}
+
+func (pacmanBackend) Name() string                    { return "pacman" }
+func (pacmanBackend) Database() string                { return "/var/lib/pacman/local" }
+func (pacmanBackend) CacheDir() string                { return "/var/cache/pacman/pkg" }
+func (pacmanBackend) CompareVersions(a, b string) int { return compareRPMVersions(a, b) }
+
+// Installed parses the desc file of every package in the local database:
+//
+//	%NAME%
+//	openssl
+//
+//	%VERSION%
+//	3.1.4-1
+func (b pacmanBackend) Installed(h *Host) []Package {
+	var packages []Package
+
+	descs, _ := h.Glob(path.Join(b.Database(), "*", "desc"))
+	sort.Strings(descs)
+	for _, desc := range descs {
+		content, err := h.ReadFile(desc)
+		if err != nil {
+			continue
+		}
+		fields := make(map[string]string)
+		var key string
+		for _, line := range strings.Split(string(content), "\n") {
+			switch {
+			case strings.HasPrefix(line, "%") && strings.HasSuffix(line, "%"):
+				key = line
+			case line != "" && fields[key] == "":
+				fields[key] = line
+			}
+		}
+		if fields["%NAME%"] == "" {
+			continue
+		}
+		packages = append(packages, Package{
+			Name:         fields["%NAME%"],
+			Version:      fields["%VERSION%"],
+			Architecture: fields["%ARCH%"],
+			Size:         fields["%SIZE%"],
+			Description:  fields["%DESC%"],
+			Section:      fields["%GROUPS%"],
+			Source:       firstNonEmpty(fields["%BASE%"], fields["%NAME%"]),
+			Status:       "installed",
+		})
+	}
+
+	return packages
+}
+
+// Updates parses pacman -Qu, which compares with the last synced
+// databases:
+//
+//	openssl 3.1.3-1 -> 3.1.4-1
+func (pacmanBackend) Updates(h *Host) []Package {
+	var packages []Package
+
+	output, err := h.Output("pacman", "-Qu")
+	if err != nil {
+		return packages
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 4 && fields[2] == "->" {
+			packages = append(packages, Package{Name: fields[0], Version: fields[3], Status: "available"})
+		}
+	}
+
+	return packages
+}
+
+// Repositories reads the repository sections of /etc/pacman.conf with
+// their first Server, following an Include of a mirror list.
+func (pacmanBackend) Repositories(h *Host) []Repository {
+	var repos []Repository
+
+	content, err := h.ReadFile("/etc/pacman.conf")
+	if err != nil {
+		return repos
+	}
+
+	var repo *Repository
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			repo = nil
+			if name := strings.Trim(line, "[]"); name != "options" {
+				repos = append(repos, Repository{Name: name, Enabled: true})
+				repo = &repos[len(repos)-1]
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || repo == nil || repo.URL != "" {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "Server":
+			repo.URL = value
+		case "Include":
+			repo.URL = pacmanMirror(h, value)
+		}
+		repo.URL = strings.ReplaceAll(repo.URL, "$repo", repo.Name)
+	}
+
+	return repos
+}
+
+// pacmanMirror returns the first Server of a mirror list.
+func pacmanMirror(h *Host, file string) string {
+	content, err := h.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok && strings.TrimSpace(key) == "Server" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+var pacmanUpgradePattern = regexp.MustCompile(`^\[([^\]]+)\] \[ALPM\] upgraded (\S+) \((\S+) -> (\S+)\)`)
+
+// History reads upgrades from /var/log/pacman.log:
+//
+//	[2024-03-12T10:15:42+0000] [ALPM] upgraded openssl (3.1.3-1 -> 3.1.4-1)
+func (pacmanBackend) History(h *Host) []UpdateRecord {
+	var history []UpdateRecord
+
+	file, err := h.Open("/var/log/pacman.log")
+	if err != nil {
+		return history
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if match := pacmanUpgradePattern.FindStringSubmatch(scanner.Text()); match != nil {
+			history = append(history, UpdateRecord{
+				Package:    match[2],
+				OldVersion: match[3],
+				NewVersion: match[4],
+				Date:       logDate(match[1]),
+			})
+		}
+	}
+
+	return history
+}
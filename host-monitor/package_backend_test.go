@@ -0,0 +1,144 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDpkgInstalled(t *testing.T) {
+	host := newTestHost(t, map[string]string{
+		"var/lib/dpkg/status": `Package: adduser
+Status: install ok installed
+Priority: important
+Section: admin
+Installed-Size: 608
+Architecture: all
+Version: 3.118ubuntu5
+Conffiles:
+ /etc/deluser.conf 773fb95e98a27947de4a95abb3d3f2a2
+Description: add and remove users and groups
+ This package includes the 'adduser' and 'deluser' commands.
+
+Package: libssl3
+Status: hold ok installed
+Priority: optional
+Section: libs
+Installed-Size: 5800
+Architecture: amd64
+Source: openssl (3.0.2-0ubuntu1.18)
+Version: 3.0.2-0ubuntu1.18
+Description: Secure Sockets Layer toolkit - shared libraries
+
+Package: removed-pkg
+Status: deinstall ok config-files
+Architecture: amd64
+Version: 1.0
+
+Package: half
+Status: install reinstreq half-installed
+Version: 2.0
+`,
+	})
+
+	want := []Package{
+		{
+			Name: "adduser", Version: "3.118ubuntu5", Architecture: "all", Size: "622592",
+			Description: "add and remove users and groups", Status: "installed",
+			Priority: "important", Section: "admin", Source: "adduser",
+		},
+		{
+			Name: "libssl3", Version: "3.0.2-0ubuntu1.18", Architecture: "amd64", Size: "5939200",
+			Description: "Secure Sockets Layer toolkit - shared libraries", Status: "held",
+			Priority: "optional", Section: "libs", Source: "openssl",
+		},
+	}
+	if got := (dpkgBackend{}).Installed(host); !reflect.DeepEqual(got, want) {
+		t.Errorf("Installed =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestApkInstalled(t *testing.T) {
+	host := newTestHost(t, map[string]string{
+		"lib/apk/db/installed": `C:Q1YbLkhtzRqvJy1BB/DFn1NNbhjzY=
+P:musl
+V:1.2.4-r1
+A:x86_64
+S:383152
+I:622592
+T:the musl c library (libc) implementation
+o:musl
+F:lib
+R:ld-musl-x86_64.so.1
+a:0:0:755
+
+C:Q1a8O2VCWcQjx0v6bmy2T9fhvGMXU=
+P:libcrypto3
+V:3.1.3-r0
+A:x86_64
+I:4206592
+T:Crypto library from openssl
+o:openssl
+`,
+	})
+
+	want := []Package{
+		{Name: "musl", Version: "1.2.4-r1", Architecture: "x86_64", Size: "622592",
+			Description: "the musl c library (libc) implementation", Status: "installed", Source: "musl"},
+		{Name: "libcrypto3", Version: "3.1.3-r0", Architecture: "x86_64", Size: "4206592",
+			Description: "Crypto library from openssl", Status: "installed", Source: "openssl"},
+	}
+	if got := (apkBackend{}).Installed(host); !reflect.DeepEqual(got, want) {
+		t.Errorf("Installed =\n%+v\nwant\n%+v", got, want)
+	}
+
+	if got := (apkBackend{}).Installed(newTestHost(t, nil)); len(got) != 0 {
+		t.Errorf("Installed without a database = %+v", got)
+	}
+}
+
+func TestSplitNEVRA(t *testing.T) {
+	tests := []struct {
+		in, name, version, arch string
+	}{
+		{"openssl-libs-1:3.0.7-27.el9.x86_64", "openssl-libs", "1:3.0.7-27.el9", "x86_64"},
+		{"bash-5.1.8-9.el9.x86_64", "bash", "5.1.8-9.el9", "x86_64"},
+		{"tzdata-2024a-1.el9.noarch", "tzdata", "2024a-1.el9", "noarch"},
+		{"noarch", "", "", ""},
+		{"bash-5.1.x86_64", "", "", ""},
+	}
+	for _, tt := range tests {
+		name, version, arch := splitNEVRA(tt.in)
+		if name != tt.name || version != tt.version || arch != tt.arch {
+			t.Errorf("splitNEVRA(%q) = %q, %q, %q; want %q, %q, %q",
+				tt.in, name, version, arch, tt.name, tt.version, tt.arch)
+		}
+	}
+}
+
+func TestParseSourceLine(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Repository
+		ok   bool
+	}{
+		{
+			in:   "deb http://archive.ubuntu.com/ubuntu jammy main restricted",
+			want: Repository{Name: "jammy", URL: "http://archive.ubuntu.com/ubuntu", Enabled: true},
+			ok:   true,
+		},
+		{
+			in:   "deb [arch=amd64 signed-by=/etc/apt/keyrings/docker.gpg] https://download.docker.com/linux/ubuntu jammy stable",
+			want: Repository{Name: "jammy", URL: "https://download.docker.com/linux/ubuntu", Enabled: true},
+			ok:   true,
+		},
+		{in: "# deb http://archive.ubuntu.com/ubuntu jammy main"},
+		{in: "   "},
+		{in: "deb http://archive.ubuntu.com/ubuntu"},
+	}
+	for _, tt := range tests {
+		got, ok := parseSourceLine(tt.in)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseSourceLine(%q) = %+v, %v; want %+v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
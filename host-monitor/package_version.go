@@ -0,0 +1,298 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Version comparison as each package manager does it. All return -1, 0 or
+// 1 like strings.Compare.
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+func isAlpha(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+
+// compareNumbers compares digit strings of any length.
+func compareNumbers(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return sign(len(a) - len(b))
+	}
+	return strings.Compare(a, b)
+}
+
+// splitEpoch splits "1:9.2p1-2" into the epoch and the rest; the epoch
+// defaults to 0.
+func splitEpoch(version string) (int, string) {
+	if before, after, ok := strings.Cut(version, ":"); ok {
+		if epoch, err := strconv.Atoi(before); err == nil {
+			return epoch, after
+		}
+	}
+	return 0, version
+}
+
+// compareDebianVersions orders [epoch:]upstream[-revision] as dpkg does.
+func compareDebianVersions(a, b string) int {
+	aEpoch, a := splitEpoch(a)
+	bEpoch, b := splitEpoch(b)
+	if aEpoch != bEpoch {
+		return sign(aEpoch - bEpoch)
+	}
+
+	aUpstream, aRevision := a, ""
+	if i := strings.LastIndex(a, "-"); i >= 0 {
+		aUpstream, aRevision = a[:i], a[i+1:]
+	}
+	bUpstream, bRevision := b, ""
+	if i := strings.LastIndex(b, "-"); i >= 0 {
+		bUpstream, bRevision = b[:i], b[i+1:]
+	}
+	if c := compareDebianPart(aUpstream, bUpstream); c != 0 {
+		return c
+	}
+	return compareDebianPart(aRevision, bRevision)
+}
+
+// debianOrder ranks a character of a non-digit part: ~ before the end,
+// the end before letters and letters before everything else.
+func debianOrder(s string, i int) int {
+	switch {
+	case i >= len(s) || isDigit(s[i]):
+		return 0
+	case s[i] == '~':
+		return -1
+	case isAlpha(s[i]):
+		return int(s[i])
+	}
+	return int(s[i]) + 256
+}
+
+// compareDebianPart compares alternating non-digit and digit runs, dpkg's
+// verrevcmp.
+func compareDebianPart(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			if c := debianOrder(a, i) - debianOrder(b, j); c != 0 {
+				return sign(c)
+			}
+			i++
+			j++
+		}
+
+		aStart, bStart := i, j
+		for i < len(a) && isDigit(a[i]) {
+			i++
+		}
+		for j < len(b) && isDigit(b[j]) {
+			j++
+		}
+		if c := compareNumbers(a[min(aStart, len(a)):min(i, len(a))], b[min(bStart, len(b)):min(j, len(b))]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareRPMVersions orders [epoch:]version[-release] as rpm does. pacman
+// uses the same rules.
+func compareRPMVersions(a, b string) int {
+	aEpoch, a := splitEpoch(a)
+	bEpoch, b := splitEpoch(b)
+	if aEpoch != bEpoch {
+		return sign(aEpoch - bEpoch)
+	}
+
+	aVersion, aRelease, aHasRelease := cutLast(a, "-")
+	bVersion, bRelease, bHasRelease := cutLast(b, "-")
+	if c := rpmvercmp(aVersion, bVersion); c != 0 {
+		return c
+	}
+	// A version without release matches every release
+	if !aHasRelease || !bHasRelease {
+		return 0
+	}
+	return rpmvercmp(aRelease, bRelease)
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// rpmvercmp compares runs of digits numerically and runs of letters
+// lexically, skipping separators. ~ sorts before anything, even the end,
+// and ^ after the end but before anything else.
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	isSeparator := func(c byte) bool { return !isDigit(c) && !isAlpha(c) && c != '~' && c != '^' }
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for i < len(a) && isSeparator(a[i]) {
+			i++
+		}
+		for j < len(b) && isSeparator(b[j]) {
+			j++
+		}
+
+		aTilde, bTilde := i < len(a) && a[i] == '~', j < len(b) && b[j] == '~'
+		if aTilde || bTilde {
+			if !aTilde {
+				return 1
+			}
+			if !bTilde {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+
+		aCaret, bCaret := i < len(a) && a[i] == '^', j < len(b) && b[j] == '^'
+		if aCaret || bCaret {
+			switch {
+			case i >= len(a):
+				return -1
+			case j >= len(b):
+				return 1
+			case !aCaret:
+				return 1
+			case !bCaret:
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+
+		if i >= len(a) || j >= len(b) {
+			break
+		}
+
+		aStart, bStart := i, j
+		numeric := isDigit(a[i])
+		for i < len(a) && isDigit(a[i]) == numeric && (numeric || isAlpha(a[i])) {
+			i++
+		}
+		for j < len(b) && isDigit(b[j]) == numeric && (numeric || isAlpha(b[j])) {
+			j++
+		}
+		// Runs of different types: numbers are newer
+		if j == bStart {
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+
+		var c int
+		if numeric {
+			c = compareNumbers(a[aStart:i], b[bStart:j])
+		} else {
+			c = strings.Compare(a[aStart:i], b[bStart:j])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	// Whichever has something left is newer
+	switch {
+	case i >= len(a) && j >= len(b):
+		return 0
+	case i >= len(a):
+		return -1
+	}
+	return 1
+}
+
+// apkSuffixRank orders Alpine's version suffixes around the plain version
+// (rank 4).
+var apkSuffixRank = map[string]int{
+	"alpha": 0, "beta": 1, "pre": 2, "rc": 3, "cvs": 5, "svn": 6, "git": 7, "hg": 8, "p": 9,
+}
+
+// apkVersion is a parsed 1.2.3a_rc1_p2-r4.
+type apkVersion struct {
+	numbers  []string
+	letter   byte
+	suffixes [][2]string // name, number
+	release  string
+}
+
+func parseApkVersion(version string) apkVersion {
+	var parsed apkVersion
+	if main, release, ok := cutLast(version, "-r"); ok {
+		version, parsed.release = main, release
+	}
+
+	version, suffixes, _ := strings.Cut(version, "_")
+	if n := len(version); n > 0 && isAlpha(version[n-1]) {
+		parsed.letter, version = version[n-1], version[:n-1]
+	}
+	parsed.numbers = strings.Split(version, ".")
+
+	if suffixes != "" {
+		for _, suffix := range strings.Split(suffixes, "_") {
+			name := strings.TrimRight(suffix, "0123456789")
+			parsed.suffixes = append(parsed.suffixes, [2]string{name, suffix[len(name):]})
+		}
+	}
+	return parsed
+}
+
+// compareApkVersions orders Alpine versions: numbers, then the letter,
+// then suffixes (_rc1 before the release, _p1 after it), then -rN.
+func compareApkVersions(a, b string) int {
+	av, bv := parseApkVersion(a), parseApkVersion(b)
+
+	for k := 0; k < len(av.numbers) || k < len(bv.numbers); k++ {
+		// 1.2 is older than 1.2.1
+		if k >= len(av.numbers) {
+			return -1
+		}
+		if k >= len(bv.numbers) {
+			return 1
+		}
+		if c := compareNumbers(av.numbers[k], bv.numbers[k]); c != 0 {
+			return c
+		}
+	}
+	if av.letter != bv.letter {
+		return sign(int(av.letter) - int(bv.letter))
+	}
+
+	for k := 0; k < len(av.suffixes) || k < len(bv.suffixes); k++ {
+		aSuffix, bSuffix := [2]string{"", "0"}, [2]string{"", "0"}
+		aRank, bRank := 4, 4
+		if k < len(av.suffixes) {
+			aSuffix, aRank = av.suffixes[k], apkSuffixRank[av.suffixes[k][0]]
+		}
+		if k < len(bv.suffixes) {
+			bSuffix, bRank = bv.suffixes[k], apkSuffixRank[bv.suffixes[k][0]]
+		}
+		if aRank != bRank {
+			return sign(aRank - bRank)
+		}
+		if c := compareNumbers(aSuffix[1], bSuffix[1]); c != 0 {
+			return c
+		}
+	}
+
+	return compareNumbers(av.release, bv.release)
+}
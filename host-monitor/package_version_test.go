@@ -0,0 +1,96 @@
+package main
+
+import "testing"
+
+type versionTest struct {
+	a, b string
+	want int
+}
+
+// checkVersions checks compare in both directions.
+func checkVersions(t *testing.T, name string, compare func(a, b string) int, tests []versionTest) {
+	t.Helper()
+	for _, tt := range tests {
+		if got := compare(tt.a, tt.b); got != tt.want {
+			t.Errorf("%s(%q, %q) = %d, want %d", name, tt.a, tt.b, got, tt.want)
+		}
+		if got := compare(tt.b, tt.a); got != -tt.want {
+			t.Errorf("%s(%q, %q) = %d, want %d", name, tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestCompareDebianVersions(t *testing.T) {
+	checkVersions(t, "compareDebianVersions", compareDebianVersions, []versionTest{
+		{"1.0", "1.0", 0},
+		{"1.0-1", "1.0-2", -1},
+		{"1.0-10", "1.0-9", 1},
+		{"1.2.3", "1.10", -1},
+		{"1:1.0", "2.0", 1},
+		{"0:1.0", "1.0", 0},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~~", "1.0~", -1},
+		{"1.0", "1.0+dfsg", -1},
+		{"1.0a", "1.0+", -1},
+		{"1.0.0", "1.0", 1},
+		{"3.0.2-0ubuntu1.18", "3.0.2-0ubuntu1.19", -1},
+		{"3.0.2-0ubuntu1.10", "3.0.2-0ubuntu1.9", 1},
+		{"1:9.2p1-2", "1:9.2p1-2+deb12u2", -1},
+		{"2.36.1-8+deb12u1", "2.36.1-8", 1},
+		{"007", "7", 0},
+	})
+}
+
+func TestCompareRPMVersions(t *testing.T) {
+	checkVersions(t, "compareRPMVersions", compareRPMVersions, []versionTest{
+		{"1.0", "1.0", 0},
+		{"1.0-1.el9", "1.0-2.el9", -1},
+		{"1.10", "1.9", 1},
+		{"1.0a", "1.0", 1},
+		{"1.0", "1.0.1", -1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0^git1", "1.0", 1},
+		{"1.0^git1", "1.0.1", -1},
+		{"1:1.0", "2.0", 1},
+		{"1.0", "1.0-5", 0},
+		{"2.0.1", "2.0_1", 0},
+		{"a", "1", -1},
+		{"3.0.7-24.el9", "3.0.7-27.el9", -1},
+		{"8.7p1-34.el9_3.3", "8.7p1-34.el9", 1},
+	})
+}
+
+func TestCompareApkVersions(t *testing.T) {
+	checkVersions(t, "compareApkVersions", compareApkVersions, []versionTest{
+		{"1.2.4-r1", "1.2.4-r1", 0},
+		{"1.36.1-r5", "1.36.1-r7", -1},
+		{"1.2", "1.2.1", -1},
+		{"1.10", "1.9", 1},
+		{"1.2a", "1.2", 1},
+		{"1.2a", "1.2b", -1},
+		{"1.0_rc1", "1.0", -1},
+		{"1.0_alpha1", "1.0_beta1", -1},
+		{"1.0_p1", "1.0", 1},
+		{"1.0_rc2", "1.0_rc10", -1},
+		{"3.1.3-r0", "3.1.4-r0", -1},
+		{"1.0-r10", "1.0-r9", 1},
+	})
+}
+
+func TestSplitEpoch(t *testing.T) {
+	tests := []struct {
+		in    string
+		epoch int
+		rest  string
+	}{
+		{"1:9.2p1-2", 1, "9.2p1-2"},
+		{"9.2p1-2", 0, "9.2p1-2"},
+		{"x:1.0", 0, "x:1.0"},
+	}
+	for _, tt := range tests {
+		if epoch, rest := splitEpoch(tt.in); epoch != tt.epoch || rest != tt.rest {
+			t.Errorf("splitEpoch(%q) = %d, %q; want %d, %q", tt.in, epoch, rest, tt.epoch, tt.rest)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Pure-Go readers for /proc and /sys, so the collectors work in minimal
+// containers without ss, ps, find, stat or sensors. Callers fall back to the
+// external tools when these return an error.
+
+// userHZ is the clock tick rate of /proc/[pid]/stat times. It is 100 on
+// every architecture Linux exposes to user space.
+const userHZ = 100
+
+// tcpStates maps the hex st column of /proc/net/tcp to the names ss uses.
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+}
+
+// procSocket is one line of /proc/net/{tcp,tcp6,udp,udp6}.
+type procSocket struct {
+	Protocol   string // tcp or udp
+	Family     string // ipv4 or ipv6
+	LocalIP    net.IP
+	LocalPort  int
+	RemoteIP   net.IP
+	RemotePort int
+	State      string
+	UID        int
+	Inode      uint64
+}
+
+// Listening reports whether the socket accepts connections: a TCP socket in
+// LISTEN or an unconnected UDP socket.
+func (s procSocket) Listening() bool {
+	if s.Protocol == "tcp" {
+		return s.State == "LISTEN"
+	}
+	return s.State == "UNCONN"
+}
+
+func (s procSocket) LocalAddr() string {
+	return net.JoinHostPort(s.LocalIP.String(), strconv.Itoa(s.LocalPort))
+}
+
+func (s procSocket) RemoteAddr() string {
+	return net.JoinHostPort(s.RemoteIP.String(), strconv.Itoa(s.RemotePort))
+}
+
+// readProcSockets reads every TCP and UDP socket of the host network
+// namespace. It only fails when none of the tables could be read.
+func (h *Host) readProcSockets() ([]procSocket, error) {
+	var sockets []procSocket
+	var lastErr error
+	read := 0
+
+	for _, table := range []struct{ file, protocol, family string }{
+		{"tcp", "tcp", "ipv4"},
+		{"tcp6", "tcp", "ipv6"},
+		{"udp", "udp", "ipv4"},
+		{"udp6", "udp", "ipv6"},
+	} {
+		entries, err := h.parseProcNet(filepath.Join("/proc/net", table.file), table.protocol, table.family)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		read++
+		sockets = append(sockets, entries...)
+	}
+
+	if read == 0 {
+		return nil, lastErr
+	}
+	return sockets, nil
+}
+
+func (h *Host) parseProcNet(path, protocol, family string) ([]procSocket, error) {
+	file, err := h.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var sockets []procSocket
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // header
+
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+
+		localIP, localPort, err := parseHexAddr(fields[1])
+		if err != nil {
+			continue
+		}
+		remoteIP, remotePort, err := parseHexAddr(fields[2])
+		if err != nil {
+			continue
+		}
+
+		state := tcpStates[fields[3]]
+		if protocol == "udp" {
+			// UDP only uses ESTABLISHED and CLOSE, ss calls the latter UNCONN
+			state = "UNCONN"
+			if fields[3] == "01" {
+				state = "ESTAB"
+			}
+		}
+
+		uid, _ := strconv.Atoi(fields[7])
+		inode, _ := strconv.ParseUint(fields[9], 10, 64)
+
+		sockets = append(sockets, procSocket{
+			Protocol:   protocol,
+			Family:     family,
+			LocalIP:    localIP,
+			LocalPort:  localPort,
+			RemoteIP:   remoteIP,
+			RemotePort: remotePort,
+			State:      state,
+			UID:        uid,
+			Inode:      inode,
+		})
+	}
+
+	return sockets, scanner.Err()
+}
+
+// parseHexAddr decodes "0100007F:0035". The address is a sequence of 32-bit
+// words in host byte order, which is little-endian on all common platforms.
+func parseHexAddr(s string) (net.IP, int, error) {
+	addr, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, 0, fmt.Errorf("invalid address %q", s)
+	}
+
+	raw, err := hex.DecodeString(addr)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("invalid address %q", s)
+	}
+	for i := 0; i < len(raw); i += 4 {
+		raw[i], raw[i+1], raw[i+2], raw[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid port %q", s)
+	}
+
+	return net.IP(raw), int(port), nil
+}
+
+// procProcess holds what the collectors need from /proc/[pid].
+type procProcess struct {
+	PID       int
+	PPID      int
+	Name      string
+	State     string
+	UID       int
+	User      string
+	Cmdline   string
+	CPU       float64 // percent of one CPU since the process started, like ps
+	Memory    float64 // percent of MemTotal, like ps
+	RSS       int64   // kB
+	StartTime uint64  // clock ticks after boot
+}
+
+// readProcesses reads every process that is still alive while walking /proc.
+func (h *Host) readProcesses() ([]procProcess, error) {
+	entries, err := h.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	uptime := h.readUptimeSeconds()
+	memTotal := h.readMemTotal()
+
+	ctx := h.Context()
+	var processes []procProcess
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		process, err := h.readProcess(pid, uptime, memTotal)
+		if err != nil {
+			continue
+		}
+		processes = append(processes, process)
+	}
+
+	if len(processes) == 0 {
+		return nil, fmt.Errorf("no processes found in /proc")
+	}
+	return processes, nil
+}
+
+func (h *Host) readProcess(pid int, uptime float64, memTotal int64) (procProcess, error) {
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+	process := procProcess{PID: pid}
+
+	stat, err := h.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return process, err
+	}
+
+	// pid (comm) state ppid ... The comm may contain spaces and parentheses
+	open := strings.IndexByte(string(stat), '(')
+	end := strings.LastIndexByte(string(stat), ')')
+	if open < 0 || end < open {
+		return process, fmt.Errorf("invalid stat for pid %d", pid)
+	}
+	process.Name = string(stat[open+1 : end])
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 20 {
+		return process, fmt.Errorf("short stat for pid %d", pid)
+	}
+
+	// fields[0] is field 3 of proc(5)
+	process.State = fields[0]
+	process.PPID, _ = strconv.Atoi(fields[1])
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	process.StartTime, _ = strconv.ParseUint(fields[19], 10, 64)
+
+	if elapsed := uptime - float64(process.StartTime)/userHZ; elapsed > 0 {
+		process.CPU = float64(utime+stime) / userHZ / elapsed * 100
+	}
+
+	if status, err := h.ReadFile(filepath.Join(dir, "status")); err == nil {
+		for _, line := range strings.Split(string(status), "\n") {
+			key, value, _ := strings.Cut(line, ":")
+			values := strings.Fields(value)
+			if len(values) == 0 {
+				continue
+			}
+			switch key {
+			case "Uid":
+				process.UID, _ = strconv.Atoi(values[0])
+			case "VmRSS":
+				process.RSS, _ = strconv.ParseInt(values[0], 10, 64)
+			}
+		}
+	}
+	process.User = h.UserName(process.UID)
+	if memTotal > 0 {
+		process.Memory = float64(process.RSS) / float64(memTotal) * 100
+	}
+
+	process.Cmdline = h.readCmdline(pid)
+	if process.Cmdline == "" {
+		// Kernel threads have no command line, ps shows them in brackets
+		process.Cmdline = "[" + process.Name + "]"
+	}
+
+	return process, nil
+}
+
+func (h *Host) readCmdline(pid int) string {
+	data, err := h.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.ReplaceAll(string(data), "\x00", " "))
+}
+
+func (h *Host) readUptimeSeconds() float64 {
+	data, err := h.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0
+	}
+	uptime, _ := strconv.ParseFloat(fields[0], 64)
+	return uptime
+}
+
+// readMemTotal returns MemTotal from /proc/meminfo in kB.
+func (h *Host) readMemTotal() int64 {
+	data, err := h.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "MemTotal:") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 {
+				total, _ := strconv.ParseInt(fields[1], 10, 64)
+				return total
+			}
+		}
+	}
+	return 0
+}
+
+// socketOwners maps socket inodes to the process holding them by walking
+// /proc/[pid]/fd. Sockets of other users are only visible to root.
+func (h *Host) socketOwners() map[uint64]procProcess {
+	owners := make(map[uint64]procProcess)
+
+	entries, err := h.ReadDir("/proc")
+	if err != nil {
+		return owners
+	}
+
+	ctx := h.Context()
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		fdDir := filepath.Join("/proc", entry.Name(), "fd")
+		fds, err := h.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+
+		var name string
+		for _, fd := range fds {
+			link, err := h.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]"), 10, 64)
+			if err != nil {
+				continue
+			}
+
+			if name == "" {
+				name = h.readComm(pid)
+			}
+			owners[inode] = procProcess{PID: pid, Name: name}
+		}
+	}
+
+	return owners
+}
+
+func (h *Host) readComm(pid int) string {
+	data, err := h.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "comm"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// hwmonSensor is one temperature input under /sys/class/hwmon.
+type hwmonSensor struct {
+	Chip    string
+	Label   string
+	Celsius float64
+}
+
+func (s hwmonSensor) String() string {
+	return fmt.Sprintf("%s %s: %+.1f°C", s.Chip, s.Label, s.Celsius)
+}
+
+// cpuChip reports whether a hwmon chip measures the CPU package or cores.
+func (s hwmonSensor) cpuChip() bool {
+	switch s.Chip {
+	case "coretemp", "k10temp", "k8temp", "zenpower", "cpu_thermal", "acpitz", "soc_thermal":
+		return true
+	}
+	return false
+}
+
+// diskChip reports whether a hwmon chip belongs to a drive.
+func (s hwmonSensor) diskChip() bool {
+	return s.Chip == "drivetemp" || s.Chip == "nvme"
+}
+
+// readHwmonTemperatures reads every tempN_input of every hwmon chip.
+func (h *Host) readHwmonTemperatures() ([]hwmonSensor, error) {
+	chips, err := h.Glob("/sys/class/hwmon/hwmon*")
+	if err != nil || len(chips) == 0 {
+		return nil, fmt.Errorf("no hwmon devices")
+	}
+
+	var sensors []hwmonSensor
+	for _, chip := range chips {
+		name := h.readTrimmed(filepath.Join(chip, "name"))
+		inputs, _ := h.Glob(filepath.Join(chip, "temp*_input"))
+		sort.Strings(inputs)
+
+		for _, input := range inputs {
+			milli, err := strconv.ParseFloat(h.readTrimmed(input), 64)
+			if err != nil {
+				continue
+			}
+			label := h.readTrimmed(strings.TrimSuffix(input, "_input") + "_label")
+			if label == "" {
+				label = strings.TrimSuffix(filepath.Base(input), "_input")
+			}
+			sensors = append(sensors, hwmonSensor{Chip: name, Label: label, Celsius: milli / 1000})
+		}
+	}
+
+	if len(sensors) == 0 {
+		return nil, fmt.Errorf("no hwmon temperature inputs")
+	}
+	return sensors, nil
+}
+
+func (h *Host) readTrimmed(path string) string {
+	data, err := h.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseHexAddr(t *testing.T) {
+	tests := []struct {
+		in   string
+		ip   string
+		port int
+		err  bool
+	}{
+		{in: "0100007F:0035", ip: "127.0.0.1", port: 53},
+		{in: "00000000:0016", ip: "0.0.0.0", port: 22},
+		{in: "0A01A8C0:01BB", ip: "192.168.1.10", port: 443},
+		{in: "00000000000000000000000000000000:0016", ip: "::", port: 22},
+		{in: "00000000000000000000000001000000:1F90", ip: "::1", port: 8080},
+		{in: "0000000000000000FFFF00000100007F:0277", ip: "127.0.0.1", port: 631},
+		{in: "0100007F", err: true},
+		{in: "0100007:0035", err: true},
+		{in: "01000000007F:0035", err: true},
+		{in: "0100007F:XYZ", err: true},
+		{in: "0100007F:10000", err: true},
+	}
+
+	for _, tt := range tests {
+		ip, port, err := parseHexAddr(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parseHexAddr(%q) = %v, %d; want an error", tt.in, ip, port)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseHexAddr(%q): %v", tt.in, err)
+			continue
+		}
+		if !ip.Equal(net.ParseIP(tt.ip)) || port != tt.port {
+			t.Errorf("parseHexAddr(%q) = %v, %d; want %s, %d", tt.in, ip, port, tt.ip, tt.port)
+		}
+	}
+}
+
+func TestParseProcNet(t *testing.T) {
+	host := newTestHost(t, map[string]string{
+		"proc/net/tcp": `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 18231 1 0000000000000000 100 0 0 10 0
+   1: 0A01A8C0:0016 0B01A8C0:D431 01 00000000:00000000 02:0009F2A1 00000000     0        0 40122 4 0000000000000000 20 4 31 10 -1
+   2: truncated line
+   3: ZZZZZZZZ:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1 1 0000000000000000 100 0 0 10 0
+`,
+		"proc/net/udp": `   sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  412: 3500007F:0035 00000000:0000 07 00000000:00000000 00:00000000 00000000   101        0 17043 2 0000000000000000 0
+  600: 0A01A8C0:A1B2 08080808:0035 01 00000000:00000000 00:00000000 00000000  1000        0 52311 2 0000000000000000 0
+`,
+	})
+
+	tests := []struct {
+		path, protocol string
+		want           []procSocket
+	}{
+		{
+			path:     "/proc/net/tcp",
+			protocol: "tcp",
+			want: []procSocket{
+				{LocalIP: net.IPv4(0, 0, 0, 0), LocalPort: 22, RemoteIP: net.IPv4(0, 0, 0, 0), State: "LISTEN", Inode: 18231},
+				{LocalIP: net.IPv4(192, 168, 1, 10), LocalPort: 22, RemoteIP: net.IPv4(192, 168, 1, 11), RemotePort: 54321, State: "ESTABLISHED", Inode: 40122},
+			},
+		},
+		{
+			path:     "/proc/net/udp",
+			protocol: "udp",
+			want: []procSocket{
+				{LocalIP: net.IPv4(127, 0, 0, 53), LocalPort: 53, RemoteIP: net.IPv4(0, 0, 0, 0), State: "UNCONN", UID: 101, Inode: 17043},
+				{LocalIP: net.IPv4(192, 168, 1, 10), LocalPort: 41394, RemoteIP: net.IPv4(8, 8, 8, 8), RemotePort: 53, State: "ESTAB", UID: 1000, Inode: 52311},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		sockets, err := host.parseProcNet(tt.path, tt.protocol, "ipv4")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		if len(sockets) != len(tt.want) {
+			t.Fatalf("%s: got %d sockets, want %d: %+v", tt.path, len(sockets), len(tt.want), sockets)
+		}
+		for i, got := range sockets {
+			want := tt.want[i]
+			if got.Protocol != tt.protocol || got.Family != "ipv4" ||
+				!got.LocalIP.Equal(want.LocalIP) || got.LocalPort != want.LocalPort ||
+				!got.RemoteIP.Equal(want.RemoteIP) || got.RemotePort != want.RemotePort ||
+				got.State != want.State || got.UID != want.UID || got.Inode != want.Inode {
+				t.Errorf("%s line %d = %+v, want %+v", tt.path, i, got, want)
+			}
+		}
+	}
+
+	if _, err := host.parseProcNet("/proc/net/tcp6", "tcp", "ipv6"); err == nil {
+		t.Error("parseProcNet of a missing file succeeded")
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// formatSARIF is accepted by "run" only. It writes the security findings of
+// the run as one SARIF 2.1.0 log; other modules have no findings and are
+// left out.
+const formatSARIF = "sarif"
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool              `json:"tool"`
+	Results    []sarifResult          `json:"results"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string            `json:"id"`
+	Name                 string            `json:"name"`
+	ShortDescription     sarifText         `json:"shortDescription"`
+	FullDescription      sarifText         `json:"fullDescription"`
+	Help                 sarifText         `json:"help"`
+	DefaultConfiguration sarifLevel        `json:"defaultConfiguration"`
+	Properties           map[string]string `json:"properties"`
+}
+
+type sarifText struct {
+	Text string `json:"text"`
+}
+
+type sarifLevel struct {
+	Level string `json:"level"`
+}
+
+type sarifResult struct {
+	RuleID       string             `json:"ruleId"`
+	RuleIndex    int                `json:"ruleIndex"`
+	Level        string             `json:"level"`
+	Message      sarifText          `json:"message"`
+	Locations    []sarifLocation    `json:"locations"`
+	Suppressions []sarifSuppression `json:"suppressions,omitempty"`
+	Fingerprints map[string]string  `json:"partialFingerprints"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifLogicalLocation struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification,omitempty"`
+}
+
+// sarifLevels maps finding severities to SARIF levels, and
+// securitySeverity to the CVSS-like "security-severity" property that code
+// scanning tools rank by.
+var sarifLevels = map[string]string{
+	SeverityCritical: "error", SeverityHigh: "error", SeverityMedium: "warning", SeverityLow: "note", SeverityInfo: "note",
+}
+
+var securitySeverity = map[string]string{
+	SeverityCritical: "9.5", SeverityHigh: "8.0", SeverityMedium: "5.5", SeverityLow: "3.0", SeverityInfo: "0.0",
+}
+
+// BuildSARIF converts the findings of one scan. Findings about a file point
+// at it; the others are located on the host.
+func BuildSARIF(scan SecurityScan) sarifLog {
+	driver := sarifDriver{Name: "host-monitor"}
+	index := make(map[string]int)
+	for i, rule := range findingRules {
+		index[rule.ID] = i
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   rule.ID,
+			Name:                 sarifRuleName(rule.Title),
+			ShortDescription:     sarifText{rule.Title},
+			FullDescription:      sarifText{rule.Description},
+			Help:                 sarifText{rule.Remediation},
+			DefaultConfiguration: sarifLevel{sarifLevels[rule.Severity]},
+			Properties: map[string]string{
+				"security-severity": securitySeverity[rule.Severity],
+				"severity":          rule.Severity,
+			},
+		})
+	}
+
+	results := []sarifResult{}
+	for _, finding := range scan.Findings {
+		location := sarifLocation{LogicalLocations: []sarifLogicalLocation{{Name: scan.Hostname, Kind: "host"}}}
+		if finding.Path != "" {
+			location.PhysicalLocation = &sarifPhysicalLocation{ArtifactLocation: sarifArtifact{URI: (&url.URL{Scheme: "file", Path: finding.Path}).String()}}
+		}
+
+		result := sarifResult{
+			RuleID:    finding.ID,
+			RuleIndex: index[finding.ID],
+			Level:     sarifLevels[finding.Severity],
+			Message:   sarifText{finding.Title + ": " + finding.Evidence},
+			Locations: []sarifLocation{location},
+			// Stable across scans, so tools can track a finding over time:
+			// Evidence holds CPU percentages and log timestamps
+			Fingerprints: map[string]string{"hostFinding/v2": scan.Hostname + "|" + finding.ID + "|" + finding.Subject},
+		}
+		if finding.Suppressed {
+			result.Suppressions = []sarifSuppression{{Kind: "external", Justification: finding.Reason}}
+		}
+		results = append(results, result)
+	}
+
+	return sarifLog{
+		Schema:  sarifSchema,
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool:       sarifTool{Driver: driver},
+			Results:    results,
+			Properties: map[string]interface{}{"hostname": scan.Hostname, "score": scan.Score},
+		}},
+	}
+}
+
+// sarifRuleName turns a title into the PascalCase name SARIF expects.
+func sarifRuleName(title string) string {
+	var name strings.Builder
+	for _, word := range strings.FieldsFunc(title, func(r rune) bool { return r == ' ' || r == '-' || r == '/' }) {
+		name.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return name.String()
+}
+
+// writeSARIF writes one SARIF log with a run per security result.
+func writeSARIF(w io.Writer, results []CollectorResult) error {
+	log := sarifLog{Schema: sarifSchema, Version: "2.1.0", Runs: []sarifRun{}}
+	for _, result := range results {
+		scan, ok := result.Data.(SecurityScan)
+		if !ok || result.Err != nil {
+			continue
+		}
+		log.Runs = append(log.Runs, BuildSARIF(scan).Runs...)
+	}
+	if len(log.Runs) == 0 {
+		return fmt.Errorf("no security results, run with --modules security")
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+// Fingerprints must not change with the live values in the evidence.
+func TestSARIFFingerprintIgnoresEvidence(t *testing.T) {
+	scan := func(cpu float64, sudoLine string) SecurityScan {
+		scan := SecurityScan{
+			Hostname:         "web-01",
+			FirewallStatus:   "Status: active",
+			HighCPUProcesses: []ProcessInfo{{PID: "1044", User: "ubuntu", CPU: cpu, Command: "/usr/bin/python3 worker.py"}},
+			SudoLogs:         []string{sudoLine},
+		}
+		scan.Findings = NewSecurityScanner().findings(scan)
+		return scan
+	}
+	fingerprints := func(scan SecurityScan) map[string]string {
+		prints := make(map[string]string)
+		for _, result := range BuildSARIF(scan).Runs[0].Results {
+			prints[result.RuleID] = result.Fingerprints["hostFinding/v2"]
+		}
+		return prints
+	}
+
+	before := fingerprints(scan(59.0, "Oct 18 07:52:40 web-01 sudo: alice : 3 incorrect password attempts ; TTY=pts/1 ; USER=root ; COMMAND=/bin/bash"))
+	after := fingerprints(scan(87.5, "Oct 19 11:02:13 web-01 sudo: alice : 1 incorrect password attempt ; TTY=pts/4 ; USER=root ; COMMAND=/bin/bash"))
+
+	for _, id := range []string{"HM006", "HM007"} {
+		if before[id] == "" || before[id] != after[id] {
+			t.Errorf("%s fingerprint changed from %q to %q", id, before[id], after[id])
+		}
+	}
+
+	other := fingerprints(scan(59.0, "Oct 18 07:52:40 web-01 sudo: bob : 3 incorrect password attempts ; TTY=pts/1 ; USER=root ; COMMAND=/bin/bash"))
+	if other["HM006"] == before["HM006"] {
+		t.Errorf("HM006 fingerprint %q is the same for another user", other["HM006"])
+	}
+}
+
+func TestSudoUser(t *testing.T) {
+	tests := []struct {
+		line, want string
+	}{
+		{"Oct 18 07:52:40 db-02 sudo: postgres : 3 incorrect password attempts ; TTY=pts/1 ; USER=root ; COMMAND=/bin/bash", "postgres"},
+		{"2025-10-18T07:52:40.771201+00:00 db-02 sudo[4411]:    alice : user NOT in sudoers ; TTY=pts/0 ; PWD=/home/alice ; USER=root ; COMMAND=/bin/sh", "alice"},
+		{"Oct 18 07:52:40 web-01 sudo: pam_unix(sudo:auth): authentication failure; logname=bob uid=1001 euid=0 tty=/dev/pts/2 ruser=bob rhost=  user=bob", "bob"},
+		{"Oct 18 07:52:40 web-01 sudo: something else failed", "sudo: something else failed"},
+	}
+	for _, tt := range tests {
+		if got := sudoUser(tt.line); got != tt.want {
+			t.Errorf("sudoUser(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	sbomCycloneDX = "cyclonedx"
+	sbomSPDX      = "spdx"
+)
+
+// purlTypes maps package managers to package URL types
+// (https://github.com/package-url/purl-spec).
+var purlTypes = map[string]string{
+	"dpkg": "deb", "rpm": "rpm", "apk": "apk", "pacman": "alpm",
+}
+
+// CycloneDXBOM is a CycloneDX 1.5 JSON document
+// (https://cyclonedx.org/docs/1.5/json/).
+type CycloneDXBOM struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber"`
+	Version      int                  `json:"version"`
+	Metadata     CycloneDXMetadata    `json:"metadata"`
+	Components   []CycloneDXComponent `json:"components"`
+}
+
+type CycloneDXMetadata struct {
+	Timestamp string `json:"timestamp"`
+	Tools     struct {
+		Components []CycloneDXComponent `json:"components"`
+	} `json:"tools"`
+	Component  *CycloneDXComponent `json:"component,omitempty"`
+	Properties []CycloneDXProperty `json:"properties,omitempty"`
+}
+
+type CycloneDXComponent struct {
+	Type        string              `json:"type"`
+	BOMRef      string              `json:"bom-ref,omitempty"`
+	Name        string              `json:"name"`
+	Version     string              `json:"version,omitempty"`
+	Description string              `json:"description,omitempty"`
+	PURL        string              `json:"purl,omitempty"`
+	Properties  []CycloneDXProperty `json:"properties,omitempty"`
+}
+
+type CycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// SPDXDocument is an SPDX 2.3 JSON document
+// (https://spdx.github.io/spdx-spec/v2.3/).
+type SPDXDocument struct {
+	SPDXVersion       string `json:"spdxVersion"`
+	DataLicense       string `json:"dataLicense"`
+	SPDXID            string `json:"SPDXID"`
+	Name              string `json:"name"`
+	DocumentNamespace string `json:"documentNamespace"`
+	CreationInfo      struct {
+		Created  string   `json:"created"`
+		Creators []string `json:"creators"`
+		Comment  string   `json:"comment,omitempty"`
+	} `json:"creationInfo"`
+	Packages      []SPDXPackage      `json:"packages"`
+	Relationships []SPDXRelationship `json:"relationships"`
+}
+
+type SPDXPackage struct {
+	SPDXID                string            `json:"SPDXID"`
+	Name                  string            `json:"name"`
+	VersionInfo           string            `json:"versionInfo,omitempty"`
+	DownloadLocation      string            `json:"downloadLocation"`
+	FilesAnalyzed         bool              `json:"filesAnalyzed"`
+	LicenseConcluded      string            `json:"licenseConcluded"`
+	LicenseDeclared       string            `json:"licenseDeclared"`
+	CopyrightText         string            `json:"copyrightText"`
+	Summary               string            `json:"summary,omitempty"`
+	SourceInfo            string            `json:"sourceInfo,omitempty"`
+	PrimaryPackagePurpose string            `json:"primaryPackagePurpose,omitempty"`
+	ExternalRefs          []SPDXExternalRef `json:"externalRefs,omitempty"`
+}
+
+type SPDXExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type SPDXRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// ExportSBOM collects the installed packages and writes them as a CycloneDX
+// or SPDX JSON document.
+func (pm *PackageManager) ExportSBOM(w io.Writer, format string) error {
+	info := pm.GetPackageInfo()
+	if info.Manager == "" {
+		return fmt.Errorf("no supported package manager (dpkg, rpm, apk, pacman)")
+	}
+
+	var document any
+	switch format {
+	case sbomCycloneDX:
+		document = CycloneDX(info)
+	case sbomSPDX:
+		document = SPDX(info)
+	default:
+		return fmt.Errorf("unknown SBOM format %q (use cyclonedx or spdx)", format)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(document)
+}
+
+// CycloneDX describes the host as the BOM's device with the operating
+// system and every installed package as components.
+func CycloneDX(info PackageInfo) CycloneDXBOM {
+	bom := CycloneDXBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + newUUID(),
+		Version:      1,
+		Components:   []CycloneDXComponent{},
+	}
+	bom.Metadata.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	bom.Metadata.Tools.Components = []CycloneDXComponent{{Type: "application", Name: "host-monitor"}}
+	bom.Metadata.Component = &CycloneDXComponent{Type: "device", BOMRef: "host", Name: info.Hostname}
+	bom.Metadata.Properties = []CycloneDXProperty{
+		{Name: "host-monitor:hostname", Value: info.Hostname},
+		{Name: "host-monitor:package_manager", Value: info.Manager},
+	}
+
+	if info.OS.ID != "" {
+		bom.Components = append(bom.Components, CycloneDXComponent{
+			Type:        "operating-system",
+			BOMRef:      "os",
+			Name:        info.OS.ID,
+			Version:     info.OS.VersionID,
+			Description: info.OS.Name,
+		})
+	}
+	for _, pkg := range info.InstalledPkgs {
+		purl := packageURL(info, pkg)
+		component := CycloneDXComponent{
+			Type:        "library",
+			BOMRef:      purl,
+			Name:        pkg.Name,
+			Version:     pkg.Version,
+			Description: pkg.Description,
+			PURL:        purl,
+		}
+		source := pkg.Source
+		if source == pkg.Name {
+			source = ""
+		}
+		for _, property := range [][2]string{
+			{"host-monitor:architecture", pkg.Architecture},
+			{"host-monitor:source", source},
+			{"host-monitor:section", pkg.Section},
+			{"host-monitor:installed_size", pkg.Size},
+		} {
+			if property[1] != "" {
+				component.Properties = append(component.Properties, CycloneDXProperty{Name: property[0], Value: property[1]})
+			}
+		}
+		bom.Components = append(bom.Components, component)
+	}
+	return bom
+}
+
+// SPDX describes the host as a DEVICE package that contains the operating
+// system, which contains every installed package.
+func SPDX(info PackageInfo) SPDXDocument {
+	document := SPDXDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              "host-monitor-" + info.Hostname,
+		DocumentNamespace: "https://spdx.org/spdxdocs/host-monitor-" + url.PathEscape(info.Hostname) + "-" + newUUID(),
+	}
+	document.CreationInfo.Created = time.Now().UTC().Format(time.RFC3339)
+	document.CreationInfo.Creators = []string{"Tool: host-monitor"}
+	document.CreationInfo.Comment = fmt.Sprintf("Installed packages of %s (%s) from %s",
+		info.Hostname, firstNonEmpty(info.OS.Name, info.OS.ID, "unknown distribution"), info.Manager)
+
+	noAssertion := func(pkg SPDXPackage) SPDXPackage {
+		pkg.DownloadLocation, pkg.LicenseConcluded, pkg.LicenseDeclared, pkg.CopyrightText =
+			"NOASSERTION", "NOASSERTION", "NOASSERTION", "NOASSERTION"
+		return pkg
+	}
+	relate := func(element, relationship, related string) {
+		document.Relationships = append(document.Relationships, SPDXRelationship{
+			SPDXElementID: element, RelationshipType: relationship, RelatedSPDXElement: related,
+		})
+	}
+
+	document.Packages = append(document.Packages, noAssertion(SPDXPackage{
+		SPDXID:                "SPDXRef-Host",
+		Name:                  info.Hostname,
+		PrimaryPackagePurpose: "DEVICE",
+	}))
+	relate("SPDXRef-DOCUMENT", "DESCRIBES", "SPDXRef-Host")
+
+	// Packages hang off the operating system, or the host without os-release
+	parent := "SPDXRef-Host"
+	if info.OS.ID != "" {
+		document.Packages = append(document.Packages, noAssertion(SPDXPackage{
+			SPDXID:                "SPDXRef-OperatingSystem",
+			Name:                  info.OS.ID,
+			VersionInfo:           info.OS.VersionID,
+			Summary:               info.OS.Name,
+			PrimaryPackagePurpose: "OPERATING-SYSTEM",
+		}))
+		relate(parent, "CONTAINS", "SPDXRef-OperatingSystem")
+		parent = "SPDXRef-OperatingSystem"
+	}
+
+	for i, pkg := range info.InstalledPkgs {
+		spdxPackage := noAssertion(SPDXPackage{
+			SPDXID:      fmt.Sprintf("SPDXRef-Package-%d-%s", i+1, spdxIDChars.ReplaceAllString(pkg.Name, "-")),
+			Name:        pkg.Name,
+			VersionInfo: pkg.Version,
+			Summary:     pkg.Description,
+			ExternalRefs: []SPDXExternalRef{
+				{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: packageURL(info, pkg)},
+			},
+		})
+		if pkg.Source != "" && pkg.Source != pkg.Name {
+			spdxPackage.SourceInfo = "built from source package " + pkg.Source
+		}
+		document.Packages = append(document.Packages, spdxPackage)
+		relate(parent, "CONTAINS", spdxPackage.SPDXID)
+	}
+	return document
+}
+
+// spdxIDChars matches what SPDX identifiers may not contain.
+var spdxIDChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// packageURL builds the purl of an installed package, e.g.
+// pkg:deb/ubuntu/openssl@3.0.2-0ubuntu1.18?arch=amd64&distro=ubuntu-22.04.
+// rpm epochs go into a qualifier, dpkg keeps them in the version.
+func packageURL(info PackageInfo, pkg Package) string {
+	version := pkg.Version
+	var qualifiers []string
+	if pkg.Architecture != "" {
+		qualifiers = append(qualifiers, "arch="+purlEscape(pkg.Architecture))
+	}
+	if info.OS.ID != "" {
+		distro := info.OS.ID
+		if info.OS.VersionID != "" {
+			distro += "-" + info.OS.VersionID
+		}
+		qualifiers = append(qualifiers, "distro="+purlEscape(distro))
+	}
+	if info.Manager == "rpm" {
+		if epoch, rest := splitEpoch(version); rest != version {
+			version = rest
+			qualifiers = append(qualifiers, fmt.Sprintf("epoch=%d", epoch))
+		}
+	}
+	if pkg.Source != "" && pkg.Source != pkg.Name {
+		qualifiers = append(qualifiers, "upstream="+purlEscape(pkg.Source))
+	}
+
+	// The namespace is the distribution, left out without os-release
+	purl := "pkg:" + purlTypes[info.Manager] + "/"
+	if info.OS.ID != "" {
+		purl += purlEscape(info.OS.ID) + "/"
+	}
+	purl += purlEscape(pkg.Name)
+	if version != "" {
+		purl += "@" + purlEscape(version)
+	}
+	if len(qualifiers) > 0 {
+		purl += "?" + strings.Join(qualifiers, "&")
+	}
+	return purl
+}
+
+// purlEscape percent-encodes a purl component. Only unreserved characters
+// and ":" stay as they are: "+" would be read as a space, "@" would split the
+// version and "&", "=" and "#" the qualifiers. "~" is common in Debian
+// versions and is kept.
+func purlEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '.', c == '-', c == '_', c == '~', c == ':':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// sbomCommand writes the installed packages as a CycloneDX or SPDX document.
+func sbomCommand(args []string) int {
+	fs := flag.NewFlagSet("sbom", flag.ContinueOnError)
+	fs.Usage = usage
+	format := fs.String("format", sbomCycloneDX, "SBOM format: cyclonedx or spdx")
+	output := fs.String("output", "", "Write the SBOM to this file instead of stdout")
+	configPath := fs.String("config", "", "Collector config file (JSON)")
+	applyHost := hostFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *format != sbomCycloneDX && *format != sbomSPDX {
+		fmt.Fprintf(os.Stderr, "❌ Unknown SBOM format %q (use cyclonedx or spdx)\n", *format)
+		return 2
+	}
+	registry, err := newConfiguredRegistry(applyHost(), defaultSampleInterval, *configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+
+	var sbom bytes.Buffer
+	if err := registry.Settings().packageManager().ExportSBOM(&sbom, *format); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	if *output == "" {
+		os.Stdout.Write(sbom.Bytes())
+		return 0
+	}
+	if err := os.WriteFile(*output, sbom.Bytes(), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	fmt.Printf("💾 %s SBOM written to %s\n", *format, *output)
+	return 0
+}
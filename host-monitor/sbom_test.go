@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestPackageURL(t *testing.T) {
+	ubuntu := OSRelease{ID: "ubuntu", VersionID: "22.04", Name: "Ubuntu 22.04.4 LTS"}
+	tests := []struct {
+		name string
+		info PackageInfo
+		pkg  Package
+		want string
+	}{
+		{
+			name: "deb",
+			info: PackageInfo{Manager: "dpkg", OS: ubuntu},
+			pkg:  Package{Name: "openssl", Version: "3.0.2-0ubuntu1.18", Architecture: "amd64"},
+			want: "pkg:deb/ubuntu/openssl@3.0.2-0ubuntu1.18?arch=amd64&distro=ubuntu-22.04",
+		},
+		{
+			name: "deb keeps the epoch in the version and escapes + but not ~",
+			info: PackageInfo{Manager: "dpkg", OS: OSRelease{ID: "debian", VersionID: "12"}},
+			pkg:  Package{Name: "libpq5", Version: "1:15.6+dfsg-0~deb12u1", Architecture: "amd64", Source: "postgresql-15"},
+			want: "pkg:deb/debian/libpq5@1:15.6%2Bdfsg-0~deb12u1?arch=amd64&distro=debian-12&upstream=postgresql-15",
+		},
+		{
+			name: "source equal to the name is not an upstream",
+			info: PackageInfo{Manager: "dpkg", OS: ubuntu},
+			pkg:  Package{Name: "bash", Version: "5.1-6ubuntu1", Architecture: "amd64", Source: "bash"},
+			want: "pkg:deb/ubuntu/bash@5.1-6ubuntu1?arch=amd64&distro=ubuntu-22.04",
+		},
+		{
+			name: "rpm moves the epoch into a qualifier",
+			info: PackageInfo{Manager: "rpm", OS: OSRelease{ID: "rocky", VersionID: "9.3"}},
+			pkg:  Package{Name: "openssl-libs", Version: "1:3.0.7-25.el9_3", Architecture: "x86_64"},
+			want: "pkg:rpm/rocky/openssl-libs@3.0.7-25.el9_3?arch=x86_64&distro=rocky-9.3&epoch=1",
+		},
+		{
+			name: "rpm without epoch",
+			info: PackageInfo{Manager: "rpm", OS: OSRelease{ID: "fedora", VersionID: "40"}},
+			pkg:  Package{Name: "bash", Version: "5.2.26-3.fc40", Architecture: "x86_64"},
+			want: "pkg:rpm/fedora/bash@5.2.26-3.fc40?arch=x86_64&distro=fedora-40",
+		},
+		{
+			name: "apk",
+			info: PackageInfo{Manager: "apk", OS: OSRelease{ID: "alpine", VersionID: "3.19.1"}},
+			pkg:  Package{Name: "libcrypto3", Version: "3.1.4-r5", Architecture: "x86_64", Source: "openssl"},
+			want: "pkg:apk/alpine/libcrypto3@3.1.4-r5?arch=x86_64&distro=alpine-3.19.1&upstream=openssl",
+		},
+		{
+			name: "alpm on a rolling release without VERSION_ID",
+			info: PackageInfo{Manager: "pacman", OS: OSRelease{ID: "arch"}},
+			pkg:  Package{Name: "gtk2+extra", Version: "2:1.2.3-1", Architecture: "x86_64"},
+			want: "pkg:alpm/arch/gtk2%2Bextra@2:1.2.3-1?arch=x86_64&distro=arch",
+		},
+		{
+			name: "no os-release drops the namespace and distro",
+			info: PackageInfo{Manager: "dpkg"},
+			pkg:  Package{Name: "busybox", Version: "1:1.35.0-4"},
+			want: "pkg:deb/busybox@1:1.35.0-4",
+		},
+		{
+			name: "characters that would split the purl",
+			info: PackageInfo{Manager: "apk", OS: OSRelease{ID: "alpine", VersionID: "3.19"}},
+			pkg:  Package{Name: "we ird/name", Version: "1.0@2#x", Architecture: "a&b=c?"},
+			want: "pkg:apk/alpine/we%20ird%2Fname@1.0%402%23x?arch=a%26b%3Dc%3F&distro=alpine-3.19",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := packageURL(tt.info, tt.pkg); got != tt.want {
+			t.Errorf("%s: packageURL = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// sbomMasks blank the serial number, namespace and timestamps, which change
+// on every run.
+var sbomMasks = []struct {
+	pattern *regexp.Regexp
+	replace string
+}{
+	{regexp.MustCompile(`("serialNumber": )"[^"]*"`), `$1"urn:uuid:<uuid>"`},
+	{regexp.MustCompile(`("documentNamespace": "[^"]*-)[0-9a-f-]{36}"`), `$1<uuid>"`},
+	{regexp.MustCompile(`("(timestamp|created)": )"[^"]*"`), `$1"<time>"`},
+}
+
+// sbomFixtures hold one package of each backend, with the fields each
+// backend fills in.
+var sbomFixtures = map[string]PackageInfo{
+	"dpkg": {
+		Hostname: "web-01", Manager: "dpkg",
+		OS: OSRelease{ID: "ubuntu", VersionID: "22.04", Name: "Ubuntu 22.04.4 LTS"},
+		InstalledPkgs: []Package{{
+			Name: "libssl3", Version: "3.0.2-0ubuntu1.18", Architecture: "amd64", Size: "5832",
+			Description: "Secure Sockets Layer toolkit - shared libraries", Section: "libs", Source: "openssl",
+		}},
+	},
+	"rpm": {
+		Hostname: "db-02", Manager: "rpm",
+		OS: OSRelease{ID: "rocky", VersionID: "9.3", Name: "Rocky Linux 9.3 (Blue Onyx)"},
+		InstalledPkgs: []Package{{
+			Name: "openssl-libs", Version: "1:3.0.7-25.el9_3", Architecture: "x86_64", Size: "6281235",
+			Description: "A general purpose cryptography library with TLS implementation", Source: "openssl",
+		}},
+	},
+	"apk": {
+		Hostname: "edge-03", Manager: "apk",
+		OS: OSRelease{ID: "alpine", VersionID: "3.19.1", Name: "Alpine Linux v3.19"},
+		InstalledPkgs: []Package{{
+			Name: "busybox", Version: "1.36.1-r15", Architecture: "x86_64", Size: "946176",
+			Description: "Size optimized toolbox of many common UNIX utilities", Source: "busybox",
+		}},
+	},
+	"pacman": {
+		Hostname: "build-04", Manager: "pacman",
+		OS: OSRelease{ID: "arch", Name: "Arch Linux"},
+		InstalledPkgs: []Package{{
+			Name: "libc++", Version: "17.0.6-1", Architecture: "x86_64", Size: "3211264",
+			Description: "LLVM C++ standard library",
+		}},
+	},
+}
+
+// TestSBOMGolden writes both documents for each backend and compares them
+// with testdata/sbom.
+//
+//	go test -run TestSBOMGolden . -update
+func TestSBOMGolden(t *testing.T) {
+	for manager, info := range sbomFixtures {
+		for _, format := range []string{sbomCycloneDX, sbomSPDX} {
+			var document any = CycloneDX(info)
+			if format == sbomSPDX {
+				document = SPDX(info)
+			}
+
+			var output bytes.Buffer
+			encoder := json.NewEncoder(&output)
+			encoder.SetIndent("", "  ")
+			encoder.SetEscapeHTML(false)
+			if err := encoder.Encode(document); err != nil {
+				t.Fatal(err)
+			}
+			got := output.Bytes()
+			for _, mask := range sbomMasks {
+				got = mask.pattern.ReplaceAll(got, []byte(mask.replace))
+			}
+
+			golden := filepath.Join("testdata", "sbom", manager+"."+format+".json")
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s differs; run go test -run TestSBOMGolden . -update and review git diff\n%s", golden, got)
+			}
+		}
+	}
+}
+
+func TestSPDXIDsAreUnique(t *testing.T) {
+	info := PackageInfo{
+		Hostname: "web-01", Manager: "dpkg", OS: OSRelease{ID: "ubuntu", VersionID: "22.04"},
+		// Names that only differ in characters SPDX IDs cannot hold
+		InstalledPkgs: []Package{{Name: "libc++"}, {Name: "libc--"}, {Name: "libc__"}},
+	}
+
+	ids := make(map[string]bool)
+	for _, pkg := range SPDX(info).Packages {
+		if ids[pkg.SPDXID] {
+			t.Errorf("duplicate SPDXID %s", pkg.SPDXID)
+		}
+		ids[pkg.SPDXID] = true
+	}
+	for _, relationship := range SPDX(info).Relationships {
+		if relationship.SPDXElementID != "SPDXRef-DOCUMENT" && !ids[relationship.SPDXElementID] {
+			t.Errorf("relationship from unknown element %s", relationship.SPDXElementID)
+		}
+		if !ids[relationship.RelatedSPDXElement] {
+			t.Errorf("relationship to unknown element %s", relationship.RelatedSPDXElement)
+		}
+	}
+}
+
+func TestNewUUID(t *testing.T) {
+	version4 := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	first, second := newUUID(), newUUID()
+	if !version4.MatchString(first) {
+		t.Errorf("newUUID = %s, not a version 4 UUID", first)
+	}
+	if first == second {
+		t.Errorf("newUUID returned %s twice", first)
+	}
+}
@@ -3,25 +3,25 @@ package main
 // Ortak struct'lar
 
 type ProcessInfo struct {
-	PID     string
-	User    string
-	CPU     float64
-	Memory  float64
-	Command string
+	PID     string  `json:"pid"`
+	User    string  `json:"user"`
+	CPU     float64 `json:"cpu"`
+	Memory  float64 `json:"memory"`
+	Command string  `json:"command"`
 }
 
 type ConnectionInfo struct {
-	Protocol   string
-	LocalAddr  string
-	RemoteAddr string
-	State      string
-	PID        string
-	Program    string
-	Count      int    // Security için
-	RemoteIP   string // Security için
+	Protocol   string `json:"protocol"`
+	LocalAddr  string `json:"local_addr"`
+	RemoteAddr string `json:"remote_addr"`
+	State      string `json:"state"`
+	PID        string `json:"pid"`
+	Program    string `json:"program"`
+	Count      int    `json:"count"`     // Security için
+	RemoteIP   string `json:"remote_ip"` // Security için
 }
 
 type UserInfo struct {
-	Username string
-	Created  string
+	Username string `json:"username"`
+	Created  string `json:"created"`
 }
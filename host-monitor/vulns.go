@@ -0,0 +1,866 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	vulnSchemaVersion   = 1
+	defaultVulnDatabase = "/var/lib/host-monitor/vulns/db.json"
+
+	// SeverityUnknown is for advisories without a rating.
+	SeverityUnknown = "unknown"
+
+	vulnFormatOSV           = "osv"
+	vulnFormatDebianTracker = "debian-tracker"
+)
+
+// VulnConfig is the "vulnerabilities" section of the collector config.
+type VulnConfig struct {
+	Database string `json:"database"`
+}
+
+// Advisory is one affected version range of a package in one distribution
+// release, normalized from OSV or the Debian security tracker.
+type Advisory struct {
+	ID      string   `json:"id"`
+	Aliases []string `json:"aliases,omitempty"`
+	Format  string   `json:"format"`
+	// Distro is an os-release ID; Release a VERSION_ID prefix or codename.
+	Distro       string   `json:"distro"`
+	Release      string   `json:"release"`
+	Package      string   `json:"package"`
+	Introduced   string   `json:"introduced,omitempty"`
+	Fixed        string   `json:"fixed,omitempty"`
+	LastAffected string   `json:"last_affected,omitempty"`
+	Versions     []string `json:"versions,omitempty"`
+	Severity     string   `json:"severity"`
+	Summary      string   `json:"summary,omitempty"`
+}
+
+type VulnSource struct {
+	Path       string    `json:"path"`
+	Format     string    `json:"format"`
+	Advisories int       `json:"advisories"`
+	ImportedAt time.Time `json:"imported_at"`
+}
+
+// VulnDatabase is the local vulnerability database written by
+// "host-monitor vulns import".
+type VulnDatabase struct {
+	SchemaVersion int          `json:"schema_version"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+	Sources       []VulnSource `json:"sources"`
+	Advisories    []Advisory   `json:"advisories"`
+}
+
+// Vulnerability is an advisory that affects an installed package.
+type Vulnerability struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases,omitempty"`
+	Package  string   `json:"package"`
+	Source   string   `json:"source,omitempty"`
+	Version  string   `json:"version"`
+	Fixed    string   `json:"fixed"`
+	Severity string   `json:"severity"`
+	Summary  string   `json:"summary,omitempty"`
+}
+
+// VulnReport is the result of "host-monitor vulns check".
+type VulnReport struct {
+	Database        string          `json:"database"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+	OS              OSRelease       `json:"os"`
+	Manager         string          `json:"manager"`
+	Packages        int             `json:"packages"`
+	Counts          map[string]int  `json:"counts"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+}
+
+// vulnDatabasePath is the configured database. Without one the default is
+// used on the live host only: an offline root is not necessarily the
+// distribution the local database was imported for.
+func vulnDatabasePath(config VulnConfig, host *Host) string {
+	if config.Database != "" || !host.Live() {
+		return config.Database
+	}
+	return defaultVulnDatabase
+}
+
+func LoadVulnDatabase(path string) (*VulnDatabase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var db VulnDatabase
+	if err := json.Unmarshal(data, &db); err != nil {
+		return nil, fmt.Errorf("invalid vulnerability database %s: %v", path, err)
+	}
+	if db.SchemaVersion != vulnSchemaVersion {
+		return nil, fmt.Errorf("vulnerability database %s has schema version %d, expected %d", path, db.SchemaVersion, vulnSchemaVersion)
+	}
+	return &db, nil
+}
+
+// Save writes the database atomically.
+func (db *VulnDatabase) Save(path string) error {
+	db.SchemaVersion = vulnSchemaVersion
+	db.UpdatedAt = time.Now().UTC()
+	data, err := json.Marshal(db)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// Merge adds the advisories read by one import. They replace what the
+// database had for the same format, distribution and release, so importing
+// a newer dump drops advisories that were withdrawn since. Pass every dump
+// of an import at once: dumps merged one by one would replace each other
+// when they cover the same release.
+func (db *VulnDatabase) Merge(imported []VulnSource, advisories []Advisory) {
+	key := func(a Advisory) string { return a.Format + "|" + a.Distro + "|" + a.Release }
+	replaced := make(map[string]bool)
+	for _, advisory := range advisories {
+		replaced[key(advisory)] = true
+	}
+
+	kept := db.Advisories[:0]
+	for _, advisory := range db.Advisories {
+		if !replaced[key(advisory)] {
+			kept = append(kept, advisory)
+		}
+	}
+	db.Advisories = append(kept, advisories...)
+
+	paths := make(map[string]bool)
+	for _, source := range imported {
+		paths[source.Path] = true
+	}
+	sources := append([]VulnSource(nil), imported...)
+	for _, existing := range db.Sources {
+		if !paths[existing.Path] {
+			sources = append(sources, existing)
+		}
+	}
+	db.Sources = sources
+}
+
+// ReadVulnDump reads OSV entries (one per file, in a directory or a zip
+// such as the osv.dev ecosystem dumps) or a Debian security tracker JSON
+// dump. It returns the advisories and the format.
+func ReadVulnDump(path string) ([]Advisory, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var advisories []Advisory
+	format := ""
+	add := func(name string, data []byte) error {
+		found, dumpFormat, err := parseVulnDump(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		advisories = append(advisories, found...)
+		format = dumpFormat
+		return nil
+	}
+
+	switch {
+	case info.IsDir():
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() || !strings.HasSuffix(file, ".json") {
+				return err
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			return add(file, data)
+		})
+	case strings.HasSuffix(path, ".zip"):
+		var archive *zip.ReadCloser
+		if archive, err = zip.OpenReader(path); err != nil {
+			return nil, "", err
+		}
+		defer archive.Close()
+		for _, file := range archive.File {
+			if !strings.HasSuffix(file.Name, ".json") {
+				continue
+			}
+			var data []byte
+			if data, err = readZipFile(file); err != nil {
+				break
+			}
+			if err = add(file.Name, data); err != nil {
+				break
+			}
+		}
+	default:
+		var data []byte
+		if data, err = os.ReadFile(path); err == nil {
+			err = add(path, data)
+		}
+	}
+	return advisories, format, err
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// parseVulnDump tells the formats apart: OSV is an object with an id (or a
+// list of them), the Debian tracker an object keyed by source package.
+func parseVulnDump(data []byte) ([]Advisory, string, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var entries []osvEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, "", err
+		}
+		var advisories []Advisory
+		for _, entry := range entries {
+			advisories = append(advisories, entry.advisories()...)
+		}
+		return advisories, vulnFormatOSV, nil
+	}
+
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, "", err
+	}
+	if _, ok := probe["id"]; ok {
+		var entry osvEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, "", err
+		}
+		return entry.advisories(), vulnFormatOSV, nil
+	}
+
+	var tracker map[string]map[string]debianTrackerIssue
+	if err := json.Unmarshal(data, &tracker); err != nil {
+		return nil, "", fmt.Errorf("neither OSV nor Debian security tracker JSON: %v", err)
+	}
+	return debianTrackerAdvisories(tracker), vulnFormatDebianTracker, nil
+}
+
+// osvEntry is the part of the OSV schema (https://ossf.github.io/osv-schema/)
+// needed for distribution packages.
+type osvEntry struct {
+	ID               string         `json:"id"`
+	Aliases          []string       `json:"aliases"`
+	Upstream         []string       `json:"upstream"`
+	Summary          string         `json:"summary"`
+	Details          string         `json:"details"`
+	Withdrawn        string         `json:"withdrawn"`
+	Severity         []osvSeverity  `json:"severity"`
+	Affected         []osvAffected  `json:"affected"`
+	DatabaseSpecific map[string]any `json:"database_specific"`
+}
+
+type osvSeverity struct {
+	Type  string `json:"type"`
+	Score string `json:"score"`
+}
+
+type osvAffected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"`
+		Name      string `json:"name"`
+	} `json:"package"`
+	Severity []osvSeverity `json:"severity"`
+	Ranges   []struct {
+		Type   string              `json:"type"`
+		Events []map[string]string `json:"events"`
+	} `json:"ranges"`
+	Versions          []string       `json:"versions"`
+	EcosystemSpecific map[string]any `json:"ecosystem_specific"`
+	DatabaseSpecific  map[string]any `json:"database_specific"`
+}
+
+// osvDistros maps OSV ecosystem names to os-release IDs. Language
+// ecosystems (PyPI, npm, ...) are skipped.
+var osvDistros = map[string]string{
+	"Debian": "debian", "Ubuntu": "ubuntu", "Alpine": "alpine",
+	"Rocky Linux": "rocky", "AlmaLinux": "almalinux",
+}
+
+// osvRelease splits an ecosystem such as "Debian:12", "Ubuntu:22.04:LTS",
+// "Ubuntu:Pro:18.04:LTS" or "Alpine:v3.18" into distribution and release.
+func osvRelease(ecosystem string) (string, string, bool) {
+	parts := strings.Split(ecosystem, ":")
+	distro, ok := osvDistros[parts[0]]
+	if !ok {
+		return "", "", false
+	}
+	for _, part := range parts[1:] {
+		if part = strings.TrimPrefix(part, "v"); part != "" && isDigit(part[0]) {
+			return distro, part, true
+		}
+	}
+	return "", "", false
+}
+
+func (entry osvEntry) advisories() []Advisory {
+	if entry.Withdrawn != "" {
+		return nil
+	}
+
+	var aliases []string
+	for _, ids := range [][]string{entry.Aliases, entry.Upstream} {
+		for _, alias := range ids {
+			if alias != entry.ID && !hasString(aliases, alias) {
+				aliases = append(aliases, alias)
+			}
+		}
+	}
+	summary := entry.Summary
+	if summary == "" {
+		summary, _, _ = strings.Cut(strings.TrimSpace(entry.Details), "\n")
+	}
+
+	var advisories []Advisory
+	for _, affected := range entry.Affected {
+		distro, release, ok := osvRelease(affected.Package.Ecosystem)
+		if !ok {
+			continue
+		}
+		base := Advisory{
+			ID:       entry.ID,
+			Aliases:  aliases,
+			Format:   vulnFormatOSV,
+			Distro:   distro,
+			Release:  release,
+			Package:  affected.Package.Name,
+			Severity: entry.severity(affected),
+			Summary:  summary,
+		}
+
+		ranged := false
+		for _, r := range affected.Ranges {
+			if r.Type != "ECOSYSTEM" {
+				continue
+			}
+			// Events open and close ranges in order
+			introduced, open := "", false
+			for _, event := range r.Events {
+				switch {
+				case event["introduced"] != "":
+					introduced, open = event["introduced"], true
+				case event["fixed"] != "" && open:
+					advisory := base
+					advisory.Introduced, advisory.Fixed = introduced, event["fixed"]
+					advisories, open = append(advisories, advisory), false
+				case event["last_affected"] != "" && open:
+					advisory := base
+					advisory.Introduced, advisory.LastAffected = introduced, event["last_affected"]
+					advisories, open = append(advisories, advisory), false
+				}
+			}
+			if open {
+				advisory := base
+				advisory.Introduced = introduced
+				advisories = append(advisories, advisory)
+			}
+			ranged = true
+		}
+		if !ranged && len(affected.Versions) > 0 {
+			base.Versions = affected.Versions
+			advisories = append(advisories, base)
+		}
+	}
+	return advisories
+}
+
+// severity prefers the distribution's own rating over CVSS.
+func (entry osvEntry) severity(affected osvAffected) string {
+	for _, value := range []any{
+		affected.EcosystemSpecific["urgency"],
+		affected.EcosystemSpecific["severity"],
+		affected.DatabaseSpecific["severity"],
+		entry.DatabaseSpecific["severity"],
+	} {
+		if text, ok := value.(string); ok {
+			if severity := normalizeSeverity(text); severity != SeverityUnknown {
+				return severity
+			}
+		}
+	}
+	severities := append(append([]osvSeverity{}, affected.Severity...), entry.Severity...)
+	for _, severity := range severities {
+		if severity.Type == "Ubuntu" {
+			return normalizeSeverity(severity.Score)
+		}
+	}
+	for _, severity := range severities {
+		if severity.Type == "CVSS_V3" {
+			return cvss3Severity(severity.Score)
+		}
+	}
+	return SeverityUnknown
+}
+
+// normalizeSeverity maps distribution ratings to the finding severities.
+func normalizeSeverity(rating string) string {
+	switch strings.ToLower(strings.TrimRight(strings.TrimSpace(rating), "*")) {
+	case "critical":
+		return SeverityCritical
+	case "high", "important":
+		return SeverityHigh
+	case "medium", "moderate":
+		return SeverityMedium
+	case "low":
+		return SeverityLow
+	case "negligible", "unimportant":
+		return SeverityInfo
+	}
+	return SeverityUnknown
+}
+
+// cvss3Weights are the CVSS 3.x base metric weights; PR has other weights
+// when the scope changes.
+var cvss3Weights = map[string]map[string]float64{
+	"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+	"AC": {"L": 0.77, "H": 0.44},
+	"PR": {"N": 0.85, "L": 0.62, "H": 0.27},
+	"UI": {"N": 0.85, "R": 0.62},
+	"C":  {"H": 0.56, "L": 0.22, "N": 0},
+	"I":  {"H": 0.56, "L": 0.22, "N": 0},
+	"A":  {"H": 0.56, "L": 0.22, "N": 0},
+}
+
+// cvss3Severity computes the base score of a CVSS:3.x vector and returns
+// its rating.
+func cvss3Severity(vector string) string {
+	metrics := make(map[string]string)
+	for _, part := range strings.Split(vector, "/") {
+		if key, value, ok := strings.Cut(part, ":"); ok {
+			metrics[key] = value
+		}
+	}
+	weight := func(metric string) (float64, bool) {
+		value, ok := cvss3Weights[metric][metrics[metric]]
+		return value, ok
+	}
+
+	values := make(map[string]float64)
+	for metric := range cvss3Weights {
+		value, ok := weight(metric)
+		if !ok {
+			return SeverityUnknown
+		}
+		values[metric] = value
+	}
+	changed := metrics["S"] == "C"
+	if changed && metrics["PR"] == "L" {
+		values["PR"] = 0.68
+	} else if changed && metrics["PR"] == "H" {
+		values["PR"] = 0.5
+	}
+
+	iss := 1 - (1-values["C"])*(1-values["I"])*(1-values["A"])
+	impact := 6.42 * iss
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	exploitability := 8.22 * values["AV"] * values["AC"] * values["PR"] * values["UI"]
+
+	score := 0.0
+	if impact > 0 {
+		score = impact + exploitability
+		if changed {
+			score *= 1.08
+		}
+		score = math.Ceil(math.Min(score, 10)*10) / 10
+	}
+
+	switch {
+	case score >= 9:
+		return SeverityCritical
+	case score >= 7:
+		return SeverityHigh
+	case score >= 4:
+		return SeverityMedium
+	case score > 0:
+		return SeverityLow
+	}
+	return SeverityInfo
+}
+
+// debianTrackerIssue is one entry of
+// https://security-tracker.debian.org/tracker/data/json, which maps source
+// package to issue to release.
+type debianTrackerIssue struct {
+	Description string `json:"description"`
+	Releases    map[string]struct {
+		Status       string `json:"status"`
+		FixedVersion string `json:"fixed_version"`
+		Urgency      string `json:"urgency"`
+	} `json:"releases"`
+}
+
+func debianTrackerAdvisories(tracker map[string]map[string]debianTrackerIssue) []Advisory {
+	var advisories []Advisory
+	for pkg, issues := range tracker {
+		for id, issue := range issues {
+			for codename, release := range issue.Releases {
+				advisory := Advisory{
+					ID:       id,
+					Format:   vulnFormatDebianTracker,
+					Distro:   "debian",
+					Release:  codename,
+					Package:  pkg,
+					Severity: normalizeSeverity(release.Urgency),
+					Summary:  issue.Description,
+				}
+				if release.Status == "resolved" {
+					// Fixed in version 0 means the release never had the bug
+					if release.FixedVersion == "" || release.FixedVersion == "0" {
+						continue
+					}
+					advisory.Fixed = release.FixedVersion
+				}
+				advisories = append(advisories, advisory)
+			}
+		}
+	}
+	sort.Slice(advisories, func(i, j int) bool {
+		if advisories[i].Package != advisories[j].Package {
+			return advisories[i].Package < advisories[j].Package
+		}
+		if advisories[i].ID != advisories[j].ID {
+			return advisories[i].ID < advisories[j].ID
+		}
+		return advisories[i].Release < advisories[j].Release
+	})
+	return advisories
+}
+
+// appliesTo reports whether the advisory is for the host's distribution
+// and release: "12" matches VERSION_ID 12 and "3.18" matches 3.18.4.
+func (a Advisory) appliesTo(release OSRelease) bool {
+	if a.Distro != release.ID || a.Release == "" {
+		return false
+	}
+	return a.Release == release.Codename || a.Release == release.VersionID ||
+		strings.HasPrefix(release.VersionID, a.Release+".")
+}
+
+// affects reports whether the installed version is in the advisory's range.
+func (a Advisory) affects(version string, compare func(a, b string) int) bool {
+	if len(a.Versions) > 0 {
+		return hasString(a.Versions, version)
+	}
+	if a.Introduced != "" && a.Introduced != "0" && compare(version, a.Introduced) < 0 {
+		return false
+	}
+	if a.Fixed != "" {
+		return compare(version, a.Fixed) < 0
+	}
+	if a.LastAffected != "" {
+		return compare(version, a.LastAffected) <= 0
+	}
+	return true
+}
+
+// MatchVulnerabilities checks installed packages against the advisories for
+// the host's release, by binary and by source package. An advisory known
+// under several IDs (a CVE and a distribution ID aliasing it) is reported
+// once per package. Without source packages, as from dpkg -l, advisories
+// filed under a differently named source package are missed.
+func MatchVulnerabilities(advisories []Advisory, release OSRelease, packages []Package, compare func(a, b string) int) []Vulnerability {
+	byPackage := make(map[string][]Advisory)
+	for _, advisory := range advisories {
+		if advisory.appliesTo(release) {
+			byPackage[advisory.Package] = append(byPackage[advisory.Package], advisory)
+		}
+	}
+
+	vulnerabilities := []Vulnerability{}
+	for _, pkg := range packages {
+		candidates := byPackage[pkg.Name]
+		if pkg.Source != "" && pkg.Source != pkg.Name {
+			candidates = append(append([]Advisory{}, candidates...), byPackage[pkg.Source]...)
+		}
+
+		seen := make(map[string]bool)
+		for _, advisory := range candidates {
+			if seen[advisory.ID] || !advisory.affects(pkg.Version, compare) {
+				continue
+			}
+			// e.g. DEBIAN-CVE-2024-1 after CVE-2024-1; a USN listing a new
+			// CVE besides reported ones is kept
+			duplicate := len(advisory.Aliases) > 0
+			for _, alias := range advisory.Aliases {
+				duplicate = duplicate && seen[alias]
+			}
+			seen[advisory.ID] = true
+			for _, alias := range advisory.Aliases {
+				seen[alias] = true
+			}
+			if duplicate {
+				continue
+			}
+			vulnerabilities = append(vulnerabilities, Vulnerability{
+				ID:       advisory.ID,
+				Aliases:  advisory.Aliases,
+				Package:  pkg.Name,
+				Source:   pkg.Source,
+				Version:  pkg.Version,
+				Fixed:    advisory.Fixed,
+				Severity: advisory.Severity,
+				Summary:  advisory.Summary,
+			})
+		}
+	}
+
+	// Most severe first
+	sort.SliceStable(vulnerabilities, func(i, j int) bool {
+		a, b := vulnRank(vulnerabilities[i].Severity), vulnRank(vulnerabilities[j].Severity)
+		if a != b {
+			return a > b
+		}
+		if vulnerabilities[i].Package != vulnerabilities[j].Package {
+			return vulnerabilities[i].Package < vulnerabilities[j].Package
+		}
+		return vulnerabilities[i].ID < vulnerabilities[j].ID
+	})
+	return vulnerabilities
+}
+
+// vulnRank ranks unknown below info.
+func vulnRank(severity string) int {
+	if rank, ok := severityRank[severity]; ok {
+		return rank
+	}
+	return -1
+}
+
+func countVulnerabilities(vulnerabilities []Vulnerability) map[string]int {
+	counts := map[string]int{SeverityUnknown: 0}
+	for severity := range severityRank {
+		counts[severity] = 0
+	}
+	for _, vulnerability := range vulnerabilities {
+		counts[vulnerability.Severity]++
+	}
+	return counts
+}
+
+func formatVulnerability(vulnerability Vulnerability) string {
+	text := fmt.Sprintf("%s [%s] %s %s %s", severityIcon(vulnerability.Severity), strings.ToUpper(vulnerability.Severity),
+		vulnerability.ID, vulnerability.Package, vulnerability.Version)
+	if vulnerability.Fixed != "" {
+		text += " → fixed in " + vulnerability.Fixed
+	} else {
+		text += ", no fix yet"
+	}
+	for _, alias := range vulnerability.Aliases {
+		if strings.HasPrefix(alias, "CVE-") {
+			text += " (" + alias + ")"
+			break
+		}
+	}
+	if summary := vulnerability.Summary; summary != "" {
+		if len(summary) > 80 {
+			summary = summary[:77] + "..."
+		}
+		text += ": " + summary
+	}
+	return text
+}
+
+func printVulnerabilities(vulnerabilities []Vulnerability) {
+	counts := countVulnerabilities(vulnerabilities)
+	fmt.Printf("Vulnerabilities: %d (critical %d, high %d, medium %d, low %d, info %d, unknown %d)\n",
+		len(vulnerabilities), counts[SeverityCritical], counts[SeverityHigh], counts[SeverityMedium],
+		counts[SeverityLow], counts[SeverityInfo], counts[SeverityUnknown])
+	for _, vulnerability := range vulnerabilities {
+		fmt.Println("  " + formatVulnerability(vulnerability))
+	}
+}
+
+// vulnsCommand implements "host-monitor vulns import|check". check exits 1
+// when an installed package is vulnerable at or above --severity.
+func vulnsCommand(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	fs := flag.NewFlagSet("vulns "+args[0], flag.ContinueOnError)
+	fs.Usage = usage
+	dbPath := fs.String("db", "", "Vulnerability database (default "+defaultVulnDatabase+")")
+	all := fs.Bool("all", false, "import: keep advisories for every distribution, not just this host's release")
+	minSeverity := fs.String("severity", SeverityInfo, "check: lowest severity to report ("+severityList+")")
+	format := fs.String("format", formatText, "Report format: text, json or yaml")
+	configPath := fs.String("config", "", "Collector config file (JSON) with a \"vulnerabilities\" section")
+	applyHost := hostFlags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	host := applyHost()
+
+	if !validFormat(*format) {
+		fmt.Fprintf(os.Stderr, "❌ Unknown format %q (use text, json or yaml)\n", *format)
+		return 2
+	}
+	if !validSeverity(*minSeverity) {
+		fmt.Fprintf(os.Stderr, "❌ Unknown severity %q (use %s)\n", *minSeverity, severityList)
+		return 2
+	}
+
+	var config VulnConfig
+	if *configPath != "" {
+		collectorConfig, err := LoadCollectorConfig(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+		config = collectorConfig.Vulnerabilities
+	}
+	path := firstNonEmpty(*dbPath, config.Database, defaultVulnDatabase)
+	release := host.OSRelease()
+
+	switch args[0] {
+	case "import":
+		if fs.NArg() == 0 {
+			fmt.Fprintln(os.Stderr, "❌ Give the OSV or Debian security tracker files, directories or zips to import")
+			return 2
+		}
+		if !*all && release.ID == "" {
+			fmt.Fprintln(os.Stderr, "❌ No /etc/os-release to select advisories by, use --all")
+			return 2
+		}
+
+		db, err := LoadVulnDatabase(path)
+		if errors.Is(err, os.ErrNotExist) {
+			db, err = &VulnDatabase{}, nil
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+
+		var sources []VulnSource
+		var imported []Advisory
+		for _, dump := range fs.Args() {
+			advisories, format, err := ReadVulnDump(dump)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+				return 2
+			}
+			if !*all {
+				kept := advisories[:0]
+				for _, advisory := range advisories {
+					if advisory.appliesTo(release) {
+						kept = append(kept, advisory)
+					}
+				}
+				advisories = kept
+			}
+			dump = filepath.Clean(dump)
+			sources = append(sources, VulnSource{Path: dump, Format: format, Advisories: len(advisories), ImportedAt: time.Now().UTC()})
+			imported = append(imported, advisories...)
+			fmt.Printf("➕ %d advisories from %s", len(advisories), dump)
+			if len(advisories) > 0 {
+				fmt.Printf(" (%s: %s)", format, vulnReleases(advisories))
+			}
+			fmt.Println()
+		}
+		db.Merge(sources, imported)
+
+		if err := db.Save(path); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+		fmt.Printf("💾 %d advisories in %s\n", len(db.Advisories), path)
+		return 0
+
+	case "check":
+		db, err := LoadVulnDatabase(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v (run \"host-monitor vulns import\" first)\n", err)
+			return 2
+		}
+		backend := detectPackageBackend(host, release)
+		if backend == nil {
+			fmt.Fprintln(os.Stderr, "❌ No supported package manager (dpkg, rpm, apk, pacman)")
+			return 2
+		}
+
+		installed := backend.Installed(host)
+		report := VulnReport{
+			Database:        path,
+			UpdatedAt:       db.UpdatedAt,
+			OS:              release,
+			Manager:         backend.Name(),
+			Packages:        len(installed),
+			Vulnerabilities: []Vulnerability{},
+		}
+		for _, vulnerability := range MatchVulnerabilities(db.Advisories, release, installed, backend.CompareVersions) {
+			// Unrated advisories are always reported
+			if vulnRank(vulnerability.Severity) >= severityRank[*minSeverity] || vulnerability.Severity == SeverityUnknown {
+				report.Vulnerabilities = append(report.Vulnerabilities, vulnerability)
+			}
+		}
+		report.Counts = countVulnerabilities(report.Vulnerabilities)
+
+		if *format == formatText {
+			fmt.Printf("📦 %s (%s), %d packages, database %s updated %s\n", firstNonEmpty(release.Name, release.ID), report.Manager,
+				report.Packages, path, report.UpdatedAt.Local().Format("2006-01-02 15:04:05"))
+			if len(report.Vulnerabilities) == 0 {
+				fmt.Println("✅ No known vulnerabilities")
+			} else {
+				printVulnerabilities(report.Vulnerabilities)
+			}
+		} else if err := WriteReport(os.Stdout, *format, NewReport("vulns", host.Hostname(), report)); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Failed to write vulnerability report: %v\n", err)
+			return 2
+		}
+
+		if len(report.Vulnerabilities) > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	usage()
+	return 2
+}
+
+// vulnReleases counts advisories per distribution release.
+func vulnReleases(advisories []Advisory) string {
+	counts := make(map[string]int)
+	for _, advisory := range advisories {
+		counts[advisory.Distro+" "+advisory.Release]++
+	}
+	var parts []string
+	for release, count := range counts {
+		parts = append(parts, release+": "+strconv.Itoa(count))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Two dumps covering Alpine 3.18 in one import must not replace each other,
+// while importing one of them again still replaces its release.
+func TestVulnsImportKeepsEveryDump(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "db.json")
+	ids := func() map[string]int {
+		loaded, err := LoadVulnDatabase(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make(map[string]int)
+		for _, advisory := range loaded.Advisories {
+			ids[advisory.ID+" "+advisory.Release]++
+		}
+		return ids
+	}
+	vulns := func(files ...string) {
+		args := append([]string{"import", "--db", db, "--all"}, files...)
+		if _, code := captureStdout(t, func() int { return vulnsCommand(args) }); code != 0 {
+			t.Fatalf("vulns %v exited %d", args, code)
+		}
+	}
+
+	vulns("testdata/vulns/osv/alpine/ALPINE-CVE-2023-42363.json", "testdata/vulns/osv/alpine/ALPINE-CVE-2023-5678.json")
+	got := ids()
+	for _, id := range []string{"ALPINE-CVE-2023-42363 3.18", "ALPINE-CVE-2023-42363 3.19", "ALPINE-CVE-2023-5678 3.18"} {
+		if got[id] == 0 {
+			t.Errorf("%s missing after importing both dumps: %v", id, got)
+		}
+	}
+
+	vulns("testdata/vulns/osv/alpine/ALPINE-CVE-2023-5678.json")
+	if got := ids(); got["ALPINE-CVE-2023-42363 3.18"] != 0 || got["ALPINE-CVE-2023-42363 3.19"] != 1 || got["ALPINE-CVE-2023-5678 3.18"] != 1 {
+		t.Errorf("re-importing one dump left %v", got)
+	}
+}
+
+// A database that exists but cannot be read is reported, not skipped as if
+// there were none, and run exits 1.
+func TestPackagesReportVulnDatabaseError(t *testing.T) {
+	dir := t.TempDir()
+	db := filepath.Join(dir, "db.json")
+	config := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(db, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config, []byte(`{"vulnerabilities": {"database": "`+db+`"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output, code := captureStdout(t, func() int {
+		return runCommand([]string{
+			"--root", filepath.Join("testdata", "debian", "root"), "--commands", filepath.Join("testdata", "debian", "commands"),
+			"--config", config, "--format", "json", "--modules", "packages",
+		})
+	})
+	if code != 1 {
+		t.Errorf("run exited with %d, want 1", code)
+	}
+	var report struct {
+		Data PackageInfo `json:"data"`
+	}
+	if err := json.Unmarshal(output, &report); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(report.Data.VulnerabilityError, "invalid vulnerability database") {
+		t.Errorf("vulnerability_error = %q", report.Data.VulnerabilityError)
+	}
+}
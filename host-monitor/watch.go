@@ -0,0 +1,498 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var defaultWatchWindows = []time.Duration{time.Minute, 5 * time.Minute, time.Hour}
+
+// Point is one value in a sample. Label tells series of the same metric
+// apart, e.g. the interface of rx_bytes_per_second.
+type Point struct {
+	Metric string  `json:"metric"`
+	Label  string  `json:"label,omitempty"`
+	Value  float64 `json:"value"`
+}
+
+// Sample is everything measured at one tick of the watch loop.
+type Sample struct {
+	Time   time.Time `json:"time"`
+	Points []Point   `json:"points"`
+}
+
+// RingBuffer keeps the most recent samples; once full, each Add overwrites
+// the oldest sample.
+type RingBuffer struct {
+	mu      sync.RWMutex
+	samples []Sample
+	start   int
+	count   int
+}
+
+func NewRingBuffer(capacity int) *RingBuffer {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &RingBuffer{samples: make([]Sample, capacity)}
+}
+
+func (rb *RingBuffer) Add(sample Sample) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	if rb.count < len(rb.samples) {
+		rb.samples[(rb.start+rb.count)%len(rb.samples)] = sample
+		rb.count++
+		return
+	}
+	rb.samples[rb.start] = sample
+	rb.start = (rb.start + 1) % len(rb.samples)
+}
+
+func (rb *RingBuffer) Len() int {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+	return rb.count
+}
+
+func (rb *RingBuffer) Cap() int {
+	return len(rb.samples)
+}
+
+// Since returns the samples taken after t, oldest first.
+func (rb *RingBuffer) Since(t time.Time) []Sample {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+
+	var samples []Sample
+	for i := 0; i < rb.count; i++ {
+		sample := rb.samples[(rb.start+i)%len(rb.samples)]
+		if sample.Time.After(t) {
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+// WindowStats summarises one series over a window.
+type WindowStats struct {
+	Window time.Duration `json:"window_ns"`
+	Metric string        `json:"metric"`
+	Label  string        `json:"label,omitempty"`
+	Count  int           `json:"count"`
+	Min    float64       `json:"min"`
+	Avg    float64       `json:"avg"`
+	Max    float64       `json:"max"`
+	P95    float64       `json:"p95"`
+}
+
+// WatchSummary is the report written by host-monitor watch.
+type WatchSummary struct {
+	Interval time.Duration `json:"interval_ns"`
+	Samples  int           `json:"samples"`
+	Oldest   time.Time     `json:"oldest"`
+	Newest   time.Time     `json:"newest"`
+	Windows  []WindowStats `json:"windows"`
+}
+
+// Summarize computes min/avg/max/p95 of every series for each window
+// ending at now.
+func Summarize(buffer *RingBuffer, now time.Time, windows []time.Duration) []WindowStats {
+	var stats []WindowStats
+
+	for _, window := range windows {
+		type series struct {
+			metric, label string
+			values        []float64
+		}
+		var order []*series
+		index := make(map[string]*series)
+
+		// Newest first, so series follow the order of the latest sample
+		samples := buffer.Since(now.Add(-window))
+		for i := len(samples) - 1; i >= 0; i-- {
+			for _, point := range samples[i].Points {
+				key := point.Metric + "\x00" + point.Label
+				s, ok := index[key]
+				if !ok {
+					s = &series{metric: point.Metric, label: point.Label}
+					index[key] = s
+					order = append(order, s)
+				}
+				s.values = append(s.values, point.Value)
+			}
+		}
+
+		for _, s := range order {
+			stat := WindowStats{Window: window, Metric: s.metric, Label: s.label, Count: len(s.values)}
+			sort.Float64s(s.values)
+
+			sum := 0.0
+			for _, value := range s.values {
+				sum += value
+			}
+			stat.Min = s.values[0]
+			stat.Max = s.values[len(s.values)-1]
+			stat.Avg = sum / float64(len(s.values))
+			stat.P95 = percentile(s.values, 95)
+			stats = append(stats, stat)
+		}
+	}
+
+	return stats
+}
+
+// percentile uses the nearest-rank method on sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// Watcher samples performance and network metrics into a ring buffer.
+// CPU and bandwidth rates are deltas between consecutive ticks, so the first
+// tick only records a baseline for them.
+type Watcher struct {
+	perf   *PerformanceMonitor
+	net    *NetworkAnalyzer
+	buffer *RingBuffer
+
+	persistPath  string
+	persistLines int
+
+	prevCPU      map[string]cpuTimes
+	prevCounters map[string]interfaceCounters
+}
+
+func NewWatcher(perf *PerformanceMonitor, net *NetworkAnalyzer, buffer *RingBuffer) *Watcher {
+	return &Watcher{perf: perf, net: net, buffer: buffer}
+}
+
+// Sample takes one sample and adds it to the buffer.
+func (w *Watcher) Sample(now time.Time) Sample {
+	sample := Sample{Time: now}
+	add := func(metric, label string, value float64) {
+		sample.Points = append(sample.Points, Point{Metric: metric, Label: label, Value: value})
+	}
+
+	cpu, _ := w.perf.readCPUTimes()
+	if before, ok := w.prevCPU["cpu"]; ok {
+		if after, ok := cpu["cpu"]; ok {
+			usage := cpuPercentages("cpu", before, after)
+			add("cpu_usage_percent", "", usage.Usage)
+			add("cpu_iowait_percent", "", usage.IOWait)
+			add("cpu_steal_percent", "", usage.Steal)
+		}
+	}
+	w.prevCPU = cpu
+
+	load := w.perf.getLoadAverage()
+	add("load1", "", load.OneMin)
+	add("load5", "", load.FiveMin)
+	add("load15", "", load.FifteenMin)
+
+	memory := w.perf.getMemoryUsage()
+	if memory.Total > 0 {
+		add("memory_used_percent", "", float64(memory.Used)/float64(memory.Total)*100)
+	}
+	if memory.SwapTotal > 0 {
+		add("swap_used_percent", "", float64(memory.SwapUsed)/float64(memory.SwapTotal)*100)
+	}
+
+	for _, disk := range w.perf.getDiskUsage() {
+		add("disk_use_percent", disk.MountPoint, disk.UsePercent)
+	}
+
+	counters := w.net.readCounters()
+	if w.prevCounters != nil {
+		for _, bw := range bandwidthRates(w.prevCounters, counters) {
+			add("rx_bytes_per_second", bw.Interface, bw.RXRate)
+			add("tx_bytes_per_second", bw.Interface, bw.TXRate)
+			add("rx_errors_per_second", bw.Interface, bw.RXErrorRate)
+			add("tx_errors_per_second", bw.Interface, bw.TXErrorRate)
+		}
+	}
+	w.prevCounters = counters
+
+	w.buffer.Add(sample)
+	w.appendPersisted(sample)
+	return sample
+}
+
+// Persist appends every sample to a JSON lines file. Samples already in the
+// file that are newer than since are loaded into the buffer first, so a
+// restarted watch keeps its history.
+func (w *Watcher) Persist(path string, since time.Time) error {
+	w.persistPath = path
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		w.persistLines++
+		var sample Sample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			continue
+		}
+		if sample.Time.After(since) {
+			w.buffer.Add(sample)
+		}
+	}
+	return scanner.Err()
+}
+
+func (w *Watcher) appendPersisted(sample Sample) {
+	if w.persistPath == "" {
+		return
+	}
+
+	// Rewrite the file from the buffer once it holds twice as many samples,
+	// so it does not grow forever
+	if w.persistLines >= 2*w.buffer.Cap() {
+		if err := w.compactPersisted(); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠️  Failed to compact %s: %v\n", w.persistPath, err)
+		}
+		return
+	}
+
+	file, err := os.OpenFile(w.persistPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  Failed to persist sample: %v\n", err)
+		return
+	}
+	defer file.Close()
+
+	data, _ := json.Marshal(sample)
+	if _, err := file.Write(append(data, '\n')); err == nil {
+		w.persistLines++
+	}
+}
+
+func (w *Watcher) compactPersisted() error {
+	tmp, err := os.CreateTemp(filepath.Dir(w.persistPath), ".watch-*.jsonl")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	samples := w.buffer.Since(time.Time{})
+	writer := bufio.NewWriter(tmp)
+	for _, sample := range samples {
+		data, _ := json.Marshal(sample)
+		writer.Write(append(data, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), w.persistPath); err != nil {
+		return err
+	}
+	w.persistLines = len(samples)
+	return nil
+}
+
+// Summary reports the buffered samples over windows ending at now.
+func (w *Watcher) Summary(now time.Time, interval time.Duration, windows []time.Duration) WatchSummary {
+	summary := WatchSummary{
+		Interval: interval,
+		Samples:  w.buffer.Len(),
+		Windows:  Summarize(w.buffer, now, windows),
+	}
+	if samples := w.buffer.Since(time.Time{}); len(samples) > 0 {
+		summary.Oldest = samples[0].Time
+		summary.Newest = samples[len(samples)-1].Time
+	}
+	return summary
+}
+
+// parseWindows parses a comma separated list of durations, e.g. "1m,5m,1h".
+func parseWindows(list string) ([]time.Duration, error) {
+	var windows []time.Duration
+	for _, item := range strings.Split(list, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		window, err := time.ParseDuration(strings.TrimSpace(item))
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("invalid window %q", strings.TrimSpace(item))
+		}
+		windows = append(windows, window)
+	}
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("no windows given")
+	}
+	return windows, nil
+}
+
+func formatWindows(windows []time.Duration) string {
+	var parts []string
+	for _, window := range windows {
+		parts = append(parts, shortDuration(window))
+	}
+	return strings.Join(parts, ",")
+}
+
+// shortDuration prints 1m instead of 1m0s.
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+func printWatchSummary(summary WatchSummary) {
+	fmt.Println("=== WATCH SUMMARY ===")
+	fmt.Printf("Samples: %d every %v", summary.Samples, summary.Interval)
+	if !summary.Oldest.IsZero() {
+		fmt.Printf(" (%s - %s)", summary.Oldest.Format("15:04:05"), summary.Newest.Format("15:04:05"))
+	}
+	fmt.Println()
+
+	var window time.Duration
+	for _, stat := range summary.Windows {
+		if stat.Window != window {
+			window = stat.Window
+			fmt.Printf("\n📈 Last %s\n", shortDuration(window))
+			fmt.Printf("  %-22s %-14s %6s %12s %12s %12s %12s\n", "METRIC", "LABEL", "COUNT", "MIN", "AVG", "MAX", "P95")
+		}
+		fmt.Printf("  %-22s %-14s %6d %12s %12s %12s %12s\n", stat.Metric, stat.Label, stat.Count,
+			formatWatchValue(stat.Metric, stat.Min), formatWatchValue(stat.Metric, stat.Avg),
+			formatWatchValue(stat.Metric, stat.Max), formatWatchValue(stat.Metric, stat.P95))
+	}
+	if len(summary.Windows) == 0 {
+		fmt.Println("No samples yet")
+	}
+}
+
+func formatWatchValue(metric string, value float64) string {
+	if strings.HasSuffix(metric, "_bytes_per_second") {
+		return formatRate(value)
+	}
+	return fmt.Sprintf("%.2f", value)
+}
+
+// watchCommand implements "host-monitor watch" and returns the exit code.
+func watchCommand(args []string) int {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.Usage = usage
+	interval := fs.Duration("interval", 5*time.Second, "Time between samples")
+	windowList := fs.String("windows", formatWindows(defaultWatchWindows), "Comma separated summary windows")
+	reportEvery := fs.Duration("report", time.Minute, "Time between summaries")
+	duration := fs.Duration("duration", 0, "Stop after this long, 0 runs until interrupted")
+	capacity := fs.Int("capacity", 0, "Samples kept in memory, 0 fits the largest window")
+	persistPath := fs.String("persist", "", "JSON lines file to keep samples across restarts")
+	format := fs.String("format", formatText, "Report format: text, json or yaml")
+	applyHost := hostFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	host := applyHost()
+
+	if !validFormat(*format) {
+		fmt.Fprintf(os.Stderr, "❌ Unknown format %q (use text, json or yaml)\n", *format)
+		return 2
+	}
+	windows, err := parseWindows(*windowList)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	if *interval <= 0 || *reportEvery <= 0 || *duration < 0 || *capacity < 0 {
+		fmt.Fprintln(os.Stderr, "❌ --interval and --report must be > 0, --duration and --capacity >= 0")
+		return 2
+	}
+
+	longest := windows[0]
+	for _, window := range windows {
+		if window > longest {
+			longest = window
+		}
+	}
+	if *capacity == 0 {
+		*capacity = int(longest / *interval) + 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	settings := DefaultSettings(host.WithContext(ctx))
+	watcher := NewWatcher(settings.performanceMonitor(), settings.networkAnalyzer(), NewRingBuffer(*capacity))
+	if *persistPath != "" {
+		if err := watcher.Persist(*persistPath, time.Now().Add(-longest)); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 2
+		}
+	}
+
+	report := func() {
+		summary := watcher.Summary(time.Now(), *interval, windows)
+		if *format == formatText {
+			fmt.Println()
+			printWatchSummary(summary)
+			return
+		}
+		if err := WriteReport(os.Stdout, *format, NewReport("watch", host.Hostname(), summary)); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Failed to write watch report: %v\n", err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "📡 Sampling every %v, summary every %v over %s (Ctrl+C to stop)\n",
+		*interval, *reportEvery, formatWindows(windows))
+
+	sampleTicker := time.NewTicker(*interval)
+	defer sampleTicker.Stop()
+	reportTicker := time.NewTicker(*reportEvery)
+	defer reportTicker.Stop()
+
+	watcher.Sample(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			report()
+			return 0
+		case now := <-sampleTicker.C:
+			watcher.Sample(now)
+		case <-reportTicker.C:
+			report()
+		}
+	}
+}
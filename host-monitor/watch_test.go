@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var watchStart = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// watchSample is a sample taken n ticks of 5s after watchStart.
+func watchSample(n int, points ...Point) Sample {
+	return Sample{Time: watchStart.Add(time.Duration(n) * 5 * time.Second), Points: points}
+}
+
+func sampleTimes(samples []Sample) []time.Time {
+	var times []time.Time
+	for _, sample := range samples {
+		times = append(times, sample.Time)
+	}
+	return times
+}
+
+func TestRingBufferOverwrite(t *testing.T) {
+	buffer := NewRingBuffer(3)
+	if got := buffer.Since(time.Time{}); got != nil {
+		t.Errorf("empty buffer Since = %v, want nil", got)
+	}
+
+	for n := 1; n <= 2; n++ {
+		buffer.Add(watchSample(n))
+	}
+	if buffer.Len() != 2 || buffer.Cap() != 3 {
+		t.Errorf("Len, Cap = %d, %d; want 2, 3", buffer.Len(), buffer.Cap())
+	}
+
+	for n := 3; n <= 7; n++ {
+		buffer.Add(watchSample(n))
+	}
+	if buffer.Len() != 3 {
+		t.Errorf("Len after overwrite = %d, want 3", buffer.Len())
+	}
+	want := sampleTimes([]Sample{watchSample(5), watchSample(6), watchSample(7)})
+	if got := sampleTimes(buffer.Since(time.Time{})); !reflect.DeepEqual(got, want) {
+		t.Errorf("Since after overwrite = %v, want %v", got, want)
+	}
+
+	if capped := NewRingBuffer(0); capped.Cap() != 1 {
+		t.Errorf("NewRingBuffer(0).Cap() = %d, want 1", capped.Cap())
+	}
+}
+
+func TestRingBufferSince(t *testing.T) {
+	buffer := NewRingBuffer(4)
+	for n := 1; n <= 6; n++ {
+		buffer.Add(watchSample(n))
+	}
+
+	tests := []struct {
+		name  string
+		since time.Time
+		want  []Sample
+	}{
+		{name: "everything", since: time.Time{}, want: []Sample{watchSample(3), watchSample(4), watchSample(5), watchSample(6)}},
+		{name: "exact boundary is excluded", since: watchSample(4).Time, want: []Sample{watchSample(5), watchSample(6)}},
+		{name: "just before a sample", since: watchSample(4).Time.Add(-time.Nanosecond), want: []Sample{watchSample(4), watchSample(5), watchSample(6)}},
+		{name: "newest sample", since: watchSample(6).Time},
+		{name: "in the future", since: watchSample(10).Time},
+	}
+
+	for _, tt := range tests {
+		if got, want := sampleTimes(buffer.Since(tt.since)), sampleTimes(tt.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: Since = %v, want %v", tt.name, got, want)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	values := func(n int) []float64 {
+		var sorted []float64
+		for i := 1; i <= n; i++ {
+			sorted = append(sorted, float64(i))
+		}
+		return sorted
+	}
+
+	tests := []struct {
+		name   string
+		sorted []float64
+		p      float64
+		want   float64
+	}{
+		{name: "empty", sorted: nil, p: 95, want: 0},
+		{name: "1 sample", sorted: values(1), p: 95, want: 1},
+		{name: "20 samples", sorted: values(20), p: 95, want: 19},
+		{name: "21 samples", sorted: values(21), p: 95, want: 20},
+		{name: "100 samples", sorted: values(100), p: 95, want: 95},
+		{name: "p0 is the minimum", sorted: values(20), p: 0, want: 1},
+		{name: "p100 is the maximum", sorted: values(20), p: 100, want: 20},
+	}
+
+	for _, tt := range tests {
+		if got := percentile(tt.sorted, tt.p); got != tt.want {
+			t.Errorf("%s: percentile(p%v) = %v, want %v", tt.name, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	buffer := NewRingBuffer(10)
+	buffer.Add(watchSample(1, Point{Metric: "load1", Value: 9}))
+	buffer.Add(watchSample(2,
+		Point{Metric: "load1", Value: 1},
+		Point{Metric: "rx_bytes_per_second", Label: "eth0", Value: 100}))
+	buffer.Add(watchSample(3,
+		Point{Metric: "rx_bytes_per_second", Label: "eth0", Value: 300},
+		Point{Metric: "rx_bytes_per_second", Label: "eth1", Value: 50},
+		Point{Metric: "load1", Value: 3}))
+	now := watchSample(3).Time
+
+	got := Summarize(buffer, now, []time.Duration{10 * time.Second, time.Minute})
+	want := []WindowStats{
+		// The 10s window starts exactly at sample 1, which is left out
+		{Window: 10 * time.Second, Metric: "rx_bytes_per_second", Label: "eth0", Count: 2, Min: 100, Avg: 200, Max: 300, P95: 300},
+		{Window: 10 * time.Second, Metric: "rx_bytes_per_second", Label: "eth1", Count: 1, Min: 50, Avg: 50, Max: 50, P95: 50},
+		{Window: 10 * time.Second, Metric: "load1", Count: 2, Min: 1, Avg: 2, Max: 3, P95: 3},
+		{Window: time.Minute, Metric: "rx_bytes_per_second", Label: "eth0", Count: 2, Min: 100, Avg: 200, Max: 300, P95: 300},
+		{Window: time.Minute, Metric: "rx_bytes_per_second", Label: "eth1", Count: 1, Min: 50, Avg: 50, Max: 50, P95: 50},
+		{Window: time.Minute, Metric: "load1", Count: 3, Min: 1, Avg: 13.0 / 3, Max: 9, P95: 9},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Summarize =\n%+v\nwant\n%+v", got, want)
+	}
+
+	if got := Summarize(buffer, now.Add(time.Hour), []time.Duration{time.Minute}); got != nil {
+		t.Errorf("Summarize of an empty window = %+v, want nil", got)
+	}
+	if got := Summarize(NewRingBuffer(3), now, defaultWatchWindows); got != nil {
+		t.Errorf("Summarize of an empty buffer = %+v, want nil", got)
+	}
+}
+
+func TestWatcherPersistAndCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watch.jsonl")
+
+	watcher := NewWatcher(nil, nil, NewRingBuffer(2))
+	if err := watcher.Persist(path, time.Time{}); err != nil {
+		t.Fatalf("Persist of a missing file: %v", err)
+	}
+
+	// Four samples fill the file to twice the capacity, the fifth rewrites
+	// it from the buffer
+	for n := 1; n <= 4; n++ {
+		sample := watchSample(n, Point{Metric: "load1", Value: float64(n)})
+		watcher.buffer.Add(sample)
+		watcher.appendPersisted(sample)
+	}
+	if lines := countLines(t, path); lines != 4 {
+		t.Fatalf("file has %d lines before compaction, want 4", lines)
+	}
+	sample := watchSample(5, Point{Metric: "load1", Value: 5})
+	watcher.buffer.Add(sample)
+	watcher.appendPersisted(sample)
+	if lines := countLines(t, path); lines != 2 || watcher.persistLines != 2 {
+		t.Fatalf("after compaction file has %d lines, persistLines = %d; want 2, 2", lines, watcher.persistLines)
+	}
+
+	// A line that does not parse is counted but skipped
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("not json\n")
+	file.Close()
+
+	restarted := NewWatcher(nil, nil, NewRingBuffer(10))
+	if err := restarted.Persist(path, watchSample(4).Time.Add(-time.Nanosecond)); err != nil {
+		t.Fatalf("Persist: %v", err)
+	}
+	if restarted.persistLines != 3 {
+		t.Errorf("persistLines = %d, want 3", restarted.persistLines)
+	}
+	got := restarted.buffer.Since(time.Time{})
+	want := []Sample{
+		watchSample(4, Point{Metric: "load1", Value: 4}),
+		watchSample(5, Point{Metric: "load1", Value: 5}),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("restored samples = %+v, want %+v", got, want)
+	}
+
+	older := NewWatcher(nil, nil, NewRingBuffer(10))
+	if err := older.Persist(path, watchSample(4).Time); err != nil {
+		t.Fatalf("Persist: %v", err)
+	}
+	if got := sampleTimes(older.buffer.Since(time.Time{})); !reflect.DeepEqual(got, []time.Time{watchSample(5).Time}) {
+		t.Errorf("samples newer than the cutoff = %v, want only sample 5", got)
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines++
+	}
+	return lines
+}
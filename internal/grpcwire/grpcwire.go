@@ -0,0 +1,207 @@
+// Package grpcwire holds the minimal protobuf and gRPC framing helpers shared
+// by the agent and the script manager for the messages in proto/agent.proto.
+// Only the wire types used by that file are supported.
+package grpcwire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// MaxMessage bounds a single gRPC message, including pushed files.
+const MaxMessage = 64 << 20
+
+// Field is one decoded field. Varint holds varint values and Bytes
+// length-delimited ones; the values of fixed-width fields are not kept.
+type Field struct {
+	Num    int
+	Wire   int
+	Varint uint64
+	Bytes  []byte
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	return binary.AppendUvarint(b, v)
+}
+
+func appendTag(b []byte, num, wire int) []byte {
+	return appendVarint(b, uint64(num)<<3|uint64(wire))
+}
+
+// AppendVarintField appends a varint field, omitting proto3 defaults.
+func AppendVarintField(b []byte, num int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendTag(b, num, wireVarint)
+	return appendVarint(b, v)
+}
+
+func AppendBoolField(b []byte, num int, v bool) []byte {
+	if !v {
+		return b
+	}
+	return AppendVarintField(b, num, 1)
+}
+
+// AppendBytesField appends a length-delimited field, omitting empty values.
+func AppendBytesField(b []byte, num int, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	return AppendMessageField(b, num, v)
+}
+
+func AppendStringField(b []byte, num int, v string) []byte {
+	return AppendBytesField(b, num, []byte(v))
+}
+
+// AppendMessageField appends a length-delimited field even when it is empty,
+// as required for set oneof members.
+func AppendMessageField(b []byte, num int, v []byte) []byte {
+	b = appendTag(b, num, wireBytes)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func Parse(b []byte) ([]Field, error) {
+	var fields []Field
+
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("invalid field tag")
+		}
+		b = b[n:]
+
+		field := Field{Num: int(tag >> 3), Wire: int(tag & 7)}
+		switch field.Wire {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return nil, errors.New("invalid varint")
+			}
+			field.Varint = v
+			b = b[n:]
+		case wireBytes:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				return nil, errors.New("invalid length-delimited field")
+			}
+			field.Bytes = b[n : n+int(length)]
+			b = b[n+int(length):]
+		case wireFixed64:
+			if len(b) < 8 {
+				return nil, errors.New("truncated fixed64")
+			}
+			b = b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return nil, errors.New("truncated fixed32")
+			}
+			b = b[4:]
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d", field.Wire)
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// WriteFrame writes one length-prefixed, uncompressed gRPC message.
+func WriteFrame(w io.Writer, msg []byte) error {
+	header := make([]byte, 5)
+	binary.BigEndian.PutUint32(header[1:], uint32(len(msg)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
+
+// ReadFrame reads one gRPC message. It returns io.EOF when the stream
+// ends cleanly between messages.
+func ReadFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errors.New("truncated gRPC frame header")
+		}
+		return nil, err
+	}
+	if header[0] != 0 {
+		return nil, errors.New("compressed gRPC messages are not supported")
+	}
+
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > MaxMessage {
+		return nil, fmt.Errorf("gRPC message too large: %d bytes", length)
+	}
+
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, errors.New("truncated gRPC message")
+	}
+	return msg, nil
+}
+
+// EncodeStatusMessage percent-encodes a Grpc-Message trailer value as the
+// gRPC over HTTP/2 spec requires: every byte outside printable ASCII, and
+// "%" itself, becomes %XX, so newlines and UTF-8 in error text cannot break
+// the trailers.
+func EncodeStatusMessage(message string) string {
+	const hex = "0123456789ABCDEF"
+
+	var b []byte
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c >= 0x20 && c <= 0x7e && c != '%' {
+			b = append(b, c)
+			continue
+		}
+		b = append(b, '%', hex[c>>4], hex[c&0x0f])
+	}
+	return string(b)
+}
+
+// DecodeStatusMessage reverses EncodeStatusMessage. Malformed escapes are
+// kept as they are, as the spec asks of clients.
+func DecodeStatusMessage(message string) string {
+	unhex := func(c byte) (byte, bool) {
+		switch {
+		case '0' <= c && c <= '9':
+			return c - '0', true
+		case 'a' <= c && c <= 'f':
+			return c - 'a' + 10, true
+		case 'A' <= c && c <= 'F':
+			return c - 'A' + 10, true
+		}
+		return 0, false
+	}
+
+	var b []byte
+	for i := 0; i < len(message); i++ {
+		if message[i] == '%' && i+2 < len(message) {
+			high, ok1 := unhex(message[i+1])
+			low, ok2 := unhex(message[i+2])
+			if ok1 && ok2 {
+				b = append(b, high<<4|low)
+				i += 2
+				continue
+			}
+		}
+		b = append(b, message[i])
+	}
+	return string(b)
+}
@@ -0,0 +1,218 @@
+package grpcwire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		encode func([]byte) []byte
+		want   []Field
+	}{
+		{
+			"varint",
+			func(b []byte) []byte { return AppendVarintField(b, 4, 1500) },
+			[]Field{{Num: 4, Wire: wireVarint, Varint: 1500}},
+		},
+		{
+			"varint default omitted",
+			func(b []byte) []byte { return AppendVarintField(b, 4, 0) },
+			nil,
+		},
+		{
+			"bool",
+			func(b []byte) []byte { return AppendBoolField(AppendBoolField(b, 1, true), 2, false) },
+			[]Field{{Num: 1, Wire: wireVarint, Varint: 1}},
+		},
+		{
+			"string and bytes",
+			func(b []byte) []byte {
+				b = AppendStringField(b, 1, "run-1")
+				return AppendBytesField(b, 2, []byte{0, 1, 2})
+			},
+			[]Field{
+				{Num: 1, Wire: wireBytes, Bytes: []byte("run-1")},
+				{Num: 2, Wire: wireBytes, Bytes: []byte{0, 1, 2}},
+			},
+		},
+		{
+			"empty string omitted",
+			func(b []byte) []byte { return AppendStringField(b, 1, "") },
+			nil,
+		},
+		{
+			"empty message kept",
+			func(b []byte) []byte { return AppendMessageField(b, 2, nil) },
+			[]Field{{Num: 2, Wire: wireBytes, Bytes: []byte{}}},
+		},
+		{
+			"large field number",
+			func(b []byte) []byte { return AppendVarintField(b, 1000, 1) },
+			[]Field{{Num: 1000, Wire: wireVarint, Varint: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := Parse(tt.encode(nil))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if len(fields) != len(tt.want) {
+				t.Fatalf("got %d fields, want %d: %+v", len(fields), len(tt.want), fields)
+			}
+			for i, field := range fields {
+				want := tt.want[i]
+				if field.Num != want.Num || field.Wire != want.Wire || field.Varint != want.Varint ||
+					!bytes.Equal(field.Bytes, want.Bytes) {
+					t.Errorf("field %d = %+v, want %+v", i, field, want)
+				}
+			}
+		})
+	}
+}
+
+// int32 fields such as ExecuteResult.exit_code are sign-extended to 64 bits,
+// so negative values take ten bytes and must survive the round trip.
+func TestNegativeExitCode(t *testing.T) {
+	for _, exitCode := range []int32{-1, -15, 1, 255} {
+		msg := AppendVarintField(nil, 1, uint64(int64(exitCode)))
+
+		fields, err := Parse(msg)
+		if err != nil {
+			t.Fatalf("exit code %d: %v", exitCode, err)
+		}
+		if got := int32(fields[0].Varint); got != exitCode {
+			t.Errorf("exit code %d decoded as %d", exitCode, got)
+		}
+		if exitCode < 0 && len(msg) != 1+binary.MaxVarintLen64 {
+			t.Errorf("exit code %d encoded in %d bytes, want %d", exitCode, len(msg), 1+binary.MaxVarintLen64)
+		}
+	}
+}
+
+func TestParseSkipsFixedFields(t *testing.T) {
+	msg := appendTag(nil, 1, wireFixed64)
+	msg = append(msg, make([]byte, 8)...)
+	msg = appendTag(msg, 2, wireFixed32)
+	msg = append(msg, make([]byte, 4)...)
+	msg = AppendStringField(msg, 3, "ok")
+
+	fields, err := Parse(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nums []int
+	for _, field := range fields {
+		nums = append(nums, field.Num)
+	}
+	if !slices.Equal(nums, []int{1, 2, 3}) || string(fields[2].Bytes) != "ok" {
+		t.Errorf("fields = %+v", fields)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  []byte
+	}{
+		{"truncated tag", []byte{0x80}},
+		{"truncated varint", []byte{0x08, 0x80}},
+		{"length past end", []byte{0x0a, 0x05, 'a'}},
+		{"truncated fixed64", append(appendTag(nil, 1, wireFixed64), 1, 2, 3)},
+		{"truncated fixed32", append(appendTag(nil, 1, wireFixed32), 1)},
+		{"group wire type", appendTag(nil, 1, 3)},
+	}
+
+	for _, tt := range tests {
+		if _, err := Parse(tt.msg); err == nil {
+			t.Errorf("%s: Parse succeeded", tt.name)
+		}
+	}
+}
+
+func TestFrames(t *testing.T) {
+	var buf bytes.Buffer
+	messages := [][]byte{[]byte("first"), {}, AppendStringField(nil, 1, "third")}
+	for _, msg := range messages {
+		if err := WriteFrame(&buf, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, want := range messages {
+		got, err := ReadFrame(&buf)
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("frame %d = %q, want %q", i, got, want)
+		}
+	}
+	if _, err := ReadFrame(&buf); err != io.EOF {
+		t.Errorf("after the last frame: err = %v, want io.EOF", err)
+	}
+}
+
+func TestReadFrameErrors(t *testing.T) {
+	tooLarge := []byte{0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(tooLarge[1:], MaxMessage+1)
+
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"truncated header", []byte{0, 0, 0}},
+		{"compressed", []byte{1, 0, 0, 0, 1, 'x'}},
+		{"too large", tooLarge},
+		{"truncated message", []byte{0, 0, 0, 0, 5, 'a', 'b'}},
+	}
+
+	for _, tt := range tests {
+		if _, err := ReadFrame(bytes.NewReader(tt.frame)); err == nil || err == io.EOF {
+			t.Errorf("%s: err = %v, want an error", tt.name, err)
+		}
+	}
+}
+
+func TestStatusMessage(t *testing.T) {
+	tests := []struct {
+		message, encoded string
+	}{
+		{"script is required", "script is required"},
+		{"", ""},
+		{"100% done", "100%25 done"},
+		{"exit status 1\nbash: line 2: nope", "exit status 1%0Abash: line 2: nope"},
+		{"dosya bulunamadı: ü.txt", "dosya bulunamad%C4%B1: %C3%BC.txt"},
+		{"tab\tand\x7fdel", "tab%09and%7Fdel"},
+	}
+
+	for _, tt := range tests {
+		if got := EncodeStatusMessage(tt.message); got != tt.encoded {
+			t.Errorf("EncodeStatusMessage(%q) = %q, want %q", tt.message, got, tt.encoded)
+		}
+		if got := DecodeStatusMessage(tt.encoded); got != tt.message {
+			t.Errorf("DecodeStatusMessage(%q) = %q, want %q", tt.encoded, got, tt.message)
+		}
+	}
+
+	// Malformed escapes pass through
+	malformed := []struct {
+		encoded, want string
+	}{
+		{"50%", "50%"},
+		{"50%2", "50%2"},
+		{"%zz", "%zz"},
+		{"a%%41", "a%A"},
+	}
+	for _, tt := range malformed {
+		if got := DecodeStatusMessage(tt.encoded); got != tt.want {
+			t.Errorf("DecodeStatusMessage(%q) = %q, want %q", tt.encoded, got, tt.want)
+		}
+	}
+}
@@ -11,6 +11,12 @@ import (
 	"time"
 )
 
+// helloPrefix starts the script manager's handshake line. AgentV2 speaks
+// protocol version 1 (read until half-close) plus the system_info command.
+const helloPrefix = ": BASH-KING-HELLO"
+
+const helloResponse = "BASH-KING/1 features=system_info\n"
+
 type AgentV2 struct {
 	port     string
 	hostname string
@@ -62,6 +68,11 @@ func (a *AgentV2) handleConnection(conn net.Conn) {
 	cmdStr := strings.TrimSpace(string(data))
 	fmt.Printf("[DEBUG] Received data length: %d\n", len(cmdStr))
 
+	if strings.HasPrefix(cmdStr, helloPrefix) {
+		conn.Write([]byte(helloResponse))
+		return
+	}
+
 	// Special command for system info
 	if cmdStr == "system_info" {
 		conn.Write([]byte(a.getSystemInfo()))
@@ -15,7 +15,7 @@ func sendCommand(port, command string) {
 	}
 	defer conn.Close()
 
-	fmt.Fprintf(conn, command+"\n")
+	fmt.Fprint(conn, command+"\n")
 
 	scanner := bufio.NewScanner(conn)
 	fmt.Printf("📋 Agent (port %s):\n", port)
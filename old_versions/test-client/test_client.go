@@ -24,7 +24,7 @@ func main() {
 	}
 	defer conn.Close()
 
-	fmt.Fprintf(conn, command+"\n")
+	fmt.Fprint(conn, command+"\n")
 
 	scanner := bufio.NewScanner(conn)
 	for scanner.Scan() {
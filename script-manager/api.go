@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ScriptEntry struct {
+	Path     string `json:"path"`
+	Name     string `json:"name"`
+	Category string `json:"category"`
+}
+
+type AgentStatus struct {
+	Name      string         `json:"name"`
+	Address   string         `json:"address"`
+	Reachable bool           `json:"reachable"`
+	LatencyMS int64          `json:"latency_ms"`
+	CheckedAt time.Time      `json:"checked_at"`
+	Error     string         `json:"error,omitempty"`
+	Protocol  *AgentProtocol `json:"protocol,omitempty"`
+}
+
+type cancelResult struct {
+	Agent     string `json:"agent"`
+	Cancelled bool   `json:"cancelled"`
+	Error     string `json:"error,omitempty"`
+}
+
+type runRequest struct {
+	Script string   `json:"script"`
+	Agents []string `json:"agents"`
+}
+
+// APIServer exposes the script manager over HTTP/JSON.
+type APIServer struct {
+	sm   *ScriptManager
+	runs *RunStore
+}
+
+func NewAPIServer(sm *ScriptManager) *APIServer {
+	return &APIServer{
+		sm:   sm,
+		runs: NewRunStore(),
+	}
+}
+
+func (api *APIServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /runs", api.handleCreateRun)
+	mux.HandleFunc("GET /runs", api.handleListRuns)
+	mux.HandleFunc("GET /runs/{id}", api.handleGetRun)
+	mux.HandleFunc("GET /runs/{id}/events", api.handleRunEvents)
+	mux.HandleFunc("POST /runs/{id}/cancel", api.handleCancelRun)
+	mux.HandleFunc("GET /agents", api.handleAgents)
+	mux.HandleFunc("GET /scripts", api.handleScripts)
+	mux.HandleFunc("POST /baselines/diff", api.handleBaselineDiff)
+	mux.HandleFunc("POST /sboms", api.handleSBOMs)
+	mux.Handle("GET /", dashboardHandler())
+	return mux
+}
+
+// ListScripts returns every script under the scripts directory.
+func (sm *ScriptManager) ListScripts() []ScriptEntry {
+	var scripts []ScriptEntry
+
+	filepath.WalkDir("scripts", func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".sh") {
+			return nil
+		}
+
+		scripts = append(scripts, ScriptEntry{
+			Path:     filepath.ToSlash(path),
+			Name:     d.Name(),
+			Category: filepath.Base(filepath.Dir(path)),
+		})
+		return nil
+	})
+
+	sort.Slice(scripts, func(i, j int) bool {
+		return scripts[i].Path < scripts[j].Path
+	})
+	return scripts
+}
+
+// AgentStatuses checks whether each registered agent accepts connections and
+// which protocol it speaks.
+func (sm *ScriptManager) AgentStatuses() []AgentStatus {
+	statuses := make([]AgentStatus, len(sm.agents))
+	done := make(chan struct{}, len(sm.agents))
+
+	for i, agent := range sm.agents {
+		go func(i int, name string, port int) {
+			address := fmt.Sprintf("localhost:%d", port)
+			status := AgentStatus{Name: name, Address: address, CheckedAt: time.Now()}
+
+			start := time.Now()
+			conn, err := net.DialTimeout("tcp", address, 2*time.Second)
+			if err == nil {
+				status.Reachable = true
+				status.LatencyMS = time.Since(start).Milliseconds()
+				conn.Close()
+
+				if protocol, err := sm.agentProtocol(name, port); err == nil {
+					status.Protocol = &protocol
+				} else {
+					status.Error = err.Error()
+				}
+			} else {
+				status.Error = err.Error()
+			}
+
+			statuses[i] = status
+			done <- struct{}{}
+		}(i, agent, sm.ports[i])
+	}
+
+	for range sm.agents {
+		<-done
+	}
+	return statuses
+}
+
+func (api *APIServer) handleCreateRun(w http.ResponseWriter, r *http.Request) {
+	var req runRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	// Only scripts from the catalog may be run
+	known := false
+	for _, script := range api.sm.ListScripts() {
+		if script.Path == req.Script {
+			known = true
+			break
+		}
+	}
+	if !known {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown script: %s", req.Script))
+		return
+	}
+
+	agents := req.Agents
+	if len(agents) == 0 {
+		agents = api.sm.agents
+	}
+	for _, agent := range agents {
+		if api.sm.agentPort(agent) == 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown agent: %s", agent))
+			return
+		}
+	}
+
+	content, err := os.ReadFile(req.Script)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("error reading script: %v", err))
+		return
+	}
+
+	run := api.runs.Create(newRunID(), req.Script, agents)
+	go api.execute(run, string(content))
+
+	w.Header().Set("Location", "/runs/"+run.ID)
+	writeJSON(w, http.StatusAccepted, run)
+}
+
+func (api *APIServer) execute(run Run, script string) {
+	fmt.Printf("[DEBUG] API run %s: %s on %v\n", run.ID, run.Script, run.Agents)
+
+	results := make(chan ScriptResult, len(run.Agents))
+	for _, agent := range run.Agents {
+		go func(agentName string) {
+			results <- api.sm.executeWithRetry(agentName, api.sm.agentPort(agentName), run.ID, script,
+				func(agentName string, chunk []byte) {
+					api.runs.AppendOutput(run.ID, agentName, chunk)
+				})
+		}(agent)
+	}
+
+	for range run.Agents {
+		api.runs.AddResult(run.ID, <-results)
+	}
+	api.runs.Finish(run.ID)
+}
+
+// handleListRuns lists runs, optionally filtered by ?q= (matched against the
+// run ID, script and agent output), ?status= and ?agent=.
+func (api *APIServer) handleListRuns(w http.ResponseWriter, r *http.Request) {
+	query := strings.ToLower(r.URL.Query().Get("q"))
+	status := r.URL.Query().Get("status")
+	agent := r.URL.Query().Get("agent")
+
+	runs := make([]Run, 0)
+	for _, run := range api.runs.List() {
+		if status != "" && run.Status != status {
+			continue
+		}
+		if agent != "" && !containsString(run.Agents, agent) {
+			continue
+		}
+		if query != "" && !runMatches(run, query) {
+			continue
+		}
+		runs = append(runs, run)
+	}
+
+	writeJSON(w, http.StatusOK, runs)
+}
+
+func runMatches(run Run, query string) bool {
+	if strings.Contains(strings.ToLower(run.ID), query) ||
+		strings.Contains(strings.ToLower(run.Script), query) {
+		return true
+	}
+	for _, result := range run.Results {
+		if strings.Contains(strings.ToLower(result.Output), query) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (api *APIServer) handleGetRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := api.runs.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
+
+// handleCancelRun asks every agent of a running run to stop the script. The
+// run itself finishes once the agents report their results.
+func (api *APIServer) handleCancelRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := api.runs.Get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+	if run.Status != RunRunning {
+		writeError(w, http.StatusConflict, fmt.Sprintf("run is %s", run.Status))
+		return
+	}
+
+	results := make([]cancelResult, len(run.Agents))
+	done := make(chan struct{}, len(run.Agents))
+	for i, agent := range run.Agents {
+		go func(i int, agentName string) {
+			result := cancelResult{Agent: agentName}
+			cancelled, err := api.sm.cancelOnAgent(agentName, run.ID)
+			if err != nil {
+				result.Error = err.Error()
+			}
+			result.Cancelled = cancelled
+			results[i] = result
+			done <- struct{}{}
+		}(i, agent)
+	}
+	for range run.Agents {
+		<-done
+	}
+
+	fmt.Printf("[DEBUG] API run %s: cancel requested\n", run.ID)
+	writeJSON(w, http.StatusOK, results)
+}
+
+// handleRunEvents streams run events as server-sent events, replaying
+// everything published before the client connected. A reconnecting
+// EventSource sends Last-Event-ID and only gets the events after it.
+func (api *APIServer) handleRunEvents(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	lastEventID, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+	history, events, ok := api.runs.Subscribe(id, lastEventID)
+	if !ok {
+		writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+	if events != nil {
+		defer api.runs.Unsubscribe(id, events)
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	for _, event := range history {
+		writeEvent(w, event)
+	}
+	flusher.Flush()
+
+	if events == nil {
+		return
+	}
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			writeEvent(w, event)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (api *APIServer) handleAgents(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, api.sm.AgentStatuses())
+}
+
+func (api *APIServer) handleScripts(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, api.sm.ListScripts())
+}
+
+func writeEvent(w http.ResponseWriter, event RunEvent) {
+	data, _ := json.Marshal(event)
+	if event.seq > 0 {
+		fmt.Fprintf(w, "id: %d\n", event.seq)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// eventIDs reads an SSE stream and returns the IDs and types of its events.
+func eventIDs(t *testing.T, resp *http.Response) (ids, types []string) {
+	t.Helper()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if id, ok := strings.CutPrefix(line, "id: "); ok {
+			ids = append(ids, id)
+		}
+		if typ, ok := strings.CutPrefix(line, "event: "); ok {
+			types = append(types, typ)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return ids, types
+}
+
+func TestRunEventsLastEventID(t *testing.T) {
+	api := NewAPIServer(nil)
+	api.runs.Create("run", "scripts/host/ok.sh", []string{"agent1"})
+	api.runs.AppendOutput("run", "agent1", []byte("one\n"))
+	api.runs.AppendOutput("run", "agent1", []byte("two\n"))
+	api.runs.AddResult("run", ScriptResult{AgentName: "agent1", Success: true})
+	api.runs.Finish("run")
+
+	server := httptest.NewServer(api.Handler())
+	defer server.Close()
+
+	tests := []struct {
+		lastEventID string
+		wantIDs     string
+		wantTypes   string
+	}{
+		{"", "1 2 3 4", "output output result done"},
+		{"2", "3 4", "result done"},
+		{"4", "", ""},
+		{"garbage", "1 2 3 4", "output output result done"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/runs/run/events", nil)
+		if tt.lastEventID != "" {
+			req.Header.Set("Last-Event-ID", tt.lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids, types := eventIDs(t, resp)
+		resp.Body.Close()
+
+		if got := strings.Join(ids, " "); got != tt.wantIDs {
+			t.Errorf("Last-Event-ID %q: ids = %q, want %q", tt.lastEventID, got, tt.wantIDs)
+		}
+		if got := strings.Join(types, " "); got != tt.wantTypes {
+			t.Errorf("Last-Event-ID %q: events = %q, want %q", tt.lastEventID, got, tt.wantTypes)
+		}
+	}
+
+	resp, err := http.Get(server.URL + "/runs/missing/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown run: status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
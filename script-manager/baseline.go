@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBaselineFile = "/var/lib/host-monitor/baseline.json"
+	defaultBaselinePub  = "/etc/host-monitor/baseline.key.pub"
+)
+
+// safePath keeps baseline paths from smuggling shell syntax into the
+// command sent to agents.
+var safePath = regexp.MustCompile(`^/[A-Za-z0-9._/-]+$`)
+
+type baselineDiffRequest struct {
+	Agents []string `json:"agents"`
+	File   string   `json:"file"`
+	Pub    string   `json:"pub"`
+}
+
+// BaselineDrift is the result of "host-monitor baseline diff" on one agent.
+// Status is "clean", "drift" or "error".
+type BaselineDrift struct {
+	Agent    string          `json:"agent"`
+	Status   string          `json:"status"`
+	Hostname string          `json:"hostname,omitempty"`
+	Changes  int             `json:"changes"`
+	Diff     json.RawMessage `json:"diff,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Duration time.Duration   `json:"duration_ns"`
+}
+
+type BaselineDiffResponse struct {
+	RunID  string          `json:"run_id"`
+	Drift  int             `json:"drift"`
+	Agents []BaselineDrift `json:"agents"`
+}
+
+// handleBaselineDiff runs "host-monitor baseline diff" on the agents and
+// waits for all of them. The run is also kept in the run history.
+func (api *APIServer) handleBaselineDiff(w http.ResponseWriter, r *http.Request) {
+	req := baselineDiffRequest{File: defaultBaselineFile, Pub: defaultBaselinePub}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+	}
+	if req.File == "" {
+		req.File = defaultBaselineFile
+	}
+	if req.Pub == "" {
+		req.Pub = defaultBaselinePub
+	}
+	if !safePath.MatchString(req.File) || !safePath.MatchString(req.Pub) {
+		writeError(w, http.StatusBadRequest, "file and pub must be absolute paths")
+		return
+	}
+
+	agents := req.Agents
+	if len(agents) == 0 {
+		agents = api.sm.agents
+	}
+	for _, agent := range agents {
+		if api.sm.agentPort(agent) == 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown agent: %s", agent))
+			return
+		}
+	}
+
+	// A single line, so agents on the line protocol can run it too
+	command := fmt.Sprintf("host-monitor baseline diff --format json --file %s --pub %s", req.File, req.Pub)
+
+	run := api.runs.Create(newRunID(), "host-monitor baseline diff", agents)
+	results := api.sm.RunOnAgents(run.ID, command, agents, func(agentName string, chunk []byte) {
+		api.runs.AppendOutput(run.ID, agentName, chunk)
+	})
+
+	response := BaselineDiffResponse{RunID: run.ID, Agents: make([]BaselineDrift, 0, len(results))}
+	for _, result := range results {
+		api.runs.AddResult(run.ID, result)
+		drift := parseBaselineDrift(result)
+		if drift.Status == "drift" {
+			response.Drift++
+		}
+		response.Agents = append(response.Agents, drift)
+	}
+	api.runs.Finish(run.ID)
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// parseBaselineDrift reads the JSON report from the agent output. diff exits
+// 1 on drift: the gRPC transport reports that as a failed result with exit
+// code 1, the TCP one as success with a "Command error" line after the
+// report. Any other failure is an error.
+func parseBaselineDrift(result ScriptResult) BaselineDrift {
+	drift := BaselineDrift{Agent: result.AgentName, Status: "error", Duration: result.Duration}
+
+	start := strings.Index(result.Output, "{")
+	if (!result.Success && result.ExitCode != 1) || start < 0 {
+		drift.Error = lastLine(result.Output)
+		return drift
+	}
+
+	var report struct {
+		Hostname string          `json:"hostname"`
+		Error    string          `json:"error"`
+		Data     json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(strings.NewReader(result.Output[start:])).Decode(&report); err != nil {
+		drift.Error = fmt.Sprintf("invalid report: %v", err)
+		return drift
+	}
+	if report.Error != "" {
+		drift.Error = report.Error
+		return drift
+	}
+
+	// Every list in the diff counts as changes
+	var lists map[string]json.RawMessage
+	json.Unmarshal(report.Data, &lists)
+	for _, value := range lists {
+		var items []json.RawMessage
+		if json.Unmarshal(value, &items) == nil {
+			drift.Changes += len(items)
+		}
+	}
+
+	drift.Hostname = report.Hostname
+	drift.Diff = report.Data
+	drift.Status = "clean"
+	if drift.Changes > 0 {
+		drift.Status = "drift"
+	}
+	return drift
+}
+
+// lastLine returns the last line of output that is not the agent's
+// "Command error" trailer, which only repeats the exit status.
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for i := len(lines) - 1; i > 0; i-- {
+		if !strings.HasPrefix(lines[i], "Command error:") {
+			return lines[i]
+		}
+	}
+	return lines[0]
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const cleanBaselineReport = `{
+  "schema_version": 1,
+  "module": "baseline",
+  "hostname": "web-01",
+  "generated_at": "2026-10-19T08:00:00Z",
+  "data": {
+    "baseline_host": "web-01",
+    "current_host": "web-01",
+    "added_ports": null,
+    "new_users": [],
+    "new_world_writable": null
+  }
+}
+`
+
+const driftBaselineReport = `{
+  "schema_version": 1,
+  "module": "baseline",
+  "hostname": "web-01",
+  "generated_at": "2026-10-19T08:00:00Z",
+  "data": {
+    "baseline_host": "web-01",
+    "current_host": "web-01",
+    "added_ports": [{"protocol": "tcp", "port": "4444", "process": "nc"}],
+    "new_users": [{"name": "backup2", "uid": 0}],
+    "new_world_writable": ["/etc/cron.d/job"]
+  }
+}
+`
+
+const signatureFailure = "❌ baseline /var/lib/host-monitor/baseline.json: signature does not match key 3f2a9c1e\n"
+
+// The TCP transport reports every exit as success and appends a "Command
+// error" line, the gRPC one fails the result with the exit code: diff exits
+// 1 on drift and 2 on any error.
+func TestParseBaselineDrift(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   ScriptResult
+		status   string
+		hostname string
+		changes  int
+		err      string
+	}{
+		{
+			name:   "tcp clean",
+			result: ScriptResult{AgentName: "agent1", Success: true, Output: cleanBaselineReport},
+			status: "clean", hostname: "web-01",
+		},
+		{
+			name: "tcp drift",
+			result: ScriptResult{AgentName: "agent1", Success: true,
+				Output: "⚠️  Not running as root\n" + driftBaselineReport + "Command error: exit status 1\n"},
+			status: "drift", hostname: "web-01", changes: 3,
+		},
+		{
+			name: "tcp signature failure",
+			result: ScriptResult{AgentName: "agent1", Success: true,
+				Output: signatureFailure + "Command error: exit status 2\n"},
+			status: "error", err: strings.TrimSpace(signatureFailure),
+		},
+		{
+			name:   "tcp transport error",
+			result: ScriptResult{AgentName: "agent1", Output: "❌ Connection failed: dial tcp [::1]:9001: connect: connection refused"},
+			status: "error", err: "❌ Connection failed: dial tcp [::1]:9001: connect: connection refused",
+		},
+		{
+			name:   "grpc clean",
+			result: ScriptResult{AgentName: "agent2", Success: true, Output: cleanBaselineReport},
+			status: "clean", hostname: "web-01",
+		},
+		{
+			name:   "grpc drift",
+			result: ScriptResult{AgentName: "agent2", ExitCode: 1, Output: driftBaselineReport},
+			status: "drift", hostname: "web-01", changes: 3,
+		},
+		{
+			name:   "grpc signature failure",
+			result: ScriptResult{AgentName: "agent2", ExitCode: 2, Output: signatureFailure},
+			status: "error", err: strings.TrimSpace(signatureFailure),
+		},
+		{
+			name:   "grpc error after a report",
+			result: ScriptResult{AgentName: "agent2", ExitCode: 2, Output: cleanBaselineReport + "❌ Failed to write baseline report: broken pipe\n"},
+			status: "error", err: "❌ Failed to write baseline report: broken pipe",
+		},
+		{
+			name:   "grpc transport error",
+			result: ScriptResult{AgentName: "agent2", Output: "❌ gRPC execution failed: gRPC Execute failed (code 14): unavailable"},
+			status: "error", err: "❌ gRPC execution failed: gRPC Execute failed (code 14): unavailable",
+		},
+		{
+			name:   "truncated report",
+			result: ScriptResult{AgentName: "agent1", Success: true, Output: driftBaselineReport[:60]},
+			status: "error", err: "invalid report: unexpected EOF",
+		},
+		{
+			name:   "report with an error",
+			result: ScriptResult{AgentName: "agent1", Success: true, Output: `{"hostname": "web-01", "error": "security scan failed"}`},
+			status: "error", err: "security scan failed",
+		},
+	}
+
+	for _, tt := range tests {
+		drift := parseBaselineDrift(tt.result)
+		if drift.Agent != tt.result.AgentName || drift.Status != tt.status || drift.Hostname != tt.hostname ||
+			drift.Changes != tt.changes || drift.Error != tt.err {
+			t.Errorf("%s: parseBaselineDrift = %s status %q, hostname %q, %d changes, error %q; want %q, %q, %d, %q",
+				tt.name, drift.Agent, drift.Status, drift.Hostname, drift.Changes, drift.Error,
+				tt.status, tt.hostname, tt.changes, tt.err)
+		}
+		if tt.status != "error" && len(drift.Diff) == 0 {
+			t.Errorf("%s: no diff in the result", tt.name)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bash-king/internal/grpcwire"
+)
+
+// gRPC client for the Agent service in proto/agent.proto, spoken over HTTP/2
+// without TLS.
+
+const grpcServicePath = "/bashking.agent.v1.Agent/"
+
+// grpcExecuteTimeout bounds a single Execute call so that a hung agent
+// fails the attempt instead of blocking the run. It matches the agent's run
+// cache TTL, after which a retry would run the script again anyway.
+const grpcExecuteTimeout = 10 * time.Minute
+
+type ExecuteResult struct {
+	ExitCode   int32
+	Error      string
+	Cached     bool
+	DurationMS int64
+}
+
+type AgentInfo struct {
+	Hostname        string   `json:"hostname"`
+	OS              string   `json:"os"`
+	Arch            string   `json:"arch"`
+	Features        []string `json:"features"`
+	ProtocolVersion int      `json:"protocol_version"`
+}
+
+type AgentClient struct {
+	addr   string
+	client *http.Client
+}
+
+func NewAgentClient(addr string) *AgentClient {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+
+	return &AgentClient{
+		addr: addr,
+		client: &http.Client{
+			Transport: &http.Transport{Protocols: &protocols},
+		},
+	}
+}
+
+// call starts a gRPC call and returns a function that reads the next
+// response message. It returns io.EOF after the last message once the call
+// finished with status OK.
+func (c *AgentClient) call(ctx context.Context, method string, req []byte) (func() ([]byte, error), func(), error) {
+	var body bytes.Buffer
+	grpcwire.WriteFrame(&body, req)
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+c.addr+grpcServicePath+method, &body)
+	if err != nil {
+		return nil, nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/grpc")
+	httpReq.Header.Set("TE", "trailers")
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("unexpected HTTP status %s", resp.Status)
+	}
+
+	next := func() ([]byte, error) {
+		msg, err := grpcwire.ReadFrame(resp.Body)
+		if err != io.EOF {
+			return msg, err
+		}
+
+		// Trailers-only responses carry the status in the headers
+		status := resp.Trailer.Get("Grpc-Status")
+		message := resp.Trailer.Get("Grpc-Message")
+		if status == "" {
+			status = resp.Header.Get("Grpc-Status")
+			message = resp.Header.Get("Grpc-Message")
+		}
+		if status != "0" {
+			code, _ := strconv.Atoi(status)
+			return nil, fmt.Errorf("gRPC %s failed (code %d): %s", method, code, grpcwire.DecodeStatusMessage(message))
+		}
+		return nil, io.EOF
+	}
+
+	return next, func() { resp.Body.Close() }, nil
+}
+
+// unary performs a call that returns exactly one message.
+func (c *AgentClient) unary(ctx context.Context, method string, req []byte) ([]byte, error) {
+	next, done, err := c.call(ctx, method, req)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	msg, err := next()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := next(); err != io.EOF {
+		if err == nil {
+			err = fmt.Errorf("gRPC %s returned more than one message", method)
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Execute runs a script on the agent, passing output chunks to onOutput as
+// they arrive.
+func (c *AgentClient) Execute(ctx context.Context, runID, script string, onOutput func([]byte)) (ExecuteResult, error) {
+	var result ExecuteResult
+
+	var req []byte
+	req = grpcwire.AppendStringField(req, 1, runID)
+	req = grpcwire.AppendStringField(req, 2, script)
+
+	next, done, err := c.call(ctx, "Execute", req)
+	if err != nil {
+		return result, err
+	}
+	defer done()
+
+	for {
+		msg, err := next()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return result, err
+		}
+
+		fields, err := grpcwire.Parse(msg)
+		if err != nil {
+			return result, err
+		}
+		for _, field := range fields {
+			switch field.Num {
+			case 1:
+				if onOutput != nil {
+					onOutput(field.Bytes)
+				}
+			case 2:
+				result, err = parseExecuteResult(field.Bytes)
+				if err != nil {
+					return result, err
+				}
+			}
+		}
+	}
+}
+
+func parseExecuteResult(msg []byte) (ExecuteResult, error) {
+	var result ExecuteResult
+
+	fields, err := grpcwire.Parse(msg)
+	if err != nil {
+		return result, err
+	}
+	for _, field := range fields {
+		switch field.Num {
+		case 1:
+			result.ExitCode = int32(field.Varint)
+		case 2:
+			result.Error = string(field.Bytes)
+		case 3:
+			result.Cached = field.Varint != 0
+		case 4:
+			result.DurationMS = int64(field.Varint)
+		}
+	}
+	return result, nil
+}
+
+// Cancel stops the script running under runID on the agent. It reports
+// whether a running script was found.
+func (c *AgentClient) Cancel(ctx context.Context, runID string) (bool, error) {
+	msg, err := c.unary(ctx, "Cancel", grpcwire.AppendStringField(nil, 1, runID))
+	if err != nil {
+		return false, err
+	}
+
+	fields, err := grpcwire.Parse(msg)
+	if err != nil {
+		return false, err
+	}
+	for _, field := range fields {
+		if field.Num == 1 {
+			return field.Varint != 0, nil
+		}
+	}
+	return false, nil
+}
+
+// GetInfo describes the agent's host and the features it serves.
+func (c *AgentClient) GetInfo(ctx context.Context) (AgentInfo, error) {
+	var info AgentInfo
+
+	msg, err := c.unary(ctx, "GetInfo", nil)
+	if err != nil {
+		return info, err
+	}
+
+	fields, err := grpcwire.Parse(msg)
+	if err != nil {
+		return info, err
+	}
+	for _, field := range fields {
+		switch field.Num {
+		case 1:
+			info.Hostname = string(field.Bytes)
+		case 2:
+			info.OS = string(field.Bytes)
+		case 3:
+			info.Arch = string(field.Bytes)
+		case 4:
+			info.Features = append(info.Features, string(field.Bytes))
+		case 5:
+			info.ProtocolVersion = int(field.Varint)
+		}
+	}
+	return info, nil
+}
+
+// PushFile writes content to path below the agent's file directory and
+// returns the number of bytes written.
+func (c *AgentClient) PushFile(ctx context.Context, path string, content []byte, mode uint32) (int64, error) {
+	var req []byte
+	req = grpcwire.AppendStringField(req, 1, path)
+	req = grpcwire.AppendBytesField(req, 2, content)
+	req = grpcwire.AppendVarintField(req, 3, uint64(mode))
+
+	msg, err := c.unary(ctx, "PushFile", req)
+	if err != nil {
+		return 0, err
+	}
+
+	fields, err := grpcwire.Parse(msg)
+	if err != nil {
+		return 0, err
+	}
+	for _, field := range fields {
+		if field.Num == 1 {
+			return int64(field.Varint), nil
+		}
+	}
+	return 0, nil
+}
+
+// PullFile reads path below the agent's file directory, which the agent
+// streams in chunks.
+func (c *AgentClient) PullFile(ctx context.Context, path string) ([]byte, error) {
+	next, done, err := c.call(ctx, "PullFile", grpcwire.AppendStringField(nil, 1, path))
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	var content []byte
+	for {
+		msg, err := next()
+		if err == io.EOF {
+			return content, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		fields, err := grpcwire.Parse(msg)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range fields {
+			if field.Num == 1 {
+				content = append(content, field.Bytes...)
+			}
+		}
+	}
+}
+
+// grpcClient returns the client for an agent's gRPC address. Clients are
+// kept for the life of the manager so that runs share one HTTP/2 connection
+// per agent instead of dialing and leaking a transport each time.
+func (sm *ScriptManager) grpcClient(addr string) *AgentClient {
+	sm.grpcMu.Lock()
+	defer sm.grpcMu.Unlock()
+
+	client, ok := sm.grpcClients[addr]
+	if !ok {
+		client = NewAgentClient(addr)
+		sm.grpcClients[addr] = client
+	}
+	return client
+}
+
+// executeOnAgentGRPC runs a script through the agent's gRPC service and
+// returns the same result shape as the TCP transport. A script that exits
+// non-zero or fails to start is a failed result with its exit code set.
+func (sm *ScriptManager) executeOnAgentGRPC(agentName string, grpcPort int, runID, script string, onOutput OutputFunc) ScriptResult {
+	start := time.Now()
+	client := sm.grpcClient(fmt.Sprintf("localhost:%d", grpcPort))
+
+	fmt.Printf("[DEBUG] Sending script to %s over gRPC, length: %d\n", agentName, len(script))
+	ctx, cancel := context.WithTimeout(context.Background(), grpcExecuteTimeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	result, err := client.Execute(ctx, runID, script, func(chunk []byte) {
+		output.Write(chunk)
+		if onOutput != nil {
+			onOutput(agentName, chunk)
+		}
+	})
+	if err != nil {
+		// Drop the connection so that a retry dials the agent again
+		client.client.CloseIdleConnections()
+		return ScriptResult{
+			AgentName: agentName,
+			Output:    fmt.Sprintf("❌ gRPC execution failed: %v", err),
+			Success:   false,
+			Duration:  time.Since(start),
+		}
+	}
+
+	if result.Cached {
+		fmt.Printf("[DEBUG] %s returned cached result for run %s\n", agentName, runID)
+	}
+
+	if result.ExitCode != 0 || result.Error != "" {
+		if result.ExitCode == 0 {
+			result.ExitCode = -1
+		}
+		return ScriptResult{
+			AgentName: agentName,
+			Output:    output.String(),
+			Success:   false,
+			ExitCode:  int(result.ExitCode),
+			Duration:  time.Since(start),
+		}
+	}
+
+	return ScriptResult{
+		AgentName: agentName,
+		Output:    output.String(),
+		Success:   true,
+		Duration:  time.Since(start),
+	}
+}
+
+// cancelOnAgent stops a run on one agent. Cancelling goes through the
+// agent's gRPC service whichever transport started the run, so it needs an
+// agent that advertises a gRPC port.
+func (sm *ScriptManager) cancelOnAgent(agentName, runID string) (bool, error) {
+	protocol, err := sm.agentProtocol(agentName, sm.agentPort(agentName))
+	if err != nil {
+		return false, err
+	}
+	if protocol.GRPCPort == 0 {
+		return false, fmt.Errorf("%s does not serve gRPC, which cancel needs (set AGENT_GRPC_PORT)", agentName)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return sm.grpcClient(fmt.Sprintf("localhost:%d", protocol.GRPCPort)).Cancel(ctx, runID)
+}
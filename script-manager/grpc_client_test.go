@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startAgent builds the agent and starts it with its gRPC service on a free
+// port and file transfer confined to fileDir. It returns the gRPC address.
+func startAgent(t *testing.T, fileDir string) string {
+	t.Helper()
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go tool to build the agent")
+	}
+
+	binary := filepath.Join(t.TempDir(), "agent")
+	if output, err := exec.Command(goTool, "build", "-o", binary, "../agent").CombinedOutput(); err != nil {
+		t.Fatalf("building the agent: %v\n%s", err, output)
+	}
+
+	tcpPort, grpcPort := freePort(t), freePort(t)
+	cmd := exec.Command(binary, fmt.Sprint(tcpPort))
+	cmd.Env = append(os.Environ(), fmt.Sprintf("AGENT_GRPC_PORT=%d", grpcPort), "AGENT_FILE_DIR="+fileDir)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	addr := fmt.Sprintf("localhost:%d", grpcPort)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return addr
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("agent gRPC service did not come up on %s: %v", addr, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestAgentClient(t *testing.T) {
+	fileDir := t.TempDir()
+	client := NewAgentClient(startAgent(t, fileDir))
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	info, err := client.GetInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Hostname == "" || info.ProtocolVersion == 0 ||
+		!slices.Contains(info.Features, "push-file") || !slices.Contains(info.Features, "pull-file") {
+		t.Errorf("GetInfo = %+v, want a hostname, a protocol version and file transfer", info)
+	}
+
+	// Output arrives in chunks before the result, which comes last
+	var chunks [][]byte
+	result, err := client.Execute(ctx, "client-run", "echo first; sleep 0.2; echo second; exit 4", func(chunk []byte) {
+		chunks = append(chunks, bytes.Clone(chunk))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := string(bytes.Join(chunks, nil))
+	if len(chunks) < 2 || !strings.HasPrefix(output, "first\nsecond\n") {
+		t.Errorf("Execute streamed %d chunks %q, want first and second in separate chunks", len(chunks), output)
+	}
+	if result.ExitCode != 4 || result.Error != "exit status 4" || result.Cached {
+		t.Errorf("Execute result = %+v, want exit 4", result)
+	}
+
+	result, err = client.Execute(ctx, "client-run", "echo never", nil)
+	if err != nil || !result.Cached || result.ExitCode != 4 {
+		t.Errorf("resubmitted run = %+v, %v; want the cached exit 4", result, err)
+	}
+
+	if cancelled, err := client.Cancel(ctx, "not-running"); err != nil || cancelled {
+		t.Errorf("Cancel of an unknown run = %v, %v; want false", cancelled, err)
+	}
+
+	// A non-OK status comes back as an error carrying the decoded message
+	if _, err := client.Execute(ctx, "", " ", nil); err == nil || !strings.Contains(err.Error(), "(code 3): script is required") {
+		t.Errorf("Execute of an empty script: %v, want code 3", err)
+	}
+
+	content := []byte(strings.Repeat("line\n", 20000))
+	if size, err := client.PushFile(ctx, "conf/app.conf", content, 0640); err != nil || size != int64(len(content)) {
+		t.Fatalf("PushFile = %d, %v; want %d", size, err, len(content))
+	}
+	if info, err := os.Stat(filepath.Join(fileDir, "conf", "app.conf")); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("pushed file: %v, %v; want mode 0640", info, err)
+	}
+	if pulled, err := client.PullFile(ctx, "conf/app.conf"); err != nil || !bytes.Equal(pulled, content) {
+		t.Errorf("PullFile returned %d bytes, %v; want %d", len(pulled), err, len(content))
+	}
+
+	if _, err := client.PushFile(ctx, "../escape", []byte("x"), 0644); err == nil || !strings.Contains(err.Error(), "(code 7)") {
+		t.Errorf("PushFile out of the directory: %v, want code 7", err)
+	}
+	if _, err := client.PullFile(ctx, "ünïcode\nname"); err == nil || !strings.Contains(err.Error(), "(code 5): file not found: ünïcode\nname") {
+		t.Errorf("PullFile of a missing file: %v, want code 5 with the name decoded", err)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Agent protocol versions, see agent/protocol.go.
+const (
+	protocolLine    = 0 // one newline-terminated command per connection
+	protocolLegacy  = 1 // script read until half-close, no handshake
+	protocolCurrent = 2 // handshake, run IDs and streamed output
+)
+
+// maxProtocolVersion is the newest agent protocol this manager understands.
+const maxProtocolVersion = protocolCurrent
+
+// helloLine is a bash no-op, so agents without handshake support run it and
+// answer with an empty result instead of failing.
+const helloLine = ": BASH-KING-HELLO 2\n"
+
+const helloReplyPrefix = "BASH-KING/"
+
+// protocolCacheTTL is how long a negotiated protocol is reused.
+const protocolCacheTTL = 5 * time.Minute
+
+// lineProbeTimeout is how long the manager waits for an answer before
+// half-closing. Only line-based (version 0) agents answer that early.
+const lineProbeTimeout = time.Second
+
+type AgentProtocol struct {
+	Version   int       `json:"version"`
+	Features  []string  `json:"features"`
+	GRPCPort  int       `json:"grpc_port,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+func (p AgentProtocol) Has(feature string) bool {
+	for _, f := range p.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate performs the handshake with the agent at address and works out
+// which protocol it speaks.
+func negotiate(address string) (AgentProtocol, error) {
+	protocol := AgentProtocol{CheckedAt: time.Now()}
+
+	conn, err := net.DialTimeout("tcp", address, 2*time.Second)
+	if err != nil {
+		return protocol, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(helloLine)); err != nil {
+		return protocol, err
+	}
+
+	// Line-based agents answer as soon as they see the newline
+	conn.SetReadDeadline(time.Now().Add(lineProbeTimeout))
+	buffer := make([]byte, 1024)
+	n, err := conn.Read(buffer)
+	if n > 0 || err == io.EOF {
+		protocol.Version = protocolLine
+		return protocol, nil
+	}
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		return protocol, err
+	}
+
+	// Everyone else waits for the end of the request
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.CloseWrite()
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return protocol, fmt.Errorf("agent did not answer the handshake: %v", err)
+	}
+
+	line := strings.TrimSpace(string(reply))
+	if !strings.HasPrefix(line, helloReplyPrefix) {
+		protocol.Version = protocolLegacy
+		return protocol, nil
+	}
+
+	// BASH-KING/<version> key=value ...
+	fields := strings.Fields(line)
+	protocol.Version, err = strconv.Atoi(strings.TrimPrefix(fields[0], helloReplyPrefix))
+	if err != nil {
+		return protocol, fmt.Errorf("invalid handshake reply: %q", line)
+	}
+	for _, field := range fields[1:] {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "features":
+			if value != "" {
+				protocol.Features = strings.Split(value, ",")
+			}
+		case "grpc-port":
+			protocol.GRPCPort, _ = strconv.Atoi(value)
+		}
+	}
+
+	return protocol, nil
+}
+
+// agentProtocol returns the negotiated protocol of an agent, performing the
+// handshake when there is no recent result.
+func (sm *ScriptManager) agentProtocol(agentName string, port int) (AgentProtocol, error) {
+	sm.protoMu.Lock()
+	protocol, ok := sm.protocols[agentName]
+	sm.protoMu.Unlock()
+	if ok && time.Since(protocol.CheckedAt) < protocolCacheTTL {
+		return protocol, nil
+	}
+
+	protocol, err := negotiate(fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		return protocol, err
+	}
+	fmt.Printf("[DEBUG] %s speaks protocol %d (features: %v)\n", agentName, protocol.Version, protocol.Features)
+
+	sm.protoMu.Lock()
+	sm.protocols[agentName] = protocol
+	sm.protoMu.Unlock()
+	return protocol, nil
+}
+
+// forgetProtocol drops the cached protocol so the next run negotiates again,
+// e.g. after the agent was restarted with a different version.
+func (sm *ScriptManager) forgetProtocol(agentName string) {
+	sm.protoMu.Lock()
+	delete(sm.protocols, agentName)
+	sm.protoMu.Unlock()
+}
+
+// checkProtocol returns an error explaining why a script cannot be sent to an
+// agent speaking the given protocol.
+func (sm *ScriptManager) checkProtocol(protocol AgentProtocol, script string) error {
+	if protocol.Version > maxProtocolVersion {
+		return fmt.Errorf("agent speaks protocol %d but this manager supports up to %d; upgrade the script manager",
+			protocol.Version, maxProtocolVersion)
+	}
+	if sm.transport == "grpc" && !protocol.Has("grpc") {
+		return fmt.Errorf("agent speaks protocol %d without gRPC support; use -transport tcp", protocol.Version)
+	}
+	if protocol.Version == protocolLine && strings.Contains(strings.TrimSpace(script), "\n") {
+		return fmt.Errorf("agent speaks the line protocol (version 0) and can only run single-line commands; upgrade the agent")
+	}
+	return nil
+}
+
+// executeOnLineAgent sends a single command to a version 0 agent, which
+// answers after the first newline and then closes the connection.
+func (sm *ScriptManager) executeOnLineAgent(agentName string, port int, command string) ScriptResult {
+	start := time.Now()
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		return ScriptResult{
+			AgentName: agentName,
+			Output:    fmt.Sprintf("❌ Connection failed: %v", err),
+			Success:   false,
+			Duration:  time.Since(start),
+		}
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	fmt.Printf("[DEBUG] Sending command to %s (line protocol)\n", agentName)
+	if _, err := conn.Write([]byte(strings.TrimSpace(command) + "\n")); err != nil {
+		return ScriptResult{
+			AgentName: agentName,
+			Output:    fmt.Sprintf("❌ Failed to send command: %v", err),
+			Success:   false,
+			Duration:  time.Since(start),
+		}
+	}
+
+	output, err := io.ReadAll(conn)
+	if err != nil && len(output) == 0 {
+		return ScriptResult{
+			AgentName: agentName,
+			Output:    fmt.Sprintf("❌ Failed to read response: %v", err),
+			Success:   false,
+			Duration:  time.Since(start),
+		}
+	}
+
+	return ScriptResult{
+		AgentName: agentName,
+		Output:    string(output),
+		Success:   true,
+		Duration:  time.Since(start),
+	}
+}
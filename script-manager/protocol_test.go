@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"slices"
+	"testing"
+)
+
+// fakeAgent accepts one connection on a local port and hands it to handle.
+func fakeAgent(t *testing.T, handle func(conn net.Conn)) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}()
+	return listener.Addr().String()
+}
+
+// lineAgent answers as soon as it has read the first line, like the
+// old_versions agents.
+func lineAgent(conn net.Conn) {
+	bufio.NewReader(conn).ReadString('\n')
+	io.WriteString(conn, "bash: BASH-KING-HELLO: command not found\n")
+}
+
+// scriptAgent reads the whole request before answering with reply.
+func scriptAgent(reply string) func(net.Conn) {
+	return func(conn net.Conn) {
+		io.ReadAll(conn)
+		io.WriteString(conn, reply)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name         string
+		agent        func(net.Conn)
+		wantVersion  int
+		wantFeatures []string
+		wantGRPCPort int
+		wantErr      bool
+	}{
+		{"line agent", lineAgent, protocolLine, nil, 0, false},
+		{"legacy agent", scriptAgent(""), protocolLegacy, nil, 0, false},
+		{"legacy agent with output", scriptAgent("\n"), protocolLegacy, nil, 0, false},
+		{"current agent", scriptAgent("BASH-KING/2 features=run-id,stream\n"),
+			protocolCurrent, []string{"run-id", "stream"}, 0, false},
+		{"current agent with gRPC", scriptAgent("BASH-KING/2 features=run-id,stream,grpc grpc-port=10001\n"),
+			protocolCurrent, []string{"run-id", "stream", "grpc"}, 10001, false},
+		{"no features", scriptAgent("BASH-KING/2 features=\n"), protocolCurrent, nil, 0, false},
+		{"unknown keys ignored", scriptAgent("BASH-KING/2 colour=blue features=run-id\n"),
+			protocolCurrent, []string{"run-id"}, 0, false},
+		{"newer agent", scriptAgent("BASH-KING/3 features=run-id\n"), 3, []string{"run-id"}, 0, false},
+		{"invalid version", scriptAgent("BASH-KING/two\n"), 0, nil, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			protocol, err := negotiate(fakeAgent(t, tt.agent))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("negotiate succeeded with %+v", protocol)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if protocol.Version != tt.wantVersion {
+				t.Errorf("version = %d, want %d", protocol.Version, tt.wantVersion)
+			}
+			if !slices.Equal(protocol.Features, tt.wantFeatures) {
+				t.Errorf("features = %v, want %v", protocol.Features, tt.wantFeatures)
+			}
+			if protocol.GRPCPort != tt.wantGRPCPort {
+				t.Errorf("gRPC port = %d, want %d", protocol.GRPCPort, tt.wantGRPCPort)
+			}
+		})
+	}
+}
+
+func TestCheckProtocol(t *testing.T) {
+	tests := []struct {
+		name      string
+		transport string
+		protocol  AgentProtocol
+		script    string
+		wantErr   bool
+	}{
+		{"current agent", "tcp", AgentProtocol{Version: protocolCurrent}, "echo a\necho b\n", false},
+		{"newer agent refused", "tcp", AgentProtocol{Version: maxProtocolVersion + 1}, "echo a\n", true},
+		{"line agent single line", "tcp", AgentProtocol{Version: protocolLine}, "uptime\n", false},
+		{"line agent multi-line refused", "tcp", AgentProtocol{Version: protocolLine}, "echo a\necho b\n", true},
+		{"gRPC without support refused", "grpc", AgentProtocol{Version: protocolCurrent}, "echo a\n", true},
+		{"gRPC", "grpc", AgentProtocol{Version: protocolCurrent, Features: []string{"grpc"}}, "echo a\n", false},
+	}
+
+	for _, tt := range tests {
+		sm := &ScriptManager{transport: tt.transport}
+		err := sm.checkProtocol(tt.protocol, tt.script)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// maxRuns is how many runs the store keeps. Beyond it the oldest finished
+// runs are forgotten together with their output.
+const maxRuns = 100
+
+// subscriberBuffer is how many events a subscriber may fall behind before it
+// is dropped.
+const subscriberBuffer = 64
+
+const (
+	RunRunning   = "running"
+	RunCompleted = "completed"
+	RunFailed    = "failed"
+)
+
+// Run is a single script execution across one or more agents.
+type Run struct {
+	ID         string         `json:"id"`
+	Script     string         `json:"script"`
+	Agents     []string       `json:"agents"`
+	Status     string         `json:"status"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+	Results    []ScriptResult `json:"results"`
+}
+
+// RunEvent is published while a run is in progress. Type is "output" for a
+// chunk of agent output, "result" when an agent finishes and "done" when the
+// whole run has finished. A subscriber that falls too far behind gets a
+// final "dropped" event instead of the rest; it can subscribe again to
+// replay the history.
+type RunEvent struct {
+	Type   string        `json:"type"`
+	Agent  string        `json:"agent,omitempty"`
+	Data   string        `json:"data,omitempty"`
+	Result *ScriptResult `json:"result,omitempty"`
+	Run    *Run          `json:"run,omitempty"`
+
+	// seq numbers the run's events from 1 and is sent as the SSE event ID,
+	// so a reconnecting client can resume after the last event it saw
+	seq int
+}
+
+type runRecord struct {
+	run         Run
+	events      []RunEvent
+	subscribers map[chan RunEvent]struct{}
+}
+
+// RunStore keeps the last maxRuns runs in memory together with their event
+// history, so that late subscribers can replay output they missed.
+type RunStore struct {
+	mu    sync.Mutex
+	runs  map[string]*runRecord
+	order []string
+}
+
+func NewRunStore() *RunStore {
+	return &RunStore{
+		runs: make(map[string]*runRecord),
+	}
+}
+
+func (rs *RunStore) Create(id, script string, agents []string) Run {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	record := &runRecord{
+		run: Run{
+			ID:        id,
+			Script:    script,
+			Agents:    agents,
+			Status:    RunRunning,
+			StartedAt: time.Now(),
+			Results:   []ScriptResult{},
+		},
+		subscribers: make(map[chan RunEvent]struct{}),
+	}
+	rs.runs[id] = record
+	rs.order = append(rs.order, id)
+	rs.prune()
+
+	return record.run
+}
+
+// prune forgets the oldest finished runs beyond maxRuns. Running runs are
+// kept whatever their number. The caller holds rs.mu.
+func (rs *RunStore) prune() {
+	excess := len(rs.order) - maxRuns
+	if excess <= 0 {
+		return
+	}
+
+	kept := rs.order[:0]
+	for _, id := range rs.order {
+		if excess > 0 && rs.runs[id].run.Status != RunRunning {
+			delete(rs.runs, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	rs.order = kept
+}
+
+func (rs *RunStore) Get(id string) (Run, bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	record, ok := rs.runs[id]
+	if !ok {
+		return Run{}, false
+	}
+	return record.run, true
+}
+
+// List returns all runs, newest first.
+func (rs *RunStore) List() []Run {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	runs := make([]Run, 0, len(rs.order))
+	for i := len(rs.order) - 1; i >= 0; i-- {
+		runs = append(runs, rs.runs[rs.order[i]].run)
+	}
+	return runs
+}
+
+func (rs *RunStore) AppendOutput(id, agentName string, chunk []byte) {
+	rs.publish(id, RunEvent{Type: "output", Agent: agentName, Data: string(chunk)})
+}
+
+func (rs *RunStore) AddResult(id string, result ScriptResult) {
+	rs.mu.Lock()
+	if record, ok := rs.runs[id]; ok {
+		record.run.Results = append(record.run.Results, result)
+	}
+	rs.mu.Unlock()
+
+	rs.publish(id, RunEvent{Type: "result", Agent: result.AgentName, Result: &result})
+}
+
+// Finish marks the run as completed, or failed if any agent failed, and
+// closes all subscriptions.
+func (rs *RunStore) Finish(id string) {
+	rs.mu.Lock()
+	record, ok := rs.runs[id]
+	if !ok {
+		rs.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	record.run.FinishedAt = &now
+	record.run.Status = RunCompleted
+	for _, result := range record.run.Results {
+		if !result.Success {
+			record.run.Status = RunFailed
+		}
+	}
+	run := record.run
+	rs.mu.Unlock()
+
+	rs.publish(id, RunEvent{Type: "done", Run: &run})
+
+	rs.mu.Lock()
+	for ch := range record.subscribers {
+		close(ch)
+	}
+	record.subscribers = nil
+	rs.mu.Unlock()
+}
+
+// Subscribe returns the events published after the first skip ones and a
+// channel for new ones. The channel is nil if the run has already finished.
+func (rs *RunStore) Subscribe(id string, skip int) ([]RunEvent, chan RunEvent, bool) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	record, ok := rs.runs[id]
+	if !ok {
+		return nil, nil, false
+	}
+
+	skip = min(max(skip, 0), len(record.events))
+	history := append([]RunEvent(nil), record.events[skip:]...)
+	if record.subscribers == nil {
+		return history, nil, true
+	}
+
+	ch := make(chan RunEvent, subscriberBuffer)
+	record.subscribers[ch] = struct{}{}
+	return history, ch, true
+}
+
+func (rs *RunStore) Unsubscribe(id string, ch chan RunEvent) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if record, ok := rs.runs[id]; ok && record.subscribers != nil {
+		if _, ok := record.subscribers[ch]; ok {
+			delete(record.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (rs *RunStore) publish(id string, event RunEvent) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	record, ok := rs.runs[id]
+	if !ok {
+		return
+	}
+
+	event.seq = len(record.events) + 1
+	record.events = append(record.events, event)
+	for ch := range record.subscribers {
+		// Only publish sends on ch, so keeping its last slot free leaves
+		// room to tell a slow subscriber it was dropped
+		if len(ch) < cap(ch)-1 {
+			ch <- event
+			continue
+		}
+		ch <- RunEvent{Type: "dropped", Data: "too far behind, subscribe again to replay the run"}
+		delete(record.subscribers, ch)
+		close(ch)
+	}
+}
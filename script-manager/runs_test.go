@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRunStorePrune(t *testing.T) {
+	tests := []struct {
+		name      string
+		finished  int
+		running   int
+		wantKept  int
+		wantFirst string
+	}{
+		{"below the cap", 10, 0, 10, "run-0"},
+		{"at the cap", maxRuns, 0, maxRuns, "run-0"},
+		{"oldest finished runs forgotten", maxRuns + 5, 0, maxRuns, "run-5"},
+		{"running runs kept beyond the cap", 0, maxRuns + 5, maxRuns + 5, "run-0"},
+		{"finished runs make room for running ones", 10, maxRuns, maxRuns, "run-10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := NewRunStore()
+			for i := range tt.finished + tt.running {
+				id := fmt.Sprintf("run-%d", i)
+				rs.Create(id, "scripts/host/ok.sh", []string{"agent1"})
+				if i < tt.finished {
+					rs.Finish(id)
+				}
+			}
+
+			runs := rs.List()
+			if len(runs) != tt.wantKept {
+				t.Fatalf("kept %d runs, want %d", len(runs), tt.wantKept)
+			}
+			if oldest := runs[len(runs)-1].ID; oldest != tt.wantFirst {
+				t.Errorf("oldest run = %s, want %s", oldest, tt.wantFirst)
+			}
+			if _, ok := rs.Get(tt.wantFirst); !ok {
+				t.Errorf("Get(%s) found nothing", tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestRunStoreSubscribeSkip(t *testing.T) {
+	rs := NewRunStore()
+	rs.Create("run", "scripts/host/ok.sh", []string{"agent1"})
+	for i := range 3 {
+		rs.AppendOutput("run", "agent1", []byte(fmt.Sprint(i)))
+	}
+
+	tests := []struct {
+		skip      int
+		wantCount int
+		wantFirst int
+	}{
+		{0, 3, 1},
+		{-1, 3, 1},
+		{2, 1, 3},
+		{3, 0, 0},
+		{10, 0, 0},
+	}
+
+	for _, tt := range tests {
+		history, events, ok := rs.Subscribe("run", tt.skip)
+		if !ok || events == nil {
+			t.Fatalf("Subscribe(%d) = ok %v, events %v", tt.skip, ok, events)
+		}
+		rs.Unsubscribe("run", events)
+
+		if len(history) != tt.wantCount {
+			t.Errorf("Subscribe(%d) replayed %d events, want %d", tt.skip, len(history), tt.wantCount)
+			continue
+		}
+		if len(history) > 0 && history[0].seq != tt.wantFirst {
+			t.Errorf("Subscribe(%d) starts at event %d, want %d", tt.skip, history[0].seq, tt.wantFirst)
+		}
+	}
+
+	if _, _, ok := rs.Subscribe("missing", 0); ok {
+		t.Error("Subscribe of an unknown run reported ok")
+	}
+}
+
+// A subscriber that stops reading gets a final "dropped" event instead of
+// blocking the run, and can subscribe again to replay everything.
+func TestRunStoreDropsSlowSubscriber(t *testing.T) {
+	rs := NewRunStore()
+	rs.Create("run", "scripts/host/ok.sh", []string{"agent1"})
+	_, events, _ := rs.Subscribe("run", 0)
+
+	const published = subscriberBuffer + 10
+	for i := range published {
+		rs.AppendOutput("run", "agent1", []byte(fmt.Sprint(i)))
+	}
+
+	var received []RunEvent
+	for event := range events {
+		received = append(received, event)
+	}
+
+	if len(received) != subscriberBuffer {
+		t.Fatalf("received %d events, want %d", len(received), subscriberBuffer)
+	}
+	if last := received[len(received)-1]; last.Type != "dropped" {
+		t.Errorf("last event = %q, want dropped", last.Type)
+	}
+	for i, event := range received[:len(received)-1] {
+		if event.Type != "output" || event.seq != i+1 {
+			t.Fatalf("event %d = %s #%d, want output #%d", i, event.Type, event.seq, i+1)
+		}
+	}
+
+	history, events, _ := rs.Subscribe("run", 0)
+	if len(history) != published {
+		t.Errorf("resubscribe replayed %d events, want %d", len(history), published)
+	}
+
+	rs.Finish("run")
+	if _, ok := <-events; !ok {
+		t.Error("resubscribed channel closed before the done event")
+	}
+	if _, ok := <-events; ok {
+		t.Error("channel still open after Finish")
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	sbomCycloneDX = "cyclonedx"
+	sbomSPDX      = "spdx"
+)
+
+type sbomRequest struct {
+	Agents []string `json:"agents"`
+	Format string   `json:"format"`
+}
+
+// AgentSBOM is the result of "host-monitor sbom" on one agent. Status is
+// "ok" or "error".
+type AgentSBOM struct {
+	Agent    string         `json:"agent"`
+	Status   string         `json:"status"`
+	Hostname string         `json:"hostname,omitempty"`
+	Packages int            `json:"packages"`
+	Error    string         `json:"error,omitempty"`
+	Duration time.Duration  `json:"duration_ns"`
+	document map[string]any // the agent's SBOM, merged into the response
+}
+
+type SBOMResponse struct {
+	RunID  string         `json:"run_id"`
+	Format string         `json:"format"`
+	Failed int            `json:"failed"`
+	Agents []AgentSBOM    `json:"agents"`
+	SBOM   map[string]any `json:"sbom"`
+}
+
+// handleSBOMs runs "host-monitor sbom" on the agents, waits for all of them
+// and merges their SBOMs into one document with a part per agent. The run is
+// also kept in the run history.
+func (api *APIServer) handleSBOMs(w http.ResponseWriter, r *http.Request) {
+	req := sbomRequest{Format: sbomCycloneDX}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+	}
+	if req.Format == "" {
+		req.Format = sbomCycloneDX
+	}
+	if req.Format != sbomCycloneDX && req.Format != sbomSPDX {
+		writeError(w, http.StatusBadRequest, "format must be cyclonedx or spdx")
+		return
+	}
+
+	// The merge names each host after its agent, so an agent listed twice
+	// runs once
+	agents := make([]string, 0, len(req.Agents))
+	seen := make(map[string]bool)
+	for _, agent := range req.Agents {
+		if !seen[agent] {
+			seen[agent] = true
+			agents = append(agents, agent)
+		}
+	}
+	if len(agents) == 0 {
+		agents = api.sm.agents
+	}
+	for _, agent := range agents {
+		if api.sm.agentPort(agent) == 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown agent: %s", agent))
+			return
+		}
+	}
+
+	command := "host-monitor sbom --format " + req.Format
+
+	run := api.runs.Create(newRunID(), command, agents)
+	results := api.sm.RunOnAgents(run.ID, command, agents, func(agentName string, chunk []byte) {
+		api.runs.AppendOutput(run.ID, agentName, chunk)
+	})
+
+	response := SBOMResponse{RunID: run.ID, Format: req.Format, Agents: make([]AgentSBOM, 0, len(results))}
+	for _, result := range results {
+		api.runs.AddResult(run.ID, result)
+		sbom := parseAgentSBOM(result, req.Format)
+		if sbom.Status != "ok" {
+			response.Failed++
+		}
+		response.Agents = append(response.Agents, sbom)
+	}
+	api.runs.Finish(run.ID)
+
+	if req.Format == sbomSPDX {
+		response.SBOM = mergeSPDX(response.Agents)
+	} else {
+		response.SBOM = mergeCycloneDX(response.Agents)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// parseAgentSBOM reads the SBOM from the agent output. Agents add a
+// "Command error" line when host-monitor fails, e.g. without a supported
+// package manager.
+func parseAgentSBOM(result ScriptResult, format string) AgentSBOM {
+	sbom := AgentSBOM{Agent: result.AgentName, Status: "error", Duration: result.Duration}
+
+	start := strings.Index(result.Output, "{")
+	if !result.Success || start < 0 {
+		sbom.Error = lastLine(result.Output)
+		return sbom
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(result.Output[start:]))
+	decoder.UseNumber()
+	if err := decoder.Decode(&sbom.document); err != nil {
+		sbom.Error = fmt.Sprintf("invalid SBOM: %v", err)
+		return sbom
+	}
+
+	switch format {
+	case sbomCycloneDX:
+		if sbom.document["bomFormat"] != "CycloneDX" {
+			sbom.Error = "not a CycloneDX SBOM"
+			return sbom
+		}
+		metadata, _ := sbom.document["metadata"].(map[string]any)
+		if host, ok := metadata["component"].(map[string]any); ok {
+			sbom.Hostname, _ = host["name"].(string)
+		}
+		for _, component := range objects(sbom.document["components"]) {
+			if component["type"] == "library" {
+				sbom.Packages++
+			}
+		}
+	case sbomSPDX:
+		if _, ok := sbom.document["spdxVersion"].(string); !ok {
+			sbom.Error = "not an SPDX SBOM"
+			return sbom
+		}
+		// Only the host and its OS have a purpose
+		for _, pkg := range objects(sbom.document["packages"]) {
+			switch pkg["primaryPackagePurpose"] {
+			case "DEVICE":
+				sbom.Hostname, _ = pkg["name"].(string)
+			case nil:
+				sbom.Packages++
+			}
+		}
+	}
+
+	sbom.Status = "ok"
+	return sbom
+}
+
+// mergeCycloneDX nests each agent's BOM under a component for its host.
+// bom-refs must be unique in a BOM, so they get the agent name as prefix.
+func mergeCycloneDX(sboms []AgentSBOM) map[string]any {
+	hosts := make([]any, 0, len(sboms))
+	for _, sbom := range sboms {
+		if sbom.Status != "ok" {
+			continue
+		}
+		metadata, _ := sbom.document["metadata"].(map[string]any)
+		host, ok := metadata["component"].(map[string]any)
+		if !ok {
+			host = map[string]any{"type": "device", "name": firstNonEmpty(sbom.Hostname, sbom.Agent)}
+		}
+		properties := append([]any{map[string]any{"name": "script-manager:agent", "value": sbom.Agent}},
+			toSlice(metadata["properties"])...)
+
+		components := objects(sbom.document["components"])
+		for _, component := range components {
+			prefixBOMRefs(component, sbom.Agent+"/")
+		}
+		host["bom-ref"] = sbom.Agent
+		host["properties"] = properties
+		host["components"] = components
+		hosts = append(hosts, host)
+	}
+
+	return map[string]any{
+		"bomFormat":    "CycloneDX",
+		"specVersion":  "1.5",
+		"serialNumber": "urn:uuid:" + newUUID(),
+		"version":      1,
+		"metadata": map[string]any{
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+			"tools": map[string]any{
+				"components": []any{map[string]any{"type": "application", "name": "script-manager"}},
+			},
+		},
+		"components": hosts,
+	}
+}
+
+func prefixBOMRefs(component map[string]any, prefix string) {
+	if ref, ok := component["bom-ref"].(string); ok {
+		component["bom-ref"] = prefix + ref
+	}
+	for _, child := range objects(component["components"]) {
+		prefixBOMRefs(child, prefix)
+	}
+}
+
+// spdxIDChars matches what SPDX identifiers may not contain. It and newUUID
+// are copies of the ones in host-monitor/sbom.go, a separate module; change
+// both together.
+var spdxIDChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// mergeSPDX copies every agent's packages and relationships into one
+// document, renaming SPDXRef-X to SPDXRef-Agent<n>-<agent>-X. The number
+// keeps IDs apart when agent names differ only in characters SPDX IDs
+// cannot hold, e.g. web_1 and web-1. The merged document describes each
+// agent's host.
+func mergeSPDX(sboms []AgentSBOM) map[string]any {
+	packages := make([]any, 0)
+	relationships := make([]any, 0)
+	var names []string
+
+	for _, sbom := range sboms {
+		if sbom.Status != "ok" {
+			continue
+		}
+		names = append(names, sbom.Agent)
+		prefix := fmt.Sprintf("SPDXRef-Agent%d-%s-", len(names), spdxIDChars.ReplaceAllString(sbom.Agent, "-"))
+		rename := func(id any) any {
+			if s, ok := id.(string); ok && s != "SPDXRef-DOCUMENT" {
+				return prefix + strings.TrimPrefix(s, "SPDXRef-")
+			}
+			return id
+		}
+
+		for _, pkg := range objects(sbom.document["packages"]) {
+			pkg["SPDXID"] = rename(pkg["SPDXID"])
+			packages = append(packages, pkg)
+		}
+		for _, relationship := range objects(sbom.document["relationships"]) {
+			relationship["spdxElementId"] = rename(relationship["spdxElementId"])
+			relationship["relatedSpdxElement"] = rename(relationship["relatedSpdxElement"])
+			relationships = append(relationships, relationship)
+		}
+	}
+
+	return map[string]any{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              "script-manager-agents",
+		"documentNamespace": "https://spdx.org/spdxdocs/script-manager-agents-" + newUUID(),
+		"creationInfo": map[string]any{
+			"created":  time.Now().UTC().Format(time.RFC3339),
+			"creators": []string{"Tool: script-manager"},
+			"comment":  "Merged SBOMs of agents " + strings.Join(names, ", "),
+		},
+		"packages":      packages,
+		"relationships": relationships,
+	}
+}
+
+// objects returns the JSON objects in a decoded JSON array.
+func objects(value any) []map[string]any {
+	result := make([]map[string]any, 0)
+	for _, item := range toSlice(value) {
+		if object, ok := item.(map[string]any); ok {
+			result = append(result, object)
+		}
+	}
+	return result
+}
+
+func toSlice(value any) []any {
+	slice, _ := value.([]any)
+	return slice
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// newUUID returns a random (version 4) UUID. See spdxIDChars.
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// Trimmed "host-monitor sbom" output for a host with the OS and one package
+const (
+	cycloneDXOutput = `{
+  "bomFormat": "CycloneDX",
+  "specVersion": "1.5",
+  "metadata": {
+    "component": {"type": "device", "bom-ref": "host", "name": "web-01"},
+    "properties": [{"name": "host-monitor:package_manager", "value": "dpkg"}]
+  },
+  "components": [
+    {"type": "operating-system", "bom-ref": "os", "name": "ubuntu", "version": "22.04"},
+    {"type": "library", "bom-ref": "pkg:deb/ubuntu/openssl@3.0.2-0ubuntu1.18?arch=amd64", "name": "openssl",
+     "purl": "pkg:deb/ubuntu/openssl@3.0.2-0ubuntu1.18?arch=amd64"}
+  ]
+}
+`
+	spdxOutput = `{
+  "spdxVersion": "SPDX-2.3",
+  "SPDXID": "SPDXRef-DOCUMENT",
+  "packages": [
+    {"SPDXID": "SPDXRef-Host", "name": "web-01", "primaryPackagePurpose": "DEVICE"},
+    {"SPDXID": "SPDXRef-OperatingSystem", "name": "ubuntu", "primaryPackagePurpose": "OPERATING-SYSTEM"},
+    {"SPDXID": "SPDXRef-Package-1-openssl", "name": "openssl"}
+  ],
+  "relationships": [
+    {"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": "SPDXRef-Host"},
+    {"spdxElementId": "SPDXRef-Host", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-OperatingSystem"},
+    {"spdxElementId": "SPDXRef-OperatingSystem", "relationshipType": "CONTAINS", "relatedSpdxElement": "SPDXRef-Package-1-openssl"}
+  ]
+}
+`
+)
+
+func TestParseAgentSBOM(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   ScriptResult
+		format   string
+		status   string
+		hostname string
+		packages int
+		err      string
+	}{
+		{
+			name:   "cyclonedx",
+			result: ScriptResult{AgentName: "agent1", Success: true, Output: cycloneDXOutput},
+			format: sbomCycloneDX, status: "ok", hostname: "web-01", packages: 1,
+		},
+		{
+			name:   "spdx after leading noise",
+			result: ScriptResult{AgentName: "agent1", Success: true, Output: "⚠️  Not running as root\n" + spdxOutput},
+			format: sbomSPDX, status: "ok", hostname: "web-01", packages: 1,
+		},
+		{
+			name:   "no JSON",
+			result: ScriptResult{AgentName: "agent1", Success: true, Output: "host-monitor: command not found\n"},
+			format: sbomCycloneDX, status: "error", err: "host-monitor: command not found",
+		},
+		{
+			name: "failed run",
+			result: ScriptResult{AgentName: "agent1", Output: "❌ no supported package manager (dpkg, rpm, apk, pacman)\n" +
+				"Command error: exit status 1\n"},
+			format: sbomCycloneDX, status: "error", err: "❌ no supported package manager (dpkg, rpm, apk, pacman)",
+		},
+		{
+			name:   "truncated JSON",
+			result: ScriptResult{AgentName: "agent1", Success: true, Output: cycloneDXOutput[:40]},
+			format: sbomCycloneDX, status: "error", err: "invalid SBOM: unexpected EOF",
+		},
+		{
+			name:   "wrong format",
+			result: ScriptResult{AgentName: "agent1", Success: true, Output: spdxOutput},
+			format: sbomCycloneDX, status: "error", err: "not a CycloneDX SBOM",
+		},
+	}
+
+	for _, tt := range tests {
+		sbom := parseAgentSBOM(tt.result, tt.format)
+		if sbom.Status != tt.status || sbom.Hostname != tt.hostname || sbom.Packages != tt.packages || sbom.Error != tt.err {
+			t.Errorf("%s: parseAgentSBOM = status %q, hostname %q, %d packages, error %q; want %q, %q, %d, %q",
+				tt.name, sbom.Status, sbom.Hostname, sbom.Packages, sbom.Error, tt.status, tt.hostname, tt.packages, tt.err)
+		}
+	}
+}
+
+// agentSBOMs parses the same output for each agent, as from hosts with the
+// same package set.
+func agentSBOMs(t *testing.T, output, format string, agents ...string) []AgentSBOM {
+	t.Helper()
+	var sboms []AgentSBOM
+	for _, agent := range agents {
+		sbom := parseAgentSBOM(ScriptResult{AgentName: agent, Success: true, Output: output}, format)
+		if sbom.Status != "ok" {
+			t.Fatalf("%s: %s", agent, sbom.Error)
+		}
+		sboms = append(sboms, sbom)
+	}
+	return append(sboms, AgentSBOM{Agent: "agent3", Status: "error"})
+}
+
+// roundTrip encodes a merged document and decodes it again, as a client of
+// POST /sboms reads it.
+func roundTrip(t *testing.T, document map[string]any) map[string]any {
+	t.Helper()
+	data, err := json.Marshal(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestMergeCycloneDX(t *testing.T) {
+	merged := roundTrip(t, mergeCycloneDX(agentSBOMs(t, cycloneDXOutput, sbomCycloneDX, "agent1", "agent2")))
+
+	refs := make(map[string]bool)
+	var walk func(components []map[string]any)
+	walk = func(components []map[string]any) {
+		for _, component := range components {
+			ref, _ := component["bom-ref"].(string)
+			if ref == "" || refs[ref] {
+				t.Errorf("bom-ref %q is missing or not unique", ref)
+			}
+			refs[ref] = true
+			walk(objects(component["components"]))
+		}
+	}
+	hosts := objects(merged["components"])
+	walk(hosts)
+
+	if len(hosts) != 2 {
+		t.Fatalf("merged %d hosts, want 2 (the failed agent is left out)", len(hosts))
+	}
+	for _, want := range []string{"agent1", "agent1/os", "agent2/pkg:deb/ubuntu/openssl@3.0.2-0ubuntu1.18?arch=amd64"} {
+		if !refs[want] {
+			t.Errorf("no bom-ref %s in %v", want, refs)
+		}
+	}
+	if properties := objects(hosts[1]["properties"]); len(properties) == 0 || properties[0]["value"] != "agent2" {
+		t.Errorf("second host properties = %v, want the agent first", properties)
+	}
+	if !strings.HasPrefix(merged["serialNumber"].(string), "urn:uuid:") {
+		t.Errorf("serialNumber = %v", merged["serialNumber"])
+	}
+}
+
+func TestMergeSPDX(t *testing.T) {
+	// web_1 and web-1 only differ in a character SPDX IDs cannot hold
+	merged := roundTrip(t, mergeSPDX(agentSBOMs(t, spdxOutput, sbomSPDX, "web_1", "web-1")))
+
+	ids := make(map[string]bool)
+	for _, pkg := range objects(merged["packages"]) {
+		id, _ := pkg["SPDXID"].(string)
+		if ids[id] {
+			t.Errorf("duplicate SPDXID %s", id)
+		}
+		ids[id] = true
+	}
+	if len(ids) != 6 {
+		t.Errorf("merged %d packages, want 6", len(ids))
+	}
+	for _, want := range []string{"SPDXRef-Agent1-web-1-Host", "SPDXRef-Agent2-web-1-Package-1-openssl"} {
+		if !ids[want] {
+			t.Errorf("no package %s in %v", want, ids)
+		}
+	}
+
+	relationships := objects(merged["relationships"])
+	if len(relationships) != 6 {
+		t.Errorf("merged %d relationships, want 6", len(relationships))
+	}
+	describes := 0
+	for _, relationship := range relationships {
+		element, _ := relationship["spdxElementId"].(string)
+		related, _ := relationship["relatedSpdxElement"].(string)
+		if element == "SPDXRef-DOCUMENT" {
+			describes++
+		} else if !ids[element] {
+			t.Errorf("relationship from unknown element %s", element)
+		}
+		if !ids[related] {
+			t.Errorf("relationship to unknown element %s", related)
+		}
+	}
+	if describes != 2 {
+		t.Errorf("document describes %d hosts, want 2", describes)
+	}
+}
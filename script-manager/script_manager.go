@@ -2,30 +2,63 @@ package main
 
 import (
 	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
+// runIDHeader carries the run ID to the agent. It is a bash comment, so older
+// agents simply ignore it.
+const runIDHeader = "# bash-king-run-id: "
+
+// maxAttempts is how many times a run is sent to an agent before giving up.
+// Retries reuse the run ID, so the agent never executes the same run twice.
+const maxAttempts = 3
+
+// ScriptResult is the outcome of a run on one agent. ExitCode is set when
+// the script ran and failed, -1 when it could not be started; only the gRPC
+// transport reports it.
 type ScriptResult struct {
-	AgentName string
-	Output    string
-	Success   bool
-	Duration  time.Duration
+	AgentName string        `json:"agent"`
+	RunID     string        `json:"run_id"`
+	Output    string        `json:"output"`
+	Success   bool          `json:"success"`
+	ExitCode  int           `json:"exit_code,omitempty"`
+	Duration  time.Duration `json:"duration_ns"`
+	Attempts  int           `json:"attempts"`
 }
 
+// OutputFunc receives script output from an agent as it arrives.
+type OutputFunc func(agentName string, chunk []byte)
+
 type ScriptManager struct {
-	agents []string
-	ports  []int
+	agents    []string
+	ports     []int
+	transport string // "tcp" or "grpc"
+
+	protoMu   sync.Mutex
+	protocols map[string]AgentProtocol
+
+	grpcMu      sync.Mutex
+	grpcClients map[string]*AgentClient
 }
 
 func NewScriptManager() *ScriptManager {
 	return &ScriptManager{
-		agents: []string{"agent1", "agent2", "agent3"},
-		ports:  []int{9001, 9002, 9003},
+		agents:    []string{"agent1", "agent2", "agent3"},
+		ports:     []int{9001, 9002, 9003},
+		transport: "tcp",
+		protocols: make(map[string]AgentProtocol),
+
+		grpcClients: make(map[string]*AgentClient),
 	}
 }
 
@@ -42,16 +75,28 @@ func (sm *ScriptManager) ExecuteScript(scriptPath string) []ScriptResult {
 		return results
 	}
 
+	runID := newRunID()
+	fmt.Printf("🆔 Run ID: %s\n", runID)
+
+	return sm.RunOnAgents(runID, string(scriptContent), sm.agents, nil)
+}
+
+// RunOnAgents sends the script to the named agents concurrently and waits
+// for all of them to finish. onOutput, if not nil, is called with output
+// chunks as they are received.
+func (sm *ScriptManager) RunOnAgents(runID string, script string, agents []string, onOutput OutputFunc) []ScriptResult {
+	results := make([]ScriptResult, 0, len(agents))
+
 	// Tüm agent'lara script içeriğini gönder
-	resultChan := make(chan ScriptResult, len(sm.agents))
-	for i, agent := range sm.agents {
-		go func(agentName string, port int, script string) {
-			result := sm.executeOnAgent(agentName, port, script)
+	resultChan := make(chan ScriptResult, len(agents))
+	for _, agent := range agents {
+		go func(agentName string, port int) {
+			result := sm.executeWithRetry(agentName, port, runID, script, onOutput)
 			resultChan <- result
-		}(agent, sm.ports[i], string(scriptContent))
+		}(agent, sm.agentPort(agent))
 	}
 
-	for i := 0; i < len(sm.agents); i++ {
+	for i := 0; i < len(agents); i++ {
 		result := <-resultChan
 		results = append(results, result)
 	}
@@ -59,7 +104,120 @@ func (sm *ScriptManager) ExecuteScript(scriptPath string) []ScriptResult {
 	return results
 }
 
-func (sm *ScriptManager) executeOnAgent(agentName string, port int, script string) ScriptResult {
+// agentPort returns the TCP port of the named agent, or 0 if it is unknown.
+func (sm *ScriptManager) agentPort(agentName string) int {
+	for i, agent := range sm.agents {
+		if agent == agentName {
+			return sm.ports[i]
+		}
+	}
+	return 0
+}
+
+// newRunID returns a random identifier for a single script run.
+func newRunID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// executeWithRetry sends the run to an agent, retrying on network errors.
+// Every attempt carries the same run ID, so an agent that already executed
+// the script returns its cached result instead of running it again. Agents
+// without run ID support are never retried, since a retry could run the
+// script twice. The handshake is repeated on every attempt, so a retry
+// after a failure uses what the agent speaks now.
+func (sm *ScriptManager) executeWithRetry(agentName string, port int, runID string, script string, onOutput OutputFunc) ScriptResult {
+	start := time.Now()
+
+	output := &retryOutput{onOutput: onOutput}
+	attempts := maxAttempts
+	var result ScriptResult
+	for attempt := 1; attempt <= attempts; attempt++ {
+		protocol, err := sm.agentProtocol(agentName, port)
+		if err != nil {
+			result = ScriptResult{
+				AgentName: agentName,
+				Output:    fmt.Sprintf("❌ Handshake failed: %v", err),
+				Success:   false,
+			}
+		} else if err := sm.checkProtocol(protocol, script); err != nil {
+			return ScriptResult{
+				AgentName: agentName,
+				RunID:     runID,
+				Output:    fmt.Sprintf("❌ Refused: %v", err),
+				Success:   false,
+				Duration:  time.Since(start),
+				Attempts:  attempt,
+			}
+		} else {
+			if !protocol.Has("run-id") {
+				attempts = attempt
+			}
+			output.seen = 0
+			result = sm.executeOnProtocol(agentName, port, protocol, runID, script, output.write)
+		}
+		result.Attempts = attempt
+		// A script that ran and failed is not retried: the agent would
+		// only return its cached failure
+		if result.Success || result.ExitCode != 0 {
+			break
+		}
+
+		sm.forgetProtocol(agentName)
+		if attempt < attempts {
+			fmt.Printf("[DEBUG] Attempt %d on %s failed, retrying run %s\n", attempt, agentName, runID)
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	}
+
+	result.RunID = runID
+	result.Duration = time.Since(start)
+	return result
+}
+
+// executeOnProtocol runs the script once over the transport the agent's
+// protocol calls for.
+func (sm *ScriptManager) executeOnProtocol(agentName string, port int, protocol AgentProtocol, runID, script string, onOutput OutputFunc) ScriptResult {
+	switch {
+	case sm.transport == "grpc":
+		return sm.executeOnAgentGRPC(agentName, protocol.GRPCPort, runID, script, onOutput)
+	case protocol.Version == protocolLine:
+		return sm.executeOnLineAgent(agentName, port, script)
+	case protocol.Has("run-id"):
+		return sm.executeOnAgent(agentName, port, runIDHeader+runID+"\n"+script, onOutput)
+	default:
+		return sm.executeOnAgent(agentName, port, script, onOutput)
+	}
+}
+
+// retryOutput passes output on across the attempts of one run. A retry
+// replays the agent's cached output from the start, so only the bytes past
+// what earlier attempts delivered are passed on.
+type retryOutput struct {
+	onOutput  OutputFunc
+	delivered int // bytes passed on by all attempts
+	seen      int // bytes received in the current attempt
+}
+
+func (o *retryOutput) write(agentName string, chunk []byte) {
+	skip := o.delivered - o.seen
+	o.seen += len(chunk)
+	if skip >= len(chunk) {
+		return
+	}
+	if skip > 0 {
+		chunk = chunk[skip:]
+	}
+	o.delivered += len(chunk)
+	if o.onOutput != nil {
+		o.onOutput(agentName, chunk)
+	}
+}
+
+func (sm *ScriptManager) executeOnAgent(agentName string, port int, script string, onOutput OutputFunc) ScriptResult {
 	start := time.Now()
 
 	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
@@ -90,20 +248,33 @@ func (sm *ScriptManager) executeOnAgent(agentName string, port int, script strin
 		tcpConn.CloseWrite()
 	}
 
-	// Read response
-	output, err := io.ReadAll(conn)
-	if err != nil {
-		return ScriptResult{
-			AgentName: agentName,
-			Output:    fmt.Sprintf("❌ Failed to read response: %v", err),
-			Success:   false,
-			Duration:  time.Since(start),
+	// Read response, passing it on as it streams in
+	var output strings.Builder
+	buffer := make([]byte, 4096)
+	for {
+		n, err := conn.Read(buffer)
+		if n > 0 {
+			output.Write(buffer[:n])
+			if onOutput != nil {
+				onOutput(agentName, buffer[:n])
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ScriptResult{
+				AgentName: agentName,
+				Output:    fmt.Sprintf("❌ Failed to read response: %v", err),
+				Success:   false,
+				Duration:  time.Since(start),
+			}
 		}
 	}
 
 	return ScriptResult{
 		AgentName: agentName,
-		Output:    string(output),
+		Output:    output.String(),
 		Success:   true,
 		Duration:  time.Since(start),
 	}
@@ -122,6 +293,9 @@ func (sm *ScriptManager) PrintResults(results []ScriptResult) {
 		} else {
 			fmt.Printf("❌ Failed (Duration: %v)\n", result.Duration)
 		}
+		if result.Attempts > 1 {
+			fmt.Printf("🔁 Attempts: %d (run %s)\n", result.Attempts, result.RunID)
+		}
 
 		fmt.Printf("📄 Output:\n%s\n", result.Output)
 	}
@@ -144,6 +318,15 @@ func (sm *ScriptManager) PrintResults(results []ScriptResult) {
 }
 
 func main() {
+	listen := flag.String("listen", "", "serve the HTTP API on this address (e.g. :8080) instead of the prompt")
+	transport := flag.String("transport", "tcp", "agent transport: tcp (legacy protocol) or grpc")
+	flag.Parse()
+
+	if *transport != "tcp" && *transport != "grpc" {
+		fmt.Printf("❌ Unknown transport: %s\n", *transport)
+		return
+	}
+
 	// Change to parent directory to access scripts folder
 	if err := os.Chdir(".."); err != nil {
 		fmt.Printf("❌ Error changing directory: %v\n", err)
@@ -151,6 +334,15 @@ func main() {
 	}
 
 	sm := NewScriptManager()
+	sm.transport = *transport
+
+	if *listen != "" {
+		fmt.Printf("🌐 Script Manager API listening on %s\n", *listen)
+		if err := http.ListenAndServe(*listen, NewAPIServer(sm).Handler()); err != nil {
+			fmt.Printf("❌ API server error: %v\n", err)
+		}
+		return
+	}
 
 	fmt.Println("🎯 Advanced Script Manager")
 	fmt.Println("Available scripts:")
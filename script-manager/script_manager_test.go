@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+// A retry replays the cached output from the start; subscribers must only
+// see each byte once.
+func TestRetryOutputSkipsReplayedPrefix(t *testing.T) {
+	var got string
+	output := &retryOutput{onOutput: func(agentName string, chunk []byte) {
+		got += string(chunk)
+	}}
+
+	attempts := [][]string{
+		{"hel", "lo "},           // cut off after 6 bytes
+		{"hello", " wor"},        // replay overlaps the first attempt
+		{"he", "llo world", "!"}, // full replay
+	}
+	for _, chunks := range attempts {
+		output.seen = 0
+		for _, chunk := range chunks {
+			output.write("agent1", []byte(chunk))
+		}
+	}
+
+	if got != "hello world!" {
+		t.Errorf("output = %q, want %q", got, "hello world!")
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed web
+var webFiles embed.FS
+
+// dashboardHandler serves the embedded web dashboard.
+func dashboardHandler() http.Handler {
+	root, _ := fs.Sub(webFiles, "web")
+	return http.FileServer(http.FS(root))
+}
@@ -0,0 +1,191 @@
+// Dashboard for the script manager HTTP API.
+
+let currentEvents = null;
+
+async function getJSON(url, options) {
+  const response = await fetch(url, options);
+  const body = await response.json();
+  if (!response.ok) {
+    throw new Error(body.error || response.statusText);
+  }
+  return body;
+}
+
+function el(tag, text, className) {
+  const node = document.createElement(tag);
+  if (text !== undefined) node.textContent = text;
+  if (className) node.className = className;
+  return node;
+}
+
+async function loadAgents() {
+  const agents = await getJSON("/agents");
+  const rows = document.getElementById("agents");
+  const targets = document.getElementById("targets");
+  const checked = new Set(
+    [...targets.querySelectorAll("input:checked")].map((input) => input.value)
+  );
+  const firstLoad = targets.children.length === 0;
+
+  rows.replaceChildren();
+  targets.replaceChildren();
+  for (const agent of agents) {
+    const row = el("tr");
+    row.append(el("td", agent.name), el("td", agent.address));
+    row.append(
+      el("td", agent.reachable ? "● up" : "● down", "status " + (agent.reachable ? "up" : "down"))
+    );
+    row.append(el("td", agent.reachable ? agent.latency_ms + " ms" : agent.error || "-"));
+    row.append(el("td", agent.protocol ? describeProtocol(agent.protocol) : "-"));
+    rows.append(row);
+
+    const label = el("label");
+    const input = el("input");
+    input.type = "checkbox";
+    input.value = agent.name;
+    input.checked = firstLoad ? agent.reachable : checked.has(agent.name);
+    label.append(input, " " + agent.name);
+    targets.append(label);
+  }
+}
+
+function describeProtocol(protocol) {
+  const features = protocol.features && protocol.features.length ? " (" + protocol.features.join(", ") + ")" : "";
+  return "v" + protocol.version + features;
+}
+
+async function loadScripts() {
+  const scripts = await getJSON("/scripts");
+  const select = document.getElementById("script");
+  select.replaceChildren();
+
+  const groups = {};
+  for (const script of scripts) {
+    if (!groups[script.category]) {
+      groups[script.category] = el("optgroup");
+      groups[script.category].label = script.category;
+      select.append(groups[script.category]);
+    }
+    const option = el("option", script.name);
+    option.value = script.path;
+    groups[script.category].append(option);
+  }
+}
+
+async function loadHistory() {
+  const params = new URLSearchParams();
+  const query = document.getElementById("query").value.trim();
+  const status = document.getElementById("status-filter").value;
+  if (query) params.set("q", query);
+  if (status) params.set("status", status);
+
+  const runs = await getJSON("/runs?" + params.toString());
+  const rows = document.getElementById("history");
+  rows.replaceChildren();
+  for (const run of runs) {
+    const row = el("tr", undefined, "clickable");
+    row.append(
+      el("td", new Date(run.started_at).toLocaleString()),
+      el("td", run.id.slice(0, 8)),
+      el("td", run.script),
+      el("td", run.agents.join(", ")),
+      el("td", run.status, "status " + run.status)
+    );
+    row.addEventListener("click", () => watchRun(run));
+    rows.append(row);
+  }
+}
+
+// watchRun shows one output pane per agent and streams the run's events
+// into them. Finished runs are replayed from the server's event history.
+// When the connection drops, EventSource reconnects with the ID of the last
+// event it received and the server resumes after it, so nothing is shown
+// twice.
+function watchRun(run) {
+  if (currentEvents) {
+    currentEvents.close();
+  }
+
+  document.getElementById("output-run").textContent = run.id + " · " + run.script;
+  const outputs = document.getElementById("outputs");
+  outputs.replaceChildren();
+
+  const panes = {};
+  for (const agent of run.agents) {
+    const pane = el("div", undefined, "agent-output");
+    const title = el("h3", agent);
+    const pre = el("pre");
+    pane.append(title, pre);
+    outputs.append(pane);
+    panes[agent] = { title, pre };
+  }
+
+  const events = new EventSource("/runs/" + run.id + "/events");
+  currentEvents = events;
+
+  events.addEventListener("output", (message) => {
+    const event = JSON.parse(message.data);
+    const pane = panes[event.agent];
+    if (!pane) return;
+    const atBottom = pane.pre.scrollTop + pane.pre.clientHeight >= pane.pre.scrollHeight - 4;
+    pane.pre.textContent += event.data;
+    if (atBottom) pane.pre.scrollTop = pane.pre.scrollHeight;
+  });
+
+  events.addEventListener("result", (message) => {
+    const event = JSON.parse(message.data);
+    const pane = panes[event.agent];
+    if (!pane) return;
+    const ok = event.result.success;
+    const seconds = (event.result.duration_ns / 1e9).toFixed(2);
+    pane.title.textContent = event.agent + (ok ? " ✅ " : " ❌ ") + seconds + "s";
+  });
+
+  events.addEventListener("done", () => {
+    events.close();
+    loadHistory();
+  });
+
+  // The server dropped this stream for falling behind; start over from the
+  // run's history
+  events.addEventListener("dropped", () => {
+    events.close();
+    watchRun(run);
+  });
+}
+
+async function launch(submitEvent) {
+  submitEvent.preventDefault();
+  const script = document.getElementById("script").value;
+  const agents = [...document.querySelectorAll("#targets input:checked")].map(
+    (input) => input.value
+  );
+  if (agents.length === 0) {
+    alert("Select at least one agent");
+    return;
+  }
+
+  try {
+    const run = await getJSON("/runs", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ script, agents }),
+    });
+    watchRun(run);
+    loadHistory();
+  } catch (err) {
+    alert("Failed to start run: " + err.message);
+  }
+}
+
+document.getElementById("launcher").addEventListener("submit", launch);
+document.getElementById("search").addEventListener("submit", (event) => {
+  event.preventDefault();
+  loadHistory();
+});
+document.getElementById("refresh-agents").addEventListener("click", loadAgents);
+
+loadAgents();
+loadScripts();
+loadHistory();
+setInterval(loadAgents, 15000);
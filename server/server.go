@@ -44,7 +44,7 @@ func (s *Server) sendCommandToAgent(agentName, port, command string) AgentResult
 	conn.SetDeadline(time.Now().Add(5 * time.Second))
 
 	// Send command
-	fmt.Fprintf(conn, command+"\n")
+	fmt.Fprint(conn, command+"\n")
 
 	// Read response
 	scanner := bufio.NewScanner(conn)